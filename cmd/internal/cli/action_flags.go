@@ -20,6 +20,7 @@ var (
 	AppName          string
 	BindPaths        []string
 	Mounts           []string
+	Devices          []string
 	HomePath         string
 	OverlayPath      []string
 	ScratchPath      []string
@@ -29,6 +30,7 @@ var (
 	Hostname         string
 	Network          string
 	NetworkArgs      []string
+	Publish          []string
 	DNS              string
 	Security         []string
 	CgroupsTOMLFile  string
@@ -119,12 +121,24 @@ var actionMountFlag = cmdline.Flag{
 	Value:        &Mounts,
 	DefaultValue: cmdline.StringArray{},
 	Name:         "mount",
-	Usage:        "a mount specification e.g. 'type=bind,source=/opt,destination=/hostopt'.",
+	Usage:        "a mount specification e.g. 'type=bind,source=/opt,destination=/hostopt', supported types are bind, image, tmpfs and overlay.",
 	EnvKeys:      []string{"MOUNT"},
 	Tag:          "<spec>",
 	EnvHandler:   cmdline.EnvAppendValue,
 }
 
+// --device
+var actionDeviceFlag = cmdline.Flag{
+	ID:           "actionDeviceFlag",
+	Value:        &Devices,
+	DefaultValue: cmdline.StringArray{},
+	Name:         "device",
+	Usage:        "fully qualified name of a CDI device to add to the container e.g. 'vendor.com/class=name', devices are described by CDI specification files in /etc/cdi and /var/run/cdi.",
+	EnvKeys:      []string{"DEVICE"},
+	Tag:          "<name>",
+	EnvHandler:   cmdline.EnvAppendValue,
+}
+
 // -H|--home
 var actionHomeFlag = cmdline.Flag{
 	ID:           "actionHomeFlag",
@@ -223,7 +237,7 @@ var actionNetworkFlag = cmdline.Flag{
 	Value:        &Network,
 	DefaultValue: "bridge",
 	Name:         "network",
-	Usage:        "specify desired network type separated by commas, each network will bring up a dedicated interface inside container",
+	Usage:        "specify desired network type separated by commas, each network will bring up a dedicated interface inside container, slirp provides user-mode networking without privileges",
 	EnvKeys:      []string{"NETWORK"},
 	Tag:          "<name>",
 }
@@ -234,11 +248,22 @@ var actionNetworkArgsFlag = cmdline.Flag{
 	Value:        &NetworkArgs,
 	DefaultValue: []string{},
 	Name:         "network-args",
-	Usage:        "specify network arguments to pass to CNI plugins",
+	Usage:        "specify network arguments to pass to CNI plugins or to the slirp network",
 	EnvKeys:      []string{"NETWORK_ARGS"},
 	Tag:          "<args>",
 }
 
+// --publish
+var actionPublishFlag = cmdline.Flag{
+	ID:           "actionPublishFlag",
+	Value:        &Publish,
+	DefaultValue: []string{},
+	Name:         "publish",
+	Usage:        "publish a host port to the container with the form hostPort[:containerPort]/protocol (implies --net)",
+	EnvKeys:      []string{"PUBLISH"},
+	Tag:          "<port>",
+}
+
 // --dns
 var actionDNSFlag = cmdline.Flag{
 	ID:           "actionDnsFlag",
@@ -840,9 +865,11 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionIpcNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionKeepPrivsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionMountFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionDeviceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetNamespaceFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetworkArgsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNetworkFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionPublishFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoHomeFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoMountFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionNoInitFlag, actionsInstanceCmd...)
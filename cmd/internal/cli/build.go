@@ -46,6 +46,10 @@ var buildArgs struct {
 	nvccli        bool
 	rocm          bool
 	writableTmpfs bool // For test section only
+	arch          []string
+	splitArch     bool
+	compression   string
+	compLevel     int
 }
 
 // -s|--sandbox
@@ -227,10 +231,53 @@ var buildWritableTmpfsFlag = cmdline.Flag{
 	EnvKeys:      []string{"WRITABLE_TMPFS"},
 }
 
+// --arch
+var buildArchFlag = cmdline.Flag{
+	ID:           "buildArchFlag",
+	Value:        &buildArgs.arch,
+	DefaultValue: []string{},
+	Name:         "arch",
+	Usage:        "architecture(s) of the container to build, multiple architectures are built in a single SIF image unless --split-arch is used",
+	EnvKeys:      []string{"BUILD_ARCH"},
+}
+
+// --split-arch
+var buildSplitArchFlag = cmdline.Flag{
+	ID:           "buildSplitArchFlag",
+	Value:        &buildArgs.splitArch,
+	DefaultValue: false,
+	Name:         "split-arch",
+	Usage:        "build one image per architecture, named after the target with the architecture appended",
+	EnvKeys:      []string{"SPLIT_ARCH"},
+}
+
+// --compression
+var buildCompressionFlag = cmdline.Flag{
+	ID:           "buildCompressionFlag",
+	Value:        &buildArgs.compression,
+	DefaultValue: "",
+	Name:         "compression",
+	Usage:        "squashfs compression algorithm of SIF images (gzip|lz4|lzo|xz|zstd), defaults to the mksquashfs compression configuration directive",
+	EnvKeys:      []string{"BUILD_COMPRESSION"},
+}
+
+// --compression-level
+var buildCompressionLevelFlag = cmdline.Flag{
+	ID:           "buildCompressionLevelFlag",
+	Value:        &buildArgs.compLevel,
+	DefaultValue: 0,
+	Name:         "compression-level",
+	Usage:        "squashfs compression level of SIF images (1-9 for gzip and lzo, 1-22 for zstd), 0 selects the default level",
+	EnvKeys:      []string{"BUILD_COMPRESSION_LEVEL"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(buildCmd)
 
+		cmdManager.RegisterFlagForCmd(&buildArchFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildCompressionFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildCompressionLevelFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildDisableCacheFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildEncryptFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildFakerootFlag, buildCmd)
@@ -241,6 +288,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildNoTestFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildSandboxFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildSectionFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildSplitArchFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildUpdateFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonForceFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, buildCmd)
@@ -259,6 +307,19 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildBindFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildMountFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildWritableTmpfsFlag, buildCmd)
+
+		cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionBlkioWeightFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionBlkioWeightDeviceFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUSharesFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUsetCPUsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUsetMemsFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionMemoryFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionMemoryReservationFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionMemorySwapFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionOomKillDisableFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&actionPidsLimitFlag, buildCmd)
 	})
 }
 
@@ -279,6 +340,7 @@ var buildCmd = &cobra.Command{
 func preRun(cmd *cobra.Command, args []string) {
 	spec := args[len(args)-1]
 	isDeffile := fs.IsFile(spec) && !isImage(spec)
+	buildCgroupsExec()
 	if buildArgs.fakeroot {
 		fakerootExec(isDeffile)
 	} else {
@@ -13,13 +13,19 @@ package cli
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	osExec "os/exec"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/apptainer/apptainer/internal/pkg/build"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	fakerootConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/fakeroot/config"
@@ -32,11 +38,121 @@ import (
 	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
 	"github.com/apptainer/apptainer/pkg/util/cryptkey"
 	keyClient "github.com/apptainer/container-key-client/client"
 	"github.com/spf13/cobra"
 )
 
+// buildCgroupsEnv holds the file descriptor a build process executed by
+// buildCgroupsExec waits on, and is then set to buildCgroupsApplied so the
+// fakeroot build executed from there doesn't apply the limits again.
+const (
+	buildCgroupsEnv     = "_APPTAINER_BUILD_CGROUPS"
+	buildCgroupsApplied = "applied"
+)
+
+// buildCgroupsExec applies the build resource limits by executing the build
+// again in a child process placed in the build cgroup. The child waits until
+// it was added to the cgroup before doing anything, so every process of the
+// build inherits the limits, and the cgroup is removed once the child exited.
+func buildCgroupsExec() {
+	switch v := os.Getenv(buildCgroupsEnv); v {
+	case "":
+	case buildCgroupsApplied:
+		return
+	default:
+		if err := waitBuildCgroups(v); err != nil {
+			sylog.Fatalf("Build resource limits were not applied: %s", err)
+		}
+		return
+	}
+
+	cgJSON, err := getCgroupsJSON()
+	if err != nil {
+		sylog.Fatalf("While parsing cgroups configuration: %s", err)
+	}
+	if cgJSON == "" {
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		sylog.Fatalf("While creating build synchronization pipe: %s", err)
+	}
+
+	cmd := osExec.Command("/proc/self/exe", os.Args[1:]...)
+	cmd.Args[0] = os.Args[0]
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{r}
+	cmd.Env = append(os.Environ(), buildCgroupsEnv+"=3")
+	if err := cmd.Start(); err != nil {
+		sylog.Fatalf("While executing build: %s", err)
+	}
+	r.Close()
+
+	systemd := apptainerconf.GetCurrentConfig().SystemdCgroups
+	manager, err := cgroups.NewManagerWithJSON(cgJSON, cmd.Process.Pid, "", systemd)
+	if err != nil {
+		w.Close()
+		_ = cmd.Wait()
+		sylog.Fatalf("While applying build resource limits: %s", err)
+	}
+	if _, err := w.Write([]byte{'1'}); err != nil {
+		_ = cmd.Process.Kill()
+	}
+	w.Close()
+
+	// forward termination signals to the build, interrupts from the
+	// terminal are already received by the whole process group
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range sigCh {
+			if sig != syscall.SIGINT {
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	status := 0
+	if err := cmd.Wait(); err != nil {
+		status = 255
+		if exitErr, ok := err.(*osExec.ExitError); ok {
+			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				if ws.Signaled() {
+					status = 128 + int(ws.Signal())
+				} else {
+					status = ws.ExitStatus()
+				}
+			}
+		}
+	}
+	if err := manager.Destroy(); err != nil {
+		sylog.Warningf("Could not remove build cgroup: %s", err)
+	}
+	os.Exit(status)
+}
+
+// waitBuildCgroups blocks until the parent process placed the current
+// process in the build cgroup.
+func waitBuildCgroups(fdStr string) error {
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return fmt.Errorf("bad build synchronization file descriptor %q", fdStr)
+	}
+	f := os.NewFile(uintptr(fd), "build-cgroups")
+	defer f.Close()
+
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return fmt.Errorf("while waiting on build synchronization pipe: %s", err)
+	}
+	return os.Setenv(buildCgroupsEnv, buildCgroupsApplied)
+}
+
 func fakerootExec(isDeffile bool) {
 	useSuid := starter.IsSuidInstall()
 
@@ -181,13 +297,36 @@ func runBuild(cmd *cobra.Command, args []string) {
 		os.Setenv("APPTAINER_WRITABLE_TMPFS", "1")
 	}
 
-	// check if target collides with existing file
-	if err := checkBuildTarget(dest); err != nil {
-		sylog.Fatalf("While checking build target: %s", err)
+	if len(buildArgs.arch) > 1 && buildArgs.sandbox && !buildArgs.splitArch {
+		sylog.Fatalf("Building a sandbox for multiple architectures requires --split-arch")
+	}
+
+	dests := []string{dest}
+	if len(buildArgs.arch) > 1 && buildArgs.splitArch {
+		dests = dests[:0]
+		for _, arch := range buildArgs.arch {
+			dests = append(dests, archDest(dest, arch))
+		}
+	}
+
+	// check if targets collide with existing files
+	for _, d := range dests {
+		if err := checkBuildTarget(d); err != nil {
+			sylog.Fatalf("While checking build target: %s", err)
+		}
 	}
 
 	runBuildLocal(cmd.Context(), cmd, dest, spec, fakerootPath)
-	sylog.Infof("Build complete: %s", dest)
+	sylog.Infof("Build complete: %s", strings.Join(dests, ", "))
+}
+
+// archDest returns the build target of the architecture arch when
+// building one image per architecture, the architecture is inserted
+// before the target extension.
+func archDest(dest, arch string) string {
+	dest = filepath.Clean(dest)
+	ext := filepath.Ext(dest)
+	return strings.TrimSuffix(dest, ext) + "_" + arch + ext
 }
 
 func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fakerootPath string) {
@@ -196,6 +335,9 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 		if os.Getuid() != 0 {
 			sylog.Fatalf("You must be root to build an encrypted container")
 		}
+		if len(buildArgs.arch) > 1 && !buildArgs.splitArch {
+			sylog.Fatalf("Building an encrypted container for multiple architectures requires --split-arch")
+		}
 
 		k, err := getEncryptionMaterial(cmd)
 		if err != nil {
@@ -226,10 +368,7 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 	}
 
 	// parse definition to determine build source
-	defs, err := build.MakeAllDefs(spec)
-	if err != nil {
-		sylog.Fatalf("Unable to build from %s: %v", spec, err)
-	}
+	defs := parseDefs(spec)
 
 	authToken := ""
 	hasLibrary := false
@@ -285,30 +424,82 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string, fa
 
 	}
 
+	opts := types.Options{
+		ImgCache:          imgCache,
+		TmpDir:            tmpDir,
+		NoCache:           disableCache,
+		Update:            buildArgs.update,
+		Force:             forceOverwrite,
+		Sections:          buildArgs.sections,
+		NoTest:            buildArgs.noTest,
+		NoHTTPS:           noHTTPS,
+		LibraryURL:        buildArgs.libraryURL,
+		LibraryAuthToken:  authToken,
+		FakerootPath:      fakerootPath,
+		KeyServerOpts:     ko,
+		DockerAuthConfig:  authConf,
+		EncryptionKeyInfo: keyInfo,
+		FixPerms:          buildArgs.fixPerms,
+		SandboxTarget:     sandboxTarget,
+		Compression:       buildArgs.compression,
+		CompressionLevel:  buildArgs.compLevel,
+	}
+
+	switch {
+	case len(buildArgs.arch) <= 1:
+		if len(buildArgs.arch) == 1 {
+			opts.Arch = buildArgs.arch[0]
+		}
+		runBuildArch(ctx, defs, dst, buildFormat, opts)
+	case buildArgs.splitArch:
+		for _, arch := range buildArgs.arch {
+			sylog.Infof("Building %s container", arch)
+			opts.Arch = arch
+			runBuildArch(ctx, parseDefs(spec), archDest(dst, arch), buildFormat, opts)
+		}
+	default:
+		// build a SIF image per architecture first and merge them
+		dir, err := ioutil.TempDir(tmpDir, "build-arch-")
+		if err != nil {
+			sylog.Fatalf("Unable to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		srcs := make([]string, 0, len(buildArgs.arch))
+		for _, arch := range buildArgs.arch {
+			sylog.Infof("Building %s container", arch)
+			opts.Arch = arch
+			src := filepath.Join(dir, arch+".sif")
+			runBuildArch(ctx, parseDefs(spec), src, buildFormat, opts)
+			srcs = append(srcs, src)
+		}
+
+		sylog.Infof("Creating multi-architecture image %s", dst)
+		if err := build.MergeArchSIF(dst, srcs); err != nil {
+			sylog.Fatalf("While creating multi-architecture image: %v", err)
+		}
+	}
+}
+
+// parseDefs parses the build spec, the definitions are parsed for each
+// build as a build may modify them.
+func parseDefs(spec string) []types.Definition {
+	defs, err := build.MakeAllDefs(spec)
+	if err != nil {
+		sylog.Fatalf("Unable to build from %s: %v", spec, err)
+	}
+	return defs
+}
+
+// runBuildArch builds the definitions defs into the target dst.
+func runBuildArch(ctx context.Context, defs []types.Definition, dst, format string, opts types.Options) {
 	b, err := build.New(
 		defs,
 		build.Config{
 			Dest:      dst,
-			Format:    buildFormat,
+			Format:    format,
 			NoCleanUp: buildArgs.noCleanUp,
-			Opts: types.Options{
-				ImgCache:          imgCache,
-				TmpDir:            tmpDir,
-				NoCache:           disableCache,
-				Update:            buildArgs.update,
-				Force:             forceOverwrite,
-				Sections:          buildArgs.sections,
-				NoTest:            buildArgs.noTest,
-				NoHTTPS:           noHTTPS,
-				LibraryURL:        buildArgs.libraryURL,
-				LibraryAuthToken:  authToken,
-				FakerootPath:      fakerootPath,
-				KeyServerOpts:     ko,
-				DockerAuthConfig:  authConf,
-				EncryptionKeyInfo: keyInfo,
-				FixPerms:          buildArgs.fixPerms,
-				SandboxTarget:     sandboxTarget,
-			},
+			Opts:      opts,
 		})
 	if err != nil {
 		sylog.Fatalf("Unable to create build: %v", err)
@@ -0,0 +1,73 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestWaitBuildCgroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		release bool
+		wantErr bool
+	}{
+		{
+			name:    "released",
+			release: true,
+		},
+		{
+			name:    "closed early",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(buildCgroupsEnv, "")
+
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("while creating pipe: %s", err)
+			}
+			if tt.release {
+				if _, err := w.Write([]byte{'1'}); err != nil {
+					t.Fatalf("while writing to pipe: %s", err)
+				}
+			}
+			w.Close()
+
+			// waitBuildCgroups takes ownership of the descriptor
+			fd, err := syscall.Dup(int(r.Fd()))
+			r.Close()
+			if err != nil {
+				t.Fatalf("while duplicating pipe descriptor: %s", err)
+			}
+
+			err = waitBuildCgroups(strconv.Itoa(fd))
+			if tt.wantErr && err == nil {
+				t.Fatalf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			applied := os.Getenv(buildCgroupsEnv) == buildCgroupsApplied
+			if applied == tt.wantErr {
+				t.Errorf("unexpected %s value %q", buildCgroupsEnv, os.Getenv(buildCgroupsEnv))
+			}
+		})
+	}
+
+	if err := waitBuildCgroups("bad"); err == nil {
+		t.Errorf("unexpected success with a bad file descriptor")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// -j|--json
+var checkJSON bool
+
+var checkJSONFlag = cmdline.Flag{
+	ID:           "checkJSONFlag",
+	Value:        &checkJSON,
+	DefaultValue: false,
+	Name:         "json",
+	ShortHand:    "j",
+	Usage:        "print check results in json format",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(CheckCmd)
+
+		cmdManager.RegisterFlagForCmd(&checkJSONFlag, CheckCmd)
+	})
+}
+
+// CheckCmd apptainer check
+var CheckCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		results := apptainer.Check(configurationFile)
+
+		failed := 0
+		for _, r := range results {
+			if r.Status == apptainer.CheckFail {
+				failed++
+			}
+		}
+
+		if checkJSON {
+			b, err := json.MarshalIndent(results, "", "\t")
+			if err != nil {
+				sylog.Fatalf("While formatting check results: %s", err)
+			}
+			fmt.Println(string(b))
+		} else {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, r := range results {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(string(r.Status)), r.Name, r.Message)
+				if r.Hint != "" && r.Status != apptainer.CheckPass {
+					fmt.Fprintf(tw, "\t\thint: %s\n", r.Hint)
+				}
+			}
+			tw.Flush()
+		}
+
+		if failed > 0 {
+			sylog.Fatalf("%d check(s) failed", failed)
+		}
+	},
+
+	Use:     docs.CheckUse,
+	Short:   docs.CheckShort,
+	Long:    docs.CheckLong,
+	Example: docs.CheckExample,
+}
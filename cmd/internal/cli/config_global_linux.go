@@ -79,9 +79,20 @@ var globalConfigDryRunFlag = cmdline.Flag{
 	Usage:        "dump resulting configuration on stdout but doesn't write it to apptainer.conf",
 }
 
+// --show-origin
+var globalConfigShowOrigin bool
+
+var globalConfigShowOriginFlag = cmdline.Flag{
+	ID:           "globalConfigShowOriginFlag",
+	Value:        &globalConfigShowOrigin,
+	DefaultValue: false,
+	Name:         "show-origin",
+	Usage:        "show the effective value of the configuration directive, or of all directives, along with the file setting it",
+}
+
 // configGlobalCmd apptainer config global
 var configGlobalCmd = &cobra.Command{
-	Args:                  cobra.RangeArgs(1, 2),
+	Args:                  cobra.RangeArgs(0, 2),
 	DisableFlagsInUseLine: true,
 	PreRun:                CheckRootOrUnpriv,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -95,6 +106,8 @@ var configGlobalCmd = &cobra.Command{
 			op = apptainer.GlobalConfigReset
 		} else if globalConfigGet {
 			op = apptainer.GlobalConfigGet
+		} else if globalConfigShowOrigin {
+			op = apptainer.GlobalConfigShowOrigin
 		} else {
 			return fmt.Errorf("you must specify an option (eg: --set/--unset)")
 		}
@@ -119,5 +132,6 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&globalConfigGetFlag, configGlobalCmd)
 		cmdManager.RegisterFlagForCmd(&globalConfigResetFlag, configGlobalCmd)
 		cmdManager.RegisterFlagForCmd(&globalConfigDryRunFlag, configGlobalCmd)
+		cmdManager.RegisterFlagForCmd(&globalConfigShowOriginFlag, configGlobalCmd)
 	})
 }
@@ -0,0 +1,86 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/launcher"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(EnvCmd)
+
+		cmdManager.RegisterFlagForCmd(&actionAppFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionCleanEnvFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionCompatFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionContainFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionContainAllFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionDisableCacheFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionEnvFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionEnvFileFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionHomeFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionNoEvalFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&actionPwdFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, EnvCmd)
+		cmdManager.RegisterFlagForCmd(&inspectJSONFlag, EnvCmd)
+	})
+}
+
+// EnvCmd apptainer env <image>
+var EnvCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	PreRun:                actionPreRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		lo, err := launcherOptions(cmd, args[0], nil)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+
+		vars, err := launcher.ResolveEnv(lo)
+		if err != nil {
+			sylog.Fatalf("While resolving container environment: %s", err)
+		}
+
+		if jsonfmt {
+			b, err := json.MarshalIndent(vars, "", "\t")
+			if err != nil {
+				sylog.Fatalf("While formatting container environment: %s", err)
+			}
+			fmt.Println(string(b))
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VARIABLE\tORIGIN\tVALUE")
+		for _, v := range vars {
+			value := strings.Replace(v.Value, "\n", `\n`, -1)
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Name, v.Origin, value)
+		}
+		tw.Flush()
+	},
+
+	Use:     docs.EnvUse,
+	Short:   docs.EnvShort,
+	Long:    docs.EnvLong,
+	Example: docs.EnvExample,
+}
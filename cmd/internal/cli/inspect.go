@@ -49,6 +49,8 @@ var (
 	labels      bool
 	deffile     bool
 	jsonfmt     bool
+	platforms   bool
+	compression bool
 )
 
 // -l|--labels
@@ -91,6 +93,24 @@ var inspectAppsListFlag = cmdline.Flag{
 	Usage:        "list all apps in a container",
 }
 
+// --platforms
+var inspectPlatformsFlag = cmdline.Flag{
+	ID:           "inspectPlatformsFlag",
+	Value:        &platforms,
+	DefaultValue: false,
+	Name:         "platforms",
+	Usage:        "list the architectures of the root filesystems present in a SIF image",
+}
+
+// --compression
+var inspectCompressionFlag = cmdline.Flag{
+	ID:           "inspectCompressionFlag",
+	Value:        &compression,
+	DefaultValue: false,
+	Name:         "compression",
+	Usage:        "show the compression algorithm of the image root filesystem",
+}
+
 // --app
 var inspectAppNameFlag = cmdline.Flag{
 	ID:           "inspectAppNameFlag",
@@ -164,11 +184,13 @@ func init() {
 		cmdManager.RegisterCmd(InspectCmd)
 
 		cmdManager.RegisterFlagForCmd(&inspectAppNameFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectCompressionFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectDeffileFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectEnvironmentFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectHelpfileFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectJSONFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectLabelsFlag, InspectCmd)
+		cmdManager.RegisterFlagForCmd(&inspectPlatformsFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectRunscriptFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectStartscriptFlag, InspectCmd)
 		cmdManager.RegisterFlagForCmd(&inspectTestFlag, InspectCmd)
@@ -592,6 +614,51 @@ func inspectDeffilePartition(img *image.Image) (string, error) {
 	return string(data), nil
 }
 
+// getSIFPlatforms returns the architectures of the root filesystem
+// partitions of a SIF image.
+func getSIFPlatforms(img *image.Image) []string {
+	if img.Type != image.SIF {
+		return nil
+	}
+
+	fimg, err := sif.LoadContainer(img.File,
+		sif.OptLoadWithFlag(os.O_RDONLY),
+		sif.OptLoadWithCloseOnUnload(false),
+	)
+	if err != nil {
+		sylog.Warningf("While loading SIF image: %s", err)
+		return nil
+	}
+	defer fimg.UnloadContainer()
+
+	return image.Platforms(fimg)
+}
+
+// getCompression returns the compression algorithm of the
+// squashfs root filesystem partition of an image.
+func getCompression(img *image.Image) string {
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		sylog.Warningf("While searching root filesystem partition: %s", err)
+		return ""
+	}
+	if part.Type != image.SQUASHFS {
+		return ""
+	}
+
+	b := make([]byte, 96)
+	if _, err := img.File.ReadAt(b, int64(part.Offset)); err != nil {
+		sylog.Warningf("While reading squashfs super block: %s", err)
+		return ""
+	}
+	comp, err := image.GetSquashfsComp(b)
+	if err != nil {
+		sylog.Warningf("While reading squashfs compression: %s", err)
+		return ""
+	}
+	return comp
+}
+
 func printSortedApp(m map[string]*inspect.AppAttributes) {
 	sorted := make([]string, 0, len(m))
 	for k := range m {
@@ -616,7 +683,7 @@ func printSortedMap(m map[string]string, fn func(key string)) {
 
 // returns true if flags for other forms of information are unset.
 func defaultToLabels() bool {
-	return !(helpfile || deffile || runscript || startscript || testfile || environment || listApps)
+	return !(helpfile || deffile || runscript || startscript || testfile || environment || listApps || platforms || compression)
 }
 
 // InspectCmd represents the 'inspect' command.
@@ -695,6 +762,16 @@ var InspectCmd = &cobra.Command{
 			sylog.Fatalf("%s", err)
 		}
 
+		if platforms || allData {
+			sylog.Debugf("Listing all platforms in container")
+			inspectData.Data.Attributes.Platforms = getSIFPlatforms(img)
+		}
+
+		if compression || allData {
+			sylog.Debugf("Inspection of compression selected.")
+			inspectData.Data.Attributes.Compression = getCompression(img)
+		}
+
 		for app := range inspectData.Data.Attributes.Apps {
 			if !listApps && !allData && AppName != app {
 				delete(inspectData.Data.Attributes.Apps, app)
@@ -715,6 +792,14 @@ var InspectCmd = &cobra.Command{
 				printSortedApp(inspectData.Data.Attributes.Apps)
 			}
 
+			for _, p := range inspectData.Data.Attributes.Platforms {
+				fmt.Printf("%s\n", p)
+			}
+
+			if inspectData.Data.Attributes.Compression != "" {
+				fmt.Printf("%s\n", inspectData.Data.Attributes.Compression)
+			}
+
 			if inspectData.Data.Attributes.Deffile != "" {
 				fmt.Printf("%s\n", inspectData.Data.Attributes.Deffile)
 			}
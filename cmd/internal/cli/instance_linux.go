@@ -24,6 +24,9 @@ func init() {
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStopCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceListCmd)
 		cmdManager.RegisterSubCmd(instanceCmd, instanceStatsCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceUpdateCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instancePauseCmd)
+		cmdManager.RegisterSubCmd(instanceCmd, instanceResumeCmd)
 	})
 }
 
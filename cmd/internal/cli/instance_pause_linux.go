@@ -0,0 +1,66 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance pause <name>
+// sudo apptainer instance pause --user <username> <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instancePauseUserFlag, instancePauseCmd)
+	})
+}
+
+// -u|--user
+var instancePauseUser string
+
+var instancePauseUserFlag = cmdline.Flag{
+	ID:           "instancePauseUserFlag",
+	Value:        &instancePauseUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "if running as root, pause instances belonging to user",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// apptainer instance pause
+var instancePauseCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uid := os.Getuid()
+
+		// Root is required to pause an instance of another user
+		if instancePauseUser != "" && uid != 0 {
+			sylog.Fatalf("Only root user can pause user's instances")
+		}
+
+		// Instance name is the only arg
+		name := args[0]
+		return apptainer.PauseInstance(name, instancePauseUser)
+	},
+
+	Use:     docs.InstancePauseUse,
+	Short:   docs.InstancePauseShort,
+	Long:    docs.InstancePauseLong,
+	Example: docs.InstancePauseExample,
+}
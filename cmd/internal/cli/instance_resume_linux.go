@@ -0,0 +1,66 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance resume <name>
+// sudo apptainer instance resume --user <username> <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceResumeUserFlag, instanceResumeCmd)
+	})
+}
+
+// -u|--user
+var instanceResumeUser string
+
+var instanceResumeUserFlag = cmdline.Flag{
+	ID:           "instanceResumeUserFlag",
+	Value:        &instanceResumeUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "if running as root, resume instances belonging to user",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// apptainer instance resume
+var instanceResumeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uid := os.Getuid()
+
+		// Root is required to resume an instance of another user
+		if instanceResumeUser != "" && uid != 0 {
+			sylog.Fatalf("Only root user can resume user's instances")
+		}
+
+		// Instance name is the only arg
+		name := args[0]
+		return apptainer.ResumeInstance(name, instanceResumeUser)
+	},
+
+	Use:     docs.InstanceResumeUse,
+	Short:   docs.InstanceResumeShort,
+	Long:    docs.InstanceResumeLong,
+	Example: docs.InstanceResumeExample,
+}
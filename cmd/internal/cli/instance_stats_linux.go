@@ -11,6 +11,7 @@ package cli
 
 import (
 	"os"
+	"time"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/app/apptainer"
@@ -22,11 +23,20 @@ import (
 // Basic Design
 // apptainer instance stats <name>
 // apptainer instance stats --json <name>
+// apptainer instance stats --watch --interval 5s [name]
+// apptainer instance stats --jsonl [name]
+// apptainer instance stats --prometheus [--output <file> | --listen <addr>] [name]
 
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&instanceStatsUserFlag, instanceStatsCmd)
 		cmdManager.RegisterFlagForCmd(&instanceStatsJSONFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsJSONLinesFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsPrometheusFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsWatchFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsIntervalFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsOutputFlag, instanceStatsCmd)
+		cmdManager.RegisterFlagForCmd(&instanceStatsListenFlag, instanceStatsCmd)
 	})
 }
 
@@ -56,9 +66,80 @@ var instanceStatsJSONFlag = cmdline.Flag{
 	Usage:        "output stats in json",
 }
 
+// --jsonl
+var instanceStatsJSONLines bool
+
+var instanceStatsJSONLinesFlag = cmdline.Flag{
+	ID:           "instanceStatsJSONLinesFlag",
+	Value:        &instanceStatsJSONLines,
+	DefaultValue: false,
+	Name:         "jsonl",
+	Usage:        "output stats as one json object per line and instance",
+}
+
+// --prometheus
+var instanceStatsPrometheus bool
+
+var instanceStatsPrometheusFlag = cmdline.Flag{
+	ID:           "instanceStatsPrometheusFlag",
+	Value:        &instanceStatsPrometheus,
+	DefaultValue: false,
+	Name:         "prometheus",
+	Usage:        "output stats in the Prometheus text format",
+}
+
+// -w|--watch
+var instanceStatsWatch bool
+
+var instanceStatsWatchFlag = cmdline.Flag{
+	ID:           "instanceStatsWatchFlag",
+	Value:        &instanceStatsWatch,
+	DefaultValue: false,
+	Name:         "watch",
+	ShortHand:    "w",
+	Usage:        "refresh stats at each interval until interrupted",
+}
+
+// --interval
+var instanceStatsInterval string
+
+var instanceStatsIntervalFlag = cmdline.Flag{
+	ID:           "instanceStatsIntervalFlag",
+	Value:        &instanceStatsInterval,
+	DefaultValue: "2s",
+	Name:         "interval",
+	Usage:        "refresh interval used with --watch",
+	Tag:          "<duration>",
+}
+
+// -o|--output
+var instanceStatsOutput string
+
+var instanceStatsOutputFlag = cmdline.Flag{
+	ID:           "instanceStatsOutputFlag",
+	Value:        &instanceStatsOutput,
+	DefaultValue: "",
+	Name:         "output",
+	ShortHand:    "o",
+	Usage:        "write Prometheus metrics to a file, replaced at each interval with --watch (implies --prometheus)",
+	Tag:          "<file>",
+}
+
+// --listen
+var instanceStatsListen string
+
+var instanceStatsListenFlag = cmdline.Flag{
+	ID:           "instanceStatsListenFlag",
+	Value:        &instanceStatsListen,
+	DefaultValue: "",
+	Name:         "listen",
+	Usage:        "serve Prometheus metrics over HTTP on /metrics at the address (implies --prometheus)",
+	Tag:          "<[host]:port>",
+}
+
 // apptainer instance stats
 var instanceStatsCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.MaximumNArgs(1),
 	DisableFlagsInUseLine: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		uid := os.Getuid()
@@ -68,9 +149,27 @@ var instanceStatsCmd = &cobra.Command{
 			sylog.Fatalf("Only the root user can look at stats of a user's instance")
 		}
 
-		// Instance name is the only arg
-		name := args[0]
-		return apptainer.InstanceStats(name, instanceStatsUser, instanceStatsJSON)
+		interval, err := time.ParseDuration(instanceStatsInterval)
+		if err != nil {
+			sylog.Fatalf("Invalid interval %q: %s", instanceStatsInterval, err)
+		}
+
+		// Instance name is the only arg, all instances are selected by default
+		name := "*"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		opts := apptainer.InstanceStatsOptions{
+			User:       instanceStatsUser,
+			JSON:       instanceStatsJSON,
+			JSONLines:  instanceStatsJSONLines,
+			Prometheus: instanceStatsPrometheus || instanceStatsOutput != "" || instanceStatsListen != "",
+			Watch:      instanceStatsWatch,
+			Interval:   interval,
+			Output:     instanceStatsOutput,
+			Listen:     instanceStatsListen,
+		}
+		return apptainer.InstanceStats(name, opts)
 	},
 
 	Use:     docs.InstanceStatsUse,
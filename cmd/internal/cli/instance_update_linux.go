@@ -0,0 +1,88 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// Basic Design
+// apptainer instance update --memory 8G --cpus 4 <name>
+// apptainer instance update --apply-cgroups <file> <name>
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceUpdateUserFlag, instanceUpdateCmd)
+
+		cmdManager.RegisterFlagForCmd(&actionApplyCgroupsFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionBlkioWeightFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionBlkioWeightDeviceFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUSharesFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUsFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUsetCPUsFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionCPUsetMemsFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionMemoryFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionMemoryReservationFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionMemorySwapFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionOomKillDisableFlag, instanceUpdateCmd)
+		cmdManager.RegisterFlagForCmd(&actionPidsLimitFlag, instanceUpdateCmd)
+	})
+}
+
+// -u|--user
+var instanceUpdateUser string
+
+var instanceUpdateUserFlag = cmdline.Flag{
+	ID:           "instanceUpdateUserFlag",
+	Value:        &instanceUpdateUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        "if running as root, update an instance belonging to user",
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// apptainer instance update
+var instanceUpdateCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uid := os.Getuid()
+
+		// Root is required to update an instance of another user
+		if instanceUpdateUser != "" && uid != 0 {
+			sylog.Fatalf("Only root user can update user's instances")
+		}
+
+		cgJSON, err := getCgroupsJSON()
+		if err != nil {
+			sylog.Fatalf("While parsing cgroups configuration: %s", err)
+		}
+		if cgJSON == "" {
+			return errors.New("no resource limits specified")
+		}
+
+		// Instance name is the only arg
+		name := args[0]
+		return apptainer.UpdateInstance(name, instanceUpdateUser, cgJSON)
+	},
+
+	Use:     docs.InstanceUpdateUse,
+	Short:   docs.InstanceUpdateShort,
+	Long:    docs.InstanceUpdateLong,
+	Example: docs.InstanceUpdateExample,
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var networkSubnet string
+
+// --subnet
+var networkSubnetFlag = cmdline.Flag{
+	ID:           "networkSubnetFlag",
+	Value:        &networkSubnet,
+	DefaultValue: "",
+	Name:         "subnet",
+	Usage:        "subnet of the network, allocated from the user network pool by default",
+	Tag:          "<cidr>",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(NetworkCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkCreateCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkListCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkDeleteCmd)
+
+		cmdManager.RegisterFlagForCmd(&networkSubnetFlag, NetworkCreateCmd)
+	})
+}
+
+// NetworkCmd is the 'network' command that allows to manage user networks.
+var NetworkCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.NetworkUse,
+	Short:   docs.NetworkShort,
+	Long:    docs.NetworkLong,
+	Example: docs.NetworkExample,
+}
+
+// NetworkCreateCmd apptainer network create
+var NetworkCreateCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apptainer.NetworkCreate(args[0], networkSubnet); err != nil {
+			sylog.Fatalf("Could not create network %s: %s", args[0], err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.NetworkCreateUse,
+	Short:   docs.NetworkCreateShort,
+	Long:    docs.NetworkCreateLong,
+	Example: docs.NetworkCreateExample,
+}
+
+// NetworkListCmd apptainer network list
+var NetworkListCmd = &cobra.Command{
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apptainer.NetworkList(os.Stdout); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.NetworkListUse,
+	Short:   docs.NetworkListShort,
+	Long:    docs.NetworkListLong,
+	Example: docs.NetworkListExample,
+	Aliases: []string{"ls"},
+}
+
+// NetworkDeleteCmd apptainer network delete
+var NetworkDeleteCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apptainer.NetworkDelete(args[0]); err != nil {
+			sylog.Fatalf("Could not delete network %s: %s", args[0], err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.NetworkDeleteUse,
+	Short:   docs.NetworkDeleteShort,
+	Long:    docs.NetworkDeleteLong,
+	Example: docs.NetworkDeleteExample,
+	Aliases: []string{"rm"},
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// -o|--out
+var packageOut string
+
+var pluginPackageOutFlag = cmdline.Flag{
+	ID:           "pluginPackageOutFlag",
+	Value:        &packageOut,
+	DefaultValue: "",
+	Name:         "out",
+	ShortHand:    "o",
+	Usage:        "path of the SIF output file",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&pluginPackageOutFlag, PluginPackageCmd)
+	})
+}
+
+// PluginPackageCmd allows a user to package an executable plugin.
+//
+// apptainer plugin package <executable> [-o name]
+var PluginPackageCmd = &cobra.Command{
+	Run: func(cmd *cobra.Command, args []string) {
+		destSif := packageOut
+		if destSif == "" {
+			destSif = args[0] + ".sif"
+		}
+
+		if err := apptainer.PackagePlugin(args[0], destSif); err != nil {
+			sylog.Fatalf("Plugin package failed with error: %s", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.PluginPackageUse,
+	Short:   docs.PluginPackageShort,
+	Long:    docs.PluginPackageLong,
+	Example: docs.PluginPackageExample,
+}
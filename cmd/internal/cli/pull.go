@@ -52,7 +52,7 @@ var (
 	// pullDir is the path that the containers will be pulled to, if set.
 	pullDir string
 	// pullArch is the architecture for which containers will be pulled from the
-	// SCS library.
+	// SCS library or OCI registries.
 	pullArch string
 )
 
@@ -62,7 +62,7 @@ var pullArchFlag = cmdline.Flag{
 	Value:        &pullArch,
 	DefaultValue: runtime.GOARCH,
 	Name:         "arch",
-	Usage:        "architecture to pull from library",
+	Usage:        "architecture to pull from library or OCI registry",
 	EnvKeys:      []string{"PULL_ARCH"},
 }
 
@@ -267,7 +267,7 @@ func pullRun(cmd *cobra.Command, args []string) {
 			sylog.Fatalf("While creating Docker credentials: %v", err)
 		}
 
-		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS, buildArgs.noCleanUp)
+		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS, buildArgs.noCleanUp, pullArch)
 		if err != nil {
 			sylog.Fatalf("While making image from oci registry: %v", err)
 		}
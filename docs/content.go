@@ -65,7 +65,19 @@ Enterprise Performance Computing (EPC)`
       library://  an image library (no default)
       docker://   a Docker/OCI registry (default Docker Hub)
       shub://     an Apptainer registry (default Singularity Hub)
-      oras://     an OCI registry that holds SIF files using ORAS`
+      oras://     an OCI registry that holds SIF files using ORAS
+
+  Local OCI images are also supported with the following formats:
+
+      oci-archive:         an OCI archive
+      docker-archive:      a Docker archive (docker save)
+      docker-daemon:       an image stored by the Docker daemon
+      containers-storage:  an image stored by Podman/Buildah
+      dir:                 a directory created by skopeo with dir:
+
+  An image stored by a rootless Podman can only be read from the Podman
+  user namespace, prefix the command with "podman unshare" to use it with
+  containers-storage:.`
 
 	BuildExample string = `
 
@@ -162,7 +174,19 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ apptainer build --sandbox /tmp/debian docker://debian:latest
           $ apptainer exec --writable /tmp/debian apt-get install python
-          $ apptainer build /tmp/debian2.sif /tmp/debian`
+          $ apptainer build /tmp/debian2.sif /tmp/debian
+
+      Build a single sif image holding amd64 and arm64 root filesystems, the
+      root filesystem matching the host architecture is selected at runtime:
+          $ apptainer build --arch amd64,arm64 /tmp/debian3.sif docker://debian:latest
+
+      Build one sif image per architecture (/tmp/debian4_amd64.sif and /tmp/debian4_arm64.sif),
+      running %post for a foreign architecture requires a qemu-user emulator registered
+      in /proc/sys/fs/binfmt_misc with the F flag:
+          $ apptainer build --arch amd64,arm64 --split-arch /tmp/debian4.sif /path/to/debian.def
+
+      Build a zstd compressed sif image, the installed mksquashfs must support zstd:
+          $ apptainer build --compression zstd --compression-level 19 /tmp/debian5.sif docker://debian:latest`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -560,15 +584,28 @@ Enterprise Performance Computing (EPC)`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance stats
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	InstanceStatsUse   string = `stats [stats options...] <instance name>`
-	InstanceStatsShort string = `Get stats for a named instance`
+	InstanceStatsUse   string = `stats [stats options...] [instance name]`
+	InstanceStatsShort string = `Get stats for named instances`
 	InstanceStatsLong  string = `
-  The instance stats command allows you to get statistics for a named instance,
-  either printed to the terminal or in json. If you are root, you can optionally
-  ask for statistics for a container instance belonging to a specific user.`
+  The instance stats command allows you to get statistics for named instances,
+  or for all of your instances if no name is given, either printed to the
+  terminal or in json. If you are root, you can optionally ask for statistics
+  for container instances belonging to a specific user.
+
+  With --watch the statistics are refreshed at each --interval until
+  interrupted, CPU percentages are computed between two refreshes. The --jsonl
+  option prints one json object per line and instance, suitable for scraping,
+  and --prometheus prints the statistics in the Prometheus text format. The
+  Prometheus metrics can be written to a file for a textfile collector with
+  --output, or served over HTTP on /metrics with --listen. Network counters
+  are reported for instances running in their own network namespace.`
 	InstanceStatsExample string = `
   $ apptainer instance stats mysql
   $ apptainer instance stats --json mysql
+  $ apptainer instance stats --watch --interval 5s
+  $ apptainer instance stats --jsonl --watch mysql*
+  $ apptainer instance stats --prometheus --watch --output /var/lib/node_exporter/apptainer.prom
+  $ apptainer instance stats --listen 127.0.0.1:9123
   $ sudo apptainer instance stats --user <username> user-mysql`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -596,6 +633,57 @@ Enterprise Performance Computing (EPC)`
   $ apptainer instance stop -s TERM mysql1
   $ apptainer instance stop -s 15 mysql1`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance update
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceUpdateUse   string = `update [update options...] <instance name>`
+	InstanceUpdateShort string = `Update resource limits of a named instance`
+	InstanceUpdateLong  string = `
+  The instance update command allows you to change the cgroups resource limits
+  of a running instance started with resource limits, without restarting it.
+  Limits can be set with the same flags as instance start, or read from a TOML
+  file with --apply-cgroups. If you are root, you can optionally update an
+  instance belonging to a specific user.`
+	InstanceUpdateExample string = `
+  $ sudo apptainer instance start --memory 4G --cpus 2 my-sql.sif mysql
+  $ sudo apptainer instance update --memory 8G --cpus 4 mysql
+  $ sudo apptainer instance update --apply-cgroups limits.toml mysql
+  $ sudo apptainer instance update --user <username> --pids-limit 512 user-mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance pause
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstancePauseUse   string = `pause [pause options...] <instance name>`
+	InstancePauseShort string = `Pause a named instance`
+	InstancePauseLong  string = `
+  The instance pause command suspends all processes of a named instance until
+  it is resumed with 'apptainer instance resume'. The cgroup of the instance is
+  frozen when it was started with resource limits, otherwise its processes
+  are stopped with SIGSTOP. Paused instances are shown as paused by
+  'apptainer instance list' and can still be stopped. If you are root, you can
+  optionally pause an instance belonging to a specific user.`
+	InstancePauseExample string = `
+  $ apptainer instance start my-sql.sif mysql
+  $ apptainer instance pause mysql
+  $ apptainer instance list
+  INSTANCE NAME    PID      STATUS    IP    PORTS    IMAGE
+  mysql            23845    paused                   /home/user/my-sql.sif
+  $ sudo apptainer instance pause --user <username> user-mysql`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance resume
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceResumeUse   string = `resume [resume options...] <instance name>`
+	InstanceResumeShort string = `Resume a paused instance`
+	InstanceResumeLong  string = `
+  The instance resume command resumes the processes of a named instance paused
+  with 'apptainer instance pause'. If you are root, you can optionally resume an
+  instance belonging to a specific user.`
+	InstanceResumeExample string = `
+  $ apptainer instance pause mysql
+  $ apptainer instance resume mysql
+  $ sudo apptainer instance resume --user <username> user-mysql`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// pull
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -617,6 +705,10 @@ Enterprise Performance Computing (EPC)`
   oras: Pull a SIF image from an OCI registry that supports ORAS.
       oras://registry/namespace/image:tag
 
+  containers-storage: Pull an image from the Podman/Buildah local store
+      containers-storage:localhost/image:tag
+      (run with "podman unshare" for a rootless Podman store)
+
   http, https: Pull an image using the http(s?) protocol
       https://example.com/alpine.sif`
 	PullExample string = `
@@ -805,6 +897,12 @@ Enterprise Performance Computing (EPC)`
   `
 	InspectExample string = `
   $ apptainer inspect ubuntu.sif
+
+  To list the architectures of the root filesystems present in a SIF image:
+  $ apptainer inspect --platforms ubuntu.sif
+
+  To show the compression algorithm of the image root filesystem:
+  $ apptainer inspect --compression ubuntu.sif
   
   If you want to list the applications (apps) installed in a container (located at
   /scif/apps) you should run inspect command with --list-apps <container-image> flag.
@@ -853,6 +951,47 @@ Enterprise Performance Computing (EPC)`
 
   $ apptainer inspect --app <appname> ubuntu.sif`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Check
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CheckUse   string = `check [check options...]`
+	CheckShort string = `Check the Apptainer installation and configuration`
+	CheckLong  string = `
+  Check runs a set of diagnostics on the Apptainer installation, configuration
+  and host features available to the current user: starter binaries, parsing and
+  ownership of apptainer.conf and its drop-in files, the capability file, user
+  namespaces, subuid and subgid mappings, the FUSE image driver helpers, overlay
+  support, cgroups delegation, CNI configuration and helper binaries. Each check reports pass, warn or fail along
+  with a remediation hint, the command exits with a non-zero status if any check
+  fails.`
+	CheckExample string = `
+  $ apptainer check
+
+  To print the results in json format for monitoring:
+  $ apptainer check --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Env
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	EnvUse   string = `env [env options...] <image path>`
+	EnvShort string = `Show the environment of a container process`
+	EnvLong  string = `
+  Env evaluates the environment scripts of the image along with the
+  APPTAINERENV_ variables, --env, --env-file and --cleanenv options the same
+  way as when the container starts, without starting it. Each final variable
+  is printed along with the script, option or host variable which last set it.
+
+  Commands executed by the environment scripts are not run, variables relying
+  on their output may differ from the environment of a running container.`
+	EnvExample string = `
+  $ apptainer env ubuntu.sif
+
+  To show the environment with additional variables and a clean environment:
+  $ apptainer env --cleanenv --env FOO=bar ubuntu.sif
+
+  To show the environment in json format:
+  $ apptainer env --json ubuntu.sif`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Test
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -1039,11 +1178,14 @@ Enterprise Performance Computing (EPC)`
   To enable a fakeroot user mapping for vagrant user:
   $ apptainer config fakeroot --enable vagrant`
 
-	ConfigGlobalUse   string = `global <option> <directive> [value,...]`
+	ConfigGlobalUse   string = `global <option> [directive] [value,...]`
 	ConfigGlobalShort string = `Edit apptainer.conf from command line (root user only or unprivileged installation)`
 	ConfigGlobalLong  string = `
   The config global command allow administrators to set/unset/get/reset configuration
-  directives of apptainer.conf from command line.`
+  directives of apptainer.conf from command line. Directives set by the drop-in files
+  of the apptainer.conf.d directory are not modified, --show-origin displays the
+  effective value of directives once drop-in files are merged along with the file
+  setting them.`
 	ConfigGlobalExample string = `
   To add a path to "bind path" directive:
   $ apptainer config global --set "bind path" /etc/resolv.conf
@@ -1058,7 +1200,10 @@ Enterprise Performance Computing (EPC)`
   $ apptainer config global --get "bind path"
 
   To display the resulting configuration instead of writing it to file:
-  $ apptainer config global --dry-run --set "bind path" /etc/resolv.conf`
+  $ apptainer config global --dry-run --set "bind path" /etc/resolv.conf
+
+  To display the effective value of all directives and the file setting them:
+  $ apptainer config global --show-origin`
 
 	OverlayUse   string = `overlay`
 	OverlayShort string = `Manage an EXT3 writable overlay image`
@@ -1082,6 +1227,48 @@ Enterprise Performance Computing (EPC)`
   To create a single EXT3 writable overlay image:
   $ apptainer overlay create --size 1024 /tmp/my_overlay.img`
 
+	NetworkUse   string = `network`
+	NetworkShort string = `Manage networks shared by containers`
+	NetworkLong  string = `
+  The network command allows management of bridge networks created by the
+  user. Containers started with '--net --network <name>' on the same network
+  can reach each other, and the instances attached to it resolve each other
+  by instance name. These networks require root or a setuid installation.`
+	NetworkExample string = `
+  All network commands have their own help output:
+
+  $ apptainer help network create
+  $ apptainer network create --help`
+
+	NetworkCreateUse   string = `create [create options...] <name>`
+	NetworkCreateShort string = `Create a network`
+	NetworkCreateLong  string = `
+  The network create command creates a bridge network for the current user.
+  When no subnet is specified, a free /24 subnet is allocated from the
+  'user network pool' set in apptainer.conf.`
+	NetworkCreateExample string = `
+  $ apptainer network create backend
+  $ apptainer network create --subnet 10.89.10.0/24 backend
+  $ apptainer instance start --net --network backend db.sif db
+  $ apptainer instance start --net --network backend web.sif web
+  $ apptainer exec instance://web ping db`
+
+	NetworkListUse   string = `list`
+	NetworkListShort string = `List networks`
+	NetworkListLong  string = `
+  The network list command lists the networks created by the current user
+  along with the running instances attached to them.`
+	NetworkListExample string = `
+  $ apptainer network list`
+
+	NetworkDeleteUse   string = `delete <name>`
+	NetworkDeleteShort string = `Delete a network`
+	NetworkDeleteLong  string = `
+  The network delete command deletes a network created by the current user,
+  it fails while running instances are attached to the network.`
+	NetworkDeleteExample string = `
+  $ apptainer network delete backend`
+
 	CheckpointUse   string = `checkpoint`
 	CheckpointShort string = `Manage container checkpoint state (experimental)`
 	CheckpointLong  string = `
@@ -35,6 +35,20 @@ const (
   $ apptainer plugin compile $HOME/apptainer/test-plugin`
 )
 
+// Plugin package command usage.
+const (
+	PluginPackageUse   string = `package [package options...] <executable>`
+	PluginPackageShort string = `Package an executable Apptainer plugin`
+	PluginPackageLong  string = `
+  The 'plugin package' command packs an executable plugin into a SIF file
+  which can be installed with 'plugin install'. Unlike compiled plugins,
+  an executable plugin is a standalone program speaking the plugin protocol
+  over its standard input and output (see pkg/plugin/executable), it doesn't
+  need to be built against the Apptainer source tree.`
+	PluginPackageExample string = `
+  $ apptainer plugin package -o hello.sif $HOME/apptainer/hello-plugin/hello`
+)
+
 // Plugin install command usage.
 const (
 	PluginInstallUse   string = `install <plugin_path>`
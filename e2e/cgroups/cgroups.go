@@ -11,6 +11,10 @@ package cgroups
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
@@ -103,6 +107,28 @@ func (c *ctx) instanceStats(t *testing.T, profile e2e.Profile) {
 					e2e.ExpectOutput(e2e.ContainMatch, "PIDS"),
 				),
 			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("stats jsonl"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("instance stats"),
+				e2e.WithArgs("--jsonl", instanceName),
+				e2e.ExpectExit(tt.statsErrorCode,
+					e2e.ExpectOutput(e2e.ContainMatch, `"instance":"`+instanceName+`"`),
+					e2e.ExpectOutput(e2e.ContainMatch, `"memoryUsageBytes":`),
+				),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("stats prometheus"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("instance stats"),
+				e2e.WithArgs("--prometheus", instanceName),
+				e2e.ExpectExit(tt.statsErrorCode,
+					e2e.ExpectOutput(e2e.ContainMatch, "# TYPE apptainer_instance_cpu_usage_seconds_total counter"),
+					e2e.ExpectOutput(e2e.ContainMatch, `apptainer_instance_pids{instance="`+instanceName+`"`),
+				),
+			)
 			c.env.RunApptainer(
 				t,
 				e2e.AsSubtest("stop"),
@@ -585,6 +611,51 @@ func (c *ctx) actionFlagsRootless(t *testing.T) {
 	}
 }
 
+// buildFlags tests that resource limit flags are applied to the processes
+// of a build by reading the limit of the %post section cgroup.
+func (c *ctx) buildFlags(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	// Use shell in the build container to find its cgroup and store the
+	// memory limit in the image, see actionFlagV1 and actionFlagV2.
+	limit := "/sys/fs/cgroup$(cat /proc/self/cgroup | grep '^0::' | cut -d ':' -f 3)/memory.max"
+	if !cgroups.IsCgroup2UnifiedMode() {
+		require.CgroupsResourceExists(t, "memory", "memory.limit_in_bytes")
+		limit = "/sys/fs/cgroup/memory$(cat /proc/self/cgroup | grep '[,:]memory[,:]' | cut -d ':' -f 3)/memory.limit_in_bytes"
+	}
+
+	defFile := e2e.PrepareDefFile(e2e.DefFileDetails{
+		Bootstrap: "localimage",
+		From:      c.env.ImagePath,
+		Post:      []string{"cat " + limit + " > /memory.limit"},
+	})
+	defer os.Remove(defFile)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "build-cgroups-", "")
+	defer cleanup(t)
+	sandbox := filepath.Join(tmpDir, "sandbox")
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.RootProfile),
+		e2e.WithCommand("build"),
+		e2e.WithArgs("--memory", "500M", "--bind", "/sys/fs/cgroup", "--sandbox", sandbox, defFile),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			b, err := ioutil.ReadFile(filepath.Join(sandbox, "memory.limit"))
+			if err != nil {
+				t.Fatalf("while reading build memory limit: %s", err)
+			}
+			if got := strings.TrimSpace(string(b)); got != "524288000" {
+				t.Errorf("unexpected build memory limit %q, expected 524288000", got)
+			}
+		}),
+		e2e.ExpectExit(0),
+	)
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := &ctx{
@@ -601,5 +672,6 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"action rootless cgroups":       np(env.WithRootlessManagers(c.actionApplyRootless)),
 		"action flags root cgroups":     np(env.WithRootManagers(c.actionFlagsRoot)),
 		"action flags rootless cgroups": np(env.WithRootlessManagers(c.actionFlagsRootless)),
+		"build flags root cgroups":      np(env.WithRootManagers(c.buildFlags)),
 	}
 }
@@ -67,6 +67,51 @@ func (c *ctx) testBasicEchoServer(t *testing.T) {
 	)
 }
 
+// Test that an instance can be paused, resumed and stopped while paused.
+func (c *ctx) testPauseResume(t *testing.T) {
+	const instanceName = "echo-pause"
+
+	args := []string{c.env.ImagePath, instanceName, strconv.Itoa(instanceStartPort)}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(args...),
+		e2e.ExpectExit(0),
+	)
+	c.expectInstanceStatus(t, instanceName, "running")
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance pause"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.expectInstanceStatus(t, instanceName, "paused")
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance resume"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.expectInstanceStatus(t, instanceName, "running")
+	echo(t, instanceStartPort)
+
+	// stop must work on a paused instance
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance pause"),
+		e2e.WithArgs(instanceName),
+		e2e.ExpectExit(0),
+	)
+	c.stopInstance(t, instanceName)
+}
+
 // Test creating many instances, but don't stop them.
 func (c *ctx) testCreateManyInstances(t *testing.T) {
 	const n = 10
@@ -333,6 +378,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 				function func(*testing.T)
 			}{
 				{"BasicEchoServer", c.testBasicEchoServer},
+				{"PauseResume", c.testPauseResume},
 				{"BasicOptions", c.testBasicOptions},
 				{"Contain", c.testContain},
 				{"InstanceFromURI", c.testInstanceFromURI},
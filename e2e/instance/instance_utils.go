@@ -27,6 +27,7 @@ type instance struct {
 	Image    string `json:"img"`
 	Instance string `json:"instance"`
 	Pid      int    `json:"pid"`
+	Status   string `json:"status"`
 }
 
 type instanceList struct {
@@ -113,6 +114,31 @@ func (c *ctx) expectInstance(t *testing.T, name string, nb int) {
 	)
 }
 
+// Check the status of the instance with the provided name.
+func (c *ctx) expectInstanceStatus(t *testing.T, name, status string) {
+	listInstancesFn := func(t *testing.T, r *e2e.ApptainerCmdResult) {
+		var instances instanceList
+
+		if err := json.Unmarshal([]byte(r.Stdout), &instances); err != nil {
+			t.Errorf("Error while decoding JSON from 'instance list': %v", err)
+			return
+		}
+		if len(instances.Instances) != 1 {
+			t.Errorf("%d instance %q found, expected 1", len(instances.Instances), name)
+		} else if instances.Instances[0].Status != status {
+			t.Errorf("instance %q status is %q, expected %q", name, instances.Instances[0].Status, status)
+		}
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance list"),
+		e2e.WithArgs([]string{"--json", name}...),
+		e2e.ExpectExit(0, listInstancesFn),
+	)
+}
+
 // Sends a deterministic message to an echo server and expects the same message
 // in response.
 func echo(t *testing.T, port int) {
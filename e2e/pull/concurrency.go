@@ -26,6 +26,8 @@ func (c ctx) testConcurrencyConfig(t *testing.T) {
 		{"InvalidDownloadPartSize", "download part size", "-1", 255},
 		{"DownloadBufferSize", "download buffer size", "65536", 0},
 		{"InvalidDownloadBufferSize", "download buffer size", "-1", 255},
+		{"DownloadRetries", "download retries", "2", 0},
+		{"InvalidDownloadRetries", "download retries", "-1", 255},
 	}
 
 	for _, tt := range tests {
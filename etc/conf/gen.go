@@ -34,12 +34,18 @@ func main() {
 
 // genConf produces an apptainer.conf file at out. It retains set configurations from in (leave blank for default)
 func genConf(tmpl, in, out string) {
-	inFile := in
-	// Parse current apptainer.conf file into c
-	if _, err := os.Stat(in); os.IsNotExist(err) {
-		inFile = ""
+	// Parse current apptainer.conf file into c, drop-in files
+	// are not merged into the generated file
+	var directives apptainerconf.Directives
+	if f, err := os.Open(in); err == nil {
+		directives, err = apptainerconf.GetDirectives(f)
+		f.Close()
+		if err != nil {
+			fmt.Printf("Unable to parse apptainer.conf file: %s\n", err)
+			os.Exit(1)
+		}
 	}
-	c, err := apptainerconf.Parse(inFile)
+	c, err := apptainerconf.GetConfig(directives)
 	if err != nil {
 		fmt.Printf("Unable to parse apptainer.conf file: %s\n", err)
 		os.Exit(1)
@@ -0,0 +1,96 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// This is an executable plugin, unlike other example plugins it's built
+// as a regular program and packaged with:
+//
+//	$ go build -o executable-plugin .
+//	$ apptainer plugin package -o executable-plugin.sif executable-plugin
+//	$ sudo apptainer plugin install executable-plugin.sif
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"strings"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/plugin/executable"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+)
+
+var plugin = &executable.Plugin{
+	Manifest: pluginapi.Manifest{
+		Name:        "example.com/executable-plugin",
+		Author:      "Apptainer Team",
+		Version:     "0.1.0",
+		Description: "Example of an executable plugin",
+	},
+	Commands: []executable.Command{
+		{
+			Use:     "greet [name...]",
+			Short:   "Print a greeting",
+			Example: "apptainer greet --greeting hi world",
+			Run:     greet,
+		},
+	},
+	Flags: []executable.Flag{
+		{
+			Name:     "greeting",
+			Usage:    "greeting message, also set as GREETING in the container",
+			Default:  "hello",
+			EnvKeys:  []string{"GREETING"},
+			Commands: []string{"greet", "exec", "run", "shell"},
+		},
+	},
+	EngineConfig: setGreeting,
+	Event:        logEvent,
+}
+
+func greet(stdout io.Writer, args []string, flags map[string]string) error {
+	_, err := fmt.Fprintf(stdout, "%s %s\n", flags["greeting"], strings.Join(args, " "))
+	return err
+}
+
+// setGreeting sets the GREETING environment variable in the container.
+func setGreeting(cfg *config.Common, flags map[string]string) error {
+	engineConfig, ok := cfg.EngineConfig.(*apptainerConfig.EngineConfig)
+	if !ok {
+		return fmt.Errorf("unexpected engine configuration type %T", cfg.EngineConfig)
+	}
+
+	env := engineConfig.GetApptainerEnv()
+	if env == nil {
+		env = make(map[string]string)
+	}
+	env["GREETING"] = flags["greeting"]
+	engineConfig.SetApptainerEnv(env)
+
+	return nil
+}
+
+// logEvent logs container lifecycle events to syslog.
+func logEvent(e executable.Event) error {
+	w, err := syslog.New(syslog.LOG_INFO, "apptainer")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return w.Info(fmt.Sprintf("EVENT=%s CONTAINER=%q IMAGE=%q PID=%d STATUS=%d", e.Type, e.ContainerID, e.Image, e.Pid, e.ExitStatus))
+}
+
+func main() {
+	if err := executable.Serve(plugin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/internal/pkg/image/driver"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/apptainer/apptainer/pkg/util/capabilities"
+	"github.com/apptainer/apptainer/pkg/util/fs/proc"
+	lccgroups "github.com/opencontainers/runc/libcontainer/cgroups"
+	"golang.org/x/sys/unix"
+)
+
+// CheckStatus is the status of a configuration check.
+type CheckStatus string
+
+const (
+	// CheckPass is the status of a successful check.
+	CheckPass CheckStatus = "pass"
+	// CheckWarn is the status of a check reporting a limitation.
+	CheckWarn CheckStatus = "warn"
+	// CheckFail is the status of a check reporting a broken setup.
+	CheckFail CheckStatus = "fail"
+)
+
+// CheckResult is the result of a configuration check.
+type CheckResult struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+	Hint    string      `json:"hint,omitempty"`
+}
+
+// checkPaths holds the host paths probed by the configuration checks,
+// they are replaced by unit tests.
+var checkPaths = struct {
+	maxUserNamespaces string
+	unprivUsernsClone string
+	fuseDevice        string
+	cgroupRoot        string
+	capabilityFile    string
+}{
+	maxUserNamespaces: "/proc/sys/user/max_user_namespaces",
+	unprivUsernsClone: "/proc/sys/kernel/unprivileged_userns_clone",
+	fuseDevice:        "/dev/fuse",
+	cgroupRoot:        "/sys/fs/cgroup",
+	capabilityFile:    buildcfg.CAPABILITY_FILE,
+}
+
+// checker runs the configuration checks for the current user.
+type checker struct {
+	configFile string
+	config     *apptainerconf.File
+	uid        int
+	suid       bool
+	results    []CheckResult
+}
+
+func (c *checker) add(name string, status CheckStatus, hint string, format string, a ...interface{}) {
+	c.results = append(c.results, CheckResult{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, a...),
+		Hint:    hint,
+	})
+}
+
+// Check runs a set of diagnostics on the Apptainer installation and
+// configuration for the current user and returns their results.
+func Check(configFile string) []CheckResult {
+	c := &checker{
+		configFile: configFile,
+		uid:        os.Getuid(),
+	}
+
+	c.checkStarter()
+	if !c.checkConfig() {
+		return c.results
+	}
+	c.checkCapabilities()
+	c.checkUserNamespaces()
+	c.checkIDMappings()
+	c.checkFuse()
+	c.checkOverlay()
+	c.checkCgroups()
+	c.checkCNI()
+	c.checkHelpers()
+
+	return c.results
+}
+
+func (c *checker) checkStarter() {
+	const name = "starter"
+
+	starterPath := filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter")
+	if !fs.IsExec(starterPath) {
+		c.add(name, CheckFail, "reinstall Apptainer", "%s is missing or not executable", starterPath)
+		return
+	}
+
+	suid, err := starter.CheckSuidInstall()
+	c.suid = suid
+	if err != nil {
+		path := filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter-suid")
+		c.add(name, CheckFail, fmt.Sprintf("run 'chown root:root %[1]s && chmod 4755 %[1]s' as root", path), "%s", err)
+	} else if suid {
+		c.add(name, CheckPass, "", "setuid installation")
+	} else {
+		c.add(name, CheckPass, "", "unprivileged installation")
+	}
+}
+
+func (c *checker) checkCapabilities() {
+	const name = "capabilities"
+
+	// the capability file is read by the starter engine for setuid
+	// installations and root executions only
+	if !c.suid && c.uid != 0 {
+		c.add(name, CheckPass, "", "capabilities are not used by unprivileged installations")
+		return
+	}
+
+	path := checkPaths.capabilityFile
+	f, err := os.Open(path)
+	if err != nil {
+		c.add(name, CheckFail, "run 'apptainer capability add' as root to create it", "could not open %s: %s", path, err)
+		return
+	}
+	defer f.Close()
+
+	if c.suid && !fs.IsOwner(path, 0) {
+		c.add(name, CheckFail, fmt.Sprintf("run 'chown root:root %s' as root", path), "%s must be owned by root", path)
+		return
+	}
+
+	capConfig, err := capabilities.ReadFrom(f)
+	if err != nil {
+		c.add(name, CheckFail, "fix or recreate the file with 'apptainer capability' commands", "could not parse %s: %s", path, err)
+		return
+	}
+
+	u, err := user.LookupId(strconv.Itoa(c.uid))
+	if err != nil {
+		c.add(name, CheckWarn, "", "could not look up the current user: %s", err)
+		return
+	}
+	caps := capConfig.ListUserCaps(u.Username)
+	if gids, err := u.GroupIds(); err == nil {
+		for _, gid := range gids {
+			if g, err := user.LookupGroupId(gid); err == nil {
+				caps = append(caps, capConfig.ListGroupCaps(g.Name)...)
+			}
+		}
+	}
+	c.add(name, CheckPass, "", "%d capabilities granted to %s, root default capabilities set to %s", len(caps), u.Username, c.config.RootDefaultCapabilities)
+}
+
+func (c *checker) checkConfig() bool {
+	const name = "configuration"
+
+	config, err := apptainerconf.Parse(c.configFile)
+	if err != nil {
+		c.add(name, CheckFail, "fix the reported directive", "could not parse %s: %s", c.configFile, err)
+		return false
+	}
+	c.config = config
+
+	if c.suid {
+		if !fs.IsOwner(c.configFile, 0) {
+			c.add(name, CheckFail, fmt.Sprintf("run 'chown root:root %s' as root", c.configFile), "%s must be owned by root", c.configFile)
+			return true
+		}
+		if err := apptainerconf.CheckDropInOwner(c.configFile, 0); err != nil {
+			c.add(name, CheckFail, "drop-in files must be owned by root", "%s", err)
+			return true
+		}
+		if !config.AllowSetuid {
+			c.add(name, CheckWarn, "set 'allow setuid = yes' or remove the setuid starter", "setuid starter installed but disabled by 'allow setuid = no'")
+			return true
+		}
+	}
+
+	dropIns, _ := apptainerconf.DropInFiles(c.configFile)
+	c.add(name, CheckPass, "", "%s parsed with %d drop-in file(s)", c.configFile, len(dropIns))
+	return true
+}
+
+// readSysctl returns the trimmed content of a sysctl file, an
+// empty string is returned if the file doesn't exist.
+func readSysctl(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (c *checker) checkUserNamespaces() {
+	const name = "user namespaces"
+
+	// user namespaces are optional for setuid installations
+	status := CheckFail
+	if c.suid || c.uid == 0 {
+		status = CheckWarn
+	}
+
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		c.add(name, status, "enable CONFIG_USER_NS in the kernel", "user namespaces are not supported by the kernel")
+		return
+	}
+	if readSysctl(checkPaths.maxUserNamespaces) == "0" {
+		c.add(name, status, fmt.Sprintf("set %s to a positive value, for example with 'sysctl -w user.max_user_namespaces=15000'", checkPaths.maxUserNamespaces), "user namespaces are disabled")
+		return
+	}
+	if readSysctl(checkPaths.unprivUsernsClone) == "0" {
+		c.add(name, status, fmt.Sprintf("set %s to 1, for example with 'sysctl -w kernel.unprivileged_userns_clone=1'", checkPaths.unprivUsernsClone), "unprivileged user namespaces are disabled")
+		return
+	}
+	c.add(name, CheckPass, "", "unprivileged user namespaces are enabled")
+}
+
+func (c *checker) checkIDMappings() {
+	const name = "fakeroot"
+
+	if c.uid == 0 {
+		c.add(name, CheckPass, "", "ID mappings are not required for root")
+		return
+	}
+
+	var errs []string
+	for _, file := range []string{fakeroot.SubUIDFile, fakeroot.SubGIDFile} {
+		if _, err := fakeroot.GetIDRange(file, uint32(c.uid)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, helper := range []string{"newuidmap", "newgidmap"} {
+		if _, err := bin.FindBin(helper); err != nil && !c.suid {
+			errs = append(errs, fmt.Sprintf("%s not found", helper))
+		}
+	}
+	if len(errs) == 0 {
+		c.add(name, CheckPass, "", "ID mappings are configured in %s and %s", fakeroot.SubUIDFile, fakeroot.SubGIDFile)
+		return
+	}
+
+	if _, err := bin.FindBin("fakeroot"); err == nil {
+		c.add(name, CheckWarn, "run 'apptainer config fakeroot --add <user>' as root and install newuidmap/newgidmap", "%s, --fakeroot will use the fakeroot command and a root-mapped user namespace", strings.Join(errs, ", "))
+		return
+	}
+	c.add(name, CheckWarn, "run 'apptainer config fakeroot --add <user>' as root and install newuidmap/newgidmap, or install the fakeroot command", "%s, --fakeroot will only map the root user", strings.Join(errs, ", "))
+}
+
+func (c *checker) checkFuse() {
+	const name = "fuse"
+
+	// FUSE mounts are only used by unprivileged installations
+	// and with --fusemount
+	status := CheckWarn
+	if c.suid || c.uid == 0 {
+		status = CheckPass
+	}
+
+	if _, err := os.Stat(checkPaths.fuseDevice); err != nil {
+		c.add(name, status, "load the fuse kernel module", "%s is missing, FUSE mounts are not available", checkPaths.fuseDevice)
+		return
+	}
+
+	if c.config.ImageDriver != "" && c.config.ImageDriver != "fuseapps" {
+		c.add(name, CheckPass, "", "image driver %s configured by 'image driver' directive", c.config.ImageDriver)
+		return
+	}
+
+	// probe the helpers as the fuseapps image driver does at runtime
+	features := driver.FuseappsFeatures()
+	var missing []string
+	if features&image.ImageFeature == 0 {
+		missing = append(missing, "squashfuse")
+	}
+	if features&image.OverlayFeature == 0 {
+		missing = append(missing, "fuse-overlayfs")
+	}
+	if len(missing) > 0 && status == CheckPass {
+		c.add(name, status, "", "%s not found, not required by privileged executions", strings.Join(missing, " and "))
+		return
+	} else if len(missing) > 0 {
+		c.add(name, status, "install "+strings.Join(missing, " and "), "%s not found, SIF images are extracted to temporary sandboxes and overlays require a recent kernel in unprivileged mode", strings.Join(missing, " and "))
+		return
+	}
+	c.add(name, CheckPass, "", "fuseapps image driver available with squashfuse and fuse-overlayfs")
+}
+
+// kernelAtLeast returns if the kernel release is at least major.minor.
+func kernelAtLeast(release string, major, minor int) bool {
+	fields := strings.FieldsFunc(release, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if len(fields) < 2 {
+		return false
+	}
+	maj, _ := strconv.Atoi(fields[0])
+	min, _ := strconv.Atoi(fields[1])
+	return maj > major || (maj == major && min >= minor)
+}
+
+func (c *checker) checkOverlay() {
+	const name = "overlay"
+
+	if c.config.EnableOverlay == "no" {
+		c.add(name, CheckPass, "", "overlay is disabled by 'enable overlay = no'")
+		return
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		c.add(name, CheckWarn, "", "could not determine kernel version: %s", err)
+		return
+	}
+	release := unix.ByteSliceToString(uts.Release[:])
+
+	if has, _ := proc.HasFilesystem("overlay"); !has {
+		c.add(name, CheckWarn, "load the overlay kernel module", "overlay filesystem is not available, it is loaded on first use by setuid installations")
+		return
+	}
+	if !c.suid && c.uid != 0 && !kernelAtLeast(release, 5, 11) {
+		if _, err := bin.FindBin("fuse-overlayfs"); err != nil {
+			c.add(name, CheckWarn, "install fuse-overlayfs or upgrade the kernel to 5.11 or later", "kernel %s doesn't support overlay in user namespaces", release)
+			return
+		}
+	}
+	c.add(name, CheckPass, "", "overlay filesystem is available with kernel %s", release)
+}
+
+// missingControllers returns the controllers not listed by the
+// cgroup.controllers file at path.
+func missingControllers(path string, controllers ...string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	available := strings.Fields(string(b))
+
+	var missing []string
+	for _, ctrl := range controllers {
+		found := false
+		for _, a := range available {
+			if a == ctrl {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, ctrl)
+		}
+	}
+	return missing, nil
+}
+
+func (c *checker) checkCgroups() {
+	const name = "cgroups"
+
+	version := "v1"
+	if lccgroups.IsCgroup2UnifiedMode() {
+		version = "v2"
+	} else if lccgroups.IsCgroup2HybridMode() {
+		version = "hybrid v1/v2"
+	}
+
+	if c.uid == 0 {
+		c.add(name, CheckPass, "", "cgroups %s, resource limits are available to root", version)
+		return
+	}
+
+	if err := cgroups.CheckRootless(c.config.SystemdCgroups); err != nil {
+		c.add(name, CheckWarn, "resource limits require cgroups v2, 'systemd cgroups = yes' and a systemd user session", "resource limits are not available to unprivileged users: %s", err)
+		return
+	}
+
+	path := filepath.Join(checkPaths.cgroupRoot, "user.slice", fmt.Sprintf("user-%d.slice", c.uid), fmt.Sprintf("user@%d.service", c.uid), "cgroup.controllers")
+	missing, err := missingControllers(path, "cpu", "cpuset", "io", "memory", "pids")
+	if err != nil {
+		c.add(name, CheckWarn, "check that a systemd user session is running", "could not read delegated controllers: %s", err)
+		return
+	} else if len(missing) > 0 {
+		c.add(name, CheckWarn, "set 'Delegate=yes' in a drop-in of the user@.service systemd unit", "controllers %s are not delegated to the user", strings.Join(missing, ", "))
+		return
+	}
+	c.add(name, CheckPass, "", "cgroups %s, controllers are delegated to the user", version)
+}
+
+func (c *checker) checkCNI() {
+	const name = "cni"
+
+	// same default paths as the runtime
+	confPath := c.config.CniConfPath
+	if confPath == "" {
+		confPath = filepath.Join(buildcfg.SYSCONFDIR, "apptainer", "network")
+	}
+	pluginPath := c.config.CniPluginPath
+	if pluginPath == "" {
+		pluginPath = filepath.Join(buildcfg.LIBEXECDIR, "apptainer", "cni")
+	}
+
+	confs, _ := filepath.Glob(filepath.Join(confPath, "*.conflist"))
+	if len(confs) == 0 {
+		c.add(name, CheckWarn, "set 'cni configuration path' in apptainer.conf", "no network configuration found in %s", confPath)
+		return
+	}
+	for _, plugin := range []string{"bridge", "host-local", "loopback"} {
+		if p := filepath.Join(pluginPath, plugin); !fs.IsExec(p) {
+			c.add(name, CheckWarn, "set 'cni plugin path' in apptainer.conf", "CNI plugin %s not found in %s", plugin, pluginPath)
+			return
+		}
+	}
+	c.add(name, CheckPass, "", "%d network configuration(s) found in %s", len(confs), confPath)
+}
+
+func (c *checker) checkHelpers() {
+	helpers := []struct {
+		name       string
+		configured string
+		purpose    string
+		required   bool
+	}{
+		{"mksquashfs", c.config.MksquashfsPath, "build SIF images", true},
+		{"unsquashfs", c.config.UnsquashfsPath, "extract lzo compressed images", false},
+		{"cryptsetup", c.config.CryptsetupPath, "run encrypted images", true},
+		{"ldconfig", c.config.LdconfigPath, "bind GPU libraries", true},
+		{"nvidia-container-cli", c.config.NvidiaContainerCliPath, "set up GPUs with --nvccli", c.config.UseNvCCLI},
+		{"go", c.config.GoPath, "compile plugins", false},
+	}
+
+	for _, h := range helpers {
+		path, err := bin.FindBin(h.name)
+		switch {
+		case err == nil:
+			c.add(h.name, CheckPass, "", "found at %s", path)
+		case h.configured != "":
+			c.add(h.name, CheckFail, fmt.Sprintf("fix the '%s path' directive in apptainer.conf", h.name), "configured path %s is not usable: %s", h.configured, err)
+		case h.required:
+			c.add(h.name, CheckWarn, "install "+h.name+" or set its path in apptainer.conf", "not found, required to %s", h.purpose)
+		default:
+			c.add(h.name, CheckPass, "", "not found, only required to %s", h.purpose)
+		}
+	}
+}
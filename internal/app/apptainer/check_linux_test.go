@@ -0,0 +1,148 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+)
+
+func TestKernelAtLeast(t *testing.T) {
+	tests := []struct {
+		release string
+		want    bool
+	}{
+		{"5.11.0-27-generic", true},
+		{"5.10.112", false},
+		{"6.1.0", true},
+		{"4.18.0-372.el8.x86_64", false},
+		{"invalid", false},
+	}
+	for _, tt := range tests {
+		if got := kernelAtLeast(tt.release, 5, 11); got != tt.want {
+			t.Errorf("kernelAtLeast(%q, 5, 11) = %v, want %v", tt.release, got, tt.want)
+		}
+	}
+}
+
+func TestMissingControllers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cgroup.controllers")
+	if err := ioutil.WriteFile(path, []byte("cpuset cpu io memory\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	missing, err := missingControllers(path, "cpu", "io", "memory", "pids")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(missing, []string{"pids"}) {
+		t.Errorf("unexpected missing controllers: %v", missing)
+	}
+
+	if _, err := missingControllers(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("unexpected success with missing file")
+	}
+}
+
+func TestCheckUserNamespaces(t *testing.T) {
+	defer func(maxUserNs, unprivClone string) {
+		checkPaths.maxUserNamespaces = maxUserNs
+		checkPaths.unprivUsernsClone = unprivClone
+	}(checkPaths.maxUserNamespaces, checkPaths.unprivUsernsClone)
+
+	dir := t.TempDir()
+	checkPaths.maxUserNamespaces = filepath.Join(dir, "max_user_namespaces")
+	checkPaths.unprivUsernsClone = filepath.Join(dir, "unprivileged_userns_clone")
+
+	tests := []struct {
+		name        string
+		maxUserNs   string
+		unprivClone string
+		suid        bool
+		want        CheckStatus
+	}{
+		{"Enabled", "15000", "", false, CheckPass},
+		{"MaxZero", "0", "", false, CheckFail},
+		{"MaxZeroSuid", "0", "", true, CheckWarn},
+		{"CloneDisabled", "15000", "0", false, CheckFail},
+		{"CloneEnabled", "15000", "1", false, CheckPass},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ioutil.WriteFile(checkPaths.maxUserNamespaces, []byte(tt.maxUserNs+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(checkPaths.unprivUsernsClone, []byte(tt.unprivClone+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := &checker{uid: 1000, suid: tt.suid}
+			c.checkUserNamespaces()
+			if len(c.results) != 1 {
+				t.Fatalf("unexpected number of results: %d", len(c.results))
+			}
+			if r := c.results[0]; r.Status != tt.want {
+				t.Errorf("unexpected status %s instead of %s: %s", r.Status, tt.want, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	defer func(capabilityFile string) {
+		checkPaths.capabilityFile = capabilityFile
+	}(checkPaths.capabilityFile)
+
+	checkPaths.capabilityFile = filepath.Join(t.TempDir(), "capability.json")
+
+	config, err := apptainerconf.Parse("")
+	if err != nil {
+		t.Fatalf("while getting default configuration: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		exists  bool
+		content string
+		uid     int
+		want    CheckStatus
+	}{
+		{"Unprivileged", false, "", 1000, CheckPass},
+		{"Missing", false, "", 0, CheckFail},
+		{"Empty", true, "", 0, CheckPass},
+		{"Granted", true, `{"users":{"root":["CAP_NET_RAW"]}}`, 0, CheckPass},
+		{"Invalid", true, "{", 0, CheckFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(checkPaths.capabilityFile)
+			if tt.exists {
+				if err := ioutil.WriteFile(checkPaths.capabilityFile, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := &checker{uid: tt.uid, config: config}
+			c.checkCapabilities()
+			if len(c.results) != 1 {
+				t.Fatalf("unexpected number of results: %d", len(c.results))
+			}
+			if r := c.results[0]; r.Status != tt.want {
+				t.Errorf("unexpected status %s instead of %s: %s", r.Status, tt.want, r.Message)
+			}
+		})
+	}
+}
@@ -15,7 +15,9 @@ import (
 	"io"
 	"os"
 	"strings"
+	"text/tabwriter"
 
+	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
 	"golang.org/x/sys/unix"
 )
@@ -32,6 +34,9 @@ const (
 	GlobalConfigGet
 	// GlobalConfigReset is the operation to reset a configuration directive value.
 	GlobalConfigReset
+	// GlobalConfigShowOrigin is the operation to show the effective value of
+	// configuration directives along with the file which set them.
+	GlobalConfigShowOrigin
 )
 
 func contains(slice []string, val string) bool {
@@ -79,23 +84,63 @@ func generateConfig(path string, directives apptainerconf.Directives, dry bool)
 	return nil
 }
 
+// showOrigin displays the effective value of the configuration directive,
+// or of all directives if empty, along with the file which set it.
+func showOrigin(configFile string, directive string) error {
+	settings, err := apptainerconf.ParseSettings(configFile)
+	if err != nil {
+		return fmt.Errorf("while parsing configuration file %s: %s", configFile, err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		if directive == "" || s.Directive == directive {
+			fmt.Fprintf(tw, "%s\t%s = %s\n", s.Origin, s.Directive, s.Value)
+		}
+	}
+	return tw.Flush()
+}
+
+// warnOverride warns if the value of the configuration directive
+// set in apptainer.conf is overridden by a drop-in file.
+func warnOverride(configFile string, directive string) {
+	settings, err := apptainerconf.ParseSettings(configFile)
+	if err != nil {
+		sylog.Warningf("While parsing configuration file %s: %s", configFile, err)
+		return
+	}
+	for _, s := range settings {
+		if s.Directive == directive && s.Origin != configFile && s.Origin != apptainerconf.OriginDefault {
+			sylog.Warningf("Directive %q is overridden by %s", directive, s.Origin)
+		}
+	}
+}
+
 // GlobalConfig allows to set/unset/reset a configuration directive value
 // in apptainer.conf
 func GlobalConfig(args []string, configFile string, dry bool, op GlobalConfigOp) error {
-	directive := args[0]
+	directive := ""
 	value := ""
 
-	if directive == "" {
-		return fmt.Errorf("you must specify a configuration directive")
+	if len(args) > 0 {
+		directive = args[0]
 	}
 	if len(args) > 1 {
 		value = args[1]
 	}
 
-	if !apptainerconf.HasDirective(directive) {
+	if directive == "" && op != GlobalConfigShowOrigin {
+		return fmt.Errorf("you must specify a configuration directive")
+	}
+
+	if directive != "" && !apptainerconf.HasDirective(directive) {
 		return fmt.Errorf("%q is not a valid configuration directive", directive)
 	}
 
+	if op == GlobalConfigShowOrigin {
+		return showOrigin(configFile, directive)
+	}
+
 	f, err := os.OpenFile(configFile, os.O_RDONLY, 0o644)
 	if err != nil {
 		return fmt.Errorf("while opening configuration file %s: %s", configFile, err)
@@ -158,5 +203,11 @@ func GlobalConfig(args []string, configFile string, dry bool, op GlobalConfigOp)
 		delete(directives, directive)
 	}
 
-	return generateConfig(configFile, directives, dry)
+	if err := generateConfig(configFile, directives, dry); err != nil {
+		return err
+	}
+	if !dry {
+		warnOverride(configFile, directive)
+	}
+	return nil
 }
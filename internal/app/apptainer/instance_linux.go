@@ -17,7 +17,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"strings"
 	"syscall"
 	"text/tabwriter"
@@ -25,19 +24,22 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
-	units "github.com/docker/go-units"
 	libcgroups "github.com/opencontainers/runc/libcontainer/cgroups"
 )
 
 type instanceInfo struct {
-	Instance   string `json:"instance"`
-	Pid        int    `json:"pid"`
-	Image      string `json:"img"`
-	IP         string `json:"ip"`
-	LogErrPath string `json:"logErrPath"`
-	LogOutPath string `json:"logOutPath"`
+	Instance   string   `json:"instance"`
+	Pid        int      `json:"pid"`
+	Image      string   `json:"img"`
+	IP         string   `json:"ip"`
+	Ports      []string `json:"ports,omitempty"`
+	Status     string   `json:"status"`
+	LogErrPath string   `json:"logErrPath"`
+	LogOutPath string   `json:"logOutPath"`
 }
 
 // PrintInstanceList fetches instance list, applying name and
@@ -73,13 +75,13 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	}
 
 	if !formatJSON {
-		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tIP\tIMAGE")
+		_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tPID\tSTATUS\tIP\tPORTS\tIMAGE")
 		if err != nil {
 			return fmt.Errorf("could not write list header: %v", err)
 		}
 
 		for _, i := range ii {
-			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\n", i.Name, i.Pid, i.IP, i.Image)
+			_, err = fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\t%s\t%s\n", i.Name, i.Pid, instanceStatus(i), i.IP, strings.Join(i.Ports, ","), i.Image)
 			if err != nil {
 				return fmt.Errorf("could not write instance info: %v", err)
 			}
@@ -93,6 +95,8 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 		instances[i].Pid = ii[i].Pid
 		instances[i].Instance = ii[i].Name
 		instances[i].IP = ii[i].IP
+		instances[i].Ports = ii[i].Ports
+		instances[i].Status = instanceStatus(ii[i])
 		instances[i].LogErrPath = ii[i].LogErrPath
 		instances[i].LogOutPath = ii[i].LogOutPath
 	}
@@ -109,6 +113,14 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	return nil
 }
 
+// instanceStatus returns the status of an instance displayed by instance list.
+func instanceStatus(i *instance.File) string {
+	if i.Paused {
+		return "paused"
+	}
+	return "running"
+}
+
 // WriteInstancePidFile fetches instance's PID and writes it to the pidFile,
 // truncating it if it already exists. Note that the name should not be a glob,
 // i.e. name should identify a single instance only, otherwise an error is returned.
@@ -180,27 +192,29 @@ func calculateMemoryUsage(stats *libcgroups.MemoryStats) (float64, float64, floa
 	return memUsage, memLimit, memPercent
 }
 
-// InstanceStats uses underlying cgroups to get statistics for a named instance
-func InstanceStats(name, instanceUser string, formatJSON bool) error {
+// UpdateInstance updates the cgroups resource limits of a named instance
+// with the JSON serialized LinuxResources in cgJSON. Limits not set in cgJSON
+// are left unchanged, the resulting limits are stored in the instance file.
+func UpdateInstance(name, instanceUser, cgJSON string) error {
 	ii, err := instanceListOrError(instanceUser, name)
 	if err != nil {
 		return err
 	}
-	// Instance stats required 1 instance
 	if len(ii) != 1 {
 		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
 	}
+	return updateInstance(ii[0], cgJSON)
+}
 
-	// Grab our instance to interact with!
-	i := ii[0]
-	if !formatJSON {
-		sylog.Infof("Stats for %s instance of %s (PID=%d)\n", i.Name, i.Image, i.Pid)
+// updateInstance updates the cgroups resource limits of the instance i.
+func updateInstance(i *instance.File, cgJSON string) error {
+	if !i.Cgroup {
+		return fmt.Errorf("instance %s was not started with resource limits", i.Name)
 	}
 
-	// Cut out early if we do not have cgroups
-	if !i.Cgroup {
-		url := "the Apptainer instance user guide for instructions"
-		return fmt.Errorf("stats are only available if cgroups are enabled, see %s", url)
+	resources, err := cgroups.UnmarshalJSONResources(cgJSON)
+	if err != nil {
+		return fmt.Errorf("while loading cgroups spec: %v", err)
 	}
 
 	// Get a cgroupfs managed cgroup from the pid
@@ -208,42 +222,69 @@ func InstanceStats(name, instanceUser string, formatJSON bool) error {
 	if err != nil {
 		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
 	}
-	stats, err := manager.GetStats()
-	if err != nil {
-		return fmt.Errorf("while getting stats for pid: %v", err)
+	if err := manager.UpdateFromSpec(resources); err != nil {
+		return fmt.Errorf("while updating cgroup limits: %v", err)
 	}
 
-	// Do we want json?
-	if formatJSON {
-		enc := json.NewEncoder(os.Stdout)
-		enc.SetIndent("", "\t")
-		err = enc.Encode(stats)
-		return err
-	}
+	sylog.Infof("Updated resource limits of %s instance of %s (PID=%d)", i.Name, i.Image, i.Pid)
 
-	// Otherwise print shortened table
-	tabWriter := tabwriter.NewWriter(os.Stdout, 0, 8, 4, ' ', 0)
-	defer tabWriter.Flush()
+	// record the new limits in the instance file, merged with the
+	// limits the instance was started with
+	engineConfig := apptainerConfig.NewConfig()
+	commonConfig := &config.Common{
+		EngineConfig: engineConfig,
+	}
+	if err := json.Unmarshal(i.Config, commonConfig); err != nil {
+		return fmt.Errorf("while reading instance configuration: %v", err)
+	}
+	merged, err := mergeJSON(engineConfig.GetCgroupsJSON(), cgJSON)
+	if err != nil {
+		return fmt.Errorf("while merging cgroups configuration: %v", err)
+	}
+	engineConfig.SetCgroupsJSON(merged)
 
-	// Stats can be added from this set:
-	// https://github.com/opencontainers/runc/blob/main/libcontainer/cgroups/stats.go
-	_, err = fmt.Fprintln(tabWriter, "INSTANCE NAME\tCPU USAGE\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tPIDS")
+	i.Config, err = json.Marshal(commonConfig)
 	if err != nil {
-		return fmt.Errorf("could not write stats header: %v", err)
+		return fmt.Errorf("while writing instance configuration: %v", err)
 	}
+	return i.Update()
+}
 
-	// CpuUsage denotes the usage of a CPU, aggregate since container inception.
-	// TODO CPU time needs to be a percentage
-	totalCPUTime := strconv.FormatUint(stats.CpuStats.CpuUsage.TotalUsage, 10) + " ns"
-	memUsage, memLimit, memPercent := calculateMemoryUsage(&stats.MemoryStats)
-	blockRead, blockWrite := calculateBlockIO(&stats.BlkioStats)
+// mergeJSON merges the JSON objects src into dst recursively, values
+// present in src replace those in dst. Null values in src are ignored as
+// they leave the corresponding limits unchanged.
+func mergeJSON(dst, src string) (string, error) {
+	d := make(map[string]interface{})
+	s := make(map[string]interface{})
 
-	// Generate a shortened stats list
-	_, err = fmt.Fprintf(tabWriter, "%s\t%s\t%s / %s\t%.2f%s\t%s / %s\t%d\n", i.Name, totalCPUTime, units.BytesSize(memUsage), units.BytesSize(memLimit), memPercent, "%", units.BytesSize(blockRead), units.BytesSize(blockWrite), stats.PidsStats.Current)
-	if err != nil {
-		return fmt.Errorf("could not write instance stats: %v", err)
+	if dst != "" {
+		if err := json.Unmarshal([]byte(dst), &d); err != nil {
+			return "", err
+		}
 	}
-	return nil
+	if err := json.Unmarshal([]byte(src), &s); err != nil {
+		return "", err
+	}
+
+	var merge func(dst, src map[string]interface{})
+	merge = func(dst, src map[string]interface{}) {
+		for k, v := range src {
+			if v == nil {
+				continue
+			}
+			sv, srcMap := v.(map[string]interface{})
+			dv, dstMap := dst[k].(map[string]interface{})
+			if srcMap && dstMap {
+				merge(dv, sv)
+				continue
+			}
+			dst[k] = v
+		}
+	}
+	merge(d, s)
+
+	b, err := json.Marshal(d)
+	return string(b), err
 }
 
 // StopInstance fetches instance list, applying name and
@@ -259,6 +300,12 @@ func StopInstance(name, user string, sig syscall.Signal, timeout time.Duration)
 	stopped := make([]int, 0)
 
 	for _, i := range ii {
+		// a paused instance couldn't handle the stop signal
+		if i.Paused {
+			if err := resumeInstance(i); err != nil {
+				sylog.Warningf("Could not resume %s instance before stopping it: %s", i.Name, err)
+			}
+		}
 		go killInstance(i, sig, stoppedPID)
 	}
 
@@ -303,3 +350,138 @@ func killInstance(i *instance.File, sig syscall.Signal, stoppedPID chan<- int) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+// PauseInstance suspends the processes of the named instances, by freezing
+// their cgroup or by sending SIGSTOP to their process tree if the instance
+// was started without cgroups.
+func PauseInstance(name, user string) error {
+	ii, err := instanceListOrError(user, name)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range ii {
+		if i.Paused {
+			sylog.Warningf("Instance %s is already paused", i.Name)
+			continue
+		}
+		sylog.Infof("Pausing %s instance of %s (PID=%d)", i.Name, i.Image, i.Pid)
+
+		// the state is saved first, an instance must never be left
+		// suspended without being reported as paused
+		i.Paused = true
+		if err := i.Update(); err != nil {
+			return fmt.Errorf("while updating instance file: %v", err)
+		}
+
+		if err := pauseInstance(i); err != nil {
+			// processes may have been partially suspended
+			if err := resumeInstance(i); err != nil {
+				sylog.Warningf("Could not resume instance %s: %v", i.Name, err)
+			}
+			i.Paused = false
+			if err := i.Update(); err != nil {
+				sylog.Warningf("Could not update instance file: %v", err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// pauseInstance freezes the cgroup of an instance or sends SIGSTOP to its
+// process tree if the instance was started without cgroups.
+func pauseInstance(i *instance.File) error {
+	if i.Cgroup {
+		manager, err := cgroups.GetManagerForPid(i.Pid)
+		if err != nil {
+			return fmt.Errorf("while getting cgroup manager for pid: %v", err)
+		}
+		if err := manager.Freeze(); err != nil {
+			return fmt.Errorf("while freezing instance %s: %v", i.Name, err)
+		}
+		return nil
+	}
+	if err := signalInstanceTree(i, syscall.SIGSTOP); err != nil {
+		return fmt.Errorf("while stopping processes of instance %s: %v", i.Name, err)
+	}
+	return nil
+}
+
+// ResumeInstance resumes the processes of the named paused instances.
+func ResumeInstance(name, user string) error {
+	ii, err := instanceListOrError(user, name)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range ii {
+		if !i.Paused {
+			sylog.Warningf("Instance %s is not paused", i.Name)
+			continue
+		}
+		sylog.Infof("Resuming %s instance of %s (PID=%d)", i.Name, i.Image, i.Pid)
+
+		if err := resumeInstance(i); err != nil {
+			return err
+		}
+
+		i.Paused = false
+		if err := i.Update(); err != nil {
+			return fmt.Errorf("while updating instance file: %v", err)
+		}
+	}
+	return nil
+}
+
+// resumeInstance thaws the cgroup of an instance or sends SIGCONT to its
+// process tree if the instance was started without cgroups.
+func resumeInstance(i *instance.File) error {
+	if i.Cgroup {
+		manager, err := cgroups.GetManagerForPid(i.Pid)
+		if err != nil {
+			return fmt.Errorf("while getting cgroup manager for pid: %v", err)
+		}
+		if err := manager.Thaw(); err != nil {
+			return fmt.Errorf("while thawing instance %s: %v", i.Name, err)
+		}
+		return nil
+	}
+	if err := signalInstanceTree(i, syscall.SIGCONT); err != nil {
+		return fmt.Errorf("while resuming processes of instance %s: %v", i.Name, err)
+	}
+	return nil
+}
+
+// signalInstanceTree sends a signal to the instance process and all its
+// descendants. With SIGSTOP the process tree is scanned again until no new
+// process shows up, as processes may fork while their parent is stopped.
+func signalInstanceTree(i *instance.File, sig syscall.Signal) error {
+	if err := syscall.Kill(i.Pid, sig); err != nil {
+		return err
+	}
+
+	signaled := make(map[int]bool)
+	for pass := 0; pass < 10; pass++ {
+		pids, err := proc.Descendants(i.Pid)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, pid := range pids {
+			if signaled[pid] {
+				continue
+			}
+			found = true
+			signaled[pid] = true
+			// process may have exited in the meantime
+			if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+				return err
+			}
+		}
+		if !found || sig != syscall.SIGSTOP {
+			break
+		}
+	}
+	return nil
+}
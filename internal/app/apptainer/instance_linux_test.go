@@ -0,0 +1,181 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/util/fs/proc"
+)
+
+// processState returns the state letter of a process from /proc/<pid>/stat.
+func processState(t *testing.T, pid int) string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the state follows the command name enclosed in parentheses
+	s := string(b)
+	return strings.Fields(s[strings.LastIndexByte(s, ')')+1:])[0]
+}
+
+func TestSignalInstanceTree(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		syscall.Kill(cmd.Process.Pid, syscall.SIGCONT)
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	var pids []int
+	for i := 0; i < 100 && len(pids) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pids, _ = proc.Descendants(cmd.Process.Pid)
+	}
+	if len(pids) == 0 {
+		t.Fatal("sleep process not started")
+	}
+	defer syscall.Kill(pids[0], syscall.SIGKILL)
+
+	i := &instance.File{Name: "test", Pid: cmd.Process.Pid}
+
+	if err := signalInstanceTree(i, syscall.SIGSTOP); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, pid := range []int{cmd.Process.Pid, pids[0]} {
+		// stopped state may take a moment to be reported
+		for n := 0; n < 100 && processState(t, pid) != "T"; n++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if s := processState(t, pid); s != "T" {
+			t.Errorf("process %d state is %s instead of stopped", pid, s)
+		}
+	}
+
+	if err := resumeInstance(i); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, pid := range []int{cmd.Process.Pid, pids[0]} {
+		for n := 0; n < 100 && processState(t, pid) == "T"; n++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if s := processState(t, pid); s == "T" {
+			t.Errorf("process %d still stopped after resume", pid)
+		}
+	}
+}
+
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		dst     string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "empty destination",
+			src:  `{"memory":{"limit":524288000}}`,
+			want: `{"memory":{"limit":524288000}}`,
+		},
+		{
+			name: "nested merge",
+			dst:  `{"memory":{"limit":524288000,"reservation":262144000},"pids":{"limit":10}}`,
+			src:  `{"memory":{"limit":1048576000},"cpu":{"shares":512}}`,
+			want: `{"cpu":{"shares":512},"memory":{"limit":1048576000,"reservation":262144000},"pids":{"limit":10}}`,
+		},
+		{
+			name: "zero override",
+			dst:  `{"memory":{"limit":524288000},"pids":{"limit":10}}`,
+			src:  `{"pids":{"limit":0}}`,
+			want: `{"memory":{"limit":524288000},"pids":{"limit":0}}`,
+		},
+		{
+			name: "null ignored",
+			dst:  `{"memory":{"limit":524288000},"pids":{"limit":10}}`,
+			src:  `{"memory":{"limit":null},"pids":null}`,
+			want: `{"memory":{"limit":524288000},"pids":{"limit":10}}`,
+		},
+		{
+			name: "object replaces value",
+			dst:  `{"cpu":0}`,
+			src:  `{"cpu":{"shares":512}}`,
+			want: `{"cpu":{"shares":512}}`,
+		},
+		{
+			name:    "bad destination",
+			dst:     `{"memory":`,
+			src:     `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad source",
+			src:     `[]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeJSON(tt.dst, tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, expected %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateInstance(t *testing.T) {
+	cgJSON := `{"memory":{"limit":524288000}}`
+
+	tests := []struct {
+		name   string
+		update func() error
+	}{
+		{
+			name: "unknown instance",
+			update: func() error {
+				return UpdateInstance("nonexistent-update-instance", "", cgJSON)
+			},
+		},
+		{
+			name: "instance without cgroups",
+			update: func() error {
+				return updateInstance(&instance.File{Name: "test", Pid: 1}, cgJSON)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.update(); err == nil {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
@@ -0,0 +1,512 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	units "github.com/docker/go-units"
+	"golang.org/x/term"
+)
+
+// InstanceStatsOptions holds the options of InstanceStats.
+type InstanceStatsOptions struct {
+	// User selects the instances of another user, root only.
+	User string
+	// JSON prints the raw cgroups statistics of a single instance.
+	JSON bool
+	// JSONLines prints one compact JSON object per instance and sample.
+	JSONLines bool
+	// Prometheus prints the statistics in the Prometheus text format.
+	Prometheus bool
+	// Watch refreshes the statistics every Interval until interrupted.
+	Watch    bool
+	Interval time.Duration
+	// Output is a file receiving the Prometheus metrics instead of
+	// the standard output, it is replaced at each interval.
+	Output string
+	// Listen is an address serving the Prometheus metrics over HTTP.
+	Listen string
+}
+
+// instanceNetStats holds the network counters of an instance, the
+// loopback interface is excluded.
+type instanceNetStats struct {
+	RxBytes   uint64 `json:"rxBytes"`
+	RxPackets uint64 `json:"rxPackets"`
+	TxBytes   uint64 `json:"txBytes"`
+	TxPackets uint64 `json:"txPackets"`
+}
+
+// instanceStats is a resource usage sample of an instance.
+type instanceStats struct {
+	Instance    string            `json:"instance"`
+	User        string            `json:"user"`
+	Pid         int               `json:"pid"`
+	Time        time.Time         `json:"time"`
+	CPUUsage    uint64            `json:"cpuUsageNs"`
+	CPUPercent  *float64          `json:"cpuPercent,omitempty"`
+	MemoryUsage uint64            `json:"memoryUsageBytes"`
+	MemoryLimit uint64            `json:"memoryLimitBytes"`
+	Pids        uint64            `json:"pids"`
+	BlockRead   uint64            `json:"blockReadBytes"`
+	BlockWrite  uint64            `json:"blockWriteBytes"`
+	Network     *instanceNetStats `json:"network,omitempty"`
+}
+
+// InstanceStats uses underlying cgroups to get statistics for the instances
+// matching name, the statistics are refreshed at each interval in watch mode
+// or served over HTTP in the Prometheus text format when a listen address is
+// provided.
+func InstanceStats(name string, opts InstanceStatsOptions) error {
+	formats := 0
+	for _, f := range []bool{opts.JSON, opts.JSONLines, opts.Prometheus} {
+		if f {
+			formats++
+		}
+	}
+	if formats > 1 {
+		return fmt.Errorf("only one of --json, --jsonl and --prometheus can be used")
+	}
+	if opts.JSON && opts.Watch {
+		return fmt.Errorf("--json can't be used with --watch, use --jsonl to stream statistics")
+	}
+	if (opts.Output != "" || opts.Listen != "") && !opts.Prometheus {
+		return fmt.Errorf("--output and --listen require --prometheus")
+	}
+	if opts.Watch && opts.Interval <= 0 {
+		return fmt.Errorf("watch interval must be greater than zero")
+	}
+
+	ii, err := instanceListOrError(opts.User, name)
+	if err != nil {
+		return err
+	}
+	if opts.JSON && len(ii) != 1 {
+		return fmt.Errorf("query returned more than one instance (%d)", len(ii))
+	}
+
+	// Cut out early if we do not have cgroups
+	if len(ii) == 1 && !ii[0].Cgroup {
+		url := "the Apptainer instance user guide for instructions"
+		return fmt.Errorf("stats are only available if cgroups are enabled, see %s", url)
+	}
+
+	if opts.JSON {
+		return printRawStats(ii[0])
+	}
+	if opts.Listen != "" {
+		return serveInstanceMetrics(opts.Listen, name, opts.User)
+	}
+
+	if len(ii) == 1 && !opts.Watch && formats == 0 {
+		sylog.Infof("Stats for %s instance of %s (PID=%d)\n", ii[0].Name, ii[0].Image, ii[0].Pid)
+	}
+
+	clearScreen := opts.Watch && formats == 0 && term.IsTerminal(int(os.Stdout.Fd()))
+
+	var ticker *time.Ticker
+	if opts.Watch {
+		ticker = time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+	}
+
+	var prev []*instanceStats
+	for {
+		samples := collectInstanceStats(name, opts.User, prev)
+		if len(samples) == 0 && !opts.Watch {
+			return fmt.Errorf("no instance with cgroups enabled found")
+		}
+
+		switch {
+		case opts.Output != "":
+			err = writeMetricsFile(opts.Output, samples)
+		case opts.Prometheus:
+			err = writeInstanceMetrics(os.Stdout, samples)
+		case opts.JSONLines:
+			err = writeStatsJSONLines(os.Stdout, samples)
+		default:
+			if clearScreen {
+				fmt.Print("\033[H\033[2J")
+			}
+			err = writeStatsTable(os.Stdout, samples)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !opts.Watch {
+			return nil
+		}
+		prev = samples
+		<-ticker.C
+	}
+}
+
+// printRawStats prints the cgroups statistics of an instance as indented JSON.
+func printRawStats(i *instance.File) error {
+	// Get a cgroupfs managed cgroup from the pid
+	manager, err := cgroups.GetManagerForPid(i.Pid)
+	if err != nil {
+		return fmt.Errorf("while getting cgroup manager for pid: %v", err)
+	}
+	stats, err := manager.GetStats()
+	if err != nil {
+		return fmt.Errorf("while getting stats for pid: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(stats)
+}
+
+// collectInstanceStats returns a sample for each running instance matching
+// name, CPU percentages are computed from the previous samples if any.
+// Instances without cgroups or stopped in the meantime are skipped.
+func collectInstanceStats(name, user string, prev []*instanceStats) []*instanceStats {
+	ii, err := instance.List(user, name, instance.AppSubDir)
+	if err != nil {
+		sylog.Warningf("Could not retrieve instance list: %v", err)
+		return nil
+	}
+
+	samples := make([]*instanceStats, 0, len(ii))
+	for _, i := range ii {
+		if !i.Cgroup {
+			sylog.Debugf("Skipping instance %s started without cgroups", i.Name)
+			continue
+		}
+		s, err := getInstanceStats(i)
+		if err != nil {
+			sylog.Debugf("Could not get stats for instance %s: %s", i.Name, err)
+			continue
+		}
+		for _, p := range prev {
+			if p.Instance == s.Instance && p.Pid == s.Pid {
+				s.CPUPercent = cpuPercent(p, s)
+				break
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// getInstanceStats returns a resource usage sample of an instance.
+func getInstanceStats(i *instance.File) (*instanceStats, error) {
+	// Get a cgroupfs managed cgroup from the pid
+	manager, err := cgroups.GetManagerForPid(i.Pid)
+	if err != nil {
+		return nil, fmt.Errorf("while getting cgroup manager for pid: %v", err)
+	}
+	stats, err := manager.GetStats()
+	if err != nil {
+		return nil, fmt.Errorf("while getting stats for pid: %v", err)
+	}
+
+	memUsage, memLimit, _ := calculateMemoryUsage(&stats.MemoryStats)
+	blockRead, blockWrite := calculateBlockIO(&stats.BlkioStats)
+
+	s := &instanceStats{
+		Instance:    i.Name,
+		User:        i.User,
+		Pid:         i.Pid,
+		Time:        time.Now(),
+		CPUUsage:    stats.CpuStats.CpuUsage.TotalUsage,
+		MemoryUsage: uint64(memUsage),
+		MemoryLimit: uint64(memLimit),
+		Pids:        stats.PidsStats.Current,
+		BlockRead:   uint64(blockRead),
+		BlockWrite:  uint64(blockWrite),
+	}
+
+	s.Network, err = getInstanceNetStats(i.Pid)
+	if err != nil {
+		sylog.Debugf("Could not get network stats for instance %s: %s", i.Name, err)
+	}
+	return s, nil
+}
+
+// cpuPercent returns the CPU usage between two samples as a percentage
+// of a single CPU.
+func cpuPercent(prev, cur *instanceStats) *float64 {
+	elapsed := cur.Time.Sub(prev.Time)
+	if elapsed <= 0 || cur.CPUUsage < prev.CPUUsage {
+		return nil
+	}
+	percent := float64(cur.CPUUsage-prev.CPUUsage) / float64(elapsed.Nanoseconds()) * 100.0
+	return &percent
+}
+
+// getInstanceNetStats returns the network counters of the instance process,
+// it returns nil if the instance doesn't run in its own network namespace.
+func getInstanceNetStats(pid int) (*instanceNetStats, error) {
+	self, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return nil, err
+	}
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return nil, err
+	}
+	if ns == self {
+		return nil, nil
+	}
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseNetDev(f)
+}
+
+// parseNetDev sums up the interface counters reported in the /proc/net/dev
+// format, the loopback interface is ignored.
+func parseNetDev(r io.Reader) (*instanceNetStats, error) {
+	stats := new(instanceNetStats)
+
+	scanner := bufio.NewScanner(r)
+	for line := 0; scanner.Scan(); line++ {
+		// skip the two header lines
+		if line < 2 {
+			continue
+		}
+		text := scanner.Text()
+		idx := strings.IndexByte(text, ':')
+		if idx < 0 {
+			return nil, fmt.Errorf("badly formatted line %q", text)
+		}
+		if strings.TrimSpace(text[:idx]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(text[idx+1:])
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("badly formatted line %q", text)
+		}
+
+		var counters [4]uint64
+		var err error
+		for n, f := range []string{fields[0], fields[1], fields[8], fields[9]} {
+			counters[n], err = strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("badly formatted counter %q: %s", f, err)
+			}
+		}
+		stats.RxBytes += counters[0]
+		stats.RxPackets += counters[1]
+		stats.TxBytes += counters[2]
+		stats.TxPackets += counters[3]
+	}
+	return stats, scanner.Err()
+}
+
+// writeStatsTable prints the samples as a table.
+func writeStatsTable(w io.Writer, samples []*instanceStats) error {
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer tabWriter.Flush()
+
+	// Stats can be added from this set:
+	// https://github.com/opencontainers/runc/blob/main/libcontainer/cgroups/stats.go
+	_, err := fmt.Fprintln(tabWriter, "INSTANCE NAME\tCPU USAGE\tCPU %\tMEM USAGE / LIMIT\tMEM %\tBLOCK I/O\tNET I/O\tPIDS")
+	if err != nil {
+		return fmt.Errorf("could not write stats header: %v", err)
+	}
+
+	for _, s := range samples {
+		cpu := "--"
+		if s.CPUPercent != nil {
+			cpu = fmt.Sprintf("%.2f%%", *s.CPUPercent)
+		}
+		memPercent := 0.0
+		if s.MemoryLimit != 0 {
+			memPercent = float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100.0
+		}
+		netIO := "--"
+		if s.Network != nil {
+			netIO = units.BytesSize(float64(s.Network.RxBytes)) + " / " + units.BytesSize(float64(s.Network.TxBytes))
+		}
+
+		_, err = fmt.Fprintf(tabWriter, "%s\t%d ns\t%s\t%s / %s\t%.2f%%\t%s / %s\t%s\t%d\n",
+			s.Instance, s.CPUUsage, cpu,
+			units.BytesSize(float64(s.MemoryUsage)), units.BytesSize(float64(s.MemoryLimit)), memPercent,
+			units.BytesSize(float64(s.BlockRead)), units.BytesSize(float64(s.BlockWrite)),
+			netIO, s.Pids,
+		)
+		if err != nil {
+			return fmt.Errorf("could not write instance stats: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeStatsJSONLines prints a compact JSON object per sample.
+func writeStatsJSONLines(w io.Writer, samples []*instanceStats) error {
+	enc := json.NewEncoder(w)
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			return fmt.Errorf("could not write instance stats: %v", err)
+		}
+	}
+	return nil
+}
+
+// instanceMetrics are the metrics exported in the Prometheus text format,
+// value returns false when the metric isn't available for a sample.
+var instanceMetrics = []struct {
+	name  string
+	help  string
+	kind  string
+	value func(*instanceStats) (float64, bool)
+}{
+	{
+		"apptainer_instance_cpu_usage_seconds_total", "Total CPU time consumed by the instance.", "counter",
+		func(s *instanceStats) (float64, bool) { return float64(s.CPUUsage) / 1e9, true },
+	},
+	{
+		"apptainer_instance_memory_usage_bytes", "Memory used by the instance.", "gauge",
+		func(s *instanceStats) (float64, bool) { return float64(s.MemoryUsage), true },
+	},
+	{
+		"apptainer_instance_memory_limit_bytes", "Memory available to the instance.", "gauge",
+		func(s *instanceStats) (float64, bool) { return float64(s.MemoryLimit), true },
+	},
+	{
+		"apptainer_instance_pids", "Number of processes in the instance.", "gauge",
+		func(s *instanceStats) (float64, bool) { return float64(s.Pids), true },
+	},
+	{
+		"apptainer_instance_block_read_bytes_total", "Bytes read from block devices by the instance.", "counter",
+		func(s *instanceStats) (float64, bool) { return float64(s.BlockRead), true },
+	},
+	{
+		"apptainer_instance_block_write_bytes_total", "Bytes written to block devices by the instance.", "counter",
+		func(s *instanceStats) (float64, bool) { return float64(s.BlockWrite), true },
+	},
+	{
+		"apptainer_instance_network_receive_bytes_total", "Bytes received by the instance network interfaces.", "counter",
+		func(s *instanceStats) (float64, bool) {
+			if s.Network == nil {
+				return 0, false
+			}
+			return float64(s.Network.RxBytes), true
+		},
+	},
+	{
+		"apptainer_instance_network_receive_packets_total", "Packets received by the instance network interfaces.", "counter",
+		func(s *instanceStats) (float64, bool) {
+			if s.Network == nil {
+				return 0, false
+			}
+			return float64(s.Network.RxPackets), true
+		},
+	},
+	{
+		"apptainer_instance_network_transmit_bytes_total", "Bytes transmitted by the instance network interfaces.", "counter",
+		func(s *instanceStats) (float64, bool) {
+			if s.Network == nil {
+				return 0, false
+			}
+			return float64(s.Network.TxBytes), true
+		},
+	},
+	{
+		"apptainer_instance_network_transmit_packets_total", "Packets transmitted by the instance network interfaces.", "counter",
+		func(s *instanceStats) (float64, bool) {
+			if s.Network == nil {
+				return 0, false
+			}
+			return float64(s.Network.TxPackets), true
+		},
+	},
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeInstanceMetrics prints the samples in the Prometheus text format.
+func writeInstanceMetrics(w io.Writer, samples []*instanceStats) error {
+	b := new(bytes.Buffer)
+
+	for _, m := range instanceMetrics {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range samples {
+			v, ok := m.value(s)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(b, "%s{instance=\"%s\",user=\"%s\"} %s\n",
+				m.name, labelEscaper.Replace(s.Instance), labelEscaper.Replace(s.User),
+				strconv.FormatFloat(v, 'f', -1, 64),
+			)
+		}
+	}
+
+	if _, err := b.WriteTo(w); err != nil {
+		return fmt.Errorf("could not write instance metrics: %v", err)
+	}
+	return nil
+}
+
+// writeMetricsFile replaces path with the samples in the Prometheus text
+// format, the file is renamed into place so collectors never read it
+// partially written.
+func writeMetricsFile(path string, samples []*instanceStats) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("could not create metrics file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := writeInstanceMetrics(f, samples); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return fmt.Errorf("could not set metrics file permissions: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write metrics file: %v", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not replace metrics file: %v", err)
+	}
+	return nil
+}
+
+// serveInstanceMetrics serves the statistics of the instances matching
+// name in the Prometheus text format on /metrics.
+func serveInstanceMetrics(addr, name, user string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := writeInstanceMetrics(w, collectInstanceStats(name, user, nil)); err != nil {
+			sylog.Warningf("%s", err)
+		}
+	})
+
+	sylog.Infof("Serving instance metrics on http://%s/metrics", addr)
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0:    2048      20    0    0    0     0          0         0     4096      40    0    0    0     0       0          0
+  eth1:     100       1    0    0    0     0          0         0      200       2    0    0    0     0       0          0
+`
+
+func TestParseNetDev(t *testing.T) {
+	stats, err := parseNetDev(strings.NewReader(testNetDev))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := &instanceNetStats{RxBytes: 2148, RxPackets: 21, TxBytes: 4296, TxPackets: 42}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("unexpected stats %+v instead of %+v", stats, want)
+	}
+
+	bad := strings.Join(strings.Split(testNetDev, "\n")[:2], "\n") + "\n  eth0: 1 2 3\n"
+	if _, err := parseNetDev(strings.NewReader(bad)); err == nil {
+		t.Errorf("unexpected success with truncated counters")
+	}
+}
+
+func TestCPUPercent(t *testing.T) {
+	now := time.Now()
+	prev := &instanceStats{Time: now, CPUUsage: 1e9}
+
+	cur := &instanceStats{Time: now.Add(2 * time.Second), CPUUsage: 2e9}
+	if p := cpuPercent(prev, cur); p == nil || *p != 50 {
+		t.Errorf("unexpected CPU percentage %v", p)
+	}
+
+	// counters reset when the instance is restarted
+	cur = &instanceStats{Time: now.Add(2 * time.Second), CPUUsage: 1}
+	if p := cpuPercent(prev, cur); p != nil {
+		t.Errorf("unexpected CPU percentage %v", *p)
+	}
+}
+
+func TestWriteInstanceMetrics(t *testing.T) {
+	samples := []*instanceStats{
+		{Instance: "web", User: "alice", CPUUsage: 1500000000, MemoryUsage: 4096, Pids: 3},
+		{Instance: `my"db`, User: "alice", Network: &instanceNetStats{RxBytes: 10, TxBytes: 20}},
+	}
+
+	b := new(bytes.Buffer)
+	if err := writeInstanceMetrics(b, samples); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE apptainer_instance_cpu_usage_seconds_total counter\n",
+		`apptainer_instance_cpu_usage_seconds_total{instance="web",user="alice"} 1.5` + "\n",
+		`apptainer_instance_memory_usage_bytes{instance="web",user="alice"} 4096` + "\n",
+		`apptainer_instance_pids{instance="web",user="alice"} 3` + "\n",
+		`apptainer_instance_network_transmit_bytes_total{instance="my\"db",user="alice"} 20` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metric %q not found in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `apptainer_instance_network_receive_bytes_total{instance="web"`) {
+		t.Errorf("unexpected network metric for instance without network namespace")
+	}
+
+	path := filepath.Join(t.TempDir(), "apptainer.prom")
+	if err := writeMetricsFile(path, samples); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(content) != out {
+		t.Errorf("unexpected metrics file content:\n%s", content)
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	if len(files) != 1 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/network"
+	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+)
+
+// reservedNetworks are network names with a special meaning for --network.
+var reservedNetworks = []string{"none", "fakeroot", network.UserModeNetwork}
+
+// cniNetworks returns the names of the CNI networks configured by the
+// administrator.
+func cniNetworks(config *apptainerconf.File) []string {
+	// same default path as the runtime
+	confPath := config.CniConfPath
+	if confPath == "" {
+		confPath = filepath.Join(buildcfg.SYSCONFDIR, "apptainer", "network")
+	}
+
+	confs, err := network.GetAllNetworkConfigList(&network.CNIPath{Conf: confPath})
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(confs))
+	for _, c := range confs {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// NetworkCreate creates a bridge network for the current user, the subnet
+// is allocated from the user network pool when not specified.
+func NetworkCreate(name, subnet string) error {
+	config := apptainerconf.GetCurrentConfig()
+	if config == nil {
+		return fmt.Errorf("apptainer configuration not loaded")
+	}
+	if err := network.CheckNamedNetworkName(name); err != nil {
+		return err
+	}
+	for _, n := range append(reservedNetworks, cniNetworks(config)...) {
+		if n == name {
+			return fmt.Errorf("network name %s is reserved or used by an administrator network", name)
+		}
+	}
+
+	dir := syfs.NetworkDir()
+	if _, err := network.LoadNamedNetwork(dir, name); err == nil {
+		return fmt.Errorf("network %s already exists", name)
+	} else if !errors.Is(err, network.ErrNoNamedNetwork) {
+		return err
+	}
+
+	networks, err := network.LoadNamedNetworks(dir)
+	if err != nil {
+		return err
+	}
+	used := make([]string, 0, len(networks))
+	for _, n := range networks {
+		used = append(used, n.Subnet)
+	}
+
+	if subnet == "" {
+		subnet, err = network.AllocateSubnet(config.UserNetworkPool, used)
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := network.CheckSubnet(subnet, config.UserNetworkPool, ""); err != nil {
+			return err
+		}
+		if network.SubnetsOverlap(subnet, used) {
+			return fmt.Errorf("subnet %s overlaps with another network", subnet)
+		}
+	}
+
+	return network.SaveNamedNetwork(dir, &network.NamedNetwork{Name: name, Subnet: subnet})
+}
+
+// runningInstances returns the names of the running instances of the
+// current user attached to the network with the specified hosts file.
+func runningInstances(hostsFile string) ([]string, error) {
+	entries, err := network.HostsEntries(hostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		files, err := instance.List("", e.Name, instance.AppSubDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			names = append(names, e.Name)
+		}
+	}
+	return names, nil
+}
+
+// NetworkList prints the networks created by the current user along with
+// the running instances attached to them.
+func NetworkList(w io.Writer) error {
+	dir := syfs.NetworkDir()
+	networks, err := network.LoadNamedNetworks(dir)
+	if err != nil {
+		return fmt.Errorf("could not retrieve network list: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer tw.Flush()
+
+	if _, err := fmt.Fprintln(tw, "NAME\tSUBNET\tBRIDGE\tINSTANCES"); err != nil {
+		return fmt.Errorf("could not write list header: %v", err)
+	}
+	for _, n := range networks {
+		instances, err := runningInstances(network.NamedNetworkHostsFile(dir, n.Name))
+		if err != nil {
+			return fmt.Errorf("could not retrieve instances of network %s: %v", n.Name, err)
+		}
+		_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", n.Name, n.Subnet, n.Bridge(os.Getuid()), strings.Join(instances, ","))
+		if err != nil {
+			return fmt.Errorf("could not write network info: %v", err)
+		}
+	}
+	return nil
+}
+
+// NetworkDelete deletes a network created by the current user, it fails
+// if running instances are attached to it.
+func NetworkDelete(name string) error {
+	dir := syfs.NetworkDir()
+	if _, err := network.LoadNamedNetwork(dir, name); err != nil {
+		return err
+	}
+
+	instances, err := runningInstances(network.NamedNetworkHostsFile(dir, name))
+	if err != nil {
+		return err
+	}
+	if len(instances) > 0 {
+		return fmt.Errorf("network %s is used by instance(s) %s", name, strings.Join(instances, ", "))
+	}
+
+	return network.DeleteNamedNetwork(dir, name)
+}
@@ -14,6 +14,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -247,24 +248,30 @@ func makeSIF(sourceDir, sifPath string) error {
 	}
 	defer fp.Close()
 
-	plObjInput, err := sif.NewDescriptorInput(sif.DataPartition, fp,
-		sif.OptObjectName("plugin.so"),
-		sif.OptPartitionMetadata(sif.FsRaw, sif.PartData, runtime.GOARCH),
-	)
-	if err != nil {
-		return err
-	}
-
 	// create plugin manifest descriptor
 	manifestPath := pluginManifestPath(sourceDir)
 
-	fp, err = os.Open(manifestPath)
+	mp, err := os.Open(manifestPath)
 	if err != nil {
 		return fmt.Errorf("while opening plugin manifest file %v: %w", manifestPath, err)
 	}
-	defer fp.Close()
+	defer mp.Close()
+
+	return createPluginSIF(fp, "plugin.so", mp, sifPath)
+}
+
+// createPluginSIF creates the plugin SIF file at sifPath with the plugin
+// object obj named objName and the plugin manifest.
+func createPluginSIF(obj io.Reader, objName string, manifest io.Reader, sifPath string) error {
+	plObjInput, err := sif.NewDescriptorInput(sif.DataPartition, obj,
+		sif.OptObjectName(objName),
+		sif.OptPartitionMetadata(sif.FsRaw, sif.PartData, runtime.GOARCH),
+	)
+	if err != nil {
+		return err
+	}
 
-	plManifestInput, err := sif.NewDescriptorInput(sif.DataGenericJSON, fp,
+	plManifestInput, err := sif.NewDescriptorInput(sif.DataGenericJSON, manifest,
 		sif.OptObjectName("plugin.manifest"),
 	)
 	if err != nil {
@@ -0,0 +1,56 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// PackagePlugin packs the executable plugin located at path into the
+// plugin SIF file destSif. The plugin manifest is obtained from the
+// plugin during the protocol handshake.
+func PackagePlugin(path, destSif string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("while getting absolute path of %q: %w", path, err)
+	}
+
+	manifest, err := plugin.ExecutableManifest(path)
+	if err != nil {
+		return fmt.Errorf("while getting plugin manifest: %s", err)
+	} else if manifest.Name == "" {
+		return fmt.Errorf("empty plugin name in manifest")
+	}
+
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(manifest); err != nil {
+		return fmt.Errorf("while encoding plugin manifest: %s", err)
+	}
+
+	fp, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("while opening plugin executable %v: %w", path, err)
+	}
+	defer fp.Close()
+
+	if err := createPluginSIF(fp, "plugin.exec", &b, destSif); err != nil {
+		return fmt.Errorf("while making sif file: %s", err)
+	}
+
+	sylog.Infof("Plugin %s packaged to: %s", manifest.Name, destSif)
+
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package apptainer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+)
+
+// Transports the policy applies to.
+const (
+	// PolicyTransportLibrary applies to library:// images, scopes are
+	// <host>/<entity>/<collection>/<container>[:<tag>] prefixes.
+	PolicyTransportLibrary = "library"
+	// PolicyTransportOras applies to oras:// images, scopes are
+	// <registry>/<repository>[:<tag>] prefixes.
+	PolicyTransportOras = "oras"
+	// PolicyTransportDocker applies to docker:// images, scopes are
+	// <registry>/<repository>[:<tag>] prefixes.
+	PolicyTransportDocker = "docker"
+)
+
+// Policy requirement types.
+const (
+	// PolicyInsecureAcceptAnything accepts any image.
+	PolicyInsecureAcceptAnything = "insecureAcceptAnything"
+	// PolicyReject rejects any image.
+	PolicyReject = "reject"
+	// PolicySignedBy accepts images signed by the given keys.
+	PolicySignedBy = "signedBy"
+)
+
+// PolicyRequirement is a requirement images must satisfy.
+type PolicyRequirement struct {
+	Type string `json:"type"`
+	// Fingerprints lists the fingerprints of the keys which must all have
+	// signed the image, the keys are looked up in the public keyrings.
+	Fingerprints []string `json:"fingerprints,omitempty"`
+	// KeyPath is the path of a public keyring, the image must be signed
+	// with keys from this keyring.
+	KeyPath string `json:"keyPath,omitempty"`
+}
+
+// Policy maps image sources to the requirements images pulled from them
+// must satisfy, the format follows the containers policy.json format.
+type Policy struct {
+	// Default holds the requirements applying to images not matching
+	// any transport scope.
+	Default []PolicyRequirement `json:"default"`
+	// Transports maps transports to scopes and their requirements, the
+	// empty scope applies to all images of the transport.
+	Transports map[string]map[string][]PolicyRequirement `json:"transports,omitempty"`
+}
+
+// PolicyRule holds the requirements applying to an image.
+type PolicyRule struct {
+	// Name identifies the rule in error messages.
+	Name         string
+	Requirements []PolicyRequirement
+}
+
+// PolicyPath returns the path of the pull policy file.
+func PolicyPath() string {
+	return filepath.Join(buildcfg.APPTAINER_CONFDIR, "policy.json")
+}
+
+// LoadPolicy reads and validates the policy file at path, a nil policy
+// is returned if the file doesn't exist.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading policy: %s", err)
+	}
+
+	p := new(Policy)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("while parsing policy %s: %s", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %s", path, err)
+	}
+	return p, nil
+}
+
+// validate checks the policy transports and requirements.
+func (p *Policy) validate() error {
+	if len(p.Default) == 0 {
+		return fmt.Errorf("no default requirement")
+	}
+	if err := validateRequirements(p.Default); err != nil {
+		return fmt.Errorf("default: %s", err)
+	}
+	for transport, scopes := range p.Transports {
+		switch transport {
+		case PolicyTransportLibrary, PolicyTransportOras, PolicyTransportDocker:
+		default:
+			return fmt.Errorf("unsupported transport %q", transport)
+		}
+		for scope, reqs := range scopes {
+			if len(reqs) == 0 {
+				return fmt.Errorf("%s: no requirement", ruleName(transport, scope))
+			}
+			if err := validateRequirements(reqs); err != nil {
+				return fmt.Errorf("%s: %s", ruleName(transport, scope), err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRequirements(reqs []PolicyRequirement) error {
+	for _, r := range reqs {
+		switch r.Type {
+		case PolicyInsecureAcceptAnything, PolicyReject:
+			if len(r.Fingerprints) > 0 || r.KeyPath != "" {
+				return fmt.Errorf("%s requirement doesn't accept keys", r.Type)
+			}
+		case PolicySignedBy:
+			if len(r.Fingerprints) == 0 && r.KeyPath == "" {
+				return fmt.Errorf("%s requirement without fingerprints nor keyPath", r.Type)
+			}
+			if r.KeyPath != "" && !filepath.IsAbs(r.KeyPath) {
+				return fmt.Errorf("keyPath %s is not an absolute path", r.KeyPath)
+			}
+			for _, fp := range r.Fingerprints {
+				if b, err := hex.DecodeString(fp); err != nil || len(b) != 20 {
+					return fmt.Errorf("invalid fingerprint %q", fp)
+				}
+			}
+		default:
+			return fmt.Errorf("unknown requirement type %q", r.Type)
+		}
+	}
+	return nil
+}
+
+// ruleName returns the name of a transport scope rule.
+func ruleName(transport, scope string) string {
+	if scope == "" {
+		return fmt.Sprintf("transports.%s default", transport)
+	}
+	return fmt.Sprintf("transports.%s[%q]", transport, scope)
+}
+
+// policyScopes returns the scopes matching ref, from the most to the least
+// specific: the complete reference, the reference without its tag or digest,
+// then each parent path.
+func policyScopes(ref string) []string {
+	scopes := []string{ref}
+
+	name := ref
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[:i]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	if name != ref {
+		scopes = append(scopes, name)
+	}
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name, "/") {
+		name = name[:i]
+		scopes = append(scopes, name)
+	}
+	return scopes
+}
+
+// Rule returns the rule applying to the image ref pulled through transport,
+// ref has the form <host>/<path>[:<tag>|@<digest>]. The most specific scope
+// matching ref applies, or the transport default scope, or the policy
+// default requirements.
+func (p *Policy) Rule(transport, ref string) PolicyRule {
+	scopes := p.Transports[transport]
+	for _, s := range policyScopes(ref) {
+		if reqs, ok := scopes[s]; ok {
+			return PolicyRule{Name: ruleName(transport, s), Requirements: reqs}
+		}
+	}
+	if reqs, ok := scopes[""]; ok {
+		return PolicyRule{Name: ruleName(transport, ""), Requirements: reqs}
+	}
+	return PolicyRule{Name: "default", Requirements: p.Default}
+}
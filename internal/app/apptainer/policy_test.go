@@ -0,0 +1,348 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package apptainer
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/apptainer/container-key-client/client"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name            string
+		policy          string
+		expectedSuccess bool
+		expectedNil     bool
+	}{
+		{
+			name:            "NoPolicy",
+			expectedSuccess: true,
+			expectedNil:     true,
+		},
+		{
+			name:            "Default",
+			policy:          `{"default": [{"type": "insecureAcceptAnything"}]}`,
+			expectedSuccess: true,
+		},
+		{
+			name: "Transports",
+			policy: `{
+				"default": [{"type": "reject"}],
+				"transports": {
+					"library": {
+						"": [{"type": "signedBy", "fingerprints": ["` + testFingerPrint + `"]}],
+						"library.example.com/entity": [{"type": "insecureAcceptAnything"}]
+					},
+					"oras": {"registry.example.com/repo": [{"type": "signedBy", "keyPath": "/etc/keys.asc"}]},
+					"docker": {"docker.io": [{"type": "insecureAcceptAnything"}]}
+				}
+			}`,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Malformed",
+			policy:          `{"default": [`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "NoDefault",
+			policy:          `{"transports": {"library": {"": [{"type": "reject"}]}}}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "UnknownTransport",
+			policy:          `{"default": [{"type": "reject"}], "transports": {"shub": {"": [{"type": "reject"}]}}}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "UnknownType",
+			policy:          `{"default": [{"type": "signedByAnyone"}]}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "EmptyScope",
+			policy:          `{"default": [{"type": "reject"}], "transports": {"library": {"": []}}}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "SignedByNoKey",
+			policy:          `{"default": [{"type": "signedBy"}]}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "InvalidFingerprint",
+			policy:          `{"default": [{"type": "signedBy", "fingerprints": ["ABCD"]}]}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "RelativeKeyPath",
+			policy:          `{"default": [{"type": "signedBy", "keyPath": "keys.asc"}]}`,
+			expectedSuccess: false,
+		},
+		{
+			name:            "RejectWithKey",
+			policy:          `{"default": [{"type": "reject", "keyPath": "/etc/keys.asc"}]}`,
+			expectedSuccess: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if tt.policy != "" {
+				if err := os.WriteFile(path, []byte(tt.policy), 0o644); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			p, err := LoadPolicy(path)
+			if (err == nil) != tt.expectedSuccess {
+				t.Fatalf("got error %v, expected success %v", err, tt.expectedSuccess)
+			}
+			if err == nil && (p == nil) != tt.expectedNil {
+				t.Errorf("got policy %v, expected nil policy %v", p, tt.expectedNil)
+			}
+		})
+	}
+}
+
+func TestPolicyRule(t *testing.T) {
+	reject := []PolicyRequirement{{Type: PolicyReject}}
+	accept := []PolicyRequirement{{Type: PolicyInsecureAcceptAnything}}
+	signed := []PolicyRequirement{{Type: PolicySignedBy, Fingerprints: []string{testFingerPrint}}}
+
+	p := &Policy{
+		Default: reject,
+		Transports: map[string]map[string][]PolicyRequirement{
+			PolicyTransportLibrary: {
+				"":                                      signed,
+				"library.example.com/entity":            accept,
+				"library.example.com/entity/collection": reject,
+			},
+			PolicyTransportDocker: {
+				"docker.io/library/alpine":        accept,
+				"docker.io/library/alpine:latest": signed,
+				"registry.example.com:5000":       signed,
+			},
+		},
+	}
+
+	tests := []struct {
+		transport    string
+		ref          string
+		expectedName string
+		expectedReqs []PolicyRequirement
+	}{
+		{
+			transport:    PolicyTransportLibrary,
+			ref:          "library.example.com/entity/collection/container:latest",
+			expectedName: `transports.library["library.example.com/entity/collection"]`,
+			expectedReqs: reject,
+		},
+		{
+			transport:    PolicyTransportLibrary,
+			ref:          "library.example.com/entity/other/container:latest",
+			expectedName: `transports.library["library.example.com/entity"]`,
+			expectedReqs: accept,
+		},
+		{
+			transport:    PolicyTransportLibrary,
+			ref:          "library.example.com/entity2/collection/container:latest",
+			expectedName: "transports.library default",
+			expectedReqs: signed,
+		},
+		{
+			transport:    PolicyTransportDocker,
+			ref:          "docker.io/library/alpine:latest",
+			expectedName: `transports.docker["docker.io/library/alpine:latest"]`,
+			expectedReqs: signed,
+		},
+		{
+			transport:    PolicyTransportDocker,
+			ref:          "docker.io/library/alpine:3.15",
+			expectedName: `transports.docker["docker.io/library/alpine"]`,
+			expectedReqs: accept,
+		},
+		{
+			transport:    PolicyTransportDocker,
+			ref:          "registry.example.com:5000/ns/image",
+			expectedName: `transports.docker["registry.example.com:5000"]`,
+			expectedReqs: signed,
+		},
+		{
+			transport:    PolicyTransportDocker,
+			ref:          "registry.example.com/ns/image",
+			expectedName: "default",
+			expectedReqs: reject,
+		},
+		{
+			transport:    PolicyTransportOras,
+			ref:          "registry.example.com/repo:tag",
+			expectedName: "default",
+			expectedReqs: reject,
+		},
+	}
+
+	for _, tt := range tests {
+		rule := p.Rule(tt.transport, tt.ref)
+		if rule.Name != tt.expectedName {
+			t.Errorf("%s %s: got rule %s, expected %s", tt.transport, tt.ref, rule.Name, tt.expectedName)
+		}
+		if !reflect.DeepEqual(rule.Requirements, tt.expectedReqs) {
+			t.Errorf("%s %s: got requirements %v, expected %v", tt.transport, tt.ref, rule.Requirements, tt.expectedReqs)
+		}
+	}
+}
+
+// writePublicKey writes the armored public key of e to path.
+func writePublicKey(t *testing.T, path string, e *openpgp.Entity) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	// Start up a mock HKP server.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	// Create an option that points to the mock HKP server.
+	keyServerOpt := OptVerifyUseKeyServer(client.OptBaseURL(s.URL))
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.asc")
+	writePublicKey(t, keyPath, e)
+
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeyPath := filepath.Join(dir, "other.asc")
+	writePublicKey(t, otherKeyPath, other)
+
+	signed := filepath.Join("testdata", "images", "one-group-signed.sif")
+	unsigned := filepath.Join("testdata", "images", "one-group.sif")
+
+	tests := []struct {
+		name    string
+		path    string
+		reqs    []PolicyRequirement
+		wantErr bool
+	}{
+		{
+			name: "InsecureAcceptAnything",
+			path: unsigned,
+			reqs: []PolicyRequirement{{Type: PolicyInsecureAcceptAnything}},
+		},
+		{
+			name:    "Reject",
+			path:    signed,
+			reqs:    []PolicyRequirement{{Type: PolicyReject}},
+			wantErr: true,
+		},
+		{
+			name: "Fingerprints",
+			path: signed,
+			reqs: []PolicyRequirement{{Type: PolicySignedBy, Fingerprints: []string{testFingerPrint}}},
+		},
+		{
+			name:    "FingerprintsMismatch",
+			path:    signed,
+			reqs:    []PolicyRequirement{{Type: PolicySignedBy, Fingerprints: []string{invalidFingerPrint}}},
+			wantErr: true,
+		},
+		{
+			name:    "FingerprintsUnsigned",
+			path:    unsigned,
+			reqs:    []PolicyRequirement{{Type: PolicySignedBy, Fingerprints: []string{testFingerPrint}}},
+			wantErr: true,
+		},
+		{
+			name: "KeyPath",
+			path: signed,
+			reqs: []PolicyRequirement{{Type: PolicySignedBy, KeyPath: keyPath}},
+		},
+		{
+			name:    "KeyPathMismatch",
+			path:    signed,
+			reqs:    []PolicyRequirement{{Type: PolicySignedBy, KeyPath: otherKeyPath}},
+			wantErr: true,
+		},
+		{
+			name:    "KeyPathMissing",
+			path:    signed,
+			reqs:    []PolicyRequirement{{Type: PolicySignedBy, KeyPath: filepath.Join(dir, "missing.asc")}},
+			wantErr: true,
+		},
+		{
+			name: "KeyPathAndFingerprints",
+			path: signed,
+			reqs: []PolicyRequirement{{Type: PolicySignedBy, KeyPath: keyPath, Fingerprints: []string{testFingerPrint}}},
+		},
+		{
+			name: "AllRequirements",
+			path: signed,
+			reqs: []PolicyRequirement{
+				{Type: PolicySignedBy, KeyPath: keyPath},
+				{Type: PolicyReject},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := PolicyRule{Name: "test-rule", Requirements: tt.reqs}
+
+			err := VerifyPolicy(context.Background(), tt.path, rule, keyServerOpt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+
+			var pe *PolicyError
+			if !errors.As(err, &pe) || pe.Rule != rule.Name {
+				t.Errorf("got error %v, want policy error for rule %s", err, rule.Name)
+			}
+			if !strings.Contains(err.Error(), rule.Name) {
+				t.Errorf("error %q doesn't name the rule", err)
+			}
+		})
+	}
+}
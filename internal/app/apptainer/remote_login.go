@@ -17,6 +17,7 @@ import (
 	"os"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/util/auth"
 	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
@@ -98,7 +99,11 @@ func RemoteLogin(usrConfigFile string, args *LoginArgs) (err error) {
 		return fmt.Errorf("failed to flush remote config file %s: %s", file.Name(), err)
 	}
 
-	sylog.Infof("Token stored in %s", file.Name())
+	if h := c.GetCredentialHelper(); h != nil && r != nil {
+		sylog.Infof("Token stored with credential helper %s%s", credential.HelperPrefix, h.Name)
+	} else {
+		sylog.Infof("Token stored in %s", file.Name())
+	}
 	return nil
 }
 
@@ -118,7 +123,7 @@ func endPointLogin(ep *endpoint.Config, args *LoginArgs) error {
 	} else {
 		// Interactive login
 		// If a token is already set, prompt to see if we want to replace it
-		if ep.Token != "" {
+		if ep.GetToken() != "" {
 			input, err := interactive.AskYNQuestion("n", "An access token is already set for this remote. Replace it? [N/y] ")
 			if err != nil {
 				return fmt.Errorf("while reading input: %s", err)
@@ -151,6 +156,8 @@ func endPointLogin(ep *endpoint.Config, args *LoginArgs) error {
 		return fmt.Errorf("while verifying token: %v", err)
 	}
 	// Token is verified, update the endpoint config with it
-	ep.Token = token
+	if err := ep.SetToken(token); err != nil {
+		return fmt.Errorf("while storing token: %v", err)
+	}
 	return nil
 }
@@ -47,7 +47,9 @@ func RemoteLogout(usrConfigFile, name string) (err error) {
 
 	if r != nil {
 		// endpoint
-		r.Token = ""
+		if err := r.SetToken(""); err != nil {
+			return fmt.Errorf("while removing token: %v", err)
+		}
 	} else {
 		// services
 		if err := c.Logout(name); err != nil {
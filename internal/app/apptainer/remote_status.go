@@ -131,7 +131,7 @@ func doStatusCheck(name string, sp endpoint.Service) *status {
 }
 
 func doTokenCheck(e *endpoint.Config) error {
-	if e.Token == "" {
+	if e.GetToken() == "" {
 		fmt.Println("\nNo authentication token set (logged out).")
 		return nil
 	}
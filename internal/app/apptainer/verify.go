@@ -11,18 +11,26 @@
 package apptainer
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	imgutil "github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/sypgp"
 	"github.com/apptainer/container-key-client/client"
 	"github.com/apptainer/sif/v2/pkg/integrity"
 	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
 )
 
 // TODO - error overlaps with ECL - should probably become part of a common errors package at some point.
@@ -32,6 +40,7 @@ type VerifyCallback func(*sif.FileImage, integrity.VerifyResult) bool
 
 type verifier struct {
 	opts      []client.Option
+	kr        openpgp.KeyRing
 	groupIDs  []uint32
 	objectIDs []uint32
 	all       bool
@@ -51,6 +60,15 @@ func OptVerifyUseKeyServer(opts ...client.Option) VerifyOpt {
 	}
 }
 
+// OptVerifyWithKeyRing specifies that kr be used as the only source of key material, instead of
+// the public keyrings and keyserver.
+func OptVerifyWithKeyRing(kr openpgp.KeyRing) VerifyOpt {
+	return func(v *verifier) error {
+		v.kr = kr
+		return nil
+	}
+}
+
 // OptVerifyGroup adds a verification task for the group with the specified groupID. This may be
 // called multiple times to request verification of more than one group.
 func OptVerifyGroup(groupID uint32) VerifyOpt {
@@ -106,11 +124,12 @@ func newVerifier(opts []VerifyOpt) (verifier, error) {
 	return v, nil
 }
 
-// getOpts returns integrity.VerifierOpt necessary to validate f.
-func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
-	var iopts []integrity.VerifierOpt
+// keyRing returns the keyring providing key material.
+func (v verifier) keyRing(ctx context.Context) (openpgp.KeyRing, error) {
+	if v.kr != nil {
+		return v.kr, nil
+	}
 
-	// Add keyring.
 	var kr openpgp.KeyRing
 	if v.opts != nil {
 		hkr, err := sypgp.NewHybridKeyRing(ctx, v.opts...)
@@ -132,8 +151,18 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 	if err != nil {
 		return nil, err
 	}
-	kr = sypgp.NewMultiKeyRing(gkr, kr)
+	return sypgp.NewMultiKeyRing(gkr, kr), nil
+}
+
+// getOpts returns integrity.VerifierOpt necessary to validate f.
+func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
+	var iopts []integrity.VerifierOpt
 
+	// Add keyring.
+	kr, err := v.keyRing(ctx)
+	if err != nil {
+		return nil, err
+	}
 	iopts = append(iopts, integrity.OptVerifyWithKeyRing(kr))
 
 	// Add group IDs, if applicable.
@@ -153,9 +182,10 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 		} else {
 			iopts = append(iopts, integrity.OptVerifyLegacy())
 
-			// If no objects explicitly selected, select system partition.
+			// If no objects explicitly selected, select the system partition
+			// executed on the host architecture.
 			if len(v.groupIDs) == 0 && len(v.objectIDs) == 0 {
-				od, err := f.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+				od, err := imgutil.SelectSystemPartition(f)
 				if err != nil {
 					return nil, err
 				}
@@ -268,3 +298,220 @@ func VerifyFingerprints(ctx context.Context, path string, fingerprints []string,
 	}
 	return nil
 }
+
+// PolicyError is returned when an image doesn't satisfy a policy rule.
+type PolicyError struct {
+	Rule string
+	Err  error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("image rejected by policy rule %s: %s", e.Rule, e.Err)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// errPolicyReject is returned by reject requirements.
+var errPolicyReject = errors.New("images from this source are rejected")
+
+// loadPolicyKeyRing reads the public keyring at path.
+func loadPolicyKeyRing(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	el, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if el, err = openpgp.ReadKeyRing(f); err != nil {
+			return nil, fmt.Errorf("while reading keyring %s: %s", path, err)
+		}
+	}
+	return el, nil
+}
+
+// VerifyPolicy verifies the SIF image found at path satisfies all the requirements of the policy
+// rule, a PolicyError naming the rule is returned otherwise.
+//
+// By default, the apptainer public keyring provides the key material of fingerprints requirements.
+// To supplement this with a keyserver, use OptVerifyUseKeyServer.
+func VerifyPolicy(ctx context.Context, path string, rule PolicyRule, opts ...VerifyOpt) error {
+	for _, r := range rule.Requirements {
+		var err error
+
+		switch r.Type {
+		case PolicyInsecureAcceptAnything:
+		case PolicyReject:
+			err = errPolicyReject
+		case PolicySignedBy:
+			ropts := opts
+			if r.KeyPath != "" {
+				var el openpgp.EntityList
+				if el, err = loadPolicyKeyRing(r.KeyPath); err != nil {
+					break
+				}
+				ropts = append(ropts[:len(ropts):len(ropts)], OptVerifyWithKeyRing(el))
+			}
+			if len(r.Fingerprints) > 0 {
+				err = VerifyFingerprints(ctx, path, r.Fingerprints, ropts...)
+			} else {
+				err = Verify(ctx, path, ropts...)
+			}
+		default:
+			err = fmt.Errorf("unknown requirement type %q", r.Type)
+		}
+
+		if err != nil {
+			return &PolicyError{Rule: rule.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// ociPolicyRequirements converts the policy rule requirements to container signature policy
+// requirements, the keys of fingerprints requirements are looked up in the public keyrings.
+func ociPolicyRequirements(rule PolicyRule) (signature.PolicyRequirements, error) {
+	var keys openpgp.EntityList
+
+	reqs := make(signature.PolicyRequirements, 0, len(rule.Requirements))
+	for _, r := range rule.Requirements {
+		switch r.Type {
+		case PolicyInsecureAcceptAnything:
+			reqs = append(reqs, signature.NewPRInsecureAcceptAnything())
+		case PolicyReject:
+			reqs = append(reqs, signature.NewPRReject())
+		case PolicySignedBy:
+			if r.KeyPath != "" {
+				req, err := signature.NewPRSignedByKeyPath(signature.SBKeyTypeGPGKeys, r.KeyPath, signature.NewPRMMatchRepoDigestOrExact())
+				if err != nil {
+					return nil, err
+				}
+				reqs = append(reqs, req)
+			}
+			if len(r.Fingerprints) > 0 && keys == nil {
+				var err error
+				if keys, err = publicKeys(); err != nil {
+					return nil, err
+				}
+			}
+			// one requirement per fingerprint, as all of them must have signed the image
+			for _, fp := range r.Fingerprints {
+				e := findEntity(keys, fp)
+				if e == nil {
+					return nil, fmt.Errorf("no public key found for fingerprint %s", fp)
+				}
+				var buf bytes.Buffer
+				if err := e.Serialize(&buf); err != nil {
+					return nil, err
+				}
+				req, err := signature.NewPRSignedByKeyData(signature.SBKeyTypeGPGKeys, buf.Bytes(), signature.NewPRMMatchRepoDigestOrExact())
+				if err != nil {
+					return nil, err
+				}
+				reqs = append(reqs, req)
+			}
+		default:
+			return nil, fmt.Errorf("unknown requirement type %q", r.Type)
+		}
+	}
+	return reqs, nil
+}
+
+// publicKeys returns the keys of the user and global public keyrings.
+func publicKeys() (openpgp.EntityList, error) {
+	el, err := sypgp.NewHandle("").LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+	global := sypgp.NewHandle(buildcfg.APPTAINER_CONFDIR, sypgp.GlobalHandleOpt())
+	gel, err := global.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return append(gel, el...), nil
+}
+
+// findEntity returns the entity with the given fingerprint.
+func findEntity(el openpgp.EntityList, fingerprint string) *openpgp.Entity {
+	for _, e := range el {
+		if strings.EqualFold(fingerprint, hex.EncodeToString(e.PrimaryKey.Fingerprint)) {
+			return e
+		}
+	}
+	return nil
+}
+
+// VerifyOCIPolicy verifies the OCI image referenced by ref satisfies all the requirements of the
+// policy rule, a PolicyError naming the rule is returned otherwise. Image signatures are looked up
+// as configured by the registries.d configuration.
+func VerifyOCIPolicy(ctx context.Context, ref types.ImageReference, sysCtx *types.SystemContext, rule PolicyRule) error {
+	// avoid contacting the registry when the outcome is known
+	accept := true
+	for _, r := range rule.Requirements {
+		switch r.Type {
+		case PolicyReject:
+			return &PolicyError{Rule: rule.Name, Err: errPolicyReject}
+		case PolicySignedBy:
+			accept = false
+		}
+	}
+	if accept {
+		return nil
+	}
+
+	reqs, err := ociPolicyRequirements(rule)
+	if err != nil {
+		return &PolicyError{Rule: rule.Name, Err: err}
+	}
+
+	pc, err := signature.NewPolicyContext(&signature.Policy{Default: reqs})
+	if err != nil {
+		return err
+	}
+	defer pc.Destroy()
+
+	src, err := ref.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if _, err := pc.IsRunningImageAllowed(ctx, image.UnparsedInstance(src, nil)); err != nil {
+		return &PolicyError{Rule: rule.Name, Err: err}
+	}
+	return nil
+}
+
+// VerifyPullPolicy verifies the SIF image found at path, pulled from ref through transport, satisfies
+// the pull policy. It has no effect when no pull policy is configured.
+func VerifyPullPolicy(ctx context.Context, transport, ref, path string, opts ...VerifyOpt) error {
+	p, err := LoadPolicy(PolicyPath())
+	if err != nil || p == nil {
+		return err
+	}
+	rule := p.Rule(transport, ref)
+	sylog.Debugf("Verifying %s image %s with policy rule %s", transport, ref, rule.Name)
+	return VerifyPolicy(ctx, path, rule, opts...)
+}
+
+// VerifyOCIPullPolicy verifies the OCI image referenced by ref satisfies the pull policy. It has no
+// effect when no pull policy is configured or for images not pulled from a registry.
+func VerifyOCIPullPolicy(ctx context.Context, ref types.ImageReference, sysCtx *types.SystemContext) error {
+	if ref.Transport().Name() != PolicyTransportDocker || ref.DockerReference() == nil {
+		return nil
+	}
+	p, err := LoadPolicy(PolicyPath())
+	if err != nil || p == nil {
+		return err
+	}
+	name := ref.DockerReference().String()
+	rule := p.Rule(PolicyTransportDocker, name)
+	sylog.Debugf("Verifying %s image %s with policy rule %s", PolicyTransportDocker, name, rule.Name)
+	return VerifyOCIPolicy(ctx, ref, sysCtx, rule)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package audit implements container job accounting records, written
+// either to syslog (and so to journald on systemd hosts) or appended to
+// a JSON-lines file.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"time"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+const (
+	// None disables audit records.
+	None = "no"
+	// Syslog sends audit records to syslog.
+	Syslog = "syslog"
+	// File appends audit records to a JSON-lines file.
+	File = "file"
+)
+
+// syslogTag is the tag used for syslog audit records.
+const syslogTag = "apptainer-audit"
+
+// Record describes a container execution audit record.
+type Record struct {
+	Event       string          `json:"event"`
+	User        string          `json:"user"`
+	UID         int             `json:"uid"`
+	Instance    string          `json:"instance,omitempty"`
+	Image       string          `json:"image"`
+	SIFID       string          `json:"sifId,omitempty"`
+	Digest      string          `json:"digest,omitempty"`
+	Signers     []string        `json:"signers,omitempty"`
+	Command     []string        `json:"command,omitempty"`
+	Binds       []string        `json:"binds,omitempty"`
+	Namespaces  []string        `json:"namespaces,omitempty"`
+	Cgroups     json.RawMessage `json:"cgroups,omitempty"`
+	Pid         int             `json:"pid"`
+	StartTime   time.Time       `json:"startTime"`
+	EndTime     *time.Time      `json:"endTime,omitempty"`
+	ExitStatus  *int            `json:"exitStatus,omitempty"`
+	ExitMessage string          `json:"exitMessage,omitempty"`
+}
+
+// Write writes the audit record to the destination, path is only used
+// by the File destination.
+func Write(dest, path string, r *Record) error {
+	switch dest {
+	case None, "":
+		return nil
+	case Syslog:
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("while marshaling audit record: %s", err)
+		}
+		w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, syslogTag)
+		if err != nil {
+			return fmt.Errorf("while connecting to syslog: %s", err)
+		}
+		defer w.Close()
+		return w.Info(string(data))
+	case File:
+		if path == "" {
+			return fmt.Errorf("no audit log file configured")
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return fmt.Errorf("while opening audit log file: %s", err)
+		}
+		defer f.Close()
+		return WriteTo(f, r)
+	default:
+		return fmt.Errorf("unknown audit log destination %q", dest)
+	}
+}
+
+// WriteTo writes the audit record as a single JSON line to w.
+func WriteTo(w io.Writer, r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("while marshaling audit record: %s", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Digest returns the SHA256 digest of the image file.
+func Digest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SIFInfo returns the SIF unique ID and the fingerprints of the keys
+// used to sign the image. Signatures are not verified.
+func SIFInfo(path string) (string, []string, error) {
+	fimg, err := sif.LoadContainerFromPath(path, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		return "", nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	var signers []string
+	seen := make(map[string]bool)
+
+	sigs, err := fimg.GetDescriptors(sif.WithDataType(sif.DataSignature))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, d := range sigs {
+		_, fp, err := d.SignatureMetadata()
+		if err != nil {
+			continue
+		}
+		s := fmt.Sprintf("%X", fp)
+		if !seen[s] {
+			seen[s] = true
+			signers = append(signers, s)
+		}
+	}
+
+	return fimg.ID(), signers, nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	exitCode := 1
+	end := time.Now()
+
+	records := []*Record{
+		{
+			Event:     "start",
+			User:      "user",
+			UID:       1000,
+			Image:     "/images/test.sif",
+			Binds:     []string{"/data:/data"},
+			Cgroups:   json.RawMessage(`{"memory":{"limit":1024}}`),
+			StartTime: end.Add(-time.Minute),
+		},
+		{
+			Event:      "end",
+			User:       "user",
+			UID:        1000,
+			Image:      "/images/test.sif",
+			StartTime:  end.Add(-time.Minute),
+			EndTime:    &end,
+			ExitStatus: &exitCode,
+		},
+	}
+
+	for _, r := range records {
+		if err := Write(File, path, r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("while opening audit log: %s", err)
+	}
+	defer f.Close()
+
+	var read []Record
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var r Record
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatalf("while decoding audit record %q: %s", s.Text(), err)
+		}
+		read = append(read, r)
+	}
+
+	if len(read) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(read))
+	}
+	if read[0].Event != "start" || read[0].Binds[0] != "/data:/data" {
+		t.Errorf("unexpected start record: %+v", read[0])
+	}
+	if read[1].Event != "end" || read[1].ExitStatus == nil || *read[1].ExitStatus != exitCode {
+		t.Errorf("unexpected end record: %+v", read[1])
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	r := &Record{Event: "start"}
+
+	if err := Write(None, "", r); err != nil {
+		t.Errorf("unexpected error with audit disabled: %s", err)
+	}
+	if err := Write(File, "", r); err == nil {
+		t.Errorf("unexpected success without audit log file")
+	}
+	if err := Write("journal", "", r); err == nil {
+		t.Errorf("unexpected success with unknown destination")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image")
+	if err := ioutil.WriteFile(path, []byte("test"), 0o644); err != nil {
+		t.Fatalf("while writing image: %s", err)
+	}
+
+	digest, err := Digest(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if digest != expected {
+		t.Errorf("got digest %s, expected %s", digest, expected)
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
-	"runtime"
 	"sort"
 	"strconv"
 	"syscall"
@@ -32,10 +31,11 @@ import (
 
 // SIFAssembler doesn't store anything.
 type SIFAssembler struct {
-	GzipFlag        bool
-	MksquashfsProcs uint
-	MksquashfsMem   string
-	MksquashfsPath  string
+	// CompressionFlags select the mksquashfs compression algorithm and level.
+	CompressionFlags []string
+	MksquashfsProcs  uint
+	MksquashfsMem    string
+	MksquashfsPath   string
 }
 
 type encryptionOptions struct {
@@ -174,9 +174,7 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 		flags = append(flags, "-all-root")
 	}
 	// specify compression if needed
-	if a.GzipFlag {
-		flags = append(flags, "-comp", "gzip")
-	}
+	flags = append(flags, a.CompressionFlags...)
 	if a.MksquashfsMem != "" {
 		flags = append(flags, "-mem", a.MksquashfsMem)
 	}
@@ -185,8 +183,10 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	}
 	arch := machine.ArchFromContainer(b.RootfsPath)
 	if arch == "" {
-		sylog.Infof("Architecture not recognized, use native")
-		arch = runtime.GOARCH
+		sylog.Infof("Architecture not recognized, use %s", b.Opts.TargetArch())
+		arch = b.Opts.TargetArch()
+	} else if b.Opts.Arch != "" && arch != b.Opts.Arch {
+		sylog.Warningf("Container architecture %s doesn't match requested architecture %s", arch, b.Opts.Arch)
 	}
 	sylog.Verbosef("Set SIF container architecture to %s", arch)
 
@@ -194,7 +194,21 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, fmt.Errorf("while searching for mksquashfs: %v", err)
 		}
 
-		flag, err := ensureGzipComp(b.stages[lastStageIndex].b.TmpDir, mksquashfsPath)
+		comp := conf.Opts.Compression
+		if comp == "" {
+			if comp, err = squashfs.GetCompression(); err != nil {
+				return nil, fmt.Errorf("while searching for mksquashfs compression: %v", err)
+			}
+		}
+		level := conf.Opts.CompressionLevel
+		if level == 0 {
+			l, err := squashfs.GetCompressionLevel()
+			if err != nil {
+				return nil, fmt.Errorf("while searching for mksquashfs compression level: %v", err)
+			}
+			level = int(l)
+		}
+		compFlags, err := ensureComp(b.stages[lastStageIndex].b.TmpDir, mksquashfsPath, comp, level)
 		if err != nil {
 			return nil, fmt.Errorf("while ensuring correct compression algorithm: %v", err)
 		}
@@ -207,10 +221,10 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
 		}
 		b.stages[lastStageIndex].a = &assemblers.SIFAssembler{
-			GzipFlag:        flag,
-			MksquashfsProcs: mksquashfsProcs,
-			MksquashfsMem:   mksquashfsMem,
-			MksquashfsPath:  mksquashfsPath,
+			CompressionFlags: compFlags,
+			MksquashfsProcs:  mksquashfsProcs,
+			MksquashfsMem:    mksquashfsMem,
+			MksquashfsPath:   mksquashfsPath,
 		}
 	default:
 		return nil, fmt.Errorf("unrecognized output format %s", conf.Format)
@@ -219,28 +233,32 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	return b, nil
 }
 
-// ensureGzipComp builds dummy squashfs images and checks the type of compression used
-// to deduce if we can successfully build with gzip compression. It returns an error
-// if we cannot and a boolean to indicate if the `-comp` flag is needed to specify
-// gzip compression when the final squashfs is built
-func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
-	sylog.Debugf("Ensuring gzip compression for mksquashfs")
+// ensureComp builds dummy squashfs images and checks the type of compression used
+// to deduce if we can successfully build with the comp compression algorithm. It
+// returns an error if we cannot and the flags needed to select the compression
+// algorithm and level when the final squashfs is built
+func ensureComp(tmpdir, mksquashfsPath, comp string, level int) ([]string, error) {
+	sylog.Debugf("Ensuring %s compression for mksquashfs", comp)
+
+	compFlags, err := packer.CompressionFlags(comp, level)
+	if err != nil {
+		return nil, err
+	}
 
-	var err error
 	s := packer.NewSquashfs()
 	s.MksquashfsPath = mksquashfsPath
 
-	srcf, err := ioutil.TempFile(tmpdir, "squashfs-gzip-comp-test-src")
+	srcf, err := ioutil.TempFile(tmpdir, "squashfs-comp-test-src")
 	if err != nil {
-		return false, fmt.Errorf("while creating temporary file for squashfs source: %v", err)
+		return nil, fmt.Errorf("while creating temporary file for squashfs source: %v", err)
 	}
 
 	srcf.Write([]byte("Test File Content"))
 	srcf.Close()
 
-	f, err := ioutil.TempFile(tmpdir, "squashfs-gzip-comp-test-")
+	f, err := ioutil.TempFile(tmpdir, "squashfs-comp-test-")
 	if err != nil {
-		return false, fmt.Errorf("while creating temporary file for squashfs: %v", err)
+		return nil, fmt.Errorf("while creating temporary file for squashfs: %v", err)
 	}
 	f.Close()
 
@@ -248,11 +266,11 @@ func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
 
 	mksquashfsProcs, err := squashfs.GetProcs()
 	if err != nil {
-		return false, fmt.Errorf("while searching for mksquashfs processor limits: %v", err)
+		return nil, fmt.Errorf("while searching for mksquashfs processor limits: %v", err)
 	}
 	mksquashfsMem, err := squashfs.GetMem()
 	if err != nil {
-		return false, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
+		return nil, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
 	}
 	if mksquashfsMem != "" {
 		flags = append(flags, "-mem", mksquashfsMem)
@@ -261,48 +279,52 @@ func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
 		flags = append(flags, "-processors", fmt.Sprint(mksquashfsProcs))
 	}
 
-	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("while creating squashfs: %v", err)
-	}
+	// old mksquashfs versions don't support the -comp flag and only
+	// build gzip compressed images, check the default compression first
+	if comp == "gzip" && level == 0 {
+		if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
+			return nil, fmt.Errorf("while creating squashfs: %v", err)
+		}
 
-	content, err := ioutil.ReadFile(f.Name())
-	if err != nil {
-		return false, fmt.Errorf("while reading test squashfs: %v", err)
-	}
+		content, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("while reading test squashfs: %v", err)
+		}
 
-	comp, err := image.GetSquashfsComp(content)
-	if err != nil {
-		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
-	}
+		c, err := image.GetSquashfsComp(content)
+		if err != nil {
+			return nil, fmt.Errorf("could not verify squashfs compression type: %v", err)
+		}
 
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression by default ensured")
-		return false, nil
+		if c == comp {
+			sylog.Debugf("Gzip compression by default ensured")
+			return nil, nil
+		}
 	}
 
-	// Now force add `-comp gzip` in addition to -noappend -mem -processors
-	flags = append(flags, "-comp", "gzip")
+	// Now force add the compression flags in addition to -noappend -mem -processors
+	flags = append(flags, compFlags...)
 
 	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("could not build squashfs with required gzip compression")
+		return nil, fmt.Errorf("%s doesn't support %s compression: %v", mksquashfsPath, comp, err)
 	}
 
-	content, err = ioutil.ReadFile(f.Name())
+	content, err := ioutil.ReadFile(f.Name())
 	if err != nil {
-		return false, fmt.Errorf("while reading test squashfs: %v", err)
+		return nil, fmt.Errorf("while reading test squashfs: %v", err)
 	}
 
-	comp, err = image.GetSquashfsComp(content)
+	c, err := image.GetSquashfsComp(content)
 	if err != nil {
-		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
+		return nil, fmt.Errorf("could not verify squashfs compression type: %v", err)
 	}
 
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression with -comp flag ensured")
-		return true, nil
+	if c == comp {
+		sylog.Debugf("%s compression with -comp flag ensured", comp)
+		return compFlags, nil
 	}
 
-	return false, fmt.Errorf("could not build squashfs with required gzip compression")
+	return nil, fmt.Errorf("could not build squashfs with required %s compression", comp)
 }
 
 // cleanUp removes remnants of build from file system unless NoCleanUp is specified.
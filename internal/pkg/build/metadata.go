@@ -16,7 +16,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -344,8 +343,7 @@ func addBuildLabels(labels map[string]string, b *types.Bundle) error {
 	}
 
 	// Architecture of build
-	// Local builds currently always use the host architecture.
-	labels["org.label-schema.build-arch"] = runtime.GOARCH
+	labels["org.label-schema.build-arch"] = b.Opts.TargetArch()
 
 	return nil
 }
@@ -0,0 +1,114 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// MergeArchSIF creates the multi-architecture SIF image dst from the
+// single architecture SIF images srcs. The first image is the base of the
+// merged image, its root filesystem stays the primary system partition
+// while the root filesystems of the other images are added as system
+// partitions, each in its own group. The runtime selects the partition
+// matching the host architecture.
+func MergeArchSIF(dst string, srcs []string) error {
+	if len(srcs) == 0 {
+		return fmt.Errorf("no image to merge")
+	}
+
+	tmp := dst + ".merge"
+	if err := fs.CopyFile(srcs[0], tmp, 0o755); err != nil {
+		return fmt.Errorf("while copying %s: %s", srcs[0], err)
+	}
+	defer os.Remove(tmp)
+
+	fimg, err := sif.LoadContainerFromPath(tmp)
+	if err != nil {
+		return fmt.Errorf("while loading %s: %s", tmp, err)
+	}
+	defer fimg.UnloadContainer()
+
+	arch, err := primaryArch(fimg)
+	if err != nil {
+		return fmt.Errorf("while reading %s: %s", srcs[0], err)
+	}
+	archs := map[string]bool{arch: true}
+
+	for i, src := range srcs[1:] {
+		if err := addArchPartition(fimg, src, uint32(i+2), archs); err != nil {
+			return fmt.Errorf("while merging %s: %s", src, err)
+		}
+	}
+
+	if err := fimg.UnloadContainer(); err != nil {
+		return fmt.Errorf("while writing %s: %s", dst, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("while writing %s: %s", dst, err)
+	}
+	return nil
+}
+
+// addArchPartition adds the root filesystem of the SIF image src as a system
+// partition with the given group ID to fimg, archs holds the architectures
+// already present in fimg.
+func addArchPartition(fimg *sif.FileImage, src string, groupID uint32, archs map[string]bool) error {
+	simg, err := sif.LoadContainerFromPath(src, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		return err
+	}
+	defer simg.UnloadContainer()
+
+	desc, err := simg.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+	if err != nil {
+		return fmt.Errorf("while searching root filesystem partition: %s", err)
+	}
+	fstype, _, arch, err := desc.PartitionMetadata()
+	if err != nil {
+		return err
+	}
+	if fstype == sif.FsEncryptedSquashfs {
+		return fmt.Errorf("encrypted root filesystems are not supported")
+	}
+	if archs[arch] {
+		return fmt.Errorf("an image with %s architecture is already present", arch)
+	}
+	archs[arch] = true
+
+	di, err := sif.NewDescriptorInput(sif.DataPartition, io.LimitReader(desc.GetReader(), desc.Size()),
+		sif.OptPartitionMetadata(fstype, sif.PartSystem, arch),
+		sif.OptGroupID(groupID),
+	)
+	if err != nil {
+		return err
+	}
+	return fimg.AddObject(di)
+}
+
+// primaryArch returns the architecture of the primary system partition.
+func primaryArch(fimg *sif.FileImage) (string, error) {
+	desc, err := fimg.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+	if err != nil {
+		return "", fmt.Errorf("while searching root filesystem partition: %s", err)
+	}
+	fstype, _, arch, err := desc.PartitionMetadata()
+	if err != nil {
+		return "", err
+	}
+	if fstype == sif.FsEncryptedSquashfs {
+		return "", fmt.Errorf("encrypted root filesystems are not supported")
+	}
+	return arch, nil
+}
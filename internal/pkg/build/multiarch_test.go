@@ -0,0 +1,129 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package build
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// createArchSIF creates a SIF image in dir with a primary system partition
+// of the given architecture holding the architecture name.
+func createArchSIF(t *testing.T, dir, arch string, fstype sif.FSType) string {
+	path := filepath.Join(dir, arch+".sif")
+
+	di, err := sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader([]byte(arch)),
+		sif.OptPartitionMetadata(fstype, sif.PartPrimSys, arch),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	fimg, err := sif.CreateContainerAtPath(path, sif.OptCreateWithDescriptors(di))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return path
+}
+
+func TestMergeArchSIF(t *testing.T) {
+	dir := t.TempDir()
+
+	amd64 := createArchSIF(t, dir, "amd64", sif.FsSquash)
+	arm64 := createArchSIF(t, dir, "arm64", sif.FsSquash)
+	ppc64le := createArchSIF(t, dir, "ppc64le", sif.FsSquash)
+	encrypted := createArchSIF(t, dir, "s390x", sif.FsEncryptedSquashfs)
+
+	tests := []struct {
+		name              string
+		srcs              []string
+		expectedSuccess   bool
+		expectedPlatforms []string
+	}{
+		{
+			name:            "NoImage",
+			expectedSuccess: false,
+		},
+		{
+			name:              "SingleImage",
+			srcs:              []string{amd64},
+			expectedSuccess:   true,
+			expectedPlatforms: []string{"amd64"},
+		},
+		{
+			name:              "MultipleImages",
+			srcs:              []string{arm64, amd64, ppc64le},
+			expectedSuccess:   true,
+			expectedPlatforms: []string{"arm64", "amd64", "ppc64le"},
+		},
+		{
+			name:            "DuplicateArch",
+			srcs:            []string{amd64, arm64, amd64},
+			expectedSuccess: false,
+		},
+		{
+			name:            "Encrypted",
+			srcs:            []string{amd64, encrypted},
+			expectedSuccess: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "merged.sif")
+
+			err := MergeArchSIF(dst, tt.srcs)
+			if (err == nil) != tt.expectedSuccess {
+				t.Fatalf("got error %v, expect success %v", err, tt.expectedSuccess)
+			}
+			if err != nil {
+				if _, err := os.Stat(dst); !os.IsNotExist(err) {
+					t.Errorf("unexpected merged image after failure")
+				}
+				return
+			}
+
+			fimg, err := sif.LoadContainerFromPath(dst, sif.OptLoadWithFlag(os.O_RDONLY))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer fimg.UnloadContainer()
+
+			if p := image.Platforms(fimg); !reflect.DeepEqual(p, tt.expectedPlatforms) {
+				t.Errorf("got platforms %v, expected %v", p, tt.expectedPlatforms)
+			}
+
+			descs, err := fimg.GetDescriptors(sif.WithPartitionType(sif.PartSystem))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for i, d := range descs {
+				_, _, arch, _ := d.PartitionMetadata()
+				data, err := d.GetData()
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if string(data) != arch {
+					t.Errorf("got %q partition content for %s architecture", data, arch)
+				}
+				if d.GroupID() != uint32(i+2) {
+					t.Errorf("got group ID %d for %s architecture, expected %d", d.GroupID(), arch, i+2)
+				}
+			}
+		})
+	}
+}
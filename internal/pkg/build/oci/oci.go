@@ -15,9 +15,11 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"runtime"
 	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/docker"
@@ -46,6 +48,7 @@ func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.Ima
 	if err != nil {
 		return nil, err
 	}
+	cacheTag = platformDigest(cacheTag, sys)
 
 	cacheDir, err := imgCache.GetOciCacheDir(cache.OciBlobCacheType)
 	if err != nil {
@@ -119,7 +122,28 @@ func ImageDigest(ctx context.Context, uri string, sys *types.SystemContext) (str
 		return "", fmt.Errorf("unable to parse image name %v: %v", uri, err)
 	}
 
-	return getRefDigest(ctx, ref, sys)
+	if sys != nil && sys.DockerAuthConfig == nil {
+		sys.DockerAuthConfig, err = credential.DockerHelperAuth(sys.AuthFilePath, ref)
+		if err != nil {
+			return "", fmt.Errorf("while getting credentials from credential helper: %v", err)
+		}
+	}
+
+	digest, err := getRefDigest(ctx, ref, sys)
+	if err != nil {
+		return "", err
+	}
+	return platformDigest(digest, sys), nil
+}
+
+// platformDigest returns the digest suffixed by the architecture
+// selected in the system context when it's not the host architecture,
+// as a manifest list digest is shared by the images of all platforms.
+func platformDigest(digest string, sys *types.SystemContext) string {
+	if sys == nil || sys.ArchitectureChoice == "" || sys.ArchitectureChoice == runtime.GOARCH {
+		return digest
+	}
+	return digest + "-" + sys.ArchitectureChoice
 }
 
 // getRefDigest obtains the manifest digest for a ref.
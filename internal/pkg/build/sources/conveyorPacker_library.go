@@ -13,7 +13,6 @@ package sources
 import (
 	"context"
 	"fmt"
-	"runtime"
 
 	golog "github.com/go-log/log"
 
@@ -76,7 +75,7 @@ func (cp *LibraryConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err
 		Logger:    (golog.Logger)(sylog.DebugLogger{}),
 	}
 
-	imagePath, err := library.Pull(ctx, b.Opts.ImgCache, imageRef, runtime.GOARCH, cp.b.TmpDir, libraryConfig)
+	imagePath, err := library.Pull(ctx, b.Opts.ImgCache, imageRef, b.Opts.TargetArch(), cp.b.TmpDir, libraryConfig)
 	if err != nil {
 		return fmt.Errorf("while fetching library image: %v", err)
 	}
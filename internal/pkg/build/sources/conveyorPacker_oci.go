@@ -26,7 +26,9 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/build/oci"
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/internal/pkg/util/shell"
 	sytypes "github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/image"
@@ -34,12 +36,14 @@ import (
 	"github.com/apptainer/apptainer/pkg/sylog"
 	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker"
 	dockerarchive "github.com/containers/image/v5/docker/archive"
 	dockerdaemon "github.com/containers/image/v5/docker/daemon"
 	ociarchive "github.com/containers/image/v5/oci/archive"
 	ocilayout "github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/storage"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
@@ -128,11 +132,16 @@ type OCIConveyorPacker struct {
 	policyCtx *signature.PolicyContext
 	imgConfig imgspecv1.ImageConfig
 	sysCtx    *types.SystemContext
+	// lazy indicates that the layers are streamed from the
+	// source while unpacking instead of being fetched first
+	lazy bool
 }
 
 // Get downloads container information from the specified source
 func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err error) {
 	cp.b = b
+	// one-shot builds don't use the cache and don't need a copy of the image
+	cp.lazy = b.Opts.NoCache
 
 	policy := &signature.Policy{Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()}}
 	cp.policyCtx, err = signature.NewPolicyContext(policy)
@@ -152,6 +161,7 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		AuthFilePath:             syfs.DockerConf(),
 		DockerRegistryUserAgent:  useragent.Value(),
 		BigFilesTemporaryDir:     b.TmpDir,
+		ArchitectureChoice:       cp.b.Opts.Arch,
 	}
 	if cp.b.Opts.NoHTTPS {
 		cp.sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
@@ -175,6 +185,10 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		cp.srcRef, err = dockerarchive.ParseReference(ref)
 	case "docker-daemon":
 		cp.srcRef, err = dockerdaemon.ParseReference(ref)
+	case "containers-storage":
+		cp.srcRef, err = storage.Transport.ParseReference(ref)
+	case "dir":
+		cp.srcRef, err = directory.Transport.ParseReference(ref)
 	case "oci":
 		cp.srcRef, err = ocilayout.ParseReference(ref)
 	case "oci-archive":
@@ -182,7 +196,9 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 			// As root, the direct oci-archive handling will work
 			cp.srcRef, err = ociarchive.ParseReference(ref)
 		} else {
-			// As non-root we need to do a dumb tar extraction first
+			// As non-root we need to do a dumb tar extraction first,
+			// the extracted image is removed once Get returns
+			cp.lazy = false
 			tmpDir, err := ioutil.TempDir(b.TmpDir, "temp-oci-")
 			if err != nil {
 				return fmt.Errorf("could not create temporary oci directory: %v", err)
@@ -214,6 +230,19 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		return fmt.Errorf("invalid image source: %v", err)
 	}
 
+	// containers/image doesn't support the default credential helper
+	// (credsStore), credentials are resolved here in this case
+	if cp.sysCtx.DockerAuthConfig == nil {
+		cp.sysCtx.DockerAuthConfig, err = credential.DockerHelperAuth(cp.sysCtx.AuthFilePath, cp.srcRef)
+		if err != nil {
+			return fmt.Errorf("while getting credentials from credential helper: %v", err)
+		}
+	}
+
+	if err := apptainer.VerifyOCIPullPolicy(ctx, cp.srcRef, cp.sysCtx); err != nil {
+		return err
+	}
+
 	if !cp.b.Opts.NoCache {
 		// Grab the modified source ref from the cache
 		cp.srcRef, err = oci.ConvertReference(ctx, b.Opts.ImgCache, cp.srcRef, cp.sysCtx)
@@ -222,13 +251,15 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		}
 	}
 
-	// To to do the RootFS extraction we also have to have a location that
-	// contains *only* this image
-	cp.tmpfsRef, err = ocilayout.ParseReference(cp.b.TmpDir + ":" + "tmp")
+	if !cp.lazy {
+		// To to do the RootFS extraction we also have to have a location that
+		// contains *only* this image
+		cp.tmpfsRef, err = ocilayout.ParseReference(cp.b.TmpDir + ":" + "tmp")
 
-	err = cp.fetch(ctx)
-	if err != nil {
-		return err
+		err = cp.fetch(ctx)
+		if err != nil {
+			return err
+		}
 	}
 
 	cp.imgConfig, err = cp.getConfig(ctx)
@@ -385,6 +416,9 @@ func (cp *OCIConveyorPacker) extractArchive(src string, dst string) error {
 }
 
 func (cp *OCIConveyorPacker) unpackTmpfs(ctx context.Context) error {
+	if cp.lazy {
+		return unpackLazyRootfs(ctx, cp.b, cp.srcRef, cp.sysCtx)
+	}
 	return unpackRootfs(ctx, cp.b, cp.tmpfsRef, cp.sysCtx)
 }
 
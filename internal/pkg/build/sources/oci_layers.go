@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/klauspost/compress/zstd"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/casext"
+)
+
+// estargzTOCAnnotation is the annotation set on estargz layers,
+// estargz layers are gzip compressed tar archives embedding a
+// table of contents and landmark files used by lazy pulling.
+const estargzTOCAnnotation = "containerd.io/snapshot/stargz/toc.digest"
+
+// estargzMetadataFiles lists the metadata files embedded at the
+// root of estargz layers.
+var estargzMetadataFiles = []string{
+	"stargz.index.json",
+	".prefetch.landmark",
+	".no.prefetch.landmark",
+}
+
+// isZstdLayer returns if the layer is zstd compressed, zstd:chunked
+// layers are zstd compressed tar archives with the table of contents
+// stored in skippable frames ignored by decoders.
+func isZstdLayer(layer imgspecv1.Descriptor) bool {
+	return layer.MediaType == imgspecv1.MediaTypeImageLayerZstd ||
+		layer.MediaType == imgspecv1.MediaTypeImageLayerNonDistributableZstd
+}
+
+// hasEstargzLayers returns if any of the manifest layers is an estargz layer.
+func hasEstargzLayers(manifest imgspecv1.Manifest) bool {
+	for _, l := range manifest.Layers {
+		if l.Annotations[estargzTOCAnnotation] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// decompressZstdLayers replaces the zstd compressed layers of the manifest
+// by their uncompressed content stored in the image layout, as umoci only
+// supports gzip compressed and uncompressed layers. The uncompressed layer
+// digest is the layer diff ID, so the image configuration stays valid.
+func decompressZstdLayers(ctx context.Context, engine casext.Engine, manifest *imgspecv1.Manifest) error {
+	for i, l := range manifest.Layers {
+		if !isZstdLayer(l) {
+			continue
+		}
+		sylog.Debugf("Decompressing zstd layer %s", l.Digest)
+
+		blob, err := engine.GetBlob(ctx, l.Digest)
+		if err != nil {
+			return fmt.Errorf("while opening layer %s: %s", l.Digest, err)
+		}
+		dec, err := zstd.NewReader(blob)
+		if err != nil {
+			blob.Close()
+			return fmt.Errorf("while decompressing layer %s: %s", l.Digest, err)
+		}
+		d, size, err := engine.PutBlob(ctx, dec)
+		dec.Close()
+		blob.Close()
+		if err != nil {
+			return fmt.Errorf("while decompressing layer %s: %s", l.Digest, err)
+		}
+
+		mediaType := imgspecv1.MediaTypeImageLayer
+		if l.MediaType == imgspecv1.MediaTypeImageLayerNonDistributableZstd {
+			mediaType = imgspecv1.MediaTypeImageLayerNonDistributable
+		}
+		manifest.Layers[i] = imgspecv1.Descriptor{
+			MediaType: mediaType,
+			Digest:    d,
+			Size:      size,
+		}
+	}
+	return nil
+}
+
+// removeEstargzMetadata removes the estargz metadata files extracted
+// at the root of the root filesystem.
+func removeEstargzMetadata(rootfs string) error {
+	for _, f := range estargzMetadataFiles {
+		if err := os.Remove(filepath.Join(rootfs, f)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("while removing estargz metadata file %s: %s", f, err)
+		}
+	}
+	return nil
+}
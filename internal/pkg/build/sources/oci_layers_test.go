@@ -0,0 +1,121 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/cas/dir"
+	"github.com/opencontainers/umoci/oci/casext"
+)
+
+func TestDecompressZstdLayers(t *testing.T) {
+	ctx := context.Background()
+
+	layout := filepath.Join(t.TempDir(), "layout")
+	if err := dir.Create(layout); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cas, err := dir.Open(layout)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	engine := casext.NewEngine(cas)
+	defer engine.Close()
+
+	// uncompressed layer content
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	content := []byte("hello")
+	if err := tw.WriteHeader(&tar.Header{Name: "hello", Mode: 0o644, Size: int64(len(content))}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tw.Close()
+	diffID := digest.FromBytes(layer.Bytes())
+
+	var compressed bytes.Buffer
+	enc, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	enc.Write(layer.Bytes())
+	enc.Close()
+
+	zstdDigest, zstdSize, err := engine.PutBlob(ctx, &compressed)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	gzipLayer := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageLayerGzip, Digest: digest.FromString("gzip"), Size: 4}
+
+	manifest := imgspecv1.Manifest{
+		Layers: []imgspecv1.Descriptor{
+			gzipLayer,
+			{MediaType: imgspecv1.MediaTypeImageLayerZstd, Digest: zstdDigest, Size: zstdSize},
+		},
+	}
+	if err := decompressZstdLayers(ctx, engine, &manifest); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if manifest.Layers[0].Digest != gzipLayer.Digest {
+		t.Errorf("gzip layer was modified: %v", manifest.Layers[0])
+	}
+	l := manifest.Layers[1]
+	if l.MediaType != imgspecv1.MediaTypeImageLayer {
+		t.Errorf("got media type %s, expected %s", l.MediaType, imgspecv1.MediaTypeImageLayer)
+	}
+	if l.Digest != diffID || l.Size != int64(layer.Len()) {
+		t.Errorf("got layer %s (%d bytes), expected %s (%d bytes)", l.Digest, l.Size, diffID, layer.Len())
+	}
+}
+
+func TestRemoveEstargzMetadata(t *testing.T) {
+	manifest := imgspecv1.Manifest{
+		Layers: []imgspecv1.Descriptor{
+			{MediaType: imgspecv1.MediaTypeImageLayerGzip},
+		},
+	}
+	if hasEstargzLayers(manifest) {
+		t.Errorf("unexpected estargz layer")
+	}
+	manifest.Layers[0].Annotations = map[string]string{estargzTOCAnnotation: "sha256:1234"}
+	if !hasEstargzLayers(manifest) {
+		t.Errorf("estargz layer not detected")
+	}
+
+	rootfs := t.TempDir()
+	for _, f := range []string{"stargz.index.json", ".prefetch.landmark", "file"} {
+		if err := ioutil.WriteFile(filepath.Join(rootfs, f), nil, 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := removeEstargzMetadata(rootfs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries, err := os.ReadDir(rootfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "file" {
+		t.Errorf("unexpected rootfs content: %v", entries)
+	}
+}
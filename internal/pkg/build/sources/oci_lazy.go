@@ -0,0 +1,381 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/cas"
+)
+
+// boundedBuffer is an in-memory pipe holding at most size bytes, writes
+// block while the buffer is full and reads block while it's empty.
+type boundedBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	size   int
+	err    error
+	closed bool
+}
+
+func newBoundedBuffer(size int) *boundedBuffer {
+	b := &boundedBuffer{size: size}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Write writes p to the buffer, blocking until there is enough room
+// or the reader side is closed.
+func (b *boundedBuffer) Write(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(p) > 0 {
+		for b.buf.Len() >= b.size && !b.closed {
+			b.cond.Wait()
+		}
+		if b.closed {
+			return n, io.ErrClosedPipe
+		}
+		k := b.size - b.buf.Len()
+		if k > len(p) {
+			k = len(p)
+		}
+		b.buf.Write(p[:k])
+		p = p[k:]
+		n += k
+		b.cond.Broadcast()
+	}
+	return n, nil
+}
+
+// Read reads from the buffer, blocking until data is available or
+// the writer side is closed.
+func (b *boundedBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.buf.Len() == 0 && b.err == nil && !b.closed {
+		b.cond.Wait()
+	}
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if b.buf.Len() > 0 {
+		n, _ := b.buf.Read(p)
+		b.cond.Broadcast()
+		return n, nil
+	}
+	return 0, b.err
+}
+
+// CloseWithError closes the writer side, subsequent reads return err
+// once the buffer is drained, or io.EOF if err is nil.
+func (b *boundedBuffer) CloseWithError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		err = io.EOF
+	}
+	if b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
+
+// Close closes the reader side, pending and subsequent writes fail.
+func (b *boundedBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	// release the buffer memory, Reset would keep it allocated
+	b.buf = bytes.Buffer{}
+	b.cond.Broadcast()
+	return nil
+}
+
+// layerStream is a layer blob streamed from the image source.
+type layerStream struct {
+	info types.BlobInfo
+	// digest is the digest of the streamed content, it differs from
+	// the blob digest when the layer is decompressed on the fly.
+	digest digest.Digest
+	zstd   bool
+	buf    *boundedBuffer
+}
+
+// lazyEngine is a read-only cas.Engine serving the blobs of a single
+// image manifest directly from an image source, so the layers can be
+// unpacked without staging a copy of the image. Layers are downloaded
+// concurrently in manifest order, each download buffers at most a part
+// size in memory ahead of the unpacker.
+type lazyEngine struct {
+	src          types.ImageSource
+	config       []byte
+	configDigest digest.Digest
+	layers       []*layerStream
+	next         int
+	cancel       context.CancelFunc
+}
+
+// newLazyEngine returns an engine serving the blobs of manifest from src
+// and starts the layer downloads. zstd compressed layers, not supported
+// by umoci, are decompressed on the fly and their manifest descriptors
+// are replaced accordingly.
+func newLazyEngine(ctx context.Context, src types.ImageSource, m *imgspecv1.Manifest, config []byte, concurrency int, partSize int64) (*lazyEngine, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("invalid download concurrency value (%v)", concurrency)
+	}
+	if partSize < 1 {
+		return nil, fmt.Errorf("invalid download part size (%v)", partSize)
+	}
+
+	var img imgspecv1.Image
+	if err := json.Unmarshal(config, &img); err != nil {
+		return nil, fmt.Errorf("while decoding image configuration: %s", err)
+	}
+
+	e := &lazyEngine{
+		src:          src,
+		config:       config,
+		configDigest: m.Config.Digest,
+	}
+
+	for i, l := range m.Layers {
+		s := &layerStream{
+			info:   types.BlobInfo{Digest: l.Digest, Size: l.Size, URLs: l.URLs, MediaType: l.MediaType},
+			digest: l.Digest,
+			zstd:   isZstdLayer(l),
+			buf:    newBoundedBuffer(int(partSize)),
+		}
+		if s.zstd {
+			if i >= len(img.RootFS.DiffIDs) {
+				return nil, fmt.Errorf("no diff ID found for layer %s", l.Digest)
+			}
+			mediaType := imgspecv1.MediaTypeImageLayer
+			if l.MediaType == imgspecv1.MediaTypeImageLayerNonDistributableZstd {
+				mediaType = imgspecv1.MediaTypeImageLayerNonDistributable
+			}
+			// the uncompressed size is unknown
+			s.digest = img.RootFS.DiffIDs[i]
+			m.Layers[i] = imgspecv1.Descriptor{
+				MediaType: mediaType,
+				Digest:    s.digest,
+				Size:      -1,
+			}
+		}
+		e.layers = append(e.layers, s)
+	}
+
+	ctx, e.cancel = context.WithCancel(ctx)
+	go e.download(ctx, concurrency)
+
+	return e, nil
+}
+
+// download starts the layer downloads in manifest order, with at most
+// concurrency downloads in progress. As the unpacker consumes layers in
+// the same order, the next layer to unpack is always being downloaded.
+func (e *lazyEngine) download(ctx context.Context, concurrency int) {
+	sem := make(chan struct{}, concurrency)
+
+	for _, s := range e.layers {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			s.buf.CloseWithError(ctx.Err())
+			continue
+		}
+		go func(s *layerStream) {
+			defer func() { <-sem }()
+			s.buf.CloseWithError(e.fetch(ctx, s))
+		}(s)
+	}
+}
+
+// fetch copies the layer blob into the layer stream buffer.
+func (e *lazyEngine) fetch(ctx context.Context, s *layerStream) error {
+	sylog.Debugf("Streaming layer %s", s.info.Digest)
+
+	rc, _, err := e.src.GetBlob(ctx, s.info, none.NoCache)
+	if err != nil {
+		return fmt.Errorf("while fetching layer %s: %s", s.info.Digest, err)
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if s.zstd {
+		dec, err := zstd.NewReader(rc, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("while decompressing layer %s: %s", s.info.Digest, err)
+		}
+		defer dec.Close()
+		r = dec
+	}
+
+	if _, err := io.Copy(s.buf, r); err != nil && err != io.ErrClosedPipe {
+		return fmt.Errorf("while fetching layer %s: %s", s.info.Digest, err)
+	}
+	return nil
+}
+
+// GetBlob returns the image configuration or the next layer stream,
+// layers can only be read once and in manifest order.
+func (e *lazyEngine) GetBlob(ctx context.Context, d digest.Digest) (io.ReadCloser, error) {
+	if d == e.configDigest {
+		return ioutil.NopCloser(bytes.NewReader(e.config)), nil
+	}
+	if e.next < len(e.layers) && e.layers[e.next].digest == d {
+		s := e.layers[e.next]
+		e.next++
+		return s.buf, nil
+	}
+	return nil, cas.ErrNotExist
+}
+
+// releaseLayer closes the stream of an unpacked layer, so its buffer and
+// download are released before the next layers are unpacked. It's called
+// by umoci after each layer is unpacked.
+func (e *lazyEngine) releaseLayer(_ imgspecv1.Manifest, d imgspecv1.Descriptor) error {
+	for _, s := range e.layers[:e.next] {
+		if s.digest == d.Digest {
+			return s.buf.Close()
+		}
+	}
+	return nil
+}
+
+// PutBlob is not supported by the read-only engine.
+func (e *lazyEngine) PutBlob(ctx context.Context, reader io.Reader) (digest.Digest, int64, error) {
+	return "", -1, cas.ErrNotImplemented
+}
+
+// PutIndex is not supported by the read-only engine.
+func (e *lazyEngine) PutIndex(ctx context.Context, index imgspecv1.Index) error {
+	return cas.ErrNotImplemented
+}
+
+// GetIndex is not supported, the engine serves a single manifest.
+func (e *lazyEngine) GetIndex(ctx context.Context) (imgspecv1.Index, error) {
+	return imgspecv1.Index{}, cas.ErrNotImplemented
+}
+
+// DeleteBlob is not supported by the read-only engine.
+func (e *lazyEngine) DeleteBlob(ctx context.Context, d digest.Digest) error {
+	return cas.ErrNotImplemented
+}
+
+// ListBlobs returns the digests of the configuration and layers.
+func (e *lazyEngine) ListBlobs(ctx context.Context) ([]digest.Digest, error) {
+	digests := []digest.Digest{e.configDigest}
+	for _, s := range e.layers {
+		digests = append(digests, s.digest)
+	}
+	return digests, nil
+}
+
+// Clean has nothing to clean.
+func (e *lazyEngine) Clean(ctx context.Context) error {
+	return nil
+}
+
+// Close stops the downloads in progress.
+func (e *lazyEngine) Close() error {
+	e.cancel()
+	for _, s := range e.layers {
+		s.buf.Close()
+	}
+	return nil
+}
+
+// lazyImage returns the OCI manifest and configuration of the image
+// referenced by ref, the image is resolved for the platform described
+// by sysCtx when ref is a manifest list. The returned image source
+// must be closed by the caller.
+func lazyImage(ctx context.Context, ref types.ImageReference, sysCtx *types.SystemContext) (types.ImageSource, *imgspecv1.Manifest, []byte, error) {
+	src, err := ref.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error creating image source: %s", err)
+	}
+
+	m, config, err := ociManifest(ctx, src, sysCtx)
+	if err != nil {
+		src.Close()
+		return nil, nil, nil, err
+	}
+	return src, m, config, nil
+}
+
+// ociManifest returns the manifest and configuration of the image
+// provided by src converted to the OCI format.
+func ociManifest(ctx context.Context, src types.ImageSource, sysCtx *types.SystemContext) (*imgspecv1.Manifest, []byte, error) {
+	var instance *digest.Digest
+
+	b, mediaType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error obtaining manifest source: %s", err)
+	}
+	if manifest.MIMETypeIsMultiImage(mediaType) {
+		list, err := manifest.ListFromBlob(b, mediaType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing manifest list: %s", err)
+		}
+		d, err := list.ChooseInstance(sysCtx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error choosing image instance: %s", err)
+		}
+		instance = &d
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sysCtx, image.UnparsedInstance(src, instance))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading image: %s", err)
+	}
+	if _, mediaType, err = img.Manifest(ctx); err != nil {
+		return nil, nil, fmt.Errorf("error obtaining manifest source: %s", err)
+	}
+	if mediaType != imgspecv1.MediaTypeImageManifest {
+		img, err = img.UpdatedImage(ctx, types.ManifestUpdateOptions{ManifestMIMEType: imgspecv1.MediaTypeImageManifest})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error converting manifest: %s", err)
+		}
+	}
+
+	b, _, err = img.Manifest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error obtaining manifest source: %s", err)
+	}
+	m := new(imgspecv1.Manifest)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, nil, fmt.Errorf("error decoding manifest: %s", err)
+	}
+
+	config, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error obtaining image configuration: %s", err)
+	}
+	return m, config, nil
+}
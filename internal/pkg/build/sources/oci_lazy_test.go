@@ -0,0 +1,215 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/umoci/oci/cas"
+	"github.com/opencontainers/umoci/oci/casext"
+)
+
+// blobSource is an image source serving blobs from memory.
+type blobSource struct {
+	types.ImageSource
+	blobs map[digest.Digest][]byte
+}
+
+func (s *blobSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	b, ok := s.blobs[info.Digest]
+	if !ok {
+		return nil, -1, fmt.Errorf("blob %s not found", info.Digest)
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+}
+
+func (s *blobSource) Close() error {
+	return nil
+}
+
+func TestBoundedBuffer(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	b := newBoundedBuffer(16)
+	go func() {
+		for i := 0; i < len(data); i += 7 {
+			end := i + 7
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := b.Write(data[i:end]); err != nil {
+				b.CloseWithError(err)
+				return
+			}
+		}
+		b.CloseWithError(nil)
+	}()
+
+	got, err := ioutil.ReadAll(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("unexpected buffer content")
+	}
+
+	expectedErr := errors.New("download error")
+	b = newBoundedBuffer(16)
+	b.Write([]byte("data"))
+	b.CloseWithError(expectedErr)
+	if got, err := ioutil.ReadAll(b); !errors.Is(err, expectedErr) || string(got) != "data" {
+		t.Errorf("got %q and error %v, expected %q and error %v", got, err, "data", expectedErr)
+	}
+
+	b = newBoundedBuffer(16)
+	b.Close()
+	if _, err := b.Write(data); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("got error %v, expected %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestLazyEngine(t *testing.T) {
+	ctx := context.Background()
+
+	layers := [][]byte{
+		bytes.Repeat([]byte("first layer "), 50),
+		bytes.Repeat([]byte("second layer "), 50),
+		bytes.Repeat([]byte("third layer "), 50),
+	}
+
+	var compressed bytes.Buffer
+	enc, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	enc.Write(layers[1])
+	enc.Close()
+
+	src := &blobSource{blobs: make(map[digest.Digest][]byte)}
+	m := &imgspecv1.Manifest{}
+	img := imgspecv1.Image{RootFS: imgspecv1.RootFS{Type: "layers"}}
+
+	for i, l := range layers {
+		mediaType := imgspecv1.MediaTypeImageLayer
+		if i == 1 {
+			mediaType = imgspecv1.MediaTypeImageLayerZstd
+			l = compressed.Bytes()
+		}
+		d := digest.FromBytes(l)
+		src.blobs[d] = l
+		m.Layers = append(m.Layers, imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(l))})
+		img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, digest.FromBytes(layers[i]))
+	}
+	// a layer missing from the source
+	missing := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageLayer, Digest: digest.FromString("missing"), Size: 7}
+	m.Layers = append(m.Layers, missing)
+	img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, missing.Digest)
+
+	config, err := json.Marshal(img)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m.Config = imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: digest.FromBytes(config), Size: int64(len(config))}
+
+	e, err := newLazyEngine(ctx, src, m, config, 2, 16)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer e.Close()
+
+	if m.Layers[1].MediaType != imgspecv1.MediaTypeImageLayer || m.Layers[1].Digest != img.RootFS.DiffIDs[1] {
+		t.Errorf("zstd layer descriptor not replaced: %+v", m.Layers[1])
+	}
+
+	engine := casext.NewEngine(e)
+
+	read := func(desc imgspecv1.Descriptor) ([]byte, error) {
+		r, err := engine.GetVerifiedBlob(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+
+	b, err := read(m.Config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(b, config) {
+		t.Errorf("unexpected configuration content")
+	}
+
+	// layers can only be read in manifest order
+	if _, err := e.GetBlob(ctx, m.Layers[1].Digest); !errors.Is(err, cas.ErrNotExist) {
+		t.Errorf("got error %v, expected %v", err, cas.ErrNotExist)
+	}
+
+	for i, l := range layers {
+		b, err := read(m.Layers[i])
+		if err != nil {
+			t.Fatalf("unexpected error while reading layer %d: %s", i, err)
+		}
+		if !bytes.Equal(b, l) {
+			t.Errorf("unexpected layer %d content", i)
+		}
+	}
+
+	if _, err := read(missing); err == nil {
+		t.Errorf("unexpected success while reading missing layer")
+	}
+}
+
+func TestLazyEngineReleaseLayer(t *testing.T) {
+	ctx := context.Background()
+
+	layer := bytes.Repeat([]byte("layer "), 50)
+	d := digest.FromBytes(layer)
+	src := &blobSource{blobs: map[digest.Digest][]byte{d: layer}}
+
+	img := imgspecv1.Image{RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{d}}}
+	config, err := json.Marshal(img)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	desc := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageLayer, Digest: d, Size: int64(len(layer))}
+	m := &imgspecv1.Manifest{
+		Config: imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers: []imgspecv1.Descriptor{desc},
+	}
+
+	e, err := newLazyEngine(ctx, src, m, config, 1, 16)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer e.Close()
+
+	r, err := e.GetBlob(ctx, d)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the layer is released without being closed by the reader
+	if err := e.releaseLayer(*m, desc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Errorf("got error %v, expected %v", err, io.ErrClosedPipe)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 
 	apexlog "github.com/apex/log"
+	"github.com/apptainer/apptainer/internal/pkg/client"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	sytypes "github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -28,12 +29,69 @@ import (
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/opencontainers/umoci"
+	"github.com/opencontainers/umoci/oci/cas"
 	umocilayer "github.com/opencontainers/umoci/oci/layer"
 	"github.com/opencontainers/umoci/pkg/idtools"
 )
 
 // unpackRootfs extracts all of the layers of the given image reference into the rootfs of the provided bundle
 func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageReference, sysCtx *types.SystemContext) (err error) {
+	engineExt, err := umoci.OpenLayout(b.TmpDir)
+	if err != nil {
+		return fmt.Errorf("error opening layout: %s", err)
+	}
+
+	// Obtain the manifest
+	imageSource, err := tmpfsRef.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return fmt.Errorf("error creating image source: %s", err)
+	}
+	manifestData, mediaType, err := imageSource.GetManifest(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error obtaining manifest source: %s", err)
+	}
+	if mediaType != imgspecv1.MediaTypeImageManifest {
+		return fmt.Errorf("error verifying manifest media type: %s", mediaType)
+	}
+	var manifest imgspecv1.Manifest
+	json.Unmarshal(manifestData, &manifest)
+
+	// zstd and zstd:chunked layers are not supported by umoci
+	if err := decompressZstdLayers(ctx, engineExt, &manifest); err != nil {
+		return err
+	}
+
+	return unpackManifest(ctx, b, engineExt, manifest, nil)
+}
+
+// unpackLazyRootfs extracts all of the layers of the given image reference into
+// the rootfs of the provided bundle, the layers are streamed from the image source
+// without being stored first
+func unpackLazyRootfs(ctx context.Context, b *sytypes.Bundle, srcRef types.ImageReference, sysCtx *types.SystemContext) error {
+	dl, err := client.DownloadConfig()
+	if err != nil {
+		return err
+	}
+
+	src, manifest, config, err := lazyImage(ctx, srcRef, sysCtx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	engine, err := newLazyEngine(ctx, src, manifest, config, int(dl.Concurrency), dl.PartSize)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	return unpackManifest(ctx, b, engine, *manifest, engine.releaseLayer)
+}
+
+// unpackManifest extracts all of the layers of the image manifest, with blobs
+// provided by engine, into the rootfs of the provided bundle, afterLayer is
+// called if set once each layer is unpacked
+func unpackManifest(ctx context.Context, b *sytypes.Bundle, engine cas.Engine, manifest imgspecv1.Manifest, afterLayer umocilayer.AfterLayerUnpackCallback) (err error) {
 	var mapOptions umocilayer.MapOptions
 
 	loggerLevel := sylog.GetLevel()
@@ -71,36 +129,27 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 		mapOptions.GIDMappings = append(mapOptions.GIDMappings, gidMap)
 	}
 
-	engineExt, err := umoci.OpenLayout(b.TmpDir)
-	if err != nil {
-		return fmt.Errorf("error opening layout: %s", err)
-	}
-
-	// Obtain the manifest
-	imageSource, err := tmpfsRef.NewImageSource(ctx, sysCtx)
-	if err != nil {
-		return fmt.Errorf("error creating image source: %s", err)
-	}
-	manifestData, mediaType, err := imageSource.GetManifest(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("error obtaining manifest source: %s", err)
-	}
-	if mediaType != imgspecv1.MediaTypeImageManifest {
-		return fmt.Errorf("error verifying manifest media type: %s", mediaType)
-	}
-	var manifest imgspecv1.Manifest
-	json.Unmarshal(manifestData, &manifest)
-
 	// UnpackRootfs from umoci v0.4.2 expects a path to a non-existing directory
 	os.RemoveAll(b.RootfsPath)
 
 	// Unpack root filesystem
-	unpackOptions := umocilayer.UnpackOptions{MapOptions: mapOptions}
-	err = umocilayer.UnpackRootfs(ctx, engineExt, b.RootfsPath, manifest, &unpackOptions)
+	unpackOptions := umocilayer.UnpackOptions{
+		MapOptions:       mapOptions,
+		AfterLayerUnpack: afterLayer,
+	}
+	err = umocilayer.UnpackRootfs(ctx, engine, b.RootfsPath, manifest, &unpackOptions)
 	if err != nil {
 		return fmt.Errorf("error unpacking rootfs: %s", err)
 	}
 
+	// estargz layers are extracted like gzip layers, except
+	// for their metadata files
+	if hasEstargzLayers(manifest) {
+		if err := removeEstargzMetadata(b.RootfsPath); err != nil {
+			return err
+		}
+	}
+
 	// If the `--fix-perms` flag was used, then modify the permissions so that
 	// content has owner rwX and we're done
 	if b.Opts.FixPerms {
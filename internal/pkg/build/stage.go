@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
 	envUtil "github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/machine"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/sylog"
 )
@@ -84,6 +86,13 @@ func (s *stage) runSectionScript(name string, script types.Script) error {
 
 func (s *stage) runPostScript(sessionResolv, sessionHosts string) error {
 	if s.b.Recipe.BuildData.Post.Script != "" {
+		// a foreign architecture %post script is executed through the
+		// user-mode emulator registered with binfmt_misc, the F flag
+		// is required to use the emulator from within the container
+		if arch := s.b.Opts.TargetArch(); !machine.CompatibleWith(arch) {
+			return fmt.Errorf("could not run %%post script for %s architecture on %s host: register a qemu-user emulator for %s in /proc/sys/fs/binfmt_misc with the F flag", arch, runtime.GOARCH, arch)
+		}
+
 		cmdArgs := []string{"-s", "--build-config", "exec", "--pwd", "/", "--writable"}
 		cmdArgs = append(cmdArgs, "--cleanenv", "--env", aEnvironment, "--env", sEnvironment, "--env", aLabels, "--env", sLabels)
 
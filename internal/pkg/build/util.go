@@ -27,8 +27,9 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-// ConvertOciToSIF will convert an OCI source into a SIF using the build routines
-func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedImgPath, tmpDir string, noHTTPS, noCleanUp bool, authConf *ocitypes.DockerAuthConfig) error {
+// ConvertOciToSIF will convert an OCI source into a SIF using the build routines,
+// arch selects the image platform, the host architecture is used if empty
+func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedImgPath, tmpDir string, noHTTPS, noCleanUp bool, authConf *ocitypes.DockerAuthConfig, arch string) error {
 	if imgCache == nil {
 		return fmt.Errorf("image cache is undefined")
 	}
@@ -46,6 +47,7 @@ func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedI
 				NoHTTPS:          noHTTPS,
 				DockerAuthConfig: authConf,
 				ImgCache:         imgCache,
+				Arch:             arch,
 			},
 		},
 	)
@@ -0,0 +1,419 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package cdi implements the loading of Container Device Interface (CDI)
+// specification files and the resolution of fully qualified device names,
+// of the form vendor.com/class=name, into the container edits (device
+// nodes, mounts, environment variables and hooks) to apply to a container.
+// See https://github.com/cncf-tags/container-device-interface for the
+// specification format.
+package cdi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/blang/semver/v4"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v2"
+)
+
+// SpecDirs are the directories where CDI specification files are looked
+// for, in increasing order of priority.
+var SpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+const (
+	// minVersion and maxVersion are the supported range of
+	// specification versions.
+	minVersion = "0.3.0"
+	maxVersion = "0.6.0"
+)
+
+var (
+	vendorRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.-]*[a-zA-Z0-9])?$`)
+	classRegexp  = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_-]*[a-zA-Z0-9])?$`)
+	nameRegexp   = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.:-]*[a-zA-Z0-9])?$`)
+)
+
+// hookNames are the OCI hook names supported in container edits.
+var hookNames = map[string]bool{
+	"prestart":        true,
+	"createRuntime":   true,
+	"createContainer": true,
+	"startContainer":  true,
+	"poststart":       true,
+	"poststop":        true,
+}
+
+// Spec describes a CDI specification file.
+type Spec struct {
+	Version        string         `json:"cdiVersion" yaml:"cdiVersion"`
+	Kind           string         `json:"kind" yaml:"kind"`
+	Devices        []Device       `json:"devices" yaml:"devices"`
+	ContainerEdits ContainerEdits `json:"containerEdits,omitempty" yaml:"containerEdits,omitempty"`
+	// Path is the path of the specification file.
+	Path string `json:"-" yaml:"-"`
+}
+
+// Device describes a device of a CDI specification.
+type Device struct {
+	Name           string         `json:"name" yaml:"name"`
+	ContainerEdits ContainerEdits `json:"containerEdits" yaml:"containerEdits"`
+}
+
+// ContainerEdits describes the edits applied to a container to
+// make devices available.
+type ContainerEdits struct {
+	Env         []string      `json:"env,omitempty" yaml:"env,omitempty"`
+	DeviceNodes []*DeviceNode `json:"deviceNodes,omitempty" yaml:"deviceNodes,omitempty"`
+	Hooks       []*Hook       `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Mounts      []*Mount      `json:"mounts,omitempty" yaml:"mounts,omitempty"`
+}
+
+// DeviceNode describes a device node made available in the container.
+type DeviceNode struct {
+	Path        string  `json:"path" yaml:"path"`
+	HostPath    string  `json:"hostPath,omitempty" yaml:"hostPath,omitempty"`
+	Type        string  `json:"type,omitempty" yaml:"type,omitempty"`
+	Major       int64   `json:"major,omitempty" yaml:"major,omitempty"`
+	Minor       int64   `json:"minor,omitempty" yaml:"minor,omitempty"`
+	FileMode    *uint32 `json:"fileMode,omitempty" yaml:"fileMode,omitempty"`
+	Permissions string  `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	UID         *uint32 `json:"uid,omitempty" yaml:"uid,omitempty"`
+	GID         *uint32 `json:"gid,omitempty" yaml:"gid,omitempty"`
+}
+
+// Mount describes a host path bind mounted in the container.
+type Mount struct {
+	HostPath      string   `json:"hostPath" yaml:"hostPath"`
+	ContainerPath string   `json:"containerPath" yaml:"containerPath"`
+	Type          string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Options       []string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// Hook describes an OCI hook executed for the container.
+type Hook struct {
+	HookName string   `json:"hookName" yaml:"hookName"`
+	Path     string   `json:"path" yaml:"path"`
+	Args     []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Env      []string `json:"env,omitempty" yaml:"env,omitempty"`
+	Timeout  *int     `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ParseQualifiedName parses a fully qualified device name of the form
+// vendor.com/class=name and returns the device kind (vendor.com/class)
+// and the device name.
+func ParseQualifiedName(device string) (string, string, error) {
+	parts := strings.SplitN(device, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("device %q is not a fully qualified CDI device name (vendor.com/class=name)", device)
+	}
+	if err := validateKind(parts[0]); err != nil {
+		return "", "", fmt.Errorf("device %q: %s", device, err)
+	}
+	if !nameRegexp.MatchString(parts[1]) {
+		return "", "", fmt.Errorf("device %q: invalid device name %q", device, parts[1])
+	}
+	return parts[0], parts[1], nil
+}
+
+func validateKind(kind string) error {
+	parts := strings.SplitN(kind, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid kind %q, must be vendor.com/class", kind)
+	}
+	if !vendorRegexp.MatchString(parts[0]) {
+		return fmt.Errorf("invalid vendor %q in kind %q", parts[0], kind)
+	}
+	if !classRegexp.MatchString(parts[1]) {
+		return fmt.Errorf("invalid class %q in kind %q", parts[1], kind)
+	}
+	return nil
+}
+
+// Validate checks that the specification is correct.
+func (s *Spec) Validate() error {
+	v, err := semver.Parse(s.Version)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %s", s.Version, err)
+	}
+	if v.LT(semver.MustParse(minVersion)) || v.GT(semver.MustParse(maxVersion)) {
+		return fmt.Errorf("unsupported version %s, supported versions are %s to %s", s.Version, minVersion, maxVersion)
+	}
+	if err := validateKind(s.Kind); err != nil {
+		return err
+	}
+	if len(s.Devices) == 0 {
+		return fmt.Errorf("no devices defined")
+	}
+	if err := s.ContainerEdits.Validate(); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, d := range s.Devices {
+		if !nameRegexp.MatchString(d.Name) {
+			return fmt.Errorf("invalid device name %q", d.Name)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("device %q defined more than once", d.Name)
+		}
+		names[d.Name] = true
+		if err := d.ContainerEdits.Validate(); err != nil {
+			return fmt.Errorf("device %q: %s", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the container edits are correct.
+func (e *ContainerEdits) Validate() error {
+	for _, env := range e.Env {
+		if !strings.Contains(env, "=") || strings.HasPrefix(env, "=") {
+			return fmt.Errorf("invalid environment variable %q", env)
+		}
+	}
+	for _, d := range e.DeviceNodes {
+		if !filepath.IsAbs(d.Path) {
+			return fmt.Errorf("device node path %q must be an absolute path", d.Path)
+		}
+		if d.HostPath != "" && !filepath.IsAbs(d.HostPath) {
+			return fmt.Errorf("device node host path %q must be an absolute path", d.HostPath)
+		}
+		switch d.Type {
+		case "", "b", "c", "u", "p":
+		default:
+			return fmt.Errorf("invalid type %q for device node %s", d.Type, d.Path)
+		}
+		if strings.Trim(d.Permissions, "rwm") != "" {
+			return fmt.Errorf("invalid permissions %q for device node %s", d.Permissions, d.Path)
+		}
+	}
+	for _, m := range e.Mounts {
+		if !filepath.IsAbs(m.HostPath) {
+			return fmt.Errorf("mount host path %q must be an absolute path", m.HostPath)
+		}
+		if !filepath.IsAbs(m.ContainerPath) {
+			return fmt.Errorf("mount container path %q must be an absolute path", m.ContainerPath)
+		}
+		if m.Type != "" && m.Type != "bind" {
+			return fmt.Errorf("unsupported mount type %q for %s, only bind mounts are supported", m.Type, m.ContainerPath)
+		}
+	}
+	for _, h := range e.Hooks {
+		if !hookNames[h.HookName] {
+			return fmt.Errorf("invalid hook name %q", h.HookName)
+		}
+		if !filepath.IsAbs(h.Path) {
+			return fmt.Errorf("hook path %q must be an absolute path", h.Path)
+		}
+	}
+	return nil
+}
+
+// Append appends the edits o to the container edits.
+func (e *ContainerEdits) Append(o *ContainerEdits) {
+	e.Env = append(e.Env, o.Env...)
+	e.DeviceNodes = append(e.DeviceNodes, o.DeviceNodes...)
+	e.Hooks = append(e.Hooks, o.Hooks...)
+	e.Mounts = append(e.Mounts, o.Mounts...)
+}
+
+// GetHostPath returns the path of the device node on the host.
+func (d *DeviceNode) GetHostPath() string {
+	if d.HostPath != "" {
+		return d.HostPath
+	}
+	return d.Path
+}
+
+// Registry holds the devices defined by CDI specification files.
+type Registry struct {
+	// devices maps fully qualified device names to their specification.
+	devices map[string]*Spec
+}
+
+// Load loads the CDI specification files (*.json, *.yaml) found in the
+// supplied directories. A device defined in a directory overrides the
+// device with the same name defined in a previous directory, the same
+// device defined twice in a directory is an error. When root is true,
+// directories and specification files must be owned by root.
+func Load(dirs []string, root bool) (*Registry, error) {
+	r := &Registry{devices: make(map[string]*Spec)}
+
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			sylog.Debugf("CDI specification directory %s doesn't exist, skipping", dir)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading CDI specification directory %s: %s", dir, err)
+		}
+		if root && !fs.IsOwner(dir, 0) {
+			return nil, fmt.Errorf("CDI specification directory %s must be owned by root", dir)
+		}
+
+		// devices defined in this directory
+		dirDevices := make(map[string]*Spec)
+
+		sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+		for _, f := range files {
+			ext := filepath.Ext(f.Name())
+			if f.IsDir() || (ext != ".json" && ext != ".yaml") {
+				continue
+			}
+			path := filepath.Join(dir, f.Name())
+			if root && !fs.IsOwner(path, 0) {
+				return nil, fmt.Errorf("CDI specification %s must be owned by root", path)
+			}
+			s, err := loadSpec(path)
+			if err != nil {
+				return nil, fmt.Errorf("while loading CDI specification %s: %s", path, err)
+			}
+			for _, d := range s.Devices {
+				name := s.Kind + "=" + d.Name
+				if prev, ok := dirDevices[name]; ok {
+					return nil, fmt.Errorf("device %s defined in both %s and %s", name, prev.Path, s.Path)
+				}
+				dirDevices[name] = s
+			}
+		}
+
+		for name, s := range dirDevices {
+			r.devices[name] = s
+		}
+	}
+
+	return r, nil
+}
+
+func loadSpec(path string) (*Spec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Spec)
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(b, s)
+	} else {
+		err = yaml.UnmarshalStrict(b, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	s.Path = path
+	return s, nil
+}
+
+// Devices returns the sorted list of fully qualified device names.
+func (r *Registry) Devices() []string {
+	names := make([]string, 0, len(r.devices))
+	for name := range r.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Edits returns the container edits for the fully qualified device names,
+// specification wide edits are applied once for each specification. Host
+// device nodes must exist.
+func (r *Registry) Edits(devices []string) (*ContainerEdits, error) {
+	edits := new(ContainerEdits)
+	specs := make(map[*Spec]bool)
+
+	for _, device := range devices {
+		kind, name, err := ParseQualifiedName(device)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := r.devices[kind+"="+name]
+		if !ok {
+			return nil, fmt.Errorf("unresolvable CDI device %s", device)
+		}
+		if !specs[s] {
+			specs[s] = true
+			edits.Append(&s.ContainerEdits)
+		}
+		for i := range s.Devices {
+			if s.Devices[i].Name == name {
+				edits.Append(&s.Devices[i].ContainerEdits)
+				break
+			}
+		}
+	}
+
+	for _, d := range edits.DeviceNodes {
+		if err := d.check(); err != nil {
+			return nil, fmt.Errorf("CDI device node %s: %s", d.Path, err)
+		}
+	}
+
+	return edits, nil
+}
+
+// check returns an error if the device node can't be made available as
+// declared. Device nodes are bind mounted from the host, so the type and
+// the major and minor numbers must match those of the host device node,
+// and ownership and permissions can't be changed.
+func (d *DeviceNode) check() error {
+	if d.FileMode != nil || d.UID != nil || d.GID != nil {
+		return fmt.Errorf("setting fileMode, uid or gid is not supported, device nodes are bound from the host")
+	}
+	if d.Permissions != "" {
+		return fmt.Errorf("setting permissions is not supported, device access is not restricted")
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(d.GetHostPath(), &st); err != nil {
+		return &os.PathError{Op: "stat", Path: d.GetHostPath(), Err: err}
+	}
+	if d.Type == "" && d.Major == 0 && d.Minor == 0 {
+		return nil
+	}
+
+	var typ string
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFCHR:
+		typ = "c"
+	case unix.S_IFBLK:
+		typ = "b"
+	case unix.S_IFIFO:
+		typ = "p"
+	}
+	want := d.Type
+	if want == "u" {
+		want = "c"
+	}
+	if want != "" && want != typ {
+		return fmt.Errorf("host path %s is not a device node of type %s", d.GetHostPath(), d.Type)
+	}
+
+	if d.Major == 0 && d.Minor == 0 {
+		return nil
+	} else if typ == "" || typ == "p" {
+		return fmt.Errorf("host path %s has no major and minor numbers", d.GetHostPath())
+	}
+	if major, minor := int64(unix.Major(st.Rdev)), int64(unix.Minor(st.Rdev)); d.Major != major || d.Minor != minor {
+		return fmt.Errorf("host path %s is device %d:%d, not %d:%d", d.GetHostPath(), major, minor, d.Major, d.Minor)
+	}
+	return nil
+}
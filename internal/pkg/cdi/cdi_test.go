@@ -0,0 +1,297 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cdi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeSpec(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("while writing specification %s: %s", name, err)
+	}
+}
+
+func TestParseQualifiedName(t *testing.T) {
+	tests := []struct {
+		device  string
+		kind    string
+		name    string
+		wantErr bool
+	}{
+		{device: "vendor.com/gpu=0", kind: "vendor.com/gpu", name: "0"},
+		{device: "example.org/fpga=dev_1.a", kind: "example.org/fpga", name: "dev_1.a"},
+		{device: "vendor.com/gpu", wantErr: true},
+		{device: "vendor.com/gpu=", wantErr: true},
+		{device: "gpu=0", wantErr: true},
+		{device: "vendor.com/gpu=a b", wantErr: true},
+		{device: "-vendor/gpu=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.device, func(t *testing.T) {
+			kind, name, err := ParseQualifiedName(tt.device)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			}
+			if kind != tt.kind || name != tt.name {
+				t.Errorf("got %s=%s, expected %s=%s", kind, name, tt.kind, tt.name)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		err  string
+	}{
+		{
+			name: "BadVersion",
+			spec: `{"cdiVersion": "0.1.0", "kind": "vendor.com/gpu", "devices": [{"name": "0"}]}`,
+			err:  "unsupported version",
+		},
+		{
+			name: "BadKind",
+			spec: `{"cdiVersion": "0.5.0", "kind": "gpu", "devices": [{"name": "0"}]}`,
+			err:  "invalid kind",
+		},
+		{
+			name: "NoDevices",
+			spec: `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu"}`,
+			err:  "no devices defined",
+		},
+		{
+			name: "DuplicateDevice",
+			spec: `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu", "devices": [{"name": "0"}, {"name": "0"}]}`,
+			err:  "defined more than once",
+		},
+		{
+			name: "RelativeDeviceNode",
+			spec: `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu", "devices": [{"name": "0", "containerEdits": {"deviceNodes": [{"path": "dev/gpu0"}]}}]}`,
+			err:  "must be an absolute path",
+		},
+		{
+			name: "MountType",
+			spec: `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu", "devices": [{"name": "0"}], "containerEdits": {"mounts": [{"hostPath": "/a", "containerPath": "/b", "type": "tmpfs"}]}}`,
+			err:  "only bind mounts are supported",
+		},
+		{
+			name: "HookName",
+			spec: `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu", "devices": [{"name": "0"}], "containerEdits": {"hooks": [{"hookName": "prerun", "path": "/bin/true"}]}}`,
+			err:  "invalid hook name",
+		},
+		{
+			name: "Environment",
+			spec: `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu", "devices": [{"name": "0", "containerEdits": {"env": ["FOO"]}}]}`,
+			err:  "invalid environment variable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSpec(t, dir, "spec.json", tt.spec)
+			_, err := Load([]string{dir}, false)
+			if err == nil {
+				t.Fatalf("unexpected success")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %q, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+
+	writeSpec(t, dir1, "gpu.json", `{
+		"cdiVersion": "0.5.0",
+		"kind": "vendor.com/gpu",
+		"devices": [{"name": "0"}, {"name": "1"}]
+	}`)
+	writeSpec(t, dir1, "README", "not a specification")
+	// overrides vendor.com/gpu=1 from the first directory
+	writeSpec(t, dir2, "gpu.yaml", `
+cdiVersion: 0.5.0
+kind: vendor.com/gpu
+devices:
+- name: "1"
+  containerEdits:
+    env:
+    - GPU=1
+`)
+
+	r, err := Load([]string{dir1, dir2, filepath.Join(dir1, "nonexistent")}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"vendor.com/gpu=0", "vendor.com/gpu=1"}
+	if devices := r.Devices(); !reflect.DeepEqual(devices, expected) {
+		t.Errorf("got devices %v, expected %v", devices, expected)
+	}
+	edits, err := r.Edits([]string{"vendor.com/gpu=1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(edits.Env, []string{"GPU=1"}) {
+		t.Errorf("device from the second directory not used, got environment %v", edits.Env)
+	}
+
+	// same device defined twice in the same directory
+	writeSpec(t, dir2, "gpu2.json", `{
+		"cdiVersion": "0.5.0",
+		"kind": "vendor.com/gpu",
+		"devices": [{"name": "1"}]
+	}`)
+	if _, err := Load([]string{dir1, dir2}, false); err == nil {
+		t.Errorf("unexpected success with conflicting devices")
+	}
+}
+
+func TestEdits(t *testing.T) {
+	dir := t.TempDir()
+	node := filepath.Join(t.TempDir(), "gpu0")
+	if err := ioutil.WriteFile(node, nil, 0o644); err != nil {
+		t.Fatalf("while creating device node: %s", err)
+	}
+
+	writeSpec(t, dir, "gpu.json", fmt.Sprintf(`{
+		"cdiVersion": "0.5.0",
+		"kind": "vendor.com/gpu",
+		"containerEdits": {
+			"env": ["VENDOR=1"],
+			"hooks": [{"hookName": "createContainer", "path": "/bin/true"}]
+		},
+		"devices": [
+			{"name": "0", "containerEdits": {"deviceNodes": [{"path": "/dev/gpu0", "hostPath": %q}]}},
+			{"name": "1", "containerEdits": {"mounts": [{"hostPath": "/opt", "containerPath": "/opt/gpu", "options": ["ro"]}]}},
+			{"name": "missing", "containerEdits": {"deviceNodes": [{"path": "/dev/nonexistent-gpu"}]}}
+		]
+	}`, node))
+
+	r, err := Load([]string{dir}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	edits, err := r.Edits([]string{"vendor.com/gpu=0", "vendor.com/gpu=1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// specification wide edits are applied once
+	if len(edits.Env) != 1 || len(edits.Hooks) != 1 {
+		t.Errorf("got %d variables and %d hooks, expected 1 of each", len(edits.Env), len(edits.Hooks))
+	}
+	if len(edits.DeviceNodes) != 1 || edits.DeviceNodes[0].GetHostPath() != node {
+		t.Errorf("unexpected device nodes: %v", edits.DeviceNodes)
+	}
+	if len(edits.Mounts) != 1 || edits.Mounts[0].ContainerPath != "/opt/gpu" {
+		t.Errorf("unexpected mounts: %v", edits.Mounts)
+	}
+
+	if _, err := r.Edits([]string{"vendor.com/gpu=2"}); err == nil {
+		t.Errorf("unexpected success with unknown device")
+	}
+	if _, err := r.Edits([]string{"vendor.com/gpu=missing"}); err == nil {
+		t.Errorf("unexpected success with missing host device node")
+	}
+}
+
+func TestEditsDeviceNode(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("while creating file: %s", err)
+	}
+	if _, err := os.Stat("/dev/null"); err != nil {
+		t.Skipf("/dev/null not found: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		node    string
+		wantErr bool
+	}{
+		{
+			name: "HostPathOnly",
+			node: fmt.Sprintf(`{"path": "/dev/file", "hostPath": %q}`, file),
+		},
+		{
+			name: "MatchingDevice",
+			node: `{"path": "/dev/null", "type": "c", "major": 1, "minor": 3}`,
+		},
+		{
+			name: "UnbufferedCharDevice",
+			node: `{"path": "/dev/null", "type": "u"}`,
+		},
+		{
+			name:    "WrongType",
+			node:    `{"path": "/dev/null", "type": "b"}`,
+			wantErr: true,
+		},
+		{
+			name:    "WrongMinor",
+			node:    `{"path": "/dev/null", "type": "c", "major": 1, "minor": 5}`,
+			wantErr: true,
+		},
+		{
+			name:    "NotDevice",
+			node:    fmt.Sprintf(`{"path": "/dev/file", "hostPath": %q, "type": "c"}`, file),
+			wantErr: true,
+		},
+		{
+			name:    "FileMode",
+			node:    `{"path": "/dev/null", "fileMode": 438}`,
+			wantErr: true,
+		},
+		{
+			name:    "Owner",
+			node:    `{"path": "/dev/null", "uid": 0, "gid": 0}`,
+			wantErr: true,
+		},
+		{
+			name:    "Permissions",
+			node:    `{"path": "/dev/null", "permissions": "r"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSpec(t, dir, "node.json", fmt.Sprintf(`{
+				"cdiVersion": "0.5.0",
+				"kind": "vendor.com/node",
+				"devices": [{"name": "0", "containerEdits": {"deviceNodes": [%s]}}]
+			}`, tt.node))
+
+			r, err := Load([]string{dir}, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_, err = r.Edits([]string{"vendor.com/node=0"})
+			if tt.wantErr && err == nil {
+				t.Errorf("unexpected success")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -255,6 +255,18 @@ func checkRootless(group string, systemd bool) (rootless bool, err error) {
 	return true, nil
 }
 
+// CheckRootless returns an error if the cgroups of the current user
+// can't be managed, systemd corresponds to the systemd cgroups directive
+// of apptainer.conf.
+func CheckRootless(systemd bool) error {
+	group := "user.slice:"
+	if os.Getuid() == 0 {
+		group = "system.slice:"
+	}
+	_, err := checkRootless(group, systemd)
+	return err
+}
+
 // newManager creates a new Manager, with the associated resources and cgroup.
 // The Manager is ready to manage the cgroup but does not apply limits etc.
 func newManager(resources *specs.LinuxResources, group string, systemd bool) (manager *Manager, err error) {
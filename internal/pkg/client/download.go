@@ -0,0 +1,557 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// downloadBackoff is the delay before the first retry of an
+	// interrupted transfer, it doubles with each subsequent retry.
+	downloadBackoff = time.Second
+	// maxDownloadBackoff is the maximum delay between two retries.
+	maxDownloadBackoff = 30 * time.Second
+)
+
+// Downloader defines the parameters of resumable downloads.
+type Downloader struct {
+	// Concurrency is the number of parts downloaded concurrently when
+	// the server supports range requests.
+	Concurrency uint
+	// PartSize is the size of each part of concurrent downloads.
+	PartSize int64
+	// BufferSize is the transfer buffer size.
+	BufferSize int64
+	// Retries is the number of times an interrupted transfer is
+	// resumed before giving up, the count is reset each time data
+	// are received.
+	Retries uint
+}
+
+func getEnvInt(key string, defval int64) int64 {
+	envKey := env.TrimApptainerKey(key)
+	if env := env.GetenvLegacy(envKey, envKey); env != "" {
+		if n, err := strconv.ParseInt(env, 10, 0); err == nil {
+			return n
+		}
+		sylog.Warningf("Error parsing %s; using default (%d)", key, defval)
+	}
+	return defval
+}
+
+// DownloadConfig returns the download parameters set in apptainer.conf,
+// possibly overridden by environment variables.
+func DownloadConfig() (Downloader, error) {
+	// get downloader parameters from config
+	conf := apptainerconf.GetCurrentConfig()
+	if conf == nil {
+		if strings.HasSuffix(os.Args[0], ".test") {
+			// read config if doing unit tests
+			var err error
+			conf, err = apptainerconf.Parse(buildcfg.APPTAINER_CONF_FILE)
+			if err != nil {
+				sylog.Fatalf("unable to parse apptainer.conf file: %s", err)
+			}
+		} else {
+			sylog.Fatalf("configuration not pre-loaded in DownloadConfig")
+		}
+	}
+
+	concurrency := getEnvInt("APPTAINER_DOWNLOAD_CONCURRENCY", int64(conf.DownloadConcurrency))
+	partSize := getEnvInt("APPTAINER_DOWNLOAD_PART_SIZE", int64(conf.DownloadPartSize))
+	bufferSize := getEnvInt("APPTAINER_DOWNLOAD_BUFFER_SIZE", int64(conf.DownloadBufferSize))
+	retries := getEnvInt("APPTAINER_DOWNLOAD_RETRIES", int64(conf.DownloadRetries))
+
+	if concurrency < 1 {
+		return Downloader{}, fmt.Errorf("invalid download concurrency value (%v)", concurrency)
+	}
+	if partSize < 1 {
+		return Downloader{}, fmt.Errorf("invalid concurrent download part size (%v)", partSize)
+	}
+	if bufferSize < 1 {
+		return Downloader{}, fmt.Errorf("invalid concurrent download buffer size (%v)", bufferSize)
+	}
+	if retries < 0 {
+		return Downloader{}, fmt.Errorf("invalid download retries value (%v)", retries)
+	}
+
+	return Downloader{
+		Concurrency: uint(concurrency),
+		PartSize:    partSize,
+		BufferSize:  bufferSize,
+		Retries:     uint(retries),
+	}, nil
+}
+
+// statusError is returned for unexpected HTTP responses.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	if e.code == http.StatusNotFound {
+		return "the requested image was not found"
+	}
+	return fmt.Sprintf("download did not succeed: %d %s", e.code, e.msg)
+}
+
+// temporary returns if the transfer can be retried after err.
+func temporary(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError ||
+			se.code == http.StatusTooManyRequests ||
+			se.code == http.StatusRequestTimeout
+	}
+	var pe *permanentError
+	return !errors.As(err, &pe)
+}
+
+// permanentError is returned for failures that retries can't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// parseContentRange parses a Content-Range header value and returns the
+// offset of the first byte of the range and the complete size, -1 is
+// returned for values left unspecified.
+func parseContentRange(s string) (first, size int64, err error) {
+	first, size = -1, -1
+
+	if !strings.HasPrefix(s, "bytes ") {
+		return first, size, fmt.Errorf("invalid content range %q", s)
+	}
+	rng, total, ok := cut(strings.TrimPrefix(s, "bytes "), "/")
+	if !ok {
+		return first, size, fmt.Errorf("invalid content range %q", s)
+	}
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			return first, size, fmt.Errorf("invalid content range %q", s)
+		}
+	}
+	if rng != "*" {
+		start, _, ok := cut(rng, "-")
+		if !ok {
+			return first, size, fmt.Errorf("invalid content range %q", s)
+		}
+		if first, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return first, size, fmt.Errorf("invalid content range %q", s)
+		}
+	}
+	return first, size, nil
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// headerDigest returns the SHA-256 instance digest advertised by the
+// server through the Digest header (RFC 3230), if any.
+func headerDigest(h http.Header) digest.Digest {
+	for _, v := range h.Values("Digest") {
+		for _, d := range strings.Split(v, ",") {
+			alg, value, ok := cut(strings.TrimSpace(d), "=")
+			if !ok || !strings.EqualFold(alg, "sha-256") {
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				continue
+			}
+			d := digest.NewDigestFromEncoded(digest.SHA256, hex.EncodeToString(b))
+			if d.Validate() == nil {
+				return d
+			}
+		}
+	}
+	return ""
+}
+
+// offsetWriter writes to a file at an increasing offset.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+	pb  *DownloadProgressBar
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	w.pb.IncrBy(n)
+	return n, err
+}
+
+// transfer holds the state of a file download.
+type transfer struct {
+	Downloader
+
+	client *http.Client
+	req    *http.Request
+	f      *os.File
+	pb     *DownloadProgressBar
+	bar    bool
+
+	mu sync.Mutex
+	// size is the size of the remote file, -1 when unknown.
+	size int64
+	// ranges is set when the server advertises range requests support.
+	ranges bool
+	// validator is the entity tag or the last modification date of
+	// the remote file, sent along range requests so the whole file is
+	// returned if it changed.
+	validator string
+	// digest is the expected digest of the file.
+	digest digest.Digest
+	// init is set once the first response was received.
+	init bool
+}
+
+// Download downloads the content returned by req into the file at path,
+// the file is created or truncated first. Interrupted transfers are
+// resumed with range requests, up to d.Retries times with an exponential
+// backoff, from the data already written. Files larger than d.PartSize are
+// downloaded in concurrent parts when the server supports range requests.
+// The downloaded file is checked against the expected digest, or against
+// the digest advertised by the server if expected is empty. pb is an
+// optional progress bar.
+func (d Downloader) Download(ctx context.Context, c *http.Client, req *http.Request, path string, expected digest.Digest, pb *DownloadProgressBar) error {
+	if d.BufferSize < 1 {
+		d.BufferSize = 32 * 1024
+	}
+
+	// Perms are 777 *prior* to umask
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o777)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t := &transfer{
+		Downloader: d,
+		client:     c,
+		req:        req,
+		f:          f,
+		pb:         pb,
+		bar:        pb != nil,
+		size:       -1,
+		digest:     expected,
+	}
+	if pb == nil {
+		// never initialized, all methods are no-op
+		t.pb = &DownloadProgressBar{}
+	}
+
+	if err := t.run(ctx); err != nil {
+		t.pb.Abort(true)
+		t.pb.Wait()
+		return err
+	}
+	t.pb.Wait()
+
+	if t.digest == "" {
+		return nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	sylog.Debugf("Verifying downloaded file digest")
+	got, err := t.digest.Algorithm().FromReader(f)
+	if err != nil {
+		return fmt.Errorf("while computing downloaded file digest: %s", err)
+	}
+	if got != t.digest {
+		return fmt.Errorf("downloaded file digest %s does not match expected digest %s", got, t.digest)
+	}
+	return nil
+}
+
+// run downloads the file as a single stream, or switches to a concurrent
+// download once the first response shows the server supports it.
+func (t *transfer) run(ctx context.Context) error {
+	var offset, reached int64
+	var parts bool
+
+	err := t.retry(ctx, func() (bool, error) {
+		res, first, err := t.open(ctx, offset, -1)
+		if err != nil {
+			return false, err
+		} else if res == nil {
+			// nothing left to download
+			return false, nil
+		}
+		defer res.Body.Close()
+
+		if offset > 0 && first == 0 {
+			sylog.Debugf("Server returned the whole file, restarting download")
+			if err := t.f.Truncate(0); err != nil {
+				return false, &permanentError{err}
+			}
+			t.pb.SetCurrent(0)
+		}
+		offset = first
+
+		if offset == 0 && t.ranges && t.Concurrency > 1 && t.size > t.PartSize {
+			parts = true
+			return false, nil
+		}
+
+		n, err := t.copy(ctx, res.Body, offset)
+		offset += n
+		if err == nil && t.size >= 0 && offset < t.size {
+			err = io.ErrUnexpectedEOF
+		}
+		// data received after a restart from the beginning is not progress
+		progress := offset > reached
+		if progress {
+			reached = offset
+		}
+		return progress, err
+	})
+	if err != nil || !parts {
+		return err
+	}
+	return t.parts(ctx)
+}
+
+// parts downloads the file in concurrent parts.
+func (t *transfer) parts(ctx context.Context) error {
+	numParts := 1 + (t.size-1)/t.PartSize
+	concurrency := t.Concurrency
+	if uint(numParts) < concurrency {
+		concurrency = uint(numParts)
+	}
+
+	sylog.Debugf("size: %d, parts: %d, concurrency: %d, partsize: %d, bufsize: %d",
+		t.size, numParts, concurrency, t.PartSize, t.BufferSize,
+	)
+
+	g, ctx := errgroup.WithContext(ctx)
+	jobs := make(chan int64)
+
+	for i := uint(0); i < concurrency; i++ {
+		g.Go(func() error {
+			for start := range jobs {
+				end := start + t.PartSize - 1
+				if end >= t.size {
+					end = t.size - 1
+				}
+				if err := t.part(ctx, start, end); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+feed:
+	for start := int64(0); start < t.size; start += t.PartSize {
+		select {
+		case jobs <- start:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+
+	return g.Wait()
+}
+
+// part downloads the part of the file from start to end included.
+func (t *transfer) part(ctx context.Context, start, end int64) error {
+	offset := start
+
+	return t.retry(ctx, func() (bool, error) {
+		res, first, err := t.open(ctx, offset, end)
+		if err != nil {
+			return false, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusPartialContent || first != offset {
+			return false, &permanentError{fmt.Errorf("server returned an unexpected range for bytes %d-%d", offset, end)}
+		}
+
+		n, err := t.copy(ctx, io.LimitReader(res.Body, end-offset+1), offset)
+		offset += n
+		if err == nil && offset <= end {
+			err = io.ErrUnexpectedEOF
+		}
+		return n > 0, err
+	})
+}
+
+// retry calls fn until it succeeds or fails with a permanent error, or
+// until the retries are exhausted. fn returns if data were received, which
+// resets the retry count.
+func (t *transfer) retry(ctx context.Context, fn func() (bool, error)) error {
+	var retries uint
+
+	for {
+		progress, err := fn()
+		if err == nil {
+			return nil
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if progress {
+			retries = 0
+		}
+		if !temporary(err) || retries >= t.Retries {
+			return err
+		}
+
+		delay := downloadBackoff << retries
+		if delay <= 0 || delay > maxDownloadBackoff {
+			delay = maxDownloadBackoff
+		}
+		retries++
+
+		sylog.Warningf("Download interrupted: %s, retrying in %s (%d/%d)", err, delay, retries, t.Retries)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// open requests the bytes of the file from start to end included, or up
+// to the end of the file if end is negative. It returns the response and
+// the offset of its first byte, which is 0 when the server returns the
+// whole file. A nil response is returned when there is nothing left to
+// download.
+func (t *transfer) open(ctx context.Context, start, end int64) (*http.Response, int64, error) {
+	req := t.req.Clone(ctx)
+	if start > 0 || end >= 0 {
+		rng := fmt.Sprintf("bytes=%d-", start)
+		if end >= 0 {
+			rng += strconv.FormatInt(end, 10)
+		}
+		req.Header.Set("Range", rng)
+
+		t.mu.Lock()
+		if t.validator != "" {
+			req.Header.Set("If-Range", t.validator)
+		}
+		t.mu.Unlock()
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		t.update(res, res.ContentLength)
+		return res, 0, nil
+	case http.StatusPartialContent:
+		first, size, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil {
+			res.Body.Close()
+			return nil, 0, &permanentError{err}
+		}
+		t.update(res, size)
+		return res, first, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		if _, size, err := parseContentRange(res.Header.Get("Content-Range")); err == nil && end < 0 && size == start {
+			return nil, start, nil
+		}
+		return nil, 0, &statusError{code: res.StatusCode}
+	}
+
+	defer res.Body.Close()
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(io.LimitReader(res.Body, 4096))
+	return nil, 0, &statusError{code: res.StatusCode, msg: buf.String()}
+}
+
+// update records the remote file properties from the first response and
+// initializes the progress bar.
+func (t *transfer) update(res *http.Response, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.init {
+		return
+	}
+	t.init = true
+
+	t.size = size
+	t.ranges = res.StatusCode == http.StatusPartialContent || res.Header.Get("Accept-Ranges") == "bytes"
+	// If-Range only accepts strong entity tags
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		t.validator = etag
+	} else {
+		t.validator = res.Header.Get("Last-Modified")
+	}
+	if t.digest == "" {
+		t.digest = headerDigest(res.Header)
+	}
+
+	if t.bar {
+		t.pb.Init(size)
+	}
+}
+
+// copy writes the content of r to the file at the given offset and
+// returns the number of bytes written.
+func (t *transfer) copy(ctx context.Context, r io.Reader, offset int64) (int64, error) {
+	w := &offsetWriter{f: t.f, off: offset, pb: t.pb}
+	buf := make([]byte, t.BufferSize)
+
+	_, err := io.CopyBuffer(w, readerFunc(func(p []byte) (int, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		default:
+			return r.Read(p)
+		}
+	}), buf)
+
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		// local write errors are not recoverable
+		err = &permanentError{err}
+	}
+	return w.off - offset, err
+}
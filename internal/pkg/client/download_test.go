@@ -0,0 +1,268 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// flakyWriter aborts the response once limit bytes were written.
+type flakyWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n, _ := w.ResponseWriter.Write(p[:w.limit])
+		w.limit -= n
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.limit -= n
+	return n, err
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value         string
+		expectedFirst int64
+		expectedSize  int64
+		expectedErr   bool
+	}{
+		{value: "bytes 0-99/1000", expectedFirst: 0, expectedSize: 1000},
+		{value: "bytes 500-999/1000", expectedFirst: 500, expectedSize: 1000},
+		{value: "bytes 500-999/*", expectedFirst: 500, expectedSize: -1},
+		{value: "bytes */1000", expectedFirst: -1, expectedSize: 1000},
+		{value: "bytes 500/1000", expectedErr: true},
+		{value: "items 0-99/1000", expectedErr: true},
+		{value: "", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		first, size, err := parseContentRange(tt.value)
+		if (err != nil) != tt.expectedErr {
+			t.Errorf("%q: got error %v, expected error %v", tt.value, err, tt.expectedErr)
+			continue
+		}
+		if err == nil && (first != tt.expectedFirst || size != tt.expectedSize) {
+			t.Errorf("%q: got %d/%d, expected %d/%d", tt.value, first, size, tt.expectedFirst, tt.expectedSize)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	downloadBackoff = time.Millisecond
+	defer func() { downloadBackoff = time.Second }()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	contentDigest := digest.FromBytes(content)
+	modTime := time.Now()
+
+	tests := []struct {
+		name string
+		// failures is the number of aborted responses
+		failures int32
+		// status is returned instead of the content when set
+		status int
+		// noRanges makes the server ignore range requests
+		noRanges     bool
+		concurrency  uint
+		retries      uint
+		expected     digest.Digest
+		headerDigest string
+		// expectedRequests is checked when set
+		expectedRequests int32
+		expectedSuccess  bool
+	}{
+		{
+			name:             "NoFailure",
+			concurrency:      1,
+			expected:         contentDigest,
+			expectedRequests: 1,
+			expectedSuccess:  true,
+		},
+		{
+			name:             "Resume",
+			failures:         3,
+			concurrency:      1,
+			retries:          1,
+			expected:         contentDigest,
+			expectedRequests: 4,
+			expectedSuccess:  true,
+		},
+		{
+			name:            "NoRanges",
+			failures:        2,
+			noRanges:        true,
+			concurrency:     1,
+			retries:         2,
+			expected:        contentDigest,
+			expectedSuccess: true,
+		},
+		{
+			name:            "Concurrent",
+			failures:        4,
+			concurrency:     4,
+			retries:         1,
+			expected:        contentDigest,
+			expectedSuccess: true,
+		},
+		{
+			name:            "ConcurrentNoRanges",
+			noRanges:        true,
+			concurrency:     4,
+			expected:        contentDigest,
+			expectedSuccess: true,
+		},
+		{
+			name:            "DigestMismatch",
+			concurrency:     1,
+			expected:        digest.FromString("other content"),
+			expectedSuccess: false,
+		},
+		{
+			name:            "HeaderDigest",
+			concurrency:     1,
+			headerDigest:    "sha-256=" + base64.StdEncoding.EncodeToString(sum[:]),
+			expectedSuccess: true,
+		},
+		{
+			name:            "HeaderDigestMismatch",
+			concurrency:     1,
+			headerDigest:    "sha-256=" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)),
+			expectedSuccess: false,
+		},
+		{
+			name:             "NotFound",
+			status:           http.StatusNotFound,
+			concurrency:      1,
+			retries:          3,
+			expectedRequests: 1,
+			expectedSuccess:  false,
+		},
+		{
+			name:             "ServerError",
+			status:           http.StatusServiceUnavailable,
+			concurrency:      1,
+			retries:          3,
+			expectedRequests: 4,
+			expectedSuccess:  false,
+		},
+		{
+			name:            "TooManyFailures",
+			failures:        10,
+			noRanges:        true,
+			concurrency:     1,
+			retries:         2,
+			expectedSuccess: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				if tt.headerDigest != "" {
+					w.Header().Set("Digest", tt.headerDigest)
+				}
+				if n <= tt.failures {
+					w = &flakyWriter{ResponseWriter: w, limit: 10000}
+				}
+				if tt.noRanges {
+					w.Write(content)
+					return
+				}
+				http.ServeContent(w, r, "image.sif", modTime, bytes.NewReader(content))
+			}))
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			d := Downloader{
+				Concurrency: tt.concurrency,
+				PartSize:    int64(len(content) / 5),
+				BufferSize:  4096,
+				Retries:     tt.retries,
+			}
+			path := filepath.Join(t.TempDir(), "image.sif")
+
+			err = d.Download(context.Background(), srv.Client(), req, path, tt.expected, nil)
+			if (err == nil) != tt.expectedSuccess {
+				t.Fatalf("got error %v, expected success %v", err, tt.expectedSuccess)
+			}
+			if tt.expectedRequests != 0 && requests != tt.expectedRequests {
+				t.Errorf("got %d requests, expected %d", requests, tt.expectedRequests)
+			}
+			if err != nil {
+				return
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Errorf("unexpected downloaded content")
+			}
+		})
+	}
+}
+
+func TestDownloadCanceled(t *testing.T) {
+	downloadBackoff = time.Minute
+	defer func() { downloadBackoff = time.Second }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	d := Downloader{Concurrency: 1, PartSize: 1024, BufferSize: 1024, Retries: 5}
+	path := filepath.Join(t.TempDir(), "image.sif")
+
+	start := time.Now()
+	if err := d.Download(ctx, srv.Client(), req, path, "", nil); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("download not interrupted by context cancellation")
+	}
+}
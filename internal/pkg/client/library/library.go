@@ -12,16 +12,16 @@ package library
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 
-	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
-	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/client"
 	"github.com/apptainer/apptainer/pkg/sylog"
-	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
 	libClient "github.com/apptainer/container-library-client/client"
+	"github.com/opencontainers/go-digest"
 )
 
 const defaultTag = "latest"
@@ -59,79 +59,134 @@ func NormalizeLibraryRef(ref string) (*libClient.Ref, error) {
 	return &libClient.Ref{Host: host, Path: elem[0], Tags: tags}, nil
 }
 
-func getEnvInt(key string, defval int64) int64 {
-	envKey := env.TrimApptainerKey(key)
-	if env := env.GetenvLegacy(envKey, envKey); env != "" {
-		if n, err := strconv.ParseInt(env, 10, 0); err == nil {
-			return n
-		}
-		sylog.Warningf("Error parsing %s; using default (%d)", key, defval)
+// imageFileURL returns the URL of the library image file.
+func imageFileURL(c *libClient.Client, arch string, libraryRef *libClient.Ref) (string, error) {
+	if strings.Contains(libraryRef.Path, ":") {
+		return "", fmt.Errorf("malformed image path: %s", libraryRef.Path)
+	}
+
+	tag := defaultTag
+	if len(libraryRef.Tags) > 0 && libraryRef.Tags[0] != "" {
+		tag = libraryRef.Tags[0]
 	}
-	return defval
+
+	q := url.Values{}
+	q.Add("arch", arch)
+
+	u := c.BaseURL.ResolveReference(&url.URL{
+		Path:     fmt.Sprintf("v1/imagefile/%s:%s", strings.TrimPrefix(libraryRef.Path, "/"), tag),
+		RawQuery: q.Encode(),
+	})
+	return u.String(), nil
 }
 
-func getDownloadConfig() (libClient.Downloader, error) {
-	// get downloader parameters from config
-	conf := apptainerconf.GetCurrentConfig()
-	if conf == nil {
-		if strings.HasSuffix(os.Args[0], ".test") {
-			// read config if doing unit tests
-			var err error
-			conf, err = apptainerconf.Parse(buildcfg.APPTAINER_CONF_FILE)
-			if err != nil {
-				sylog.Fatalf("unable to parse apptainer.conf file: %s", err)
-			}
-		} else {
-			sylog.Fatalf("configuration not pre-loaded in getDownloadConfig")
-		}
+// imageDigest converts a library image hash to a digest, hashes not
+// computed with SHA-256 can't be verified and return an error.
+func imageDigest(hash string) (digest.Digest, error) {
+	d := digest.Digest(strings.Replace(hash, "sha256.", "sha256:", 1))
+	if err := d.Validate(); err != nil {
+		return "", fmt.Errorf("unsupported image hash %s: %v", hash, err)
 	}
+	return d, nil
+}
 
-	concurrency := int64(getEnvInt("APPTAINER_DOWNLOAD_CONCURRENCY", int64(conf.DownloadConcurrency)))
-	partSize := int64(getEnvInt("APPTAINER_DOWNLOAD_PART_SIZE", int64(conf.DownloadPartSize)))
-	bufferSize := int64(getEnvInt("APPTAINER_DOWNLOAD_BUFFER_SIZE", int64(conf.DownloadBufferSize)))
+// imageFileRequest returns the request downloading the library image file.
+// The library redirects image file requests to the storage URL with a 303
+// status, the redirection is resolved once so the storage is requested
+// directly by the resumed and concurrent range requests.
+func imageFileRequest(ctx context.Context, c *libClient.Client, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("BEARER %s", c.AuthToken))
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 
-	if concurrency < 1 {
-		return libClient.Downloader{}, fmt.Errorf("invalid download concurrency value (%v)", concurrency)
+	httpClient := &http.Client{
+		Transport: c.HTTPClient.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.Response.StatusCode == http.StatusSeeOther {
+				return http.ErrUseLastResponse
+			}
+			maxRedir := 10
+			if len(via) >= maxRedir {
+				return fmt.Errorf("stopped after %d redirects", maxRedir)
+			}
+			return nil
+		},
+		Jar:     c.HTTPClient.Jar,
+		Timeout: c.HTTPClient.Timeout,
 	}
-	if partSize < 1 {
-		return libClient.Downloader{}, fmt.Errorf("invalid concurrent download part size (%v)", partSize)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// library endpoint serving the image file directly
+		return req, nil
+	case http.StatusSeeOther:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("requested image was not found in the library")
+	default:
+		return nil, fmt.Errorf("unexpected HTTP status %d", res.StatusCode)
 	}
-	if bufferSize < 1 {
-		return libClient.Downloader{}, fmt.Errorf("invalid concurrent download buffer size (%v)", bufferSize)
+
+	loc, err := res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("while getting image file location: %v", err)
 	}
+	sylog.Debugf("Image file redirected to: %s", loc)
 
-	return libClient.Downloader{
-		Concurrency: uint(concurrency),
-		PartSize:    partSize,
-		BufferSize:  bufferSize,
-	}, nil
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, loc.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return req, nil
 }
 
-// DownloadImage is a helper function to wrap library image download operation
-func DownloadImage(ctx context.Context, c *libClient.Client, imagePath, arch string, libraryRef *libClient.Ref, pb libClient.ProgressBar) error {
-	// open destination file for writing
-	f, err := os.OpenFile(imagePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o777)
+// DownloadImage is a helper function to wrap library image download operation,
+// interrupted downloads are resumed and the downloaded image is checked against
+// hash when set.
+func DownloadImage(ctx context.Context, c *libClient.Client, imagePath, arch string, libraryRef *libClient.Ref, hash string, pb *client.DownloadProgressBar) error {
+	spec, err := client.DownloadConfig()
 	if err != nil {
-		return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
+		return err
 	}
-	defer f.Close()
 
-	var tag string
-	if len(libraryRef.Tags) > 0 {
-		tag = libraryRef.Tags[0]
+	var expected digest.Digest
+	if hash != "" {
+		if expected, err = imageDigest(hash); err != nil {
+			return err
+		}
 	}
 
-	spec, err := getDownloadConfig()
+	u, err := imageFileURL(c, arch, libraryRef)
 	if err != nil {
 		return err
 	}
+	sylog.Debugf("Pulling from URL: %s", u)
+
+	req, err := imageFileRequest(ctx, c, u)
+	if err != nil {
+		return fmt.Errorf("error downloading image: %v", err)
+	}
 
-	// call library client to download image
-	if err := c.ConcurrentDownloadImage(ctx, f, arch, libraryRef.Path, tag, &spec, pb); err != nil {
+	if err := spec.Download(ctx, c.HTTPClient, req, imagePath, expected, pb); err != nil {
 		// Delete incomplete image file in the event of failure
 		// we get here e.g. if the context is canceled by Ctrl-C
 		sylog.Debugf("Cleaning up incomplete download: %s", imagePath)
-		if err := os.Remove(imagePath); err != nil {
+		if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
 			sylog.Errorf("Error while removing incomplete download: %v", err)
 		}
 
@@ -143,8 +198,8 @@ func DownloadImage(ctx context.Context, c *libClient.Client, imagePath, arch str
 
 // DownloadImageNoProgress downloads an image from the library without
 // displaying a progress bar while doing so
-func DownloadImageNoProgress(ctx context.Context, c *libClient.Client, imagePath, arch string, libraryRef *libClient.Ref) error {
-	return DownloadImage(ctx, c, imagePath, arch, libraryRef, nil)
+func DownloadImageNoProgress(ctx context.Context, c *libClient.Client, imagePath, arch string, libraryRef *libClient.Ref, hash string) error {
+	return DownloadImage(ctx, c, imagePath, arch, libraryRef, hash, nil)
 }
 
 // SearchLibrary searches the library and outputs results to stdout
@@ -10,8 +10,13 @@
 package library
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+
+	libClient "github.com/apptainer/container-library-client/client"
 )
 
 func TestNormalizeLibraryRef(t *testing.T) {
@@ -54,3 +59,52 @@ func TestNormalizeLibraryRef(t *testing.T) {
 		})
 	}
 }
+
+func TestImageFileRequest(t *testing.T) {
+	var imagefileRequests int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/imagefile/", func(w http.ResponseWriter, r *http.Request) {
+		imagefileRequests++
+		if r.Header.Get("Authorization") != "BEARER token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/storage/image.sif", http.StatusSeeOther)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := libClient.NewClient(&libClient.Config{BaseURL: srv.URL, AuthToken: "token"})
+	if err != nil {
+		t.Fatalf("while creating library client: %s", err)
+	}
+
+	req, err := imageFileRequest(context.Background(), c, srv.URL+"/v1/imagefile/entity/collection/image:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := req.URL.String(), srv.URL+"/storage/image.sif"; got != want {
+		t.Errorf("got request URL %s, expected %s", got, want)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("authorization token sent to the image file location")
+	}
+	if imagefileRequests != 1 {
+		t.Errorf("got %d image file requests, expected 1", imagefileRequests)
+	}
+
+	if _, err := imageFileRequest(context.Background(), c, srv.URL+"/v1/missing"); err == nil {
+		t.Errorf("unexpected success with missing image file")
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	hash := "sha256.d7b8f8a0b5b2bf1e8f7b0a9e7fbd4e4c1e0f6c2b8e3d1a4b5c6d7e8f9a0b1c2d"
+	if _, err := imageDigest(hash); err != nil {
+		t.Errorf("unexpected error for hash %s: %s", hash, err)
+	}
+	if _, err := imageDigest("sif.5574b72c-7705-49cc-874e-424fc3b78116"); err == nil {
+		t.Errorf("unexpected success with unverifiable hash")
+	}
+}
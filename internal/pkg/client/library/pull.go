@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/apptainer/apptainer/internal/app/apptainer"
@@ -48,16 +49,20 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 		return "", err
 	}
 
-	var progressBar libClient.ProgressBar
+	var progressBar *client.DownloadProgressBar
 	if term.IsTerminal(2) {
 		progressBar = &client.DownloadProgressBar{}
 	}
 
 	if directTo != "" {
 		// Download direct to file
-		if err := downloadWrapper(ctx, c, directTo, arch, imageRef, progressBar); err != nil {
+		if err := downloadWrapper(ctx, c, directTo, arch, imageRef, libraryImage.Hash, progressBar); err != nil {
 			return "", fmt.Errorf("unable to download image: %v", err)
 		}
+		if err := verifyPolicy(ctx, c, imageRef, directTo); err != nil {
+			os.Remove(directTo)
+			return "", err
+		}
 		return directTo, nil
 	}
 
@@ -68,16 +73,10 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 	defer cacheEntry.CleanTmp()
 
 	if !cacheEntry.Exists {
-		if err := downloadWrapper(ctx, c, cacheEntry.TmpPath, arch, imageRef, progressBar); err != nil {
+		if err := downloadWrapper(ctx, c, cacheEntry.TmpPath, arch, imageRef, libraryImage.Hash, progressBar); err != nil {
 			return "", fmt.Errorf("unable to download image: %v", err)
 		}
 
-		if cacheFileHash, err := libClient.ImageHash(cacheEntry.TmpPath); err != nil {
-			return "", fmt.Errorf("error getting image hash: %v", err)
-		} else if cacheFileHash != libraryImage.Hash {
-			return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, libraryImage.Hash)
-		}
-
 		if err := cacheEntry.Finalize(); err != nil {
 			return "", err
 		}
@@ -85,11 +84,25 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo string, imageRef
 		sylog.Infof("Using cached image")
 	}
 
+	if err := verifyPolicy(ctx, c, imageRef, cacheEntry.Path); err != nil {
+		return "", err
+	}
+
 	return cacheEntry.Path, nil
 }
 
+// verifyPolicy verifies the image pulled from imageRef satisfies the pull policy.
+func verifyPolicy(ctx context.Context, c *libClient.Client, imageRef *libClient.Ref, imagePath string) error {
+	host := imageRef.Host
+	if host == "" {
+		host = c.BaseURL.Host
+	}
+	ref := fmt.Sprintf("%s/%s:%s", host, strings.TrimPrefix(imageRef.Path, "/"), imageRef.Tags[0])
+	return apptainer.VerifyPullPolicy(ctx, apptainer.PolicyTransportLibrary, ref, imagePath)
+}
+
 // downloadWrapper calls DownloadImage() and outputs download summary if progressBar not specified.
-func downloadWrapper(ctx context.Context, c *libClient.Client, imagePath, arch string, libraryRef *libClient.Ref, pb libClient.ProgressBar) error {
+func downloadWrapper(ctx context.Context, c *libClient.Client, imagePath, arch string, libraryRef *libClient.Ref, hash string, pb *client.DownloadProgressBar) error {
 	sylog.Infof("Downloading library image")
 
 	defer func(t time.Time) {
@@ -101,7 +114,7 @@ func downloadWrapper(ctx context.Context, c *libClient.Client, imagePath, arch s
 		}
 	}(time.Now())
 
-	if err := DownloadImage(ctx, c, imagePath, arch, libraryRef, pb); err != nil {
+	if err := DownloadImage(ctx, c, imagePath, arch, libraryRef, hash, pb); err != nil {
 		return err
 	}
 	return nil
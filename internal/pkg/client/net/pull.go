@@ -10,7 +10,6 @@
 package net
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -54,6 +53,11 @@ func DownloadImage(ctx context.Context, filePath string, netURL string) error {
 	url := netURL
 	sylog.Debugf("Pulling from URL: %s\n", url)
 
+	spec, err := client.DownloadConfig()
+	if err != nil {
+		return err
+	}
+
 	httpClient := &http.Client{
 		Timeout: pullTimeout * time.Second,
 	}
@@ -65,44 +69,17 @@ func DownloadImage(ctx context.Context, filePath string, netURL string) error {
 
 	req.Header.Set("User-Agent", useragent.Value())
 
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("the requested image was not found")
-	}
-
-	if res.StatusCode != http.StatusOK {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(res.Body)
-		s := buf.String()
-		return fmt.Errorf("Download did not succeed: %d %s\n\t",
-			res.StatusCode, s)
+	var pb *client.DownloadProgressBar
+	if sylog.GetLevel() > -1 {
+		pb = &client.DownloadProgressBar{}
 	}
 
-	sylog.Debugf("OK response received, beginning body download\n")
-
-	// Perms are 777 *prior* to umask
-	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o777)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	pb := client.ProgressBarCallback(ctx)
-
-	err = pb(res.ContentLength, res.Body, out)
-
-	if err != nil {
+	// the image is checked against the digest advertised by the server, if any
+	if err := spec.Download(ctx, httpClient, req, filePath, "", pb); err != nil {
 		// Delete incomplete image file in the event of failure
 		// we get here e.g. if the context is canceled by Ctrl-C
-		res.Body.Close()
-		out.Close()
 		sylog.Infof("Cleaning up incomplete download: %s", filePath)
-		if err := os.Remove(filePath); err != nil {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
 			sylog.Errorf("Error while removing incomplete download: %v", err)
 		}
 		return err
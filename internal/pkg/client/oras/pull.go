@@ -13,7 +13,10 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
 
+	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -63,6 +66,14 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		imagePath = cacheEntry.Path
 	}
 
+	ref := strings.TrimPrefix(strings.TrimPrefix(pullFrom, "oras://"), "//")
+	if err := apptainer.VerifyPullPolicy(ctx, apptainer.PolicyTransportOras, ref, imagePath); err != nil {
+		if directTo != "" {
+			os.Remove(directTo)
+		}
+		return "", err
+	}
+
 	return imagePath, nil
 }
 
@@ -123,6 +123,15 @@ func (pb *DownloadProgressBar) IncrBy(n int) {
 	pb.bar.IncrBy(n)
 }
 
+// SetCurrent sets the progress bar current value, used when a
+// download is restarted.
+func (pb *DownloadProgressBar) SetCurrent(n int64) {
+	if pb.bar == nil {
+		return
+	}
+	pb.bar.SetCurrent(n)
+}
+
 func (pb *DownloadProgressBar) Abort(drop bool) {
 	if pb.bar == nil {
 		return
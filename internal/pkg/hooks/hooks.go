@@ -0,0 +1,266 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package hooks implements the loading and execution of administrator
+// defined hooks for the native runtime. Hooks are described by JSON files
+// stored in hook directories, the format is similar to the OCI hooks.d
+// format used by other container runtimes:
+//
+//	{
+//	    "version": "1.0.0",
+//	    "hook": {
+//	        "path": "/usr/libexec/audit-hook",
+//	        "args": ["audit-hook", "--verbose"],
+//	        "timeout": 10
+//	    },
+//	    "when": {
+//	        "annotations": {"^org\\.example\\.audit$": "^true$"},
+//	        "labels": {"^org\\.label-schema\\.name$": ".*"},
+//	        "commands": ["^/usr/bin/python"]
+//	    },
+//	    "stages": ["prestart", "poststop"]
+//	}
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/exec"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Version is the supported version of the hook configuration format.
+const Version = "1.0.0"
+
+const (
+	// Prestart hooks are executed after the container environment
+	// has been created but before the container process is started.
+	Prestart = "prestart"
+	// Poststart hooks are executed right after the container
+	// process has been started.
+	Poststart = "poststart"
+	// Poststop hooks are executed after the container process
+	// exited.
+	Poststop = "poststop"
+)
+
+var stages = map[string]bool{
+	Prestart:  true,
+	Poststart: true,
+	Poststop:  true,
+}
+
+// When describes the conditions under which a hook is executed. A hook
+// is executed if Always is set to true or if any of the other conditions
+// matches.
+type When struct {
+	// Always executes the hook unconditionally.
+	Always *bool `json:"always,omitempty"`
+	// Annotations maps key regular expressions to value regular
+	// expressions matched against container annotations.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Labels maps key regular expressions to value regular
+	// expressions matched against image labels.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Commands is a list of regular expressions matched against
+	// the command executed in the container.
+	Commands []string `json:"commands,omitempty"`
+}
+
+// Hook describes a hook configuration file.
+type Hook struct {
+	Version string     `json:"version"`
+	Hook    specs.Hook `json:"hook"`
+	When    When       `json:"when"`
+	Stages  []string   `json:"stages"`
+	// Name is the name of the configuration file the hook
+	// was loaded from.
+	Name string `json:"-"`
+}
+
+// Validate checks that the hook configuration is correct.
+func (h *Hook) Validate() error {
+	if h.Version != Version {
+		return fmt.Errorf("unsupported hook version %q, only %q is supported", h.Version, Version)
+	}
+	if !filepath.IsAbs(h.Hook.Path) {
+		return fmt.Errorf("hook path %q must be an absolute path", h.Hook.Path)
+	}
+	if len(h.Stages) == 0 {
+		return fmt.Errorf("no stages specified")
+	}
+	for _, s := range h.Stages {
+		if !stages[s] {
+			return fmt.Errorf("unknown stage %q", s)
+		}
+	}
+	for k, v := range h.When.Annotations {
+		if err := checkRegexp(k, v); err != nil {
+			return fmt.Errorf("bad annotation condition: %s", err)
+		}
+	}
+	for k, v := range h.When.Labels {
+		if err := checkRegexp(k, v); err != nil {
+			return fmt.Errorf("bad label condition: %s", err)
+		}
+	}
+	if err := checkRegexp(h.When.Commands...); err != nil {
+		return fmt.Errorf("bad command condition: %s", err)
+	}
+	return nil
+}
+
+// HasStage returns if the hook must be executed for the stage.
+func (h *Hook) HasStage(stage string) bool {
+	for _, s := range h.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns if the hook conditions match the supplied container
+// annotations, image labels and command.
+func (w *When) Match(annotations, labels map[string]string, command string) bool {
+	if w.Always != nil && *w.Always {
+		return true
+	}
+	if matchMap(w.Annotations, annotations) || matchMap(w.Labels, labels) {
+		return true
+	}
+	for _, c := range w.Commands {
+		if regexp.MustCompile(c).MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load loads hook configuration files found in the supplied directories.
+// Files are loaded in lexical order and a configuration file with the same
+// name found in a subsequent directory overrides the previous one. When
+// root is true, hook configuration files and their directory must be owned
+// by root.
+func Load(dirs []string, root bool) ([]*Hook, error) {
+	hooks := make(map[string]*Hook)
+
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			sylog.Debugf("Hook directory %s doesn't exist, skipping", dir)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("while reading hook directory %s: %s", dir, err)
+		}
+		if root && !fs.IsOwner(dir, 0) {
+			return nil, fmt.Errorf("hook directory %s must be owned by root", dir)
+		}
+
+		for _, f := range files {
+			if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+				continue
+			}
+			path := filepath.Join(dir, f.Name())
+			if root && !fs.IsOwner(path, 0) {
+				return nil, fmt.Errorf("hook configuration %s must be owned by root", path)
+			}
+			h, err := loadHook(path)
+			if err != nil {
+				return nil, fmt.Errorf("while loading hook configuration %s: %s", path, err)
+			}
+			hooks[f.Name()] = h
+		}
+	}
+
+	names := make([]string, 0, len(hooks))
+	for name := range hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]*Hook, 0, len(names))
+	for _, name := range names {
+		list = append(list, hooks[name])
+	}
+	return list, nil
+}
+
+// Filter returns the hooks whose conditions match the supplied container
+// annotations, image labels and command.
+func Filter(hooks []*Hook, annotations, labels map[string]string, command string) []*Hook {
+	var matched []*Hook
+	for _, h := range hooks {
+		if h.When.Match(annotations, labels, command) {
+			matched = append(matched, h)
+		}
+	}
+	return matched
+}
+
+// Run executes hooks matching the stage with the container state passed
+// over stdin.
+func Run(ctx context.Context, hooks []*Hook, stage string, state *specs.State) error {
+	for _, h := range hooks {
+		if !h.HasStage(stage) {
+			continue
+		}
+		sylog.Debugf("Executing %s hook %s", stage, h.Name)
+		if err := exec.Hook(ctx, &h.Hook, state); err != nil {
+			return fmt.Errorf("%s hook %s: %s", stage, h.Name, err)
+		}
+	}
+	return nil
+}
+
+func loadHook(path string) (*Hook, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	h := new(Hook)
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, err
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	h.Name = filepath.Base(path)
+	return h, nil
+}
+
+func checkRegexp(exprs ...string) error {
+	for _, e := range exprs {
+		if _, err := regexp.Compile(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchMap(conditions, values map[string]string) bool {
+	for ck, cv := range conditions {
+		kre := regexp.MustCompile(ck)
+		vre := regexp.MustCompile(cv)
+		for k, v := range values {
+			if kre.MatchString(k) && vre.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
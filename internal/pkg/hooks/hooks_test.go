@@ -0,0 +1,238 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package hooks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func writeHook(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("while writing hook %s: %s", name, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+
+	writeHook(t, dir1, "10-audit.json", `{
+		"version": "1.0.0",
+		"hook": {"path": "/bin/true"},
+		"when": {"always": true},
+		"stages": ["prestart"]
+	}`)
+	writeHook(t, dir1, "20-gpu.json", `{
+		"version": "1.0.0",
+		"hook": {"path": "/bin/true"},
+		"when": {"commands": ["^/usr/bin/python"]},
+		"stages": ["prestart"]
+	}`)
+	writeHook(t, dir1, "README", "not a hook")
+	// overrides 20-gpu.json from the first directory
+	writeHook(t, dir2, "20-gpu.json", `{
+		"version": "1.0.0",
+		"hook": {"path": "/bin/false"},
+		"when": {"always": true},
+		"stages": ["poststop"]
+	}`)
+
+	hooks, err := Load([]string{dir1, dir2, filepath.Join(dir1, "nonexistent")}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(hooks) != 2 {
+		t.Fatalf("expected 2 hooks, got %d", len(hooks))
+	}
+	if hooks[0].Name != "10-audit.json" || hooks[1].Name != "20-gpu.json" {
+		t.Errorf("unexpected hook order: %s, %s", hooks[0].Name, hooks[1].Name)
+	}
+	if hooks[1].Hook.Path != "/bin/false" || !hooks[1].HasStage(Poststop) {
+		t.Errorf("hook 20-gpu.json was not overridden")
+	}
+}
+
+func TestLoadRoot(t *testing.T) {
+	dir := t.TempDir()
+
+	// a configured hook directory may not exist
+	hooks, err := Load([]string{filepath.Join(dir, "nonexistent")}, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(hooks) != 0 {
+		t.Fatalf("expected no hooks, got %d", len(hooks))
+	}
+
+	if os.Getuid() == 0 {
+		return
+	}
+	if _, err := Load([]string{dir}, true); err == nil {
+		t.Errorf("unexpected success with a hook directory not owned by root")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "Valid",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "stages": ["poststart"]}`,
+		},
+		{
+			name:    "BadVersion",
+			content: `{"version": "0.1.0", "hook": {"path": "/bin/true"}, "stages": ["poststart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "RelativePath",
+			content: `{"version": "1.0.0", "hook": {"path": "true"}, "stages": ["poststart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "NoStage",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadStage",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "stages": ["createRuntime"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadRegexp",
+			content: `{"version": "1.0.0", "hook": {"path": "/bin/true"}, "when": {"commands": ["("]}, "stages": ["prestart"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "BadJSON",
+			content: `{"version": "1.0.0",`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeHook(t, dir, "hook.json", tt.content)
+			_, err := Load([]string{dir}, false)
+			if err != nil && !tt.wantErr {
+				t.Errorf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	always := true
+
+	tests := []struct {
+		name        string
+		when        When
+		annotations map[string]string
+		labels      map[string]string
+		command     string
+		match       bool
+	}{
+		{
+			name:  "Always",
+			when:  When{Always: &always},
+			match: true,
+		},
+		{
+			name:  "NoCondition",
+			when:  When{},
+			match: false,
+		},
+		{
+			name:        "Annotation",
+			when:        When{Annotations: map[string]string{"^org\\.example\\.gpu$": "^true$"}},
+			annotations: map[string]string{"org.example.gpu": "true"},
+			match:       true,
+		},
+		{
+			name:        "AnnotationValueMismatch",
+			when:        When{Annotations: map[string]string{"^org\\.example\\.gpu$": "^true$"}},
+			annotations: map[string]string{"org.example.gpu": "false"},
+			match:       false,
+		},
+		{
+			name:   "Label",
+			when:   When{Labels: map[string]string{"^org\\.label-schema\\.name$": "^licensed"}},
+			labels: map[string]string{"org.label-schema.name": "licensed-app"},
+			match:  true,
+		},
+		{
+			name:    "Command",
+			when:    When{Commands: []string{"^/usr/bin/python"}},
+			command: "/usr/bin/python3",
+			match:   true,
+		},
+		{
+			name:    "CommandMismatch",
+			when:    When{Commands: []string{"^/usr/bin/python"}},
+			command: "/bin/sh",
+			match:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := tt.when.Match(tt.annotations, tt.labels, tt.command); m != tt.match {
+				t.Errorf("got match %v, expected %v", m, tt.match)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "state")
+
+	hooks := []*Hook{
+		{
+			Name: "prestart.json",
+			Hook: specs.Hook{
+				Path: "/bin/sh",
+				Args: []string{"sh", "-c", "cat > " + out},
+			},
+			Stages: []string{Prestart},
+		},
+		{
+			Name: "poststop.json",
+			Hook: specs.Hook{
+				Path: "/bin/false",
+			},
+			Stages: []string{Poststop},
+		},
+	}
+
+	state := &specs.State{ID: "test", Status: "created"}
+
+	if err := Run(context.Background(), hooks, Prestart, state); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Errorf("prestart hook not executed: %s", err)
+	}
+	if err := Run(context.Background(), hooks, Poststop, state); err == nil {
+		t.Errorf("unexpected success for failing poststop hook")
+	}
+}
@@ -69,21 +69,30 @@ func InitImageDrivers(register bool, unprivileged bool, fileconf *apptainerconf.
 		return nil
 	}
 
-	var squashFeature fuseappsFeature
-	var overlayFeature fuseappsFeature
-	squashFeature.init("squashfuse", "mount SIF", desiredFeatures&image.ImageFeature)
-	overlayFeature.init("fuse-overlayfs", "use overlay", desiredFeatures&image.OverlayFeature)
-
-	if squashFeature.cmdPath != "" || overlayFeature.cmdPath != "" {
+	d := newFuseappsDriver(desiredFeatures)
+	if d.Features() != 0 {
 		sylog.Debugf("Setting ImageDriver to %v", driverName)
 		fileconf.ImageDriver = driverName
 		if register {
-			return image.RegisterDriver(driverName, &fuseappsDriver{squashFeature, overlayFeature})
+			return image.RegisterDriver(driverName, d)
 		}
 	}
 	return nil
 }
 
+func newFuseappsDriver(desiredFeatures image.DriverFeature) *fuseappsDriver {
+	d := &fuseappsDriver{}
+	d.squashFeature.init("squashfuse", "mount SIF", desiredFeatures&image.ImageFeature)
+	d.overlayFeature.init("fuse-overlayfs", "use overlay", desiredFeatures&image.OverlayFeature)
+	return d
+}
+
+// FuseappsFeatures returns the features the fuseapps image driver
+// provides to unprivileged executions on this host.
+func FuseappsFeatures() image.DriverFeature {
+	return newFuseappsDriver(0).Features()
+}
+
 func (d *fuseappsDriver) Features() image.DriverFeature {
 	var features image.DriverFeature
 	if d.squashFeature.cmdPath != "" {
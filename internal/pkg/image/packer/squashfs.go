@@ -13,10 +13,50 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"strconv"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 )
 
+// SquashfsCompressions lists the compression algorithms which can be
+// selected to create squashfs images.
+var SquashfsCompressions = []string{"gzip", "lz4", "lzo", "xz", "zstd"}
+
+// squashfsLevels maps compression algorithms to their maximum
+// compression level, algorithms without levels are not listed.
+var squashfsLevels = map[string]int{
+	"gzip": 9,
+	"lzo":  9,
+	"zstd": 22,
+}
+
+// CompressionFlags returns the mksquashfs flags selecting the compression
+// algorithm comp and its compression level, a zero level selects the
+// mksquashfs default level.
+func CompressionFlags(comp string, level int) ([]string, error) {
+	found := false
+	for _, c := range SquashfsCompressions {
+		found = found || c == comp
+	}
+	if !found {
+		return nil, fmt.Errorf("unsupported squashfs compression %q, supported compressions are %v", comp, SquashfsCompressions)
+	}
+
+	flags := []string{"-comp", comp}
+	if level == 0 {
+		return flags, nil
+	}
+
+	max, ok := squashfsLevels[comp]
+	if !ok {
+		return nil, fmt.Errorf("%s compression doesn't support compression levels", comp)
+	}
+	if level < 1 || level > max {
+		return nil, fmt.Errorf("invalid %s compression level %d, must be between 1 and %d", comp, level, max)
+	}
+	return append(flags, "-Xcompression-level", strconv.Itoa(level)), nil
+}
+
 // Squashfs represents a squashfs packer
 type Squashfs struct {
 	MksquashfsPath string
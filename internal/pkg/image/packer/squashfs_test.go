@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -122,3 +123,35 @@ func TestSquashfs(t *testing.T) {
 	t.Run("non-zero exit code", testNonZeroExitCode)
 	t.Run("happy path", testHappyPath)
 }
+
+func TestCompressionFlags(t *testing.T) {
+	tests := []struct {
+		comp          string
+		level         int
+		expectedFlags []string
+		expectedErr   bool
+	}{
+		{comp: "gzip", expectedFlags: []string{"-comp", "gzip"}},
+		{comp: "gzip", level: 9, expectedFlags: []string{"-comp", "gzip", "-Xcompression-level", "9"}},
+		{comp: "gzip", level: 10, expectedErr: true},
+		{comp: "lzo", level: 1, expectedFlags: []string{"-comp", "lzo", "-Xcompression-level", "1"}},
+		{comp: "zstd", level: 19, expectedFlags: []string{"-comp", "zstd", "-Xcompression-level", "19"}},
+		{comp: "zstd", level: -1, expectedErr: true},
+		{comp: "xz", expectedFlags: []string{"-comp", "xz"}},
+		{comp: "xz", level: 6, expectedErr: true},
+		{comp: "lz4", expectedFlags: []string{"-comp", "lz4"}},
+		{comp: "lzma", expectedErr: true},
+		{comp: "", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		flags, err := CompressionFlags(tt.comp, tt.level)
+		if (err != nil) != tt.expectedErr {
+			t.Errorf("%s/%d: got error %v, expected error %v", tt.comp, tt.level, err, tt.expectedErr)
+			continue
+		}
+		if !reflect.DeepEqual(flags, tt.expectedFlags) {
+			t.Errorf("%s/%d: got flags %v, expected %v", tt.comp, tt.level, flags, tt.expectedFlags)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// squashfs compressor identifiers.
+const (
+	compGzip = 1
+	compLzma = 2
+	compLzo  = 3
+	compXz   = 4
+	compLz4  = 5
+	compZstd = 6
+)
+
+var compNames = map[uint16]string{
+	compGzip: "gzip",
+	compLzma: "lzma",
+	compLzo:  "lzo",
+	compXz:   "xz",
+	compLz4:  "lz4",
+	compZstd: "zstd",
+}
+
+// decompressor decompresses src, the decompressed data must not
+// exceed size bytes.
+type decompressor func(src []byte, size int) ([]byte, error)
+
+// readAllLimit reads r until EOF, failing if more than size bytes are read.
+func readAllLimit(r io.Reader, size int) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	n, err := buf.ReadFrom(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, err
+	} else if n > int64(size) {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", size)
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(src []byte, size int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAllLimit(r, size)
+}
+
+func lzmaDecompress(src []byte, size int) ([]byte, error) {
+	r, err := lzma.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return readAllLimit(r, size)
+}
+
+func xzDecompress(src []byte, size int) ([]byte, error) {
+	r, err := xz.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return readAllLimit(r, size)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdDecompress(src []byte, size int) ([]byte, error) {
+	// the decoder is safe for concurrent DecodeAll calls and
+	// expensive to create, share it between all images
+	zstdOnce.Do(func() {
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	})
+	if zstdErr != nil {
+		return nil, zstdErr
+	}
+	b, err := zstdDecoder.DecodeAll(src, make([]byte, 0, size))
+	if err != nil {
+		return nil, err
+	} else if len(b) > size {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", size)
+	}
+	return b, nil
+}
+
+// lz4Decompress decompresses a LZ4 block, squashfs stores raw
+// blocks without the LZ4 frame format.
+func lz4Decompress(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+	errCorrupted := fmt.Errorf("corrupted lz4 block")
+
+	// readLength reads the additional bytes of a length field.
+	readLength := func(i int, l int) (int, int, error) {
+		for {
+			if i >= len(src) {
+				return 0, 0, errCorrupted
+			}
+			b := src[i]
+			i++
+			l += int(b)
+			if b != 255 {
+				return i, l, nil
+			}
+		}
+	}
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		var err error
+
+		// literals
+		lit := int(token >> 4)
+		if lit == 15 {
+			if i, lit, err = readLength(i, lit); err != nil {
+				return nil, err
+			}
+		}
+		if lit > len(src)-i || lit > size-len(dst) {
+			return nil, errCorrupted
+		}
+		dst = append(dst, src[i:i+lit]...)
+		i += lit
+
+		// the last sequence has no match
+		if i == len(src) {
+			break
+		}
+
+		// match
+		if i+2 > len(src) {
+			return nil, errCorrupted
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errCorrupted
+		}
+		ml := int(token & 15)
+		if ml == 15 {
+			if i, ml, err = readLength(i, ml); err != nil {
+				return nil, err
+			}
+		}
+		ml += 4
+		if ml > size-len(dst) {
+			return nil, errCorrupted
+		}
+		// the match may overlap with the bytes it produces
+		start := len(dst) - offset
+		for j := 0; j < ml; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	return dst, nil
+}
+
+// getDecompressor returns the decompressor of the comp squashfs compressor.
+func getDecompressor(comp uint16) (decompressor, error) {
+	switch comp {
+	case compGzip:
+		return gzipDecompress, nil
+	case compLzma:
+		return lzmaDecompress, nil
+	case compXz:
+		return xzDecompress, nil
+	case compLz4:
+		return lz4Decompress, nil
+	case compZstd:
+		return zstdDecompress, nil
+	case compLzo:
+		return nil, fmt.Errorf("lzo compression is not supported")
+	}
+	return nil, fmt.Errorf("unknown compression algorithm %d", comp)
+}
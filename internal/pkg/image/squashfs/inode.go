@@ -0,0 +1,434 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// inode types, extended types are the basic type plus 7.
+const (
+	inodeDir     = 1
+	inodeFile    = 2
+	inodeSymlink = 3
+	inodeBlock   = 4
+	inodeChar    = 5
+	inodeFifo    = 6
+	inodeSocket  = 7
+	inodeExt     = 7
+)
+
+// xattr name prefixes, the value is stored out of line when
+// xattrOutOfLine is set in the type.
+const (
+	xattrUser      = 0
+	xattrTrusted   = 1
+	xattrSecurity  = 2
+	xattrOutOfLine = 0x100
+)
+
+var xattrPrefixes = map[uint16]string{
+	xattrUser:     "user.",
+	xattrTrusted:  "trusted.",
+	xattrSecurity: "security.",
+}
+
+// Inode describes a file of the image.
+type Inode struct {
+	Mode    os.FileMode
+	UID     uint32
+	GID     uint32
+	ModTime time.Time
+	// Number is the inode number, hard links share the same number.
+	Number uint32
+	Nlink  uint32
+	// Size is the size of regular files and symbolic link targets.
+	Size int64
+	// Target is the target of symbolic links.
+	Target string
+	// Rdev is the device number of block and character devices.
+	Rdev uint32
+
+	xattr uint32
+
+	// directory listing location
+	dirBlock  uint32
+	dirOffset uint16
+
+	// regular file data location
+	blocksStart int64
+	fragment    uint32
+	fragOffset  uint32
+	blockSizes  []uint32
+}
+
+// IsDir returns if the inode is a directory.
+func (i *Inode) IsDir() bool {
+	return i.Mode.IsDir()
+}
+
+// Major returns the major number of device inodes.
+func (i *Inode) Major() uint32 {
+	return (i.Rdev & 0xfff00) >> 8
+}
+
+// Minor returns the minor number of device inodes.
+func (i *Inode) Minor() uint32 {
+	return (i.Rdev & 0xff) | ((i.Rdev >> 12) & 0xfff00)
+}
+
+type inodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UIDIndex    uint16
+	GIDIndex    uint16
+	ModTime     uint32
+	Number      uint32
+}
+
+// fileMode converts squashfs type and permission bits to a file mode.
+func fileMode(typ, perm uint16) (os.FileMode, error) {
+	mode := os.FileMode(perm & 0o777)
+	if perm&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+
+	if typ > inodeExt {
+		typ -= inodeExt
+	}
+	switch typ {
+	case inodeDir:
+		mode |= os.ModeDir
+	case inodeFile:
+	case inodeSymlink:
+		mode |= os.ModeSymlink
+	case inodeBlock:
+		mode |= os.ModeDevice
+	case inodeChar:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case inodeFifo:
+		mode |= os.ModeNamedPipe
+	case inodeSocket:
+		mode |= os.ModeSocket
+	default:
+		return 0, fmt.Errorf("unknown inode type %d", typ)
+	}
+	return mode, nil
+}
+
+// inode reads the inode referenced by ref, the upper bits are the position
+// of the metadata block relative to the inode table, the lower 16 bits the
+// offset of the inode in the decompressed block.
+func (sqfs *Reader) inode(ref uint64) (*Inode, error) {
+	m, err := sqfs.newMetadataReader(int64(sqfs.sb.InodeTable)+int64(ref>>16), int(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+
+	var h inodeHeader
+	if err := binary.Read(m, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("while reading inode header: %s", err)
+	}
+
+	ino := &Inode{
+		Number:   h.Number,
+		ModTime:  time.Unix(int64(h.ModTime), 0),
+		xattr:    noXattr,
+		fragment: noFragment,
+	}
+	if ino.Mode, err = fileMode(h.Type, h.Permissions); err != nil {
+		return nil, err
+	}
+	if ino.UID, err = sqfs.id(h.UIDIndex); err != nil {
+		return nil, err
+	}
+	if ino.GID, err = sqfs.id(h.GIDIndex); err != nil {
+		return nil, err
+	}
+
+	read := func(data ...interface{}) error {
+		for _, d := range data {
+			if err := binary.Read(m, binary.LittleEndian, d); err != nil {
+				return fmt.Errorf("while reading inode %d: %s", h.Number, err)
+			}
+		}
+		return nil
+	}
+
+	switch h.Type {
+	case inodeDir:
+		var size uint16
+		var parent uint32
+		err = read(&ino.dirBlock, &ino.Nlink, &size, &ino.dirOffset, &parent)
+		ino.Size = int64(size)
+	case inodeDir + inodeExt:
+		var size, parent uint32
+		var indexCount uint16
+		err = read(&ino.Nlink, &size, &ino.dirBlock, &parent, &indexCount, &ino.dirOffset, &ino.xattr)
+		ino.Size = int64(size)
+	case inodeFile:
+		var start, size uint32
+		err = read(&start, &ino.fragment, &ino.fragOffset, &size)
+		ino.blocksStart = int64(start)
+		ino.Size = int64(size)
+		ino.Nlink = 1
+	case inodeFile + inodeExt:
+		var start, size, sparse uint64
+		err = read(&start, &size, &sparse, &ino.Nlink, &ino.fragment, &ino.fragOffset, &ino.xattr)
+		ino.blocksStart = int64(start)
+		ino.Size = int64(size)
+	case inodeSymlink, inodeSymlink + inodeExt:
+		var size uint32
+		if err = read(&ino.Nlink, &size); err != nil {
+			break
+		}
+		if size > 4096 {
+			return nil, fmt.Errorf("corrupted inode %d: invalid symlink size %d", h.Number, size)
+		}
+		target := make([]byte, size)
+		if _, err = io.ReadFull(m, target); err != nil {
+			break
+		}
+		ino.Target = string(target)
+		ino.Size = int64(size)
+		if h.Type == inodeSymlink+inodeExt {
+			err = read(&ino.xattr)
+		}
+	case inodeBlock, inodeChar:
+		err = read(&ino.Nlink, &ino.Rdev)
+	case inodeBlock + inodeExt, inodeChar + inodeExt:
+		err = read(&ino.Nlink, &ino.Rdev, &ino.xattr)
+	case inodeFifo, inodeSocket:
+		err = read(&ino.Nlink)
+	case inodeFifo + inodeExt, inodeSocket + inodeExt:
+		err = read(&ino.Nlink, &ino.xattr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ino.Mode.IsRegular() {
+		if ino.Size < 0 {
+			return nil, fmt.Errorf("corrupted inode %d: invalid file size", h.Number)
+		}
+		bs := int64(sqfs.sb.BlockSize)
+		blocks := ino.Size / bs
+		if ino.fragment == noFragment && ino.Size%bs != 0 {
+			blocks++
+		}
+		// block sizes are stored in the inode table
+		if blocks*4 > int64(sqfs.sb.BytesUsed) {
+			return nil, fmt.Errorf("corrupted inode %d: invalid file size %d", h.Number, ino.Size)
+		}
+		ino.blockSizes = make([]uint32, blocks)
+		if err := read(ino.blockSizes); err != nil {
+			return nil, err
+		}
+	}
+
+	return ino, nil
+}
+
+// fileReader reads the content of a regular file block by block.
+type fileReader struct {
+	sqfs  *Reader
+	ino   *Inode
+	pos   int64
+	block int
+	buf   []byte
+	left  int64
+}
+
+// Open returns a reader for the content of the regular file ino.
+func (sqfs *Reader) Open(ino *Inode) (io.Reader, error) {
+	if !ino.Mode.IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	return &fileReader{sqfs: sqfs, ino: ino, pos: ino.blocksStart, left: ino.Size}, nil
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	if f.left == 0 {
+		return 0, io.EOF
+	}
+	if len(f.buf) == 0 {
+		if err := f.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	f.left -= int64(n)
+	return n, nil
+}
+
+// next loads the next data block or the fragment holding the file tail.
+func (f *fileReader) next() error {
+	bs := int64(f.sqfs.sb.BlockSize)
+	want := bs
+	if f.left < want {
+		want = f.left
+	}
+
+	if f.block < len(f.ino.blockSizes) {
+		size := f.ino.blockSizes[f.block]
+		f.block++
+
+		// a zero size is a sparse block
+		if size == 0 {
+			f.buf = make([]byte, want)
+			return nil
+		}
+		data, err := f.sqfs.readBlock(f.pos, size)
+		if err != nil {
+			return fmt.Errorf("while reading data block at %d: %s", f.pos, err)
+		}
+		f.pos += int64(size &^ dataUncompressed)
+		if int64(len(data)) < want {
+			return fmt.Errorf("corrupted data block: got %d bytes instead of %d", len(data), want)
+		}
+		f.buf = data[:want]
+		return nil
+	}
+
+	if f.ino.fragment == noFragment {
+		return fmt.Errorf("corrupted inode %d: missing data blocks", f.ino.Number)
+	}
+	data, err := f.sqfs.fragment(f.ino.fragment)
+	if err != nil {
+		return err
+	}
+	start := int64(f.ino.fragOffset)
+	if start+want > int64(len(data)) {
+		return fmt.Errorf("corrupted inode %d: fragment offset out of range", f.ino.Number)
+	}
+	f.buf = data[start : start+want]
+	return nil
+}
+
+// Xattr is an extended attribute.
+type Xattr struct {
+	Name  string
+	Value []byte
+}
+
+// loadXattrs reads the xattr id table.
+func (sqfs *Reader) loadXattrs() error {
+	if sqfs.xattrsLoaded {
+		return nil
+	}
+	sqfs.xattrsLoaded = true
+
+	if sqfs.sb.XattrIDTable == noTable {
+		return nil
+	}
+
+	var hdr struct {
+		Table  uint64
+		Count  uint32
+		Unused uint32
+	}
+	sr := io.NewSectionReader(sqfs.r, int64(sqfs.sb.XattrIDTable), int64(binary.Size(hdr)))
+	if err := binary.Read(sr, binary.LittleEndian, &hdr); err != nil {
+		return fmt.Errorf("while reading xattr table header: %s", err)
+	}
+	sqfs.xattrTable = int64(hdr.Table)
+
+	// the block pointers follow the header
+	table, err := sqfs.readTable(int64(sqfs.sb.XattrIDTable)+16, int(hdr.Count), 16)
+	if err != nil {
+		return fmt.Errorf("while reading xattr id table: %s", err)
+	}
+	sqfs.xattrIDs = make([]xattrIDEntry, hdr.Count)
+	return binary.Read(bytes.NewReader(table), binary.LittleEndian, sqfs.xattrIDs)
+}
+
+// Xattrs returns the extended attributes of the inode.
+func (sqfs *Reader) Xattrs(ino *Inode) ([]Xattr, error) {
+	if ino.xattr == noXattr {
+		return nil, nil
+	}
+	if err := sqfs.loadXattrs(); err != nil {
+		return nil, err
+	}
+	if int(ino.xattr) >= len(sqfs.xattrIDs) {
+		return nil, fmt.Errorf("corrupted inode %d: invalid xattr index %d", ino.Number, ino.xattr)
+	}
+	id := sqfs.xattrIDs[ino.xattr]
+
+	m, err := sqfs.newMetadataReader(sqfs.xattrTable+int64(id.Ref>>16), int(id.Ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make([]Xattr, 0, id.Count)
+	for i := uint32(0); i < id.Count; i++ {
+		var key struct {
+			Type     uint16
+			NameSize uint16
+		}
+		if err := binary.Read(m, binary.LittleEndian, &key); err != nil {
+			return nil, fmt.Errorf("while reading xattr key: %s", err)
+		}
+		prefix, ok := xattrPrefixes[key.Type&^xattrOutOfLine]
+		if !ok {
+			return nil, fmt.Errorf("unknown xattr type %d", key.Type)
+		}
+		name := make([]byte, key.NameSize)
+		if _, err := io.ReadFull(m, name); err != nil {
+			return nil, fmt.Errorf("while reading xattr name: %s", err)
+		}
+
+		value, err := readXattrValue(m)
+		if err != nil {
+			return nil, err
+		}
+		if key.Type&xattrOutOfLine != 0 {
+			if len(value) != 8 {
+				return nil, fmt.Errorf("corrupted out of line xattr reference")
+			}
+			ref := binary.LittleEndian.Uint64(value)
+			vm, err := sqfs.newMetadataReader(sqfs.xattrTable+int64(ref>>16), int(ref&0xffff))
+			if err != nil {
+				return nil, err
+			}
+			if value, err = readXattrValue(vm); err != nil {
+				return nil, err
+			}
+		}
+		xattrs = append(xattrs, Xattr{Name: prefix + string(name), Value: value})
+	}
+	return xattrs, nil
+}
+
+func readXattrValue(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("while reading xattr value: %s", err)
+	}
+	if size > 65536 {
+		return nil, fmt.Errorf("corrupted xattr value: invalid size %d", size)
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, fmt.Errorf("while reading xattr value: %s", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,440 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package squashfs implements a reader for squashfs v4 filesystem images,
+// it allows to extract images without the squashfs-tools.
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+)
+
+const (
+	magic = 0x73717368
+
+	// metadataSize is the maximum size of a decompressed metadata block.
+	metadataSize = 8192
+	// metadataUncompressed is set in metadata block headers when the
+	// block is stored uncompressed.
+	metadataUncompressed = 0x8000
+	// dataUncompressed is set in data block sizes when the block is
+	// stored uncompressed.
+	dataUncompressed = 1 << 24
+
+	// noFragment and noXattr mark inodes without fragment or xattrs.
+	noFragment = 0xffffffff
+	noXattr    = 0xffffffff
+	// noTable marks absent tables in the super block.
+	noTable = 0xffffffffffffffff
+
+	// maxCachedBlocks is the number of decompressed metadata blocks
+	// kept in memory.
+	maxCachedBlocks = 256
+
+	// maxWalkDepth is the maximum directory depth walked, deeper paths
+	// would exceed PATH_MAX once extracted.
+	maxWalkDepth = 2048
+)
+
+type superblock struct {
+	Magic          uint32
+	Inodes         uint32
+	MkfsTime       uint32
+	BlockSize      uint32
+	Fragments      uint32
+	Compression    uint16
+	BlockLog       uint16
+	Flags          uint16
+	NoIds          uint16
+	Major          uint16
+	Minor          uint16
+	RootInode      uint64
+	BytesUsed      uint64
+	IDTable        uint64
+	XattrIDTable   uint64
+	InodeTable     uint64
+	DirectoryTable uint64
+	FragmentTable  uint64
+	ExportTable    uint64
+}
+
+type fragmentEntry struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+type xattrIDEntry struct {
+	Ref   uint64
+	Count uint32
+	Size  uint32
+}
+
+// Reader reads a squashfs image.
+type Reader struct {
+	r            io.ReaderAt
+	sb           superblock
+	decompress   decompressor
+	ids          []uint32
+	fragments    []fragmentEntry
+	xattrTable   int64
+	xattrIDs     []xattrIDEntry
+	cache        map[int64]metadataBlock
+	fragIndex    uint32
+	fragData     []byte
+	xattrsLoaded bool
+}
+
+type metadataBlock struct {
+	data []byte
+	next int64
+}
+
+// NewReader returns a reader for the squashfs image read from r.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	sqfs := &Reader{
+		r:         r,
+		cache:     make(map[int64]metadataBlock),
+		fragIndex: noFragment,
+	}
+
+	sr := io.NewSectionReader(r, 0, int64(binary.Size(sqfs.sb)))
+	if err := binary.Read(sr, binary.LittleEndian, &sqfs.sb); err != nil {
+		return nil, fmt.Errorf("while reading squashfs super block: %s", err)
+	}
+	sb := &sqfs.sb
+	if sb.Magic != magic {
+		return nil, fmt.Errorf("not a squashfs image")
+	}
+	if sb.Major != 4 {
+		return nil, fmt.Errorf("unsupported squashfs version %d.%d", sb.Major, sb.Minor)
+	}
+	if sb.BlockLog > 20 || sb.BlockSize != 1<<sb.BlockLog {
+		return nil, fmt.Errorf("corrupted squashfs super block: invalid block size %d", sb.BlockSize)
+	}
+
+	var err error
+
+	sqfs.decompress, err = getDecompressor(sb.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := sqfs.readTable(int64(sb.IDTable), int(sb.NoIds), 4)
+	if err != nil {
+		return nil, fmt.Errorf("while reading id table: %s", err)
+	}
+	sqfs.ids = make([]uint32, sb.NoIds)
+	if err := binary.Read(bytes.NewReader(table), binary.LittleEndian, sqfs.ids); err != nil {
+		return nil, fmt.Errorf("while reading id table: %s", err)
+	}
+
+	if sb.Fragments > 0 && sb.FragmentTable != noTable {
+		table, err := sqfs.readTable(int64(sb.FragmentTable), int(sb.Fragments), 16)
+		if err != nil {
+			return nil, fmt.Errorf("while reading fragment table: %s", err)
+		}
+		sqfs.fragments = make([]fragmentEntry, sb.Fragments)
+		if err := binary.Read(bytes.NewReader(table), binary.LittleEndian, sqfs.fragments); err != nil {
+			return nil, fmt.Errorf("while reading fragment table: %s", err)
+		}
+	}
+
+	return sqfs, nil
+}
+
+// Compression returns the name of the compression algorithm of the image.
+func (sqfs *Reader) Compression() string {
+	return compNames[sqfs.sb.Compression]
+}
+
+// BlockSize returns the data block size of the image.
+func (sqfs *Reader) BlockSize() uint32 {
+	return sqfs.sb.BlockSize
+}
+
+// readMetadata reads and decompresses the metadata block at pos, it returns
+// the block content and the position of the next block.
+func (sqfs *Reader) readMetadata(pos int64) (metadataBlock, error) {
+	if b, ok := sqfs.cache[pos]; ok {
+		return b, nil
+	}
+
+	hdr := make([]byte, 2)
+	if _, err := sqfs.r.ReadAt(hdr, pos); err != nil {
+		return metadataBlock{}, fmt.Errorf("while reading metadata block header at %d: %s", pos, err)
+	}
+	h := binary.LittleEndian.Uint16(hdr)
+	size := int64(h &^ metadataUncompressed)
+	if size == 0 || size > metadataSize {
+		return metadataBlock{}, fmt.Errorf("corrupted metadata block at %d: invalid size %d", pos, size)
+	}
+
+	data := make([]byte, size)
+	if _, err := sqfs.r.ReadAt(data, pos+2); err != nil {
+		return metadataBlock{}, fmt.Errorf("while reading metadata block at %d: %s", pos, err)
+	}
+	if h&metadataUncompressed == 0 {
+		var err error
+		data, err = sqfs.decompress(data, metadataSize)
+		if err != nil {
+			return metadataBlock{}, fmt.Errorf("while decompressing metadata block at %d: %s", pos, err)
+		}
+	}
+
+	b := metadataBlock{data: data, next: pos + 2 + size}
+	if len(sqfs.cache) >= maxCachedBlocks {
+		sqfs.cache = make(map[int64]metadataBlock)
+	}
+	sqfs.cache[pos] = b
+	return b, nil
+}
+
+// metadataReader reads metadata spanning consecutive metadata blocks.
+type metadataReader struct {
+	sqfs *Reader
+	next int64
+	buf  []byte
+}
+
+// newMetadataReader returns a reader starting offset bytes into the
+// decompressed metadata block at pos.
+func (sqfs *Reader) newMetadataReader(pos int64, offset int) (*metadataReader, error) {
+	b, err := sqfs.readMetadata(pos)
+	if err != nil {
+		return nil, err
+	}
+	if offset > len(b.data) {
+		return nil, fmt.Errorf("corrupted metadata reference: offset %d beyond block at %d", offset, pos)
+	}
+	return &metadataReader{sqfs: sqfs, next: b.next, buf: b.data[offset:]}, nil
+}
+
+func (m *metadataReader) Read(p []byte) (int, error) {
+	if len(m.buf) == 0 {
+		b, err := m.sqfs.readMetadata(m.next)
+		if err != nil {
+			return 0, err
+		}
+		m.next = b.next
+		m.buf = b.data
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// readTable reads count entries of entrySize bytes from a lookup table,
+// the table at pos lists the positions of the metadata blocks storing
+// the entries.
+func (sqfs *Reader) readTable(pos int64, count int, entrySize int) ([]byte, error) {
+	size := count * entrySize
+	blocks := (size + metadataSize - 1) / metadataSize
+
+	ptrs := make([]uint64, blocks)
+	sr := io.NewSectionReader(sqfs.r, pos, int64(blocks*8))
+	if err := binary.Read(sr, binary.LittleEndian, ptrs); err != nil {
+		return nil, err
+	}
+
+	table := make([]byte, 0, size)
+	for _, p := range ptrs {
+		b, err := sqfs.readMetadata(int64(p))
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, b.data...)
+	}
+	if len(table) < size {
+		return nil, fmt.Errorf("truncated table at %d", pos)
+	}
+	return table[:size], nil
+}
+
+// id returns the uid or gid stored at index i of the id table.
+func (sqfs *Reader) id(i uint16) (uint32, error) {
+	if int(i) >= len(sqfs.ids) {
+		return 0, fmt.Errorf("corrupted inode: invalid id index %d", i)
+	}
+	return sqfs.ids[i], nil
+}
+
+// fragment returns the decompressed fragment block i.
+func (sqfs *Reader) fragment(i uint32) ([]byte, error) {
+	if i == sqfs.fragIndex {
+		return sqfs.fragData, nil
+	}
+	if int(i) >= len(sqfs.fragments) {
+		return nil, fmt.Errorf("corrupted inode: invalid fragment index %d", i)
+	}
+	data, err := sqfs.readBlock(int64(sqfs.fragments[i].Start), sqfs.fragments[i].Size)
+	if err != nil {
+		return nil, fmt.Errorf("while reading fragment %d: %s", i, err)
+	}
+	sqfs.fragIndex = i
+	sqfs.fragData = data
+	return data, nil
+}
+
+// readBlock reads and decompresses the data block stored at pos,
+// size is the block size field of the inode or fragment entry.
+func (sqfs *Reader) readBlock(pos int64, size uint32) ([]byte, error) {
+	n := size &^ dataUncompressed
+	if n > sqfs.sb.BlockSize {
+		return nil, fmt.Errorf("corrupted data block at %d: invalid size %d", pos, n)
+	}
+	data := make([]byte, n)
+	if _, err := sqfs.r.ReadAt(data, pos); err != nil {
+		return nil, err
+	}
+	if size&dataUncompressed != 0 {
+		return data, nil
+	}
+	return sqfs.decompress(data, int(sqfs.sb.BlockSize))
+}
+
+// Root returns the root directory inode.
+func (sqfs *Reader) Root() (*Inode, error) {
+	ino, err := sqfs.inode(sqfs.sb.RootInode)
+	if err != nil {
+		return nil, err
+	}
+	if !ino.IsDir() {
+		return nil, fmt.Errorf("corrupted squashfs image: root inode is not a directory")
+	}
+	return ino, nil
+}
+
+// DirEntry is an entry of a directory.
+type DirEntry struct {
+	Name  string
+	Inode *Inode
+}
+
+type dirHeader struct {
+	Count       uint32
+	Start       uint32
+	InodeNumber uint32
+}
+
+type dirEntryHeader struct {
+	Offset      uint16
+	InodeOffset int16
+	Type        uint16
+	NameSize    uint16
+}
+
+// ReadDir returns the entries of the directory dir sorted by name.
+func (sqfs *Reader) ReadDir(dir *Inode) ([]DirEntry, error) {
+	if !dir.IsDir() {
+		return nil, fmt.Errorf("not a directory")
+	}
+	// the directory size includes 3 bytes for the implicit . and .. entries
+	if dir.Size <= 3 {
+		return nil, nil
+	}
+
+	m, err := sqfs.newMetadataReader(int64(sqfs.sb.DirectoryTable)+int64(dir.dirBlock), int(dir.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	r := &io.LimitedReader{R: m, N: dir.Size - 3}
+
+	var entries []DirEntry
+
+	for r.N > 0 {
+		var h dirHeader
+		if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+			return nil, fmt.Errorf("while reading directory header: %s", err)
+		}
+		for i := uint32(0); i <= h.Count; i++ {
+			var e dirEntryHeader
+			if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+				return nil, fmt.Errorf("while reading directory entry: %s", err)
+			}
+			name := make([]byte, int(e.NameSize)+1)
+			if _, err := io.ReadFull(r, name); err != nil {
+				return nil, fmt.Errorf("while reading directory entry name: %s", err)
+			}
+			if !validName(string(name)) {
+				return nil, fmt.Errorf("corrupted directory: invalid entry name %q", name)
+			}
+			ino, err := sqfs.inode(uint64(h.Start)<<16 | uint64(e.Offset))
+			if err != nil {
+				return nil, fmt.Errorf("while reading inode of %s: %s", name, err)
+			}
+			entries = append(entries, DirEntry{Name: string(name), Inode: ino})
+		}
+	}
+	return entries, nil
+}
+
+// validName returns if name is a valid directory entry name which
+// can't escape its directory.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !bytes.ContainsAny([]byte(name), "/\x00")
+}
+
+// WalkFunc is called by Walk for each file of the image, path is the
+// slash separated path of the file relative to the image root, the root
+// directory being ".". If WalkFunc returns filepath.SkipDir for a
+// directory, its content is skipped.
+type WalkFunc func(path string, ino *Inode) error
+
+// Walk walks the image file tree in lexical order, calling fn for each
+// file, directories are visited before their content. Directory loops
+// and trees deeper than maxWalkDepth are reported as errors.
+func (sqfs *Reader) Walk(fn WalkFunc) error {
+	root, err := sqfs.Root()
+	if err != nil {
+		return err
+	}
+	err = sqfs.walk(".", root, 0, make(map[uint32]bool), fn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walk walks the tree rooted at ino, visited holds the inode numbers of
+// the directories already entered.
+func (sqfs *Reader) walk(p string, ino *Inode, depth int, visited map[uint32]bool, fn WalkFunc) error {
+	if err := fn(p, ino); err != nil {
+		return err
+	}
+	if !ino.IsDir() {
+		return nil
+	}
+
+	if visited[ino.Number] {
+		return fmt.Errorf("directory %s was already visited, the image contains a directory loop", p)
+	}
+	visited[ino.Number] = true
+	if depth >= maxWalkDepth {
+		return fmt.Errorf("directory %s exceeds the maximum depth of %d", p, maxWalkDepth)
+	}
+
+	entries, err := sqfs.ReadDir(ino)
+	if err != nil {
+		return fmt.Errorf("while reading directory %s: %s", p, err)
+	}
+	for _, e := range entries {
+		err := sqfs.walk(path.Join(p, e.Name), e.Inode, depth+1, visited, fn)
+		if err == filepath.SkipDir {
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,579 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const testBlockLog = 12
+
+// compressors used to build test images.
+var testCompressors = map[uint16]func(t *testing.T, b []byte) []byte{
+	compGzip: func(t *testing.T, b []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	},
+	compLzma: func(t *testing.T, b []byte) []byte {
+		var buf bytes.Buffer
+		w, err := lzma.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	},
+	compXz: func(t *testing.T, b []byte) []byte {
+		var buf bytes.Buffer
+		w, err := xz.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	},
+	compZstd: func(t *testing.T, b []byte) []byte {
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		return w.EncodeAll(b, nil)
+	},
+	compLz4: func(t *testing.T, b []byte) []byte {
+		// a single sequence of literals is a valid LZ4 block
+		if len(b) < 15 {
+			return append([]byte{byte(len(b) << 4)}, b...)
+		}
+		buf := []byte{0xf0}
+		l := len(b) - 15
+		for ; l >= 255; l -= 255 {
+			buf = append(buf, 255)
+		}
+		buf = append(buf, byte(l))
+		return append(buf, b...)
+	},
+}
+
+// imageBuilder builds squashfs test images, each table is stored in a
+// single metadata block.
+type imageBuilder struct {
+	t          *testing.T
+	comp       uint16
+	compress   bool
+	data       bytes.Buffer
+	inodes     bytes.Buffer
+	dirs       bytes.Buffer
+	xattrs     bytes.Buffer
+	xattrIDs   bytes.Buffer
+	fragments  bytes.Buffer
+	fragCount  uint32
+	xattrCount uint32
+}
+
+func (b *imageBuilder) write(w io.Writer, data ...interface{}) {
+	for _, d := range data {
+		if err := binary.Write(w, binary.LittleEndian, d); err != nil {
+			b.t.Fatal(err)
+		}
+	}
+}
+
+// block returns the compressed block and its size field.
+func (b *imageBuilder) block(data []byte) ([]byte, uint32) {
+	if !b.compress {
+		return data, uint32(len(data)) | dataUncompressed
+	}
+	c := testCompressors[b.comp](b.t, data)
+	if len(c) >= len(data) {
+		// like mksquashfs, store blocks which don't compress
+		return data, uint32(len(data)) | dataUncompressed
+	}
+	return c, uint32(len(c))
+}
+
+// addData writes a data block, a nil block is a sparse block.
+func (b *imageBuilder) addData(data []byte) uint32 {
+	if data == nil {
+		return 0
+	}
+	c, size := b.block(data)
+	b.data.Write(c)
+	return size
+}
+
+func (b *imageBuilder) addFragment(data []byte) uint32 {
+	start := uint64(96 + b.data.Len())
+	c, size := b.block(data)
+	b.data.Write(c)
+	b.write(&b.fragments, start, size, uint32(0))
+	b.fragCount++
+	return b.fragCount - 1
+}
+
+func (b *imageBuilder) addXattrs(xattrs map[string]string) uint32 {
+	ref := uint64(b.xattrs.Len())
+	size := 0
+	for k, v := range xattrs {
+		b.write(&b.xattrs, uint16(xattrUser), uint16(len(k)), []byte(k), uint32(len(v)), []byte(v))
+		size += len(k) + len(v)
+	}
+	b.write(&b.xattrIDs, ref, uint32(len(xattrs)), uint32(size))
+	b.xattrCount++
+	return b.xattrCount - 1
+}
+
+// addInode writes an inode and returns its reference.
+func (b *imageBuilder) addInode(typ, perm uint16, number uint32, data ...interface{}) uint64 {
+	ref := uint64(b.inodes.Len())
+	b.write(&b.inodes, typ, perm, uint16(0), uint16(1), uint32(1600000000), number)
+	b.write(&b.inodes, data...)
+	return ref
+}
+
+type testEntry struct {
+	name   string
+	typ    uint16
+	number uint32
+	ref    uint64
+}
+
+// addDir writes the listing of a directory and returns its location.
+func (b *imageBuilder) addDir(entries []testEntry) (uint32, uint16) {
+	start := b.dirs.Len()
+	if len(entries) > 0 {
+		b.write(&b.dirs, uint32(len(entries)-1), uint32(0), entries[0].number)
+		for _, e := range entries {
+			b.write(&b.dirs, uint16(e.ref), int16(e.number-entries[0].number), e.typ, uint16(len(e.name)-1), []byte(e.name))
+		}
+	}
+	return uint32(b.dirs.Len() - start), uint16(start)
+}
+
+// metadata writes a table in a single metadata block.
+func (b *imageBuilder) metadata(w *bytes.Buffer, data []byte) {
+	if len(data) > metadataSize {
+		b.t.Fatalf("metadata too large")
+	}
+	hdr := uint16(metadataUncompressed | len(data))
+	if b.compress {
+		if c := testCompressors[b.comp](b.t, data); len(c) < len(data) {
+			data = c
+			hdr = uint16(len(data))
+		}
+	}
+	b.write(w, hdr, data)
+}
+
+// testContent returns compressible content of size bytes.
+func testContent(size int, seed byte) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = seed + byte(i%251)
+	}
+	return content
+}
+
+// buildImage builds an image holding an extended file with xattrs made of
+// a data block, a sparse block and a fragment, a hard link and a symlink
+// to this file, and a directory with a small file and a named pipe.
+func buildImage(t *testing.T, comp uint16, compress bool) []byte {
+	b := &imageBuilder{t: t, comp: comp, compress: compress}
+	bs := 1 << testBlockLog
+
+	fileContent := testContent(2*bs+100, 1)
+	copy(fileContent[bs:2*bs], make([]byte, bs))
+	smallContent := testContent(300, 7)
+
+	// data blocks and fragments
+	fileStart := uint64(96 + b.data.Len())
+	block0 := b.addData(fileContent[:bs])
+	block1 := b.addData(nil)
+	fileFrag := b.addFragment(fileContent[2*bs:])
+	smallFrag := b.addFragment(smallContent)
+	xattr := b.addXattrs(map[string]string{"test": "value"})
+
+	// inodes
+	fileRef := b.addInode(inodeFile+inodeExt, 0o4755, 2,
+		fileStart, uint64(len(fileContent)), uint64(bs), uint32(2), fileFrag, uint32(0), xattr, block0, block1)
+	linkRef := b.addInode(inodeSymlink, 0o777, 3, uint32(1), uint32(4), []byte("file"))
+	smallRef := b.addInode(inodeFile, 0o644, 5, uint32(0), smallFrag, uint32(0), uint32(len(smallContent)))
+	fifoRef := b.addInode(inodeFifo, 0o600, 6, uint32(1))
+
+	dirSize, dirOffset := b.addDir([]testEntry{
+		{name: "fifo", typ: inodeFifo, number: 6, ref: fifoRef},
+		{name: "small", typ: inodeFile, number: 5, ref: smallRef},
+	})
+	dirRef := b.addInode(inodeDir, 0o755, 4, uint32(0), uint32(2), uint16(dirSize+3), dirOffset, uint32(1))
+
+	rootSize, rootOffset := b.addDir([]testEntry{
+		{name: "dir", typ: inodeDir, number: 4, ref: dirRef},
+		{name: "file", typ: inodeFile, number: 2, ref: fileRef},
+		{name: "hardlink", typ: inodeFile, number: 2, ref: fileRef},
+		{name: "link", typ: inodeSymlink, number: 3, ref: linkRef},
+	})
+	rootRef := b.addInode(inodeDir, 0o755, 1, uint32(0), uint32(3), uint16(rootSize+3), rootOffset, uint32(7))
+
+	return b.image(rootRef, 6)
+}
+
+// image assembles the image with the root directory inode rootRef.
+func (b *imageBuilder) image(rootRef uint64, inodes uint32) []byte {
+	bs := 1 << testBlockLog
+
+	// assemble the image after the super block
+	img := new(bytes.Buffer)
+	img.Write(make([]byte, 96))
+	img.Write(b.data.Bytes())
+
+	inodeTable := uint64(img.Len())
+	b.metadata(img, b.inodes.Bytes())
+	dirTable := uint64(img.Len())
+	b.metadata(img, b.dirs.Bytes())
+
+	fragBlock := uint64(img.Len())
+	b.metadata(img, b.fragments.Bytes())
+	fragTable := uint64(img.Len())
+	b.write(img, fragBlock)
+
+	xattrTable := uint64(img.Len())
+	b.metadata(img, b.xattrs.Bytes())
+	xattrIDBlock := uint64(img.Len())
+	b.metadata(img, b.xattrIDs.Bytes())
+	xattrIDTable := uint64(img.Len())
+	b.write(img, xattrTable, b.xattrCount, uint32(0), xattrIDBlock)
+
+	idBlock := uint64(img.Len())
+	b.metadata(img, []byte{0xe8, 0x03, 0, 0, 0xe9, 0x03, 0, 0})
+	idTable := uint64(img.Len())
+	b.write(img, idBlock)
+
+	sb := superblock{
+		Magic:          magic,
+		Inodes:         inodes,
+		BlockSize:      uint32(bs),
+		Fragments:      b.fragCount,
+		Compression:    b.comp,
+		BlockLog:       testBlockLog,
+		NoIds:          2,
+		Major:          4,
+		RootInode:      rootRef,
+		BytesUsed:      uint64(img.Len()),
+		IDTable:        idTable,
+		XattrIDTable:   xattrIDTable,
+		InodeTable:     inodeTable,
+		DirectoryTable: dirTable,
+		FragmentTable:  fragTable,
+		ExportTable:    noTable,
+	}
+	hdr := new(bytes.Buffer)
+	b.write(hdr, sb)
+
+	out := img.Bytes()
+	copy(out, hdr.Bytes())
+	return out
+}
+
+func TestReader(t *testing.T) {
+	bs := 1 << testBlockLog
+	fileContent := testContent(2*bs+100, 1)
+	copy(fileContent[bs:2*bs], make([]byte, bs))
+
+	type file struct {
+		mode    os.FileMode
+		content []byte
+		target  string
+		number  uint32
+		xattrs  []Xattr
+	}
+	expected := map[string]file{
+		".":        {mode: os.ModeDir | 0o755, number: 1},
+		"dir":      {mode: os.ModeDir | 0o755, number: 4},
+		"dir/fifo": {mode: os.ModeNamedPipe | 0o600, number: 6},
+		"dir/small": {
+			mode:    0o644,
+			content: testContent(300, 7),
+			number:  5,
+		},
+		"file": {
+			mode:    os.ModeSetuid | 0o755,
+			content: fileContent,
+			number:  2,
+			xattrs:  []Xattr{{Name: "user.test", Value: []byte("value")}},
+		},
+		"hardlink": {
+			mode:    os.ModeSetuid | 0o755,
+			content: fileContent,
+			number:  2,
+			xattrs:  []Xattr{{Name: "user.test", Value: []byte("value")}},
+		},
+		"link": {mode: os.ModeSymlink | 0o777, target: "file", number: 3},
+	}
+
+	tests := []struct {
+		name     string
+		comp     uint16
+		compress bool
+	}{
+		{name: "Uncompressed", comp: compGzip},
+		{name: "Gzip", comp: compGzip, compress: true},
+		{name: "Lzma", comp: compLzma, compress: true},
+		{name: "Xz", comp: compXz, compress: true},
+		{name: "Lz4", comp: compLz4, compress: true},
+		{name: "Zstd", comp: compZstd, compress: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(buildImage(t, tt.comp, tt.compress)))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if r.Compression() != compNames[tt.comp] {
+				t.Errorf("got compression %s, expected %s", r.Compression(), compNames[tt.comp])
+			}
+
+			var paths []string
+
+			err = r.Walk(func(p string, ino *Inode) error {
+				paths = append(paths, p)
+
+				e, ok := expected[p]
+				if !ok {
+					t.Errorf("unexpected file %s", p)
+					return nil
+				}
+				if ino.Mode != e.mode {
+					t.Errorf("%s: got mode %s, expected %s", p, ino.Mode, e.mode)
+				}
+				if ino.Number != e.number {
+					t.Errorf("%s: got inode number %d, expected %d", p, ino.Number, e.number)
+				}
+				if ino.UID != 1000 || ino.GID != 1001 {
+					t.Errorf("%s: got owner %d:%d, expected 1000:1001", p, ino.UID, ino.GID)
+				}
+				if ino.Target != e.target {
+					t.Errorf("%s: got target %q, expected %q", p, ino.Target, e.target)
+				}
+
+				xattrs, err := r.Xattrs(ino)
+				if err != nil {
+					t.Errorf("%s: unexpected error: %s", p, err)
+				} else if !reflect.DeepEqual(xattrs, e.xattrs) {
+					t.Errorf("%s: got xattrs %v, expected %v", p, xattrs, e.xattrs)
+				}
+
+				if !ino.Mode.IsRegular() {
+					return nil
+				}
+				f, err := r.Open(ino)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %s", p, err)
+				}
+				content, err := io.ReadAll(f)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %s", p, err)
+				}
+				if !bytes.Equal(content, e.content) {
+					t.Errorf("%s: unexpected content", p)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			expectedPaths := []string{".", "dir", "dir/fifo", "dir/small", "file", "hardlink", "link"}
+			if !reflect.DeepEqual(paths, expectedPaths) {
+				t.Errorf("got paths %v, expected %v", paths, expectedPaths)
+			}
+		})
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(buildImage(t, compGzip, true)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var paths []string
+
+	err = r.Walk(func(p string, ino *Inode) error {
+		paths = append(paths, p)
+		if p == "dir" || p == "hardlink" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expectedPaths := []string{".", "dir", "file", "hardlink", "link"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("got paths %v, expected %v", paths, expectedPaths)
+	}
+}
+
+func TestWalkLoop(t *testing.T) {
+	b := &imageBuilder{t: t, comp: compGzip}
+
+	// the root directory holds a directory entry referencing itself
+	rootRef := uint64(b.inodes.Len())
+	rootSize, rootOffset := b.addDir([]testEntry{
+		{name: "loop", typ: inodeDir, number: 1, ref: rootRef},
+	})
+	b.addInode(inodeDir, 0o755, 1, uint32(0), uint32(3), uint16(rootSize+3), rootOffset, uint32(2))
+
+	r, err := NewReader(bytes.NewReader(b.image(rootRef, 1)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var paths []string
+
+	err = r.Walk(func(p string, ino *Inode) error {
+		paths = append(paths, p)
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("unexpected success walking a directory loop")
+	}
+
+	expectedPaths := []string{".", "loop"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("got paths %v, expected %v", paths, expectedPaths)
+	}
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	img := buildImage(t, compGzip, true)
+
+	tests := []struct {
+		name   string
+		modify func(b []byte)
+	}{
+		{
+			name:   "Truncated",
+			modify: nil,
+		},
+		{
+			name:   "BadMagic",
+			modify: func(b []byte) { b[0] = 0 },
+		},
+		{
+			name:   "BadVersion",
+			modify: func(b []byte) { binary.LittleEndian.PutUint16(b[28:], 3) },
+		},
+		{
+			name:   "BadBlockSize",
+			modify: func(b []byte) { binary.LittleEndian.PutUint32(b[12:], 1000) },
+		},
+		{
+			name:   "Lzo",
+			modify: func(b []byte) { binary.LittleEndian.PutUint16(b[20:], compLzo) },
+		},
+		{
+			name:   "UnknownCompression",
+			modify: func(b []byte) { binary.LittleEndian.PutUint16(b[20:], 42) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := append([]byte{}, img...)
+			if tt.modify == nil {
+				b = b[:50]
+			} else {
+				tt.modify(b)
+			}
+			if _, err := NewReader(bytes.NewReader(b)); err == nil {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestLz4Decompress(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         []byte
+		size        int
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "Literals",
+			src:      []byte{0x30, 'a', 'b', 'c'},
+			size:     10,
+			expected: "abc",
+		},
+		{
+			name: "OverlappingMatch",
+			// "ab" then a match of 6 bytes at offset 2, then "c"
+			src:      []byte{0x22, 'a', 'b', 0x02, 0x00, 0x10, 'c'},
+			size:     10,
+			expected: "ababababc",
+		},
+		{
+			name: "LongMatch",
+			// "a" then a match of 4+15+1 bytes at offset 1
+			src:      []byte{0x1f, 'a', 0x01, 0x00, 0x01},
+			size:     100,
+			expected: "aaaaaaaaaaaaaaaaaaaaa",
+		},
+		{
+			name:        "TooLarge",
+			src:         []byte{0x22, 'a', 'b', 0x02, 0x00},
+			size:        4,
+			expectedErr: true,
+		},
+		{
+			name:        "InvalidOffset",
+			src:         []byte{0x22, 'a', 'b', 0x03, 0x00},
+			size:        10,
+			expectedErr: true,
+		},
+		{
+			name:        "TruncatedLiterals",
+			src:         []byte{0x50, 'a'},
+			size:        10,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := lz4Decompress(tt.src, tt.size)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("got error %v, expected error %v", err, tt.expectedErr)
+			}
+			if err == nil && string(b) != tt.expected {
+				t.Errorf("got %q, expected %q", b, tt.expected)
+			}
+		})
+	}
+}
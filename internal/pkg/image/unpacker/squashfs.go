@@ -77,7 +77,8 @@ func (s *Squashfs) HasUnsquashfs() bool {
 
 func (s *Squashfs) extract(files []string, reader io.Reader, dest string) (err error) {
 	if !s.HasUnsquashfs() {
-		return fmt.Errorf("could not extract squashfs data, unsquashfs not found")
+		sylog.Debugf("unsquashfs not found, using the built-in squashfs reader")
+		return s.extractWithReader(files, reader, dest)
 	}
 
 	// pipe over stdin by default
@@ -0,0 +1,305 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package unpacker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/squashfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	"golang.org/x/sys/unix"
+)
+
+type xattrMode int
+
+const (
+	noXattrs xattrMode = iota
+	userXattrs
+	allXattrs
+)
+
+// extractFilter selects the paths to extract, each filter is a list of
+// path components which may contain shell patterns.
+type extractFilter [][]string
+
+func newExtractFilter(files []string) extractFilter {
+	filter := make(extractFilter, 0, len(files))
+	for _, f := range files {
+		f = strings.Trim(filepath.ToSlash(filepath.Clean("/"+f)), "/")
+		if f == "" {
+			// the root directory selects everything
+			return nil
+		}
+		filter = append(filter, strings.Split(f, "/"))
+	}
+	return filter
+}
+
+// match returns if the slash separated path p must be extracted, either
+// because it matches a filter or it's located in a directory matching a
+// filter, and if p is a parent directory of paths matching a filter.
+func (f extractFilter) match(p string) (extract bool, parent bool) {
+	if len(f) == 0 {
+		return true, false
+	}
+	elems := strings.Split(p, "/")
+	for _, patterns := range f {
+		n := len(elems)
+		if n > len(patterns) {
+			n = len(patterns)
+		}
+		matched := true
+		for i := 0; i < n && matched; i++ {
+			ok, err := filepath.Match(patterns[i], elems[i])
+			matched = ok && err == nil
+		}
+		if !matched {
+			continue
+		}
+		if len(elems) >= len(patterns) {
+			return true, false
+		}
+		parent = true
+	}
+	return false, parent
+}
+
+// readerExtractor extracts a squashfs image with the built-in reader.
+type readerExtractor struct {
+	r      *squashfs.Reader
+	dest   string
+	chown  bool
+	xattrs xattrMode
+	// links maps inode numbers of hard linked files to their
+	// first extracted path.
+	links map[uint32]string
+	// dirs lists the extracted directories, their attributes are set
+	// once their content has been extracted.
+	dirs []extractedDir
+}
+
+type extractedDir struct {
+	path  string
+	inode *squashfs.Inode
+}
+
+// extractWithReader extracts the squashfs filesystem read from reader to
+// dest with the built-in squashfs reader, it is used when the unsquashfs
+// binary is not available.
+func (s *Squashfs) extractWithReader(files []string, reader io.Reader, dest string) (err error) {
+	ra, ok := reader.(io.ReaderAt)
+	if !ok {
+		// use the destination parent directory to store the
+		// temporary archive
+		tmp, err := ioutil.TempFile(filepath.Dir(dest), "archive-")
+		if err != nil {
+			return fmt.Errorf("failed to create staging file: %s", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if _, err := io.Copy(tmp, reader); err != nil {
+			return fmt.Errorf("failed to copy content in staging file: %s", err)
+		}
+		ra = tmp
+	}
+
+	r, err := squashfs.NewReader(ra)
+	if err != nil {
+		return fmt.Errorf("while reading squashfs image: %s", err)
+	}
+
+	hostuid, err := namespaces.HostUID()
+	if err != nil {
+		return fmt.Errorf("could not get host UID: %s", err)
+	}
+	rootless := hostuid != 0
+
+	e := &readerExtractor{
+		r:      r,
+		dest:   dest,
+		chown:  os.Geteuid() == 0,
+		xattrs: allXattrs,
+		links:  make(map[uint32]string),
+	}
+
+	// apply the same xattr restrictions than with unsquashfs
+	ok, err = TestUserXattr(filepath.Dir(dest))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		e.xattrs = noXattrs
+	} else if rootless {
+		e.xattrs = userXattrs
+	}
+
+	// non real root users could not create pseudo devices, exclude
+	// the dev directory if there is no specific files to extract
+	excludeDev := rootless && len(files) == 0
+	if excludeDev {
+		sylog.Debugf("Excluding /dev directory during root filesystem extraction (non root user)")
+	}
+
+	filter := newExtractFilter(files)
+
+	sylog.Debugf("Extracting %s squashfs image with the built-in reader", r.Compression())
+
+	err = r.Walk(func(p string, ino *squashfs.Inode) error {
+		if p == "." {
+			return e.extract(dest, ino)
+		}
+		if excludeDev && p == "dev" {
+			return filepath.SkipDir
+		}
+		extract, parent := filter.match(p)
+		if !extract && !(parent && ino.IsDir()) {
+			return filepath.SkipDir
+		}
+		return e.extract(filepath.Join(dest, filepath.FromSlash(p)), ino)
+	})
+	if err != nil {
+		return err
+	}
+
+	// set directory attributes in reverse order so parent
+	// directories are still writable while setting them
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		if err := e.setAttributes(e.dirs[i].path, e.dirs[i].inode); err != nil {
+			return err
+		}
+	}
+
+	if excludeDev {
+		// create $rootfs/dev as it has been excluded
+		rootfsDev := filepath.Join(dest, "dev")
+		if err := os.Mkdir(rootfsDev, 0o755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("could not create %s: %s", rootfsDev, err)
+		}
+	}
+	return nil
+}
+
+// extract creates path from the image inode ino.
+func (e *readerExtractor) extract(path string, ino *squashfs.Inode) error {
+	// replace existing files, existing directories are merged
+	if fi, err := os.Lstat(path); err == nil && !(fi.IsDir() && ino.IsDir()) {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("while removing %s: %s", path, err)
+		}
+	}
+
+	if !ino.IsDir() && ino.Nlink > 1 {
+		if target, ok := e.links[ino.Number]; ok {
+			if err := os.Link(target, path); err != nil {
+				return fmt.Errorf("while creating hard link %s: %s", path, err)
+			}
+			return nil
+		}
+		e.links[ino.Number] = path
+	}
+
+	mode := ino.Mode
+	switch {
+	case mode.IsDir():
+		if err := os.Mkdir(path, 0o700); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("while creating directory %s: %s", path, err)
+		}
+		e.dirs = append(e.dirs, extractedDir{path: path, inode: ino})
+		return nil
+	case mode.IsRegular():
+		if err := e.writeFile(path, ino); err != nil {
+			return err
+		}
+	case mode&os.ModeSymlink != 0:
+		if err := os.Symlink(ino.Target, path); err != nil {
+			return fmt.Errorf("while creating symlink %s: %s", path, err)
+		}
+	case mode&os.ModeDevice != 0:
+		devMode := uint32(unix.S_IFBLK)
+		if mode&os.ModeCharDevice != 0 {
+			devMode = unix.S_IFCHR
+		}
+		dev := int(unix.Mkdev(ino.Major(), ino.Minor()))
+		if err := unix.Mknod(path, devMode|uint32(mode.Perm()), dev); err != nil {
+			sylog.Warningf("Could not create device %s: %s", path, err)
+			return nil
+		}
+	case mode&os.ModeNamedPipe != 0:
+		if err := unix.Mkfifo(path, uint32(mode.Perm())); err != nil {
+			return fmt.Errorf("while creating fifo %s: %s", path, err)
+		}
+	default:
+		sylog.Debugf("Skipping socket %s", path)
+		return nil
+	}
+
+	return e.setAttributes(path, ino)
+}
+
+func (e *readerExtractor) writeFile(path string, ino *squashfs.Inode) error {
+	r, err := e.r.Open(ino)
+	if err != nil {
+		return fmt.Errorf("while reading %s: %s", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("while creating %s: %s", path, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("while extracting %s: %s", path, err)
+	}
+	return f.Close()
+}
+
+// setAttributes sets ownership, extended attributes, permissions and
+// modification time of path.
+func (e *readerExtractor) setAttributes(path string, ino *squashfs.Inode) error {
+	if e.chown {
+		if err := os.Lchown(path, int(ino.UID), int(ino.GID)); err != nil {
+			sylog.Debugf("Could not change ownership of %s: %s", path, err)
+		}
+	}
+
+	if e.xattrs != noXattrs {
+		xattrs, err := e.r.Xattrs(ino)
+		if err != nil {
+			return fmt.Errorf("while reading extended attributes of %s: %s", path, err)
+		}
+		for _, x := range xattrs {
+			if e.xattrs == userXattrs && !strings.HasPrefix(x.Name, "user.") {
+				continue
+			}
+			if err := unix.Lsetxattr(path, x.Name, x.Value, 0); err != nil {
+				sylog.Debugf("Could not set extended attribute %s on %s: %s", x.Name, path, err)
+			}
+		}
+	}
+
+	// symlink permissions are ignored, chmod is done after chown
+	// which clears the setuid and setgid bits
+	if ino.Mode&os.ModeSymlink == 0 {
+		if err := os.Chmod(path, ino.Mode); err != nil {
+			return fmt.Errorf("while setting permissions of %s: %s", path, err)
+		}
+	}
+
+	ts := unix.NsecToTimespec(ino.ModTime.UnixNano())
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("while setting modification time of %s: %s", path, err)
+	}
+	return nil
+}
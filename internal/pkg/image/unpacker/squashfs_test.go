@@ -16,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -43,21 +44,27 @@ func isExist(path string) bool {
 func TestSquashfs(t *testing.T) {
 	// Run on default TMPDIR which is unlikely to be a tmpfs but may be.
 	t.Run("default", func(t *testing.T) {
-		testSquashfs(t, "")
+		testSquashfs(t, "", false)
 	})
 	// Run on /dev/shm which should be a tmpfs - catches #5668
 	t.Run("dev_shm", func(t *testing.T) {
 		if _, err := os.Stat("/dev/shm"); err != nil {
 			t.Skipf("Could not access /dev/shm")
 		}
-		testSquashfs(t, "/dev/shm")
+		testSquashfs(t, "/dev/shm", false)
+	})
+	// Run with the built-in squashfs reader
+	t.Run("reader", func(t *testing.T) {
+		testSquashfs(t, "", true)
 	})
 }
 
-func testSquashfs(t *testing.T, tmpParent string) {
+func testSquashfs(t *testing.T, tmpParent string, builtin bool) {
 	s := NewSquashfs()
 
-	if !s.HasUnsquashfs() {
+	if builtin {
+		s.UnsquashfsPath = ""
+	} else if !s.HasUnsquashfs() {
 		t.Skip("unsquashfs not found")
 	}
 
@@ -73,11 +80,6 @@ func testSquashfs(t *testing.T, tmpParent string) {
 
 	savedPath := s.UnsquashfsPath
 
-	// test with an empty unsquashfs path
-	s.UnsquashfsPath = ""
-	if err := s.ExtractAll(archive, dir); err == nil {
-		t.Errorf("unexpected success with empty unsquashfs path")
-	}
 	// test with a bad unsquashfs path
 	s.UnsquashfsPath = "/unsquashfs-no-exists"
 	if err := s.ExtractAll(archive, dir); err == nil {
@@ -126,6 +128,38 @@ func testSquashfs(t *testing.T, tmpParent string) {
 	}
 }
 
+func TestExtractFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		path    string
+		extract bool
+		parent  bool
+	}{
+		{name: "NoFilter", path: "etc/passwd", extract: true},
+		{name: "Root", files: []string{"/"}, path: "etc/passwd", extract: true},
+		{name: "Exact", files: []string{"/etc/passwd"}, path: "etc/passwd", extract: true},
+		{name: "Relative", files: []string{"etc/passwd"}, path: "etc/passwd", extract: true},
+		{name: "Parent", files: []string{"/etc/passwd"}, path: "etc", parent: true},
+		{name: "Child", files: []string{"/etc"}, path: "etc/ssl/certs", extract: true},
+		{name: "Sibling", files: []string{"/etc/passwd"}, path: "etc/group"},
+		{name: "Other", files: []string{"/etc/passwd"}, path: "usr"},
+		{name: "Pattern", files: []string{"/etc/*.conf"}, path: "etc/ld.so.conf", extract: true},
+		{name: "PatternParent", files: []string{"/*/passwd"}, path: "etc", parent: true},
+		{name: "Multiple", files: []string{"/usr", "/etc/passwd"}, path: "etc/passwd", extract: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, parent := newExtractFilter(tt.files).match(tt.path)
+			got := []bool{extract, parent}
+			if expected := []bool{tt.extract, tt.parent}; !reflect.DeepEqual(got, expected) {
+				t.Errorf("got extract/parent %v, expected %v", got, expected)
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	cmdFunc = unsquashfsCmd
 	os.Exit(m.Run())
@@ -42,19 +42,21 @@ const (
 
 // File represents an instance file storing instance information
 type File struct {
-	Path       string `json:"-"`
-	Pid        int    `json:"pid"`
-	PPid       int    `json:"ppid"`
-	Name       string `json:"name"`
-	User       string `json:"user"`
-	Image      string `json:"image"`
-	Config     []byte `json:"config"`
-	UserNs     bool   `json:"userns"`
-	Cgroup     bool   `json:"cgroup"`
-	IP         string `json:"ip"`
-	LogErrPath string `json:"logErrPath"`
-	LogOutPath string `json:"logOutPath"`
-	Checkpoint string `json:"checkpoint"`
+	Path       string   `json:"-"`
+	Pid        int      `json:"pid"`
+	PPid       int      `json:"ppid"`
+	Name       string   `json:"name"`
+	User       string   `json:"user"`
+	Image      string   `json:"image"`
+	Config     []byte   `json:"config"`
+	UserNs     bool     `json:"userns"`
+	Cgroup     bool     `json:"cgroup"`
+	IP         string   `json:"ip"`
+	Ports      []string `json:"ports,omitempty"`
+	LogErrPath string   `json:"logErrPath"`
+	LogOutPath string   `json:"logOutPath"`
+	Checkpoint string   `json:"checkpoint"`
+	Paused     bool     `json:"paused,omitempty"`
 }
 
 // ProcName returns processus name based on instance name
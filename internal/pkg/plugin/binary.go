@@ -58,8 +58,9 @@ func Install(sifPath string) error {
 	}
 
 	m := &Meta{
-		Name:    manifest.Name,
-		Enabled: true,
+		Name:       manifest.Name,
+		Enabled:    true,
+		Executable: isExecutablePlugin(img),
 	}
 
 	err = m.install(img)
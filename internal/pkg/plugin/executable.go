@@ -0,0 +1,367 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/plugin/callback"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
+	"github.com/apptainer/apptainer/pkg/plugin/executable"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// pluginDirEnv is the environment variable holding the plugin
+// installation directory passed to executable plugins.
+const pluginDirEnv = "APPTAINER_PLUGIN_DIR"
+
+// execPlugin is an executable plugin, it holds the plugin handshake
+// reply and the value of the flags registered by the plugin.
+type execPlugin struct {
+	path      string
+	dir       string
+	handshake executable.HandshakeReply
+	flags     map[string]interface{}
+}
+
+// session is a session with a running executable plugin.
+type session struct {
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+// pipeConn is the connection over the plugin standard input and output.
+type pipeConn struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (c pipeConn) Close() error {
+	err := c.WriteCloser.Close()
+	if rerr := c.ReadCloser.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// startSession starts the plugin executable located at path and
+// performs the protocol handshake. If stdout is not nil, it's passed
+// to the plugin as file descriptor 3.
+func startSession(path, dir string, stdout *os.File, reply *executable.HandshakeReply) (*session, error) {
+	cmd := exec.Command(path)
+	cmd.Dir = "/"
+	cmd.Env = append(os.Environ(), pluginDirEnv+"="+dir)
+	cmd.Stderr = os.Stderr
+	if stdout != nil {
+		cmd.ExtraFiles = []*os.File{stdout}
+	}
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("while starting plugin %s: %s", path, err)
+	}
+
+	s := &session{
+		cmd:    cmd,
+		client: jsonrpc.NewClient(pipeConn{ReadCloser: out, WriteCloser: in}),
+	}
+
+	args := executable.HandshakeArgs{
+		ProtocolVersion:  executable.ProtocolVersion,
+		ApptainerVersion: buildcfg.PACKAGE_VERSION,
+	}
+	if err := s.client.Call(executable.MethodHandshake, args, reply); err != nil {
+		s.close()
+		return nil, fmt.Errorf("plugin handshake failed: %s", err)
+	} else if reply.ProtocolVersion != executable.ProtocolVersion {
+		s.close()
+		return nil, fmt.Errorf("plugin protocol version %d not supported, expected version %d", reply.ProtocolVersion, executable.ProtocolVersion)
+	}
+
+	return s, nil
+}
+
+// close closes the plugin standard input and waits the plugin exits.
+func (s *session) close() error {
+	s.client.Close()
+	return s.cmd.Wait()
+}
+
+// call starts a new session with the plugin, calls the method and
+// closes the session.
+func (p *execPlugin) call(method string, stdout *os.File, args, reply interface{}) error {
+	var handshake executable.HandshakeReply
+
+	s, err := startSession(p.path, p.dir, stdout, &handshake)
+	if err != nil {
+		return err
+	}
+	err = s.client.Call(method, args, reply)
+	if werr := s.close(); err == nil && werr != nil {
+		err = fmt.Errorf("plugin exited with error: %s", werr)
+	}
+	return err
+}
+
+// newExecPlugin returns the executable plugin described by m
+// once the protocol handshake succeeded.
+func newExecPlugin(m *Meta) (*execPlugin, error) {
+	p := &execPlugin{
+		path:  m.binaryName(),
+		dir:   m.path(),
+		flags: make(map[string]interface{}),
+	}
+
+	s, err := startSession(p.path, p.dir, nil, &p.handshake)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.close(); err != nil {
+		return nil, fmt.Errorf("plugin exited with error: %s", err)
+	}
+	return p, nil
+}
+
+// callbacks returns the callbacks corresponding to the plugin
+// capabilities.
+func (p *execPlugin) callbacks() []pluginapi.Callback {
+	var callbacks []pluginapi.Callback
+
+	if p.handshake.HasCapability(executable.CapabilityCommands) {
+		callbacks = append(callbacks, clicallback.Command(p.registerCommands))
+	}
+	if p.handshake.HasCapability(executable.CapabilityEngineConfig) {
+		callbacks = append(callbacks, clicallback.ApptainerEngineConfig(p.engineConfig))
+	}
+	if p.handshake.HasCapability(executable.CapabilityEvents) {
+		callbacks = append(callbacks,
+			apptainercallback.PostStartProcess(p.startEvent),
+			apptainercallback.CleanupContainer(p.stopEvent),
+		)
+	}
+	return callbacks
+}
+
+// installExecutable runs the installation of the executable plugin
+// described by m and sets the plugin callbacks name.
+func installExecutable(m *Meta) error {
+	p, err := newExecPlugin(m)
+	if err != nil {
+		return err
+	}
+
+	if p.handshake.Manifest.Name != m.Name {
+		return fmt.Errorf("plugin name %q doesn't match manifest name %q", p.handshake.Manifest.Name, m.Name)
+	}
+	if p.handshake.HasCapability(executable.CapabilityInstall) {
+		args := executable.InstallArgs{Path: m.path()}
+		if err := p.call(executable.MethodInstall, nil, args, &executable.Empty{}); err != nil {
+			return fmt.Errorf("while running plugin Install: %s", err)
+		}
+	}
+
+	m.Callbacks = callback.Names(p.callbacks())
+
+	return nil
+}
+
+// ExecutableManifest returns the manifest of the executable plugin
+// located at path.
+func ExecutableManifest(path string) (pluginapi.Manifest, error) {
+	var handshake executable.HandshakeReply
+
+	s, err := startSession(path, "", nil, &handshake)
+	if err != nil {
+		return pluginapi.Manifest{}, err
+	}
+	if err := s.close(); err != nil {
+		return pluginapi.Manifest{}, fmt.Errorf("plugin exited with error: %s", err)
+	}
+	return handshake.Manifest, nil
+}
+
+// registerCommands registers the commands and flags of the plugin.
+func (p *execPlugin) registerCommands(manager *cmdline.CommandManager) {
+	name := p.handshake.Manifest.Name
+
+	for _, c := range p.handshake.Commands {
+		fullName := c.FullName()
+		if strings.HasSuffix(fullName, "_") || fullName == "" {
+			sylog.Warningf("Plugin %s: ignoring command without name", name)
+			continue
+		} else if manager.GetCmdGroup(fullName) != nil {
+			sylog.Warningf("Plugin %s: command %s already exists", name, fullName)
+			continue
+		}
+
+		cmd := &cobra.Command{
+			DisableFlagsInUseLine: true,
+			Args:                  cobra.ArbitraryArgs,
+			Use:                   c.Use,
+			Short:                 c.Short,
+			Long:                  c.Long,
+			Example:               c.Example,
+			Run: func(cmd *cobra.Command, args []string) {
+				if err := p.run(fullName, args); err != nil {
+					sylog.Fatalf("%s", err)
+				}
+			},
+		}
+
+		if c.Parent == "" {
+			manager.RegisterCmd(cmd)
+		} else if parent := manager.GetCmd(c.Parent); parent != nil {
+			manager.RegisterSubCmd(parent, cmd)
+		} else {
+			sylog.Warningf("Plugin %s: parent command %s of %s not found", name, c.Parent, fullName)
+		}
+	}
+
+	for _, f := range p.handshake.Flags {
+		cmds := make([]*cobra.Command, 0, len(f.Commands))
+		for _, c := range f.Commands {
+			if cmd := manager.GetCmd(c); cmd != nil {
+				cmds = append(cmds, cmd)
+			} else {
+				sylog.Warningf("Plugin %s: command %s of flag --%s not found", name, c, f.Name)
+			}
+		}
+		if len(cmds) == 0 {
+			continue
+		}
+
+		flag := &cmdline.Flag{
+			ID:        fmt.Sprintf("plugin:%s:%s", name, f.Name),
+			Name:      f.Name,
+			ShortHand: f.ShortHand,
+			Usage:     f.Usage,
+			EnvKeys:   f.EnvKeys,
+		}
+		if f.Bool {
+			v := new(bool)
+			flag.Value = v
+			flag.DefaultValue = f.Default == "true"
+			p.flags[f.Name] = v
+		} else {
+			v := new(string)
+			flag.Value = v
+			flag.DefaultValue = f.Default
+			p.flags[f.Name] = v
+		}
+		manager.RegisterFlagForCmd(flag, cmds...)
+	}
+}
+
+// flagValues returns the value of the flags registered by the plugin.
+func (p *execPlugin) flagValues() map[string]string {
+	values := make(map[string]string, len(p.flags))
+	for name, v := range p.flags {
+		switch v := v.(type) {
+		case *bool:
+			values[name] = strconv.FormatBool(*v)
+		case *string:
+			values[name] = *v
+		}
+	}
+	return values
+}
+
+// run executes the plugin command.
+func (p *execPlugin) run(command string, args []string) error {
+	runArgs := executable.RunArgs{
+		Command: command,
+		Args:    args,
+		Flags:   p.flagValues(),
+	}
+	return p.call(executable.MethodRun, os.Stdout, runArgs, &executable.Empty{})
+}
+
+// engineConfig sends the engine configuration to the plugin and
+// replaces it by the configuration modified by the plugin.
+func (p *execPlugin) engineConfig(cfg *config.Common) {
+	if err := p.updateEngineConfig(cfg); err != nil {
+		sylog.Warningf("Plugin %s failed to modify engine configuration: %s", p.handshake.Manifest.Name, err)
+	}
+}
+
+func (p *execPlugin) updateEngineConfig(cfg *config.Common) error {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	args := executable.EngineConfigArgs{
+		Config: b,
+		Flags:  p.flagValues(),
+	}
+	var reply executable.EngineConfigReply
+	if err := p.call(executable.MethodEngineConfig, nil, args, &reply); err != nil {
+		return err
+	}
+
+	// the engine configuration is reset before decoding the
+	// reply to keep the engine configuration pointer in use
+	// and to not merge the configurations
+	engineConfig := cfg.EngineConfig
+	if v := reflect.ValueOf(engineConfig); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	*cfg = config.Common{EngineConfig: engineConfig}
+
+	return json.Unmarshal(reply.Config, cfg)
+}
+
+// event sends a runtime lifecycle event to the plugin.
+func (p *execPlugin) event(cfg *config.Common, e executable.Event) {
+	e.ContainerID = cfg.ContainerID
+	if c, ok := cfg.EngineConfig.(*apptainerConfig.EngineConfig); ok {
+		e.Image = c.GetImage()
+	}
+	if err := p.call(executable.MethodEvent, nil, e, &executable.Empty{}); err != nil {
+		sylog.Warningf("Plugin %s failed to process %s event: %s", p.handshake.Manifest.Name, e.Type, err)
+	}
+}
+
+func (p *execPlugin) startEvent(cfg *config.Common, pid int) error {
+	p.event(cfg, executable.Event{Type: executable.EventStart, Pid: pid})
+	return nil
+}
+
+func (p *execPlugin) stopEvent(cfg *config.Common, status syscall.WaitStatus) error {
+	exitStatus := status.ExitStatus()
+	if status.Signaled() {
+		exitStatus = 128 + int(status.Signal())
+	}
+	p.event(cfg, executable.Event{Type: executable.EventStop, ExitStatus: exitStatus})
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	"github.com/apptainer/apptainer/pkg/plugin/executable"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/spf13/cobra"
+)
+
+// testPluginEnv is set to run the test binary as an executable plugin,
+// its value is a file where events are written.
+const testPluginEnv = "APPTAINER_TEST_EXEC_PLUGIN"
+
+var testPlugin = &executable.Plugin{
+	Manifest: pluginapi.Manifest{
+		Name:    "example.com/test-plugin",
+		Version: "0.1.0",
+	},
+	Commands: []executable.Command{
+		{
+			Use: "hello [name]",
+			Run: func(stdout io.Writer, args []string, flags map[string]string) error {
+				_, err := fmt.Fprintf(stdout, "hello %s %s", strings.Join(args, " "), flags["greeting"])
+				return err
+			},
+		},
+	},
+	Flags: []executable.Flag{
+		{Name: "greeting", Default: "!", Commands: []string{"hello"}},
+		{Name: "test-bool", Bool: true, Commands: []string{"hello", "nonexistent"}},
+	},
+	EngineConfig: func(cfg *config.Common, flags map[string]string) error {
+		c := cfg.EngineConfig.(*apptainerConfig.EngineConfig)
+		c.SetImage(c.GetImage() + flags["greeting"])
+		return nil
+	},
+	Event: func(e executable.Event) error {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(os.Getenv(testPluginEnv), b, 0o644)
+	},
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) != "" {
+		if err := executable.Serve(testPlugin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestPlugin(t *testing.T) (*execPlugin, string) {
+	eventFile := filepath.Join(t.TempDir(), "event")
+	t.Setenv(testPluginEnv, eventFile)
+
+	p := &execPlugin{
+		path:  os.Args[0],
+		flags: make(map[string]interface{}),
+	}
+	s, err := startSession(p.path, p.dir, nil, &p.handshake)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return p, eventFile
+}
+
+func TestExecutableHandshake(t *testing.T) {
+	p, _ := newTestPlugin(t)
+
+	if p.handshake.Manifest.Name != testPlugin.Manifest.Name {
+		t.Errorf("got plugin name %q, expected %q", p.handshake.Manifest.Name, testPlugin.Manifest.Name)
+	}
+
+	names := []string{"cli.Command", "cli.ApptainerEngineConfig", "apptainer.PostStartProcess", "apptainer.CleanupContainer"}
+	callbacks := p.callbacks()
+	if len(callbacks) != len(names) {
+		t.Fatalf("got %d callbacks, expected %d", len(callbacks), len(names))
+	}
+	for i, c := range callbacks {
+		if n := fmt.Sprintf("%T", c); n != names[i] {
+			t.Errorf("got callback %s, expected %s", n, names[i])
+		}
+	}
+
+	m, err := ExecutableManifest(os.Args[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if m.Name != testPlugin.Manifest.Name {
+		t.Errorf("got manifest name %q, expected %q", m.Name, testPlugin.Manifest.Name)
+	}
+}
+
+func TestExecutableCommands(t *testing.T) {
+	p, _ := newTestPlugin(t)
+
+	manager := cmdline.NewCommandManager(&cobra.Command{Use: "apptainer"})
+	p.registerCommands(manager)
+
+	cmd := manager.GetCmd("hello")
+	if cmd == nil {
+		t.Fatalf("command hello not registered")
+	}
+	if err := cmd.Flags().Set("greeting", "?"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := cmd.Flags().Set("test-bool", "true"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	values := p.flagValues()
+	if values["greeting"] != "?" || values["test-bool"] != "true" {
+		t.Errorf("unexpected flag values: %v", values)
+	}
+
+	out, err := ioutil.TempFile(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer out.Close()
+
+	args := executable.RunArgs{Command: "hello", Args: []string{"world"}, Flags: values}
+	if err := p.call(executable.MethodRun, out, args, &executable.Empty{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(b) != "hello world ?" {
+		t.Errorf("got output %q, expected %q", b, "hello world ?")
+	}
+
+	args.Command = "unknown"
+	if err := p.call(executable.MethodRun, out, args, &executable.Empty{}); err == nil {
+		t.Errorf("unexpected success with unknown command")
+	}
+}
+
+func TestExecutableEngineConfig(t *testing.T) {
+	p, _ := newTestPlugin(t)
+	greeting := "-modified"
+	p.flags["greeting"] = &greeting
+
+	engineConfig := apptainerConfig.NewConfig()
+	engineConfig.SetImage("image.sif")
+	engineConfig.SetBindPath([]apptainerConfig.BindPath{{Source: "/opt", Destination: "/opt"}})
+	cfg := &config.Common{
+		EngineName:   apptainerConfig.Name,
+		ContainerID:  "test",
+		EngineConfig: engineConfig,
+	}
+
+	if err := p.updateEngineConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.EngineConfig != engineConfig {
+		t.Errorf("engine configuration pointer was replaced")
+	}
+	if image := engineConfig.GetImage(); image != "image.sif-modified" {
+		t.Errorf("got image %q, expected image.sif-modified", image)
+	}
+	if binds := engineConfig.GetBindPath(); len(binds) != 1 || binds[0].Source != "/opt" {
+		t.Errorf("unexpected bind paths: %v", binds)
+	}
+	if cfg.ContainerID != "test" {
+		t.Errorf("got container ID %q, expected test", cfg.ContainerID)
+	}
+}
+
+func TestExecutableEvents(t *testing.T) {
+	p, eventFile := newTestPlugin(t)
+
+	engineConfig := apptainerConfig.NewConfig()
+	engineConfig.SetImage("image.sif")
+	cfg := &config.Common{ContainerID: "test", EngineConfig: engineConfig}
+
+	// exited with status 3
+	if err := p.stopEvent(cfg, syscall.WaitStatus(3<<8)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(eventFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var e executable.Event
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := executable.Event{Type: executable.EventStop, ContainerID: "test", Image: "image.sif", ExitStatus: 3}
+	if e != expected {
+		t.Errorf("got event %+v, expected %+v", e, expected)
+	}
+}
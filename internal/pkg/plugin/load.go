@@ -45,7 +45,7 @@ func LoadCallbacks(cb pluginapi.Callback) ([]pluginapi.Callback, error) {
 
 		for _, name := range meta.Callbacks {
 			if name == callbackName {
-				if err := loadCallbacks(meta.binaryName()); err != nil {
+				if err := loadCallbacks(meta); err != nil {
 					// This might be destroying information by
 					// grabbing only the textual description of the
 					// error
@@ -110,22 +110,35 @@ func initMetaPlugin() error {
 }
 
 // loadCallbacks loads the plugin and the plugin callbacks.
-func loadCallbacks(path string) error {
+func loadCallbacks(meta *Meta) error {
 	lp.Lock()
 	defer lp.Unlock()
 
+	path := meta.binaryName()
+
 	if _, ok := lp.plugins[path]; ok {
 		return nil
 	}
 
-	pl, err := LoadObject(path)
-	if err != nil {
-		return err
+	var callbacks []pluginapi.Callback
+
+	if meta.Executable {
+		p, err := newExecPlugin(meta)
+		if err != nil {
+			return err
+		}
+		callbacks = p.callbacks()
+	} else {
+		pl, err := LoadObject(path)
+		if err != nil {
+			return err
+		}
+		callbacks = pl.Callbacks
 	}
 
 	lp.plugins[path] = struct{}{}
 
-	for _, c := range pl.Callbacks {
+	for _, c := range callbacks {
 		callback.Load(c)
 	}
 
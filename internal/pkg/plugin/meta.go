@@ -32,6 +32,8 @@ var (
 	nameManifest = "object.manifest"
 	// nameBinary is the name of the plugin object
 	nameBinary = "object.so"
+	// nameExecutable is the name of the plugin executable
+	nameExecutable = "object.exec"
 )
 
 // Meta is an internal representation of a plugin binary
@@ -45,6 +47,9 @@ type Meta struct {
 	Enabled bool
 	// Callbacks contains callbacks name registered by the plugin.
 	Callbacks []string
+	// Executable reports whether the plugin is an executable
+	// plugin or a Go plugin object.
+	Executable bool `json:",omitempty"`
 }
 
 // loadFromJSON loads a Meta type from an io.Reader containing
@@ -113,13 +118,18 @@ func (m *Meta) install(img *image.Image) error {
 }
 
 func (m *Meta) installBinary(img *image.Image) error {
-	fh, err := os.Create(m.binaryName())
+	mode := os.FileMode(0o644)
+	if m.Executable {
+		mode = 0o755
+	}
+
+	fh, err := os.OpenFile(m.binaryName(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
 
-	r, err := getBinaryReader(img)
+	r, err := getBinaryReader(img, m.Executable)
 	if err != nil {
 		return err
 	}
@@ -145,6 +155,10 @@ func (m *Meta) installManifest(img *image.Image) error {
 }
 
 func (m *Meta) runInstall() error {
+	if m.Executable {
+		return installExecutable(m)
+	}
+
 	binary := m.binaryName()
 
 	pl, err := LoadObject(binary)
@@ -275,6 +289,9 @@ func (m *Meta) manifestName() string {
 }
 
 func (m *Meta) binaryName() string {
+	if m.Executable {
+		return filepath.Join(m.path(), nameExecutable)
+	}
 	return filepath.Join(m.path(), nameBinary)
 }
 
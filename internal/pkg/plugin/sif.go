@@ -23,6 +23,9 @@ const (
 	// pluginBinaryName is the name of the plugin binary within the
 	// SIF file
 	pluginBinaryName = "plugin.so"
+	// pluginExecutableName is the name of the plugin executable
+	// within the SIF file
+	pluginExecutableName = "plugin.exec"
 	// pluginManifestName is the name of the plugin manifest within
 	// the SIF file
 	pluginManifestName = "plugin.manifest"
@@ -38,6 +41,9 @@ const (
 //   - PartType: sif.PartData
 // DESCR[1]: Sifmanifest
 //   - Datatype: sif.DataGenericJSON
+//
+// The partition is named plugin.so for a Go plugin object and
+// plugin.exec for an executable plugin.
 func isPluginFile(img *image.Image) bool {
 	if img.Type != image.SIF {
 		return false
@@ -49,7 +55,7 @@ func isPluginFile(img *image.Image) bool {
 	}
 
 	// check binary object
-	if part[0].Name != pluginBinaryName {
+	if part[0].Name != pluginBinaryName && part[0].Name != pluginExecutableName {
 		return false
 	} else if part[0].AllowedUsage&image.DataUsage == 0 {
 		return false
@@ -85,7 +91,17 @@ func getManifest(img *image.Image) (pluginapi.Manifest, error) {
 	return manifest, nil
 }
 
-func getBinaryReader(img *image.Image) (io.Reader, error) {
+// isExecutablePlugin returns if the plugin image contains an
+// executable plugin, the image must be a valid plugin file.
+func isExecutablePlugin(img *image.Image) bool {
+	part, _ := img.GetAllPartitions()
+	return len(part) == 1 && part[0].Name == pluginExecutableName
+}
+
+func getBinaryReader(img *image.Image, executable bool) (io.Reader, error) {
+	if executable {
+		return image.NewPartitionReader(img, pluginExecutableName, -1)
+	}
 	return image.NewPartitionReader(img, pluginBinaryName, -1)
 }
 
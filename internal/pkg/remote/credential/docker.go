@@ -0,0 +1,95 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package credential
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/containers/image/v5/docker/reference"
+	ocitypes "github.com/containers/image/v5/types"
+)
+
+// dockerHubServerURL is the server URL used by docker to store
+// Docker Hub credentials.
+const dockerHubServerURL = "https://index.docker.io/v1/"
+
+// dockerConfig is the part of the docker configuration file
+// describing the credential helpers.
+type dockerConfig struct {
+	CredsStore  string            `json:"credsStore,omitempty"`
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// DockerHelper returns the credential helper configured in the docker
+// configuration file for the registry, a registry specific helper
+// (credHelpers) takes precedence over the default helper (credsStore).
+// It returns a nil helper if there is no helper configured, along with
+// the server URL used to store the registry credentials.
+func DockerHelper(configFile, registry string) (*Helper, string, error) {
+	serverURL := registry
+	names := []string{registry}
+	if registry == "docker.io" || registry == "index.docker.io" {
+		serverURL = dockerHubServerURL
+		names = []string{"docker.io", "index.docker.io", dockerHubServerURL}
+	}
+
+	b, err := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return nil, serverURL, nil
+	} else if err != nil {
+		return nil, serverURL, fmt.Errorf("while reading %s: %s", configFile, err)
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, serverURL, fmt.Errorf("while decoding %s: %s", configFile, err)
+	}
+
+	for _, name := range names {
+		if h := cfg.CredHelpers[name]; h != "" {
+			return NewHelper(h), serverURL, nil
+		}
+	}
+	if cfg.CredsStore != "" {
+		return NewHelper(cfg.CredsStore), serverURL, nil
+	}
+	return nil, serverURL, nil
+}
+
+// DockerHelperAuth returns the credentials held by the credential helper
+// configured in the docker configuration file for the registry of the
+// image reference. It returns nil credentials if the reference is not
+// a docker registry reference, if no helper is configured or if the
+// helper doesn't hold credentials for the registry.
+func DockerHelperAuth(configFile string, ref ocitypes.ImageReference) (*ocitypes.DockerAuthConfig, error) {
+	if ref == nil || ref.Transport().Name() != "docker" || ref.DockerReference() == nil {
+		return nil, nil
+	}
+
+	h, serverURL, err := DockerHelper(configFile, reference.Domain(ref.DockerReference()))
+	if err != nil || h == nil {
+		return nil, err
+	}
+
+	c, err := h.Get(serverURL)
+	if errors.Is(err, ErrCredentialsNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if c.Username == TokenUsername {
+		return &ocitypes.DockerAuthConfig{IdentityToken: c.Secret}, nil
+	}
+	return &ocitypes.DockerAuthConfig{Username: c.Username, Password: c.Secret}, nil
+}
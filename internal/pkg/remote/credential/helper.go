@@ -0,0 +1,117 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package credential
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// HelperPrefix is the prefix of the credential helper executables
+// implementing the docker credential helper protocol.
+const HelperPrefix = "docker-credential-"
+
+// TokenUsername is the username used by credential helpers to
+// indicate that the secret is an identity token.
+const TokenUsername = "<token>"
+
+// errNotFoundMessage is the message returned by credential helpers
+// when the credentials are not found.
+const errNotFoundMessage = "credentials not found in native keychain"
+
+// ErrCredentialsNotFound is returned when the credential helper
+// doesn't hold credentials for a server.
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// Credentials are the credentials exchanged with a credential helper.
+type Credentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// Helper is an external credential helper, an executable named
+// docker-credential-<name> found in PATH.
+type Helper struct {
+	Name string
+}
+
+// NewHelper returns the credential helper with the given name.
+func NewHelper(name string) *Helper {
+	return &Helper{Name: name}
+}
+
+// Get returns the credentials stored for serverURL.
+func (h *Helper) Get(serverURL string) (*Credentials, error) {
+	out, err := h.run("get", strings.NewReader(serverURL))
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Credentials)
+	if err := json.Unmarshal(out, c); err != nil {
+		return nil, fmt.Errorf("while decoding %s%s output: %s", HelperPrefix, h.Name, err)
+	}
+	if c.ServerURL == "" {
+		c.ServerURL = serverURL
+	}
+	return c, nil
+}
+
+// Store stores the credentials c.
+func (h *Helper) Store(c *Credentials) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = h.run("store", bytes.NewReader(b))
+	return err
+}
+
+// Erase removes the credentials stored for serverURL. Erasing
+// credentials which don't exist is not an error.
+func (h *Helper) Erase(serverURL string) error {
+	_, err := h.run("erase", strings.NewReader(serverURL))
+	if errors.Is(err, ErrCredentialsNotFound) {
+		return nil
+	}
+	return err
+}
+
+// run executes the helper action with in as standard input and
+// returns the helper standard output.
+func (h *Helper) run(action string, in io.Reader) ([]byte, error) {
+	name := HelperPrefix + h.Name
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s not found: %s", name, err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(path, action)
+	cmd.Stdin = in
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stdout.String())
+		if msg == errNotFoundMessage {
+			return nil, ErrCredentialsNotFound
+		} else if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s %s failed: %s", name, action, msg)
+	}
+	return stdout.Bytes(), nil
+}
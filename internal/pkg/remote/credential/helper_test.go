@@ -0,0 +1,184 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package credential
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/oci/layout"
+	ocitypes "github.com/containers/image/v5/types"
+)
+
+// stubHelper is a credential helper storing credentials as files
+// named after the base64 encoded server URL.
+const stubHelper = `#!/bin/sh
+store="$STUB_HELPER_STORE"
+case "$1" in
+get)
+	f="$store/$(base64 -w0)"
+	if [ ! -f "$f" ]; then
+		echo "credentials not found in native keychain"
+		exit 1
+	fi
+	cat "$f"
+	;;
+store)
+	in=$(cat)
+	url=$(echo "$in" | sed -e 's/.*"ServerURL":"\([^"]*\)".*/\1/')
+	echo "$in" > "$store/$(printf '%s' "$url" | base64 -w0)"
+	;;
+erase)
+	f="$store/$(base64 -w0)"
+	if [ ! -f "$f" ]; then
+		echo "credentials not found in native keychain"
+		exit 1
+	fi
+	rm -f "$f"
+	;;
+*)
+	echo "unknown action $1"
+	exit 1
+	;;
+esac
+`
+
+// setupStubHelper installs the stub credential helper as
+// docker-credential-<name> in a directory prepended to PATH.
+func setupStubHelper(t *testing.T, name string) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "store")
+	if err := os.Mkdir(store, 0o700); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, HelperPrefix+name), []byte(stubHelper), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("STUB_HELPER_STORE", store)
+}
+
+func TestHelper(t *testing.T) {
+	setupStubHelper(t, "test")
+
+	h := NewHelper("test")
+	const serverURL = "https://cloud.example.com"
+
+	if _, err := h.Get(serverURL); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("got error %v, expected %v", err, ErrCredentialsNotFound)
+	}
+
+	c := &Credentials{ServerURL: serverURL, Username: TokenUsername, Secret: "s3cr3t"}
+	if err := h.Store(c); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := h.Get(serverURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if *got != *c {
+		t.Errorf("got credentials %+v, expected %+v", got, c)
+	}
+
+	if err := h.Erase(serverURL); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := h.Get(serverURL); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("got error %v, expected %v", err, ErrCredentialsNotFound)
+	}
+	if err := h.Erase(serverURL); err != nil {
+		t.Errorf("unexpected error while erasing missing credentials: %s", err)
+	}
+
+	if _, err := NewHelper("missing-helper").Get(serverURL); err == nil {
+		t.Errorf("unexpected success with missing helper")
+	}
+}
+
+func TestDockerHelperAuth(t *testing.T) {
+	setupStubHelper(t, "test")
+	setupStubHelper(t, "registry")
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	config := `{"credsStore": "test", "credHelpers": {"registry.example.com": "registry"}}`
+	if err := ioutil.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := NewHelper("test").Store(&Credentials{ServerURL: dockerHubServerURL, Username: "user", Secret: "pass"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := NewHelper("registry").Store(&Credentials{ServerURL: "registry.example.com", Username: TokenUsername, Secret: "token"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ociRef, err := layout.ParseReference(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		ref        string
+		configFile string
+		expected   *ocitypes.DockerAuthConfig
+	}{
+		{
+			name:       "DockerHub",
+			ref:        "//alpine:latest",
+			configFile: configFile,
+			expected:   &ocitypes.DockerAuthConfig{Username: "user", Password: "pass"},
+		},
+		{
+			name:       "RegistryHelper",
+			ref:        "//registry.example.com/alpine:latest",
+			configFile: configFile,
+			expected:   &ocitypes.DockerAuthConfig{IdentityToken: "token"},
+		},
+		{
+			name:       "NotFound",
+			ref:        "//other.example.com/alpine:latest",
+			configFile: configFile,
+		},
+		{
+			name:       "NoConfig",
+			ref:        "//alpine:latest",
+			configFile: filepath.Join(t.TempDir(), "config.json"),
+		},
+		{
+			name:       "NotDocker",
+			configFile: configFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := ociRef
+			if tt.ref != "" {
+				ref, err = docker.ParseReference(tt.ref)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			auth, err := DockerHelperAuth(tt.configFile, ref)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.expected == nil && auth != nil {
+				t.Errorf("got credentials %+v, expected none", auth)
+			} else if tt.expected != nil && (auth == nil || *auth != *tt.expected) {
+				t.Errorf("got credentials %+v, expected %+v", auth, tt.expected)
+			}
+		})
+	}
+}
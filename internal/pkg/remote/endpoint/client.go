@@ -111,7 +111,7 @@ func (config *Config) LibraryClientConfig(uri string) (*libClient.Config, error)
 		if err != nil {
 			return nil, fmt.Errorf("unable to get library service URI: %v", err)
 		}
-		libraryConfig.AuthToken = config.Token
+		libraryConfig.AuthToken = config.GetToken()
 		libraryConfig.BaseURL = libURI
 	} else if config.Exclusive {
 		libURI, err := config.GetServiceURI(Library)
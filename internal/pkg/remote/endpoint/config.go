@@ -21,6 +21,7 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/gosimple/slug"
 )
 
@@ -45,6 +46,8 @@ type Config struct {
 
 	// for internal purpose
 	credentials []*credential.Config
+	helper      *credential.Helper
+	helperToken *string
 	services    map[string][]Service
 }
 
@@ -52,6 +55,54 @@ func (config *Config) SetCredentials(creds []*credential.Config) {
 	config.credentials = creds
 }
 
+// SetCredentialHelper sets the credential helper holding the endpoint
+// token and the keyserver credentials, a nil helper means credentials
+// are stored in the remote configuration file.
+func (config *Config) SetCredentialHelper(h *credential.Helper) {
+	config.helper = h
+	config.helperToken = nil
+}
+
+// GetToken returns the endpoint token, the token is retrieved from the
+// credential helper when it's not stored in the remote configuration.
+func (config *Config) GetToken() string {
+	if config.Token != "" || config.helper == nil || config.URI == "" {
+		return config.Token
+	} else if config.helperToken != nil {
+		return *config.helperToken
+	}
+
+	token := ""
+	c, err := config.helper.Get(config.URI)
+	if err == nil {
+		token = c.Secret
+	} else if !errors.Is(err, credential.ErrCredentialsNotFound) {
+		sylog.Warningf("Could not get token for %s: %s", config.URI, err)
+	}
+	config.helperToken = &token
+	return token
+}
+
+// SetToken sets the endpoint token, the token is stored with the
+// credential helper if any, otherwise in the remote configuration.
+// An empty token removes the token.
+func (config *Config) SetToken(token string) error {
+	config.Token = ""
+	config.helperToken = nil
+
+	if config.helper == nil {
+		config.Token = token
+		return nil
+	} else if token == "" {
+		return config.helper.Erase(config.URI)
+	}
+	return config.helper.Store(&credential.Credentials{
+		ServerURL: config.URI,
+		Username:  credential.TokenUsername,
+		Secret:    token,
+	})
+}
+
 // GetUrl returns a URL with the correct https or http protocol for the endpoint.
 // The protocol depends on whether the endpoint is set 'Insecure'.
 func (config *Config) GetURL() (string, error) {
@@ -12,6 +12,7 @@ package endpoint
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -130,7 +131,7 @@ func (config *Config) UpdateKeyserversConfig() error {
 			URI: uri,
 			credential: &credential.Config{
 				URI:  uri,
-				Auth: credential.TokenPrefix + config.Token,
+				Auth: credential.TokenPrefix + config.GetToken(),
 			},
 		})
 		return nil
@@ -142,13 +143,13 @@ func (config *Config) UpdateKeyserversConfig() error {
 			// associated current endpoint token to the default key service
 			kc.credential = &credential.Config{
 				URI:  kc.URI,
-				Auth: credential.TokenPrefix + config.Token,
+				Auth: credential.TokenPrefix + config.GetToken(),
 			}
 		} else {
 			// attempt to find credentials in the credential store
 			for _, cred := range config.credentials {
 				if remoteutil.SameKeyserver(cred.URI, kc.URI) {
-					kc.credential = cred
+					kc.credential = config.helperCredential(cred)
 					break
 				}
 			}
@@ -157,6 +158,27 @@ func (config *Config) UpdateKeyserversConfig() error {
 	return nil
 }
 
+// helperCredential returns the keyserver credential with the
+// authentication retrieved from the credential helper when it's
+// not stored in the remote configuration.
+func (config *Config) helperCredential(cred *credential.Config) *credential.Config {
+	if cred.Auth != "" || config.helper == nil {
+		return cred
+	}
+	c, err := config.helper.Get(cred.URI)
+	if err != nil {
+		if !errors.Is(err, credential.ErrCredentialsNotFound) {
+			sylog.Warningf("Could not get credentials for %s: %s", cred.URI, err)
+		}
+		return cred
+	}
+	return &credential.Config{
+		URI:      cred.URI,
+		Auth:     c.Secret,
+		Insecure: cred.Insecure,
+	}
+}
+
 type keyserverTransport struct {
 	keyservers []*ServiceConfig
 	op         KeyserverOp
@@ -176,7 +176,7 @@ func (config *Config) GetAllServices() (map[string][]Service, error) {
 			URI: uri,
 			credential: &credential.Config{
 				URI:  uri,
-				Auth: credential.TokenPrefix + config.Token,
+				Auth: credential.TokenPrefix + config.GetToken(),
 			},
 		}
 
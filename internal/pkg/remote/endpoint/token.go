@@ -34,7 +34,7 @@ func (config *Config) VerifyToken(token string) (err error) {
 	}()
 
 	if token == "" {
-		token = config.Token
+		token = config.GetToken()
 	}
 
 	sp, err := config.GetAllServices()
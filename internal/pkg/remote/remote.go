@@ -53,9 +53,15 @@ type Config struct {
 	DefaultRemote string                      `yaml:"Active"`
 	Remotes       map[string]*endpoint.Config `yaml:"Remotes"`
 	Credentials   []*credential.Config        `yaml:"Credentials,omitempty"`
+	// CredentialHelper is the name of the credential helper
+	// (docker-credential-<name>) storing endpoint tokens and
+	// keyserver credentials instead of this file
+	CredentialHelper string `yaml:"CredentialHelper,omitempty"`
 
 	// set to true when this is the system configuration
 	system bool
+	// credential helper set in the system configuration
+	sysCredentialHelper string
 }
 
 // ReadFrom reads remote configuration from io.Reader
@@ -141,6 +147,7 @@ func (c *Config) SyncFrom(sys *Config) error {
 	if c.DefaultRemote == "" && sys.DefaultRemote != "" {
 		c.DefaultRemote = sys.DefaultRemote
 	}
+	c.sysCredentialHelper = sys.CredentialHelper
 
 	return nil
 }
@@ -220,9 +227,22 @@ func (c *Config) GetRemote(name string) (*endpoint.Config, error) {
 		return nil, fmt.Errorf("%s is not a remote", name)
 	}
 	r.SetCredentials(c.Credentials)
+	r.SetCredentialHelper(c.GetCredentialHelper())
 	return r, nil
 }
 
+// GetCredentialHelper returns the credential helper configured by the user,
+// or by the system administrator, or nil if credentials are stored in the
+// remote configuration file.
+func (c *Config) GetCredentialHelper() *credential.Helper {
+	if c.CredentialHelper != "" {
+		return credential.NewHelper(c.CredentialHelper)
+	} else if c.sysCredentialHelper != "" {
+		return credential.NewHelper(c.sysCredentialHelper)
+	}
+	return nil
+}
+
 // Login validates and stores credentials for a service like Docker/OCI registries
 // and keyservers.
 func (c *Config) Login(uri, username, password string, insecure bool) error {
@@ -271,6 +291,20 @@ func (c *Config) Login(uri, username, password string, insecure bool) error {
 		}
 	}
 
+	// keyserver credentials are stored with the credential helper
+	// if any, only the keyserver URI is kept in the configuration
+	if h := c.GetCredentialHelper(); h != nil && credConfig.Auth != "" {
+		err := h.Store(&credential.Credentials{
+			ServerURL: credConfig.URI,
+			Username:  credential.TokenUsername,
+			Secret:    credConfig.Auth,
+		})
+		if err != nil {
+			return err
+		}
+		credConfig.Auth = ""
+	}
+
 	c.Credentials = append(c.Credentials, credConfig)
 	return nil
 }
@@ -280,6 +314,18 @@ func (c *Config) Logout(uri string) error {
 	if err := credential.Manager.Logout(uri); err != nil {
 		return err
 	}
+	if _, err := remoteutil.NormalizeKeyserverURI(uri); err == nil {
+		if h := c.GetCredentialHelper(); h != nil {
+			for _, cred := range c.Credentials {
+				if !remoteutil.SameURI(cred.URI, uri) {
+					continue
+				}
+				if err := h.Erase(cred.URI); err != nil {
+					return err
+				}
+			}
+		}
+	}
 	// Older versions of Apptainer can create duplicate entries with same URI,
 	// so loop must handle removing multiple matches (#214).
 	for i := 0; i < len(c.Credentials); i++ {
@@ -763,6 +763,41 @@ func TestGetRemote(t *testing.T) {
 	}
 }
 
+func TestGetCredentialHelper(t *testing.T) {
+	tests := []struct {
+		name     string
+		usr      string
+		sys      string
+		expected string
+	}{
+		{name: "no helper"},
+		{name: "user helper", usr: "user", expected: "user"},
+		{name: "system helper", sys: "system", expected: "system"},
+		{name: "user helper overrides system", usr: "user", sys: "system", expected: "user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usr := &Config{Remotes: map[string]*endpoint.Config{}, CredentialHelper: tt.usr}
+			sys := &Config{Remotes: map[string]*endpoint.Config{}, CredentialHelper: tt.sys}
+			if err := usr.SyncFrom(sys); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			h := usr.GetCredentialHelper()
+			if tt.expected == "" && h != nil {
+				t.Errorf("got credential helper %s, expected none", h.Name)
+			} else if tt.expected != "" && (h == nil || h.Name != tt.expected) {
+				t.Errorf("got credential helper %v, expected %s", h, tt.expected)
+			}
+			// system credential helper must not be written
+			if usr.CredentialHelper != tt.usr {
+				t.Errorf("got user credential helper %q, expected %q", usr.CredentialHelper, tt.usr)
+			}
+		})
+	}
+}
+
 func TestGetDefaultRemote(t *testing.T) {
 	testsPass := []remoteTest{
 		{
@@ -0,0 +1,142 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/audit"
+	"github.com/apptainer/apptainer/internal/pkg/util/priv"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// containerAudit holds the container audit record and receives the
+// image digest computed in background, it's used by master process only.
+type containerAudit struct {
+	record *audit.Record
+	digest chan string
+}
+
+// startAudit writes the audit record for the container start.
+func (e *EngineOperations) startAudit(pid int) {
+	dest := e.EngineConfig.File.AuditLog
+	if dest == "" || dest == audit.None {
+		return
+	}
+
+	r := &audit.Record{
+		Event:     "start",
+		UID:       os.Getuid(),
+		Instance:  e.CommonConfig.ContainerID,
+		Image:     e.EngineConfig.GetImage(),
+		Pid:       pid,
+		StartTime: time.Now(),
+	}
+
+	if pw, err := user.CurrentOriginal(); err == nil {
+		r.User = pw.Name
+		r.UID = int(pw.UID)
+	}
+	if e.EngineConfig.OciConfig.Process != nil {
+		r.Command = e.EngineConfig.OciConfig.Process.Args
+	}
+	for _, b := range e.EngineConfig.GetBindPath() {
+		src := b.Source
+		if b.Tmpfs() {
+			src = "tmpfs"
+		} else if b.Overlay() {
+			src = "overlay"
+		}
+		r.Binds = append(r.Binds, src+":"+b.Destination)
+	}
+	if e.EngineConfig.OciConfig.Linux != nil {
+		for _, ns := range e.EngineConfig.OciConfig.Linux.Namespaces {
+			r.Namespaces = append(r.Namespaces, string(ns.Type))
+		}
+	}
+	if cg := e.EngineConfig.GetCgroupsJSON(); cg != "" {
+		r.Cgroups = json.RawMessage(cg)
+	}
+
+	if id, signers, err := audit.SIFInfo(r.Image); err == nil {
+		r.SIFID = id
+		r.Signers = signers
+	}
+
+	a := &containerAudit{record: r}
+
+	// the image digest may take a while to compute for large images,
+	// it's computed in background and reported with the exit record
+	if !e.EngineConfig.File.AuditImageDigest {
+		sylog.Debugf("Image digest not requested for audit records")
+	} else if fi, err := os.Stat(r.Image); err == nil && fi.Mode().IsRegular() {
+		a.digest = make(chan string, 1)
+		go func(path string) {
+			digest, err := audit.Digest(path)
+			if err != nil {
+				sylog.Debugf("Could not compute image digest: %s", err)
+			}
+			a.digest <- digest
+		}(r.Image)
+	}
+
+	e.audit = a
+	e.writeAudit(r)
+}
+
+// endAudit writes the audit record for the container exit.
+func (e *EngineOperations) endAudit(fatal error, status syscall.WaitStatus) {
+	if e.audit == nil {
+		return
+	}
+
+	r := e.audit.record
+	r.Event = "end"
+
+	if e.audit.digest != nil {
+		r.Digest = <-e.audit.digest
+	}
+
+	end := time.Now()
+	r.EndTime = &end
+
+	exitCode := 0
+	if fatal != nil {
+		exitCode = 255
+		r.ExitMessage = fatal.Error()
+	} else if status.Signaled() {
+		exitCode = 128 + int(status.Signal())
+		r.ExitMessage = fmt.Sprintf("interrupted by signal %s", status.Signal())
+	} else {
+		exitCode = status.ExitStatus()
+	}
+	r.ExitStatus = &exitCode
+
+	e.writeAudit(r)
+}
+
+// writeAudit writes the audit record to the configured destination,
+// privileges are escalated when possible in order to write into a
+// file only writable by root.
+func (e *EngineOperations) writeAudit(r *audit.Record) {
+	if os.Geteuid() != 0 {
+		// escalation only succeeds with setuid workflow, but
+		// Drop is always required to unlock the OS thread
+		priv.Escalate()
+		defer priv.Drop()
+	}
+	if err := audit.Write(e.EngineConfig.File.AuditLog, e.EngineConfig.File.AuditLogFile, r); err != nil {
+		sylog.Warningf("Could not write audit record: %s", err)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/cdi"
+	"github.com/apptainer/apptainer/internal/pkg/hooks"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/mount"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cdiHookStages maps CDI hook names to the native runtime hook stages.
+// There are no distinct createRuntime and createContainer stages, these
+// hooks run as prestart hooks: in the host namespaces, once the container
+// namespaces are created and before the container process is executed.
+// Unlike the OCI runtime specification, createContainer hooks are not
+// executed in the container mount namespace.
+var cdiHookStages = map[string]string{
+	"prestart":        hooks.Prestart,
+	"createRuntime":   hooks.Prestart,
+	"createContainer": hooks.Prestart,
+	"startContainer":  hooks.Poststart,
+	"poststart":       hooks.Poststart,
+	"poststop":        hooks.Poststop,
+}
+
+// prepareCDI resolves the requested CDI devices from the specification
+// files into container edits. The edits provided by the user are always
+// discarded, they are only resolved from specification files found in
+// the CDI directories.
+func (e *EngineOperations) prepareCDI(suid bool) error {
+	e.EngineConfig.SetCDIEdits(nil)
+
+	devices := e.EngineConfig.GetCDIDevices()
+	if len(devices) == 0 {
+		return nil
+	} else if e.EngineConfig.GetInstanceJoin() {
+		sylog.Warningf("CDI devices are ignored when joining an instance")
+		return nil
+	}
+
+	registry, err := cdi.Load(cdi.SpecDirs, suid)
+	if err != nil {
+		return err
+	}
+	edits, err := registry.Edits(devices)
+	if err != nil {
+		return err
+	}
+
+	// environment variables are injected like --env variables
+	// to take precedence over the image environment
+	if len(edits.Env) > 0 {
+		env := e.EngineConfig.GetApptainerEnv()
+		if env == nil {
+			env = make(map[string]string)
+		}
+		for _, kv := range edits.Env {
+			v := strings.SplitN(kv, "=", 2)
+			env[v[0]] = v[1]
+		}
+		e.EngineConfig.SetApptainerEnv(env)
+	}
+
+	sylog.Debugf("Using CDI devices %s", strings.Join(devices, ", "))
+	e.EngineConfig.SetCDIEdits(edits)
+
+	return nil
+}
+
+// cdiHooks returns the hooks of the CDI devices, they are always
+// executed.
+func (e *EngineOperations) cdiHooks() []*hooks.Hook {
+	edits := e.EngineConfig.GetCDIEdits()
+	if edits == nil {
+		return nil
+	}
+
+	always := true
+	list := make([]*hooks.Hook, 0, len(edits.Hooks))
+
+	for i, h := range edits.Hooks {
+		list = append(list, &hooks.Hook{
+			Version: hooks.Version,
+			Hook: specs.Hook{
+				Path:    h.Path,
+				Args:    h.Args,
+				Env:     h.Env,
+				Timeout: h.Timeout,
+			},
+			When:   hooks.When{Always: &always},
+			Stages: []string{cdiHookStages[h.HookName]},
+			Name:   fmt.Sprintf("cdi-%s-%d", h.HookName, i),
+		})
+	}
+	return list
+}
+
+// addCDIMount adds the CDI mounts to the mount list, and the device nodes
+// which are not part of the mounted /dev. Device nodes located in a staged
+// /dev are added by addDevMount.
+func (c *container) addCDIMount(system *mount.System) error {
+	edits := c.engine.EngineConfig.GetCDIEdits()
+	if edits == nil {
+		return nil
+	}
+
+	cfg := c.engine.EngineConfig
+	noDev := cfg.File.MountDev == "no" || cfg.GetNoDev()
+	hostDev := !noDev && cfg.File.MountDev == "yes" && !cfg.GetContain()
+
+	for _, d := range edits.DeviceNodes {
+		src := d.GetHostPath()
+		if noDev {
+			sylog.Warningf("Not mounting CDI device node %s: /dev not mounted", d.Path)
+			continue
+		} else if hostDev && src == d.Path {
+			continue
+		} else if !hostDev && stagedDev(d.Path) {
+			continue
+		}
+		sylog.Debugf("Adding CDI device node %s to mount list at %s", src, d.Path)
+		if err := c.addCDIBind(system, src, d.Path, syscall.MS_BIND|syscall.MS_NOSUID); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range edits.Mounts {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV)
+		for _, o := range m.Options {
+			switch o {
+			case "ro":
+				flags |= syscall.MS_RDONLY
+			case "rbind":
+				flags |= syscall.MS_REC
+			case "noexec":
+				flags |= syscall.MS_NOEXEC
+			}
+		}
+		sylog.Debugf("Adding CDI mount %s to mount list at %s", m.HostPath, m.ContainerPath)
+		if err := c.addCDIBind(system, m.HostPath, m.ContainerPath, flags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stagedDev returns if the device node path is located in /dev.
+func stagedDev(path string) bool {
+	return strings.HasPrefix(filepath.Clean(path), "/dev/")
+}
+
+func (c *container) addCDIBind(system *mount.System, src, dst string, flags uintptr) error {
+	if err := system.Points.AddBind(mount.FilesTag, src, dst, flags); err != nil {
+		return fmt.Errorf("unable to add %s to mount list: %s", src, err)
+	}
+	if flags&syscall.MS_RDONLY != 0 {
+		system.Points.AddRemount(mount.FilesTag, dst, flags)
+	}
+	return nil
+}
+
+// addCDIDevices adds the CDI device nodes located in /dev to the
+// staged /dev.
+func (c *container) addCDIDevices(system *mount.System) error {
+	edits := c.engine.EngineConfig.GetCDIEdits()
+	if edits == nil {
+		return nil
+	}
+	for _, d := range edits.DeviceNodes {
+		if !stagedDev(d.Path) {
+			continue
+		}
+		if err := c.addSessionDevAt(d.GetHostPath(), d.Path, system); err != nil {
+			return fmt.Errorf("while adding CDI device node %s: %s", d.Path, err)
+		}
+	}
+	return nil
+}
@@ -18,12 +18,15 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/apptainer/apptainer/internal/pkg/hooks"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	fakerootConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/crypt"
 	"github.com/apptainer/apptainer/internal/pkg/util/priv"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/capabilities"
@@ -80,6 +83,10 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 	}
 
 	if networkSetup != nil {
+		if e.EngineConfig.GetInstance() {
+			e.removeNamedNetworkHosts(e.CommonConfig.ContainerID)
+		}
+
 		net := e.EngineConfig.GetNetwork()
 		privileged := false
 		// If a CNI configuration was allowed as non-root (or fakeroot)
@@ -96,12 +103,36 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if userNetwork != nil {
+		sylog.Debugf("Stopping %s network", e.EngineConfig.GetNetwork())
+		if err := userNetwork.Stop(); err != nil {
+			sylog.Errorf("could not stop network: %v", err)
+		}
+	}
+
 	if cgroupsManager != nil {
 		if err := cgroupsManager.Destroy(); err != nil {
 			sylog.Warningf("failed to remove cgroup configuration: %v", err)
 		}
 	}
 
+	if err := e.runHooks(ctx, hooks.Poststop); err != nil {
+		sylog.Warningf("%s", err)
+	}
+
+	callbackType := (apptainercallback.CleanupContainer)(nil)
+	callbacks, err := plugin.LoadCallbacks(callbackType)
+	if err != nil {
+		sylog.Warningf("While loading plugins callbacks '%T': %s", callbackType, err)
+	}
+	for _, cb := range callbacks {
+		if err := cb.(apptainercallback.CleanupContainer)(e.CommonConfig, status); err != nil {
+			sylog.Warningf("%s", err)
+		}
+	}
+
+	e.endAudit(fatal, status)
+
 	if cryptDev != "" && imageDriver == nil {
 		if err := cleanupCrypt(cryptDev); err != nil {
 			sylog.Errorf("could not cleanup crypt: %v", err)
@@ -21,6 +21,7 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/cgroups"
+	"github.com/apptainer/apptainer/internal/pkg/hooks"
 	"github.com/apptainer/apptainer/internal/pkg/image/driver"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc/client"
@@ -56,6 +57,7 @@ import (
 var (
 	cryptDev       string
 	networkSetup   *network.Setup
+	userNetwork    *network.UserModeSetup
 	imageDriver    image.Driver
 	umountPoints   []string
 	cgroupsManager *cgroups.Manager
@@ -245,6 +247,9 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	if err := c.addFilesMount(system); err != nil {
 		return err
 	}
+	if err := c.addCDIMount(system); err != nil {
+		return err
+	}
 	if err := c.addResolvConfMount(system); err != nil {
 		return err
 	}
@@ -331,7 +336,11 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		return fmt.Errorf("while running FUSE drivers: %s", err)
 	}
 
-	return nil
+	if err := engine.loadHooks(pid, c.session.Path()); err != nil {
+		return fmt.Errorf("while loading hooks: %s", err)
+	}
+
+	return engine.runHooks(ctx, hooks.Prestart)
 }
 
 // setupSessionLayout will create the session layout according to the capabilities of Apptainer
@@ -1457,6 +1466,10 @@ func (c *container) addDevMount(system *mount.System) error {
 			}
 		}
 
+		if err := c.addCDIDevices(system); err != nil {
+			return err
+		}
+
 		if err := c.addSessionDev("/dev/fd", system); err != nil {
 			return err
 		}
@@ -1535,6 +1548,7 @@ func (c *container) addBindsMount(system *mount.System) error {
 	)
 
 	skipBinds := c.engine.EngineConfig.GetSkipBinds()
+	namedHosts := c.namedNetworkHosts()
 
 	if c.engine.EngineConfig.GetContain() {
 		hosts := hostsPath
@@ -1545,6 +1559,9 @@ func (c *container) addBindsMount(system *mount.System) error {
 		// we create a minimal default hosts for localhost resolution
 		if !c.netNS {
 			sylog.Debugf("Binding /etc/hosts and /etc/localtime only with contain")
+		} else if namedHosts != "" {
+			sylog.Verbosef("Binding network hosts file %s as contain is set", namedHosts)
+			hosts = namedHosts
 		} else {
 			sylog.Debugf("Skipping bind mounts as contain was requested")
 
@@ -1575,6 +1592,18 @@ func (c *container) addBindsMount(system *mount.System) error {
 		return nil
 	}
 
+	// containers attached to a network created by the user share
+	// a hosts file resolving their instance names
+	if namedHosts != "" && !slice.ContainsString(skipBinds, hostsPath) {
+		sylog.Verbosef("Binding network hosts file %s", namedHosts)
+		if err := system.Points.AddBind(mount.BindsTag, namedHosts, hostsPath, flags); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", namedHosts, err)
+		}
+		if err := system.Points.AddRemount(mount.BindsTag, hostsPath, flags); err != nil {
+			return fmt.Errorf("unable to add %s for remount: %s", hostsPath, err)
+		}
+	}
+
 	for _, bindpath := range c.engine.EngineConfig.File.BindPath {
 		splitted := strings.Split(bindpath, ":")
 		src := splitted[0]
@@ -1591,6 +1620,9 @@ func (c *container) addBindsMount(system *mount.System) error {
 			sylog.Debugf("Skipping bind to %s at user request", dst)
 			continue
 		}
+		if namedHosts != "" && dst == hostsPath {
+			continue
+		}
 
 		// #5465 If hosts/localtime mount fails, it should not be fatal so skip-on-error
 		bindOpt := ""
@@ -1754,8 +1786,27 @@ func (c *container) addHomeMount(system *mount.System) error {
 func (c *container) addUserbindsMount(system *mount.System) error {
 	const devPrefix = "/dev"
 	defaultFlags := uintptr(syscall.MS_BIND | c.suidFlag | syscall.MS_NODEV | syscall.MS_REC)
+	nbOverlay := 0
 
 	for _, b := range c.engine.EngineConfig.GetBindPath() {
+		// tmpfs and overlay mounts
+		if b.Tmpfs() || b.Overlay() {
+			if !c.engine.EngineConfig.File.UserBindControl {
+				sylog.Warningf("Ignoring %s mount: user bind control disabled by system administrator", b.Destination)
+				continue
+			}
+			if b.Tmpfs() {
+				if err := c.addUserTmpfsMount(system, b); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.addUserOverlayMount(system, b, nbOverlay); err != nil {
+				return err
+			}
+			nbOverlay++
+			continue
+		}
 		if strings.HasPrefix(b.Destination, "/.singularity.d/libs") {
 			// Defer to library bind time because otherwise the
 			//  binds here will get hidden under a new directory
@@ -1847,6 +1898,162 @@ func (c *container) addUserbindsMount(system *mount.System) error {
 	return nil
 }
 
+// addUserTmpfsMount adds a tmpfs mount point requested with
+// --mount type=tmpfs.
+func (c *container) addUserTmpfsMount(system *mount.System, b apptainer.BindPath) error {
+	flags := uintptr(c.suidFlag | syscall.MS_NODEV)
+	if b.Readonly() {
+		flags |= syscall.MS_RDONLY
+	}
+
+	// options are provided by the user, check them again as they
+	// are passed to a mount done with privileges
+	size, mode := b.Size(), b.Mode()
+	if err := apptainer.CheckTmpfsOptions(size, mode); err != nil {
+		return fmt.Errorf("tmpfs %s: %s", b.Destination, err)
+	}
+
+	if maxSize := c.engine.EngineConfig.File.TmpfsMaxSize; maxSize > 0 {
+		if size == "" {
+			size = fmt.Sprintf("%dm", maxSize)
+		} else if n, err := tmpfsSizeBytes(size); err != nil {
+			return fmt.Errorf("tmpfs %s: %s", b.Destination, err)
+		} else if n > uint64(maxSize)<<20 {
+			return fmt.Errorf("tmpfs %s: size %s exceeds the maximum size of %dMB", b.Destination, size, maxSize)
+		}
+	}
+
+	var opts []string
+	if size != "" {
+		opts = append(opts, "size="+size)
+	}
+	if mode != "" {
+		opts = append(opts, "mode="+mode)
+	}
+
+	sylog.Debugf("Adding tmpfs %s to mount list\n", b.Destination)
+
+	if err := system.Points.AddFS(mount.UserbindsTag, b.Destination, "tmpfs", flags, strings.Join(opts, ",")); err != nil {
+		return fmt.Errorf("unable to add tmpfs %s to mount list: %s", b.Destination, err)
+	}
+	return nil
+}
+
+// tmpfsSizeBytes returns the size in bytes of a tmpfs size option, a
+// percentage is relative to the host memory.
+func tmpfsSizeBytes(size string) (uint64, error) {
+	unit := uint64(1)
+	switch size[len(size)-1] {
+	case 'k', 'K':
+		unit = 1 << 10
+	case 'm', 'M':
+		unit = 1 << 20
+	case 'g', 'G':
+		unit = 1 << 30
+	case '%':
+		var info unix.Sysinfo_t
+		if err := unix.Sysinfo(&info); err != nil {
+			return 0, fmt.Errorf("while getting host memory: %s", err)
+		}
+		unit = uint64(info.Totalram) * uint64(info.Unit) / 100
+	}
+	n, err := strconv.ParseUint(strings.TrimRight(size, "kKmMgG%"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tmpfs size %q", size)
+	}
+	if unit > 1 && n > ^uint64(0)/unit {
+		return 0, fmt.Errorf("tmpfs size %q is too large", size)
+	}
+	return n * unit, nil
+}
+
+// addUserOverlayMount adds an overlay mount point requested with
+// --mount type=overlay, making the destination directory writable.
+// Changes are stored in the upper and work sub-directories of the host
+// directory set with the upper option, or in the session directory and
+// discarded when the container exits.
+func (c *container) addUserOverlayMount(system *mount.System, b apptainer.BindPath, nb int) error {
+	var upper, work string
+
+	if b.Upper() != "" {
+		dir, err := filepath.Abs(b.Upper())
+		if err != nil {
+			return fmt.Errorf("while determining absolute path of %s: %s", b.Upper(), err)
+		}
+		if os.Geteuid() != 0 && !c.userNS {
+			return fmt.Errorf("only root user can use a host directory as overlay upper in setuid mode")
+		}
+		if paths := c.engine.EngineConfig.File.LimitContainerPaths; len(paths) != 0 {
+			if !authorizedPath(dir, paths) {
+				return fmt.Errorf("overlay upper directory %s is not in an allowed configured path", dir)
+			}
+		}
+		if err := fsoverlay.CheckUpper(dir); err != nil {
+			return err
+		}
+		upper = filepath.Join(dir, "upper")
+		work = filepath.Join(dir, "work")
+	} else {
+		sessionDir := fmt.Sprintf("/overlay-mounts/%d", nb)
+		if err := c.session.AddDir(sessionDir + "/upper"); err != nil {
+			return err
+		}
+		if err := c.session.AddDir(sessionDir + "/work"); err != nil {
+			return err
+		}
+		upper, _ = c.session.GetPath(sessionDir + "/upper")
+		work, _ = c.session.GetPath(sessionDir + "/work")
+	}
+
+	dst := b.Destination
+	flags := uintptr(c.suidFlag | syscall.MS_NODEV)
+
+	// the lower directory is the destination in the container root
+	// filesystem, it's resolved once the root filesystem is mounted
+	return system.RunBeforeTag(mount.UserbindsTag, func(system *mount.System) error {
+		for _, dir := range []string{upper, work} {
+			fi, err := c.rpcOps.Lstat(dir)
+			if os.IsNotExist(err) {
+				if err := c.rpcOps.Mkdir(dir, 0o755); err != nil {
+					return fmt.Errorf("failed to create %s directory: %s", dir, err)
+				}
+			} else if err != nil {
+				return fmt.Errorf("could not setup %s overlay: %s", dst, err)
+			} else if !fi.IsDir() {
+				return fmt.Errorf("overlay %s must be a directory", dir)
+			}
+		}
+
+		final := c.session.FinalPath()
+		lower := filepath.Join(final, fs.EvalRelative(dst, final))
+
+		sylog.Debugf("Adding overlay %s to mount list\n", dst)
+
+		if err := system.Points.AddOverlay(mount.UserbindsTag, dst, flags, lower, upper, work); err != nil {
+			return fmt.Errorf("unable to add overlay %s to mount list: %s", dst, err)
+		}
+		return nil
+	})
+}
+
+// authorizedPath returns if path is located in one of the
+// authorized paths.
+func authorizedPath(path string, paths []string) bool {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
+	}
+	for _, authorized := range paths {
+		match, err := filepath.EvalSymlinks(filepath.Clean(authorized))
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(path, match) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *container) addTmpMount(system *mount.System) error {
 	const (
 		tmpPath    = "/tmp"
@@ -2244,6 +2451,10 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 		var content []byte
 
 		dns := c.engine.EngineConfig.GetDNS()
+		if dns == "" && c.netNS && c.engine.EngineConfig.GetNetwork() == network.UserModeNetwork {
+			// host nameservers may be unreachable, use the helper DNS forwarder
+			dns = network.UserModeDNS
+		}
 
 		if dns == "" {
 			r, err := os.Open(resolvConf)
@@ -2323,15 +2534,38 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	fakeroot := c.engine.EngineConfig.GetFakeroot()
 	net := c.engine.EngineConfig.GetNetwork()
 
+	publish, err := network.ParsePortMaps(c.engine.EngineConfig.GetPublishPorts())
+	if err != nil {
+		return nil, err
+	}
+
 	// If we haven't requested a network namespace, or we have but with no config, we are done here
 	if !c.netNS || net == noneNet {
+		if len(publish) > 0 {
+			return nil, fmt.Errorf("publishing ports requires a network, --network=%s doesn't provide one", noneNet)
+		}
 		return nil, nil
 	}
 
+	// user-mode networking doesn't require any privileges
+	if net == network.UserModeNetwork {
+		return c.prepareUserNetwork(pid, publish)
+	}
+
 	// Otherwise start checking what's permitted for the current user
 	euid := os.Geteuid()
+	uid := os.Getuid()
+
+	named, err := c.namedNetworks(strings.Split(net, ","), uid)
+	if err != nil {
+		return nil, err
+	}
+	// networks created by the user are allowed when they are the only requested networks
+	allowedNamedNet := len(named) == len(strings.Split(net, ",")) &&
+		(euid == 0 || c.engine.EngineConfig.File.AllowUserNetworks)
+
 	allowedNetUnpriv := false
-	if euid != 0 {
+	if euid != 0 && !allowedNamedNet {
 		// Is the user permitted in the list of unpriv users / groups permitted to use CNI?
 		allowedNetUser, err := user.UIDInList(euid, c.engine.EngineConfig.File.AllowNetUsers)
 		if err != nil {
@@ -2355,7 +2589,7 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		allowedNetUnpriv = (allowedNetUser || allowedNetGroup) && allowedNetNetwork
 	}
 
-	if (c.userNS || euid != 0) && !fakeroot && !allowedNetUnpriv {
+	if (c.userNS || euid != 0) && !fakeroot && !allowedNetUnpriv && !allowedNamedNet {
 		return nil, fmt.Errorf("network requires root or --fakeroot, non-root users can only use --network=%s unless permitted by the administrator", noneNet)
 	}
 
@@ -2372,7 +2606,7 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	networks := strings.Split(c.engine.EngineConfig.GetNetwork(), ",")
 
 	// In fakeroot mode only permit the `fakeroot` CNI config
-	if fakeroot && euid != 0 && net != fakerootNet {
+	if fakeroot && euid != 0 && net != fakerootNet && !allowedNamedNet {
 		// set as debug message to avoid annoying warning
 		sylog.Debugf("only '%s' network is allowed for regular user, you requested '%s'", fakerootNet, net)
 		networks = []string{fakerootNet}
@@ -2389,7 +2623,7 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		cniPath.Plugin = defaultCNIPluginPath
 	}
 
-	setup, err := network.NewSetup(networks, strconv.Itoa(pid), nspath, cniPath)
+	setup, err := network.NewSetupWithNamedNetworks(networks, named, uid, strconv.Itoa(pid), nspath, cniPath)
 	if err != nil {
 		return nil, fmt.Errorf("network setup failed: %s", err)
 	}
@@ -2399,9 +2633,12 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	if err := networkSetup.SetArgs(netargs); err != nil {
 		return nil, fmt.Errorf("error while setting network arguments: %s", err)
 	}
+	if err := networkSetup.PublishPorts(publish); err != nil {
+		return nil, fmt.Errorf("error while publishing ports: %s", err)
+	}
 
 	return func(ctx context.Context) error {
-		if fakeroot || allowedNetUnpriv {
+		if fakeroot || allowedNetUnpriv || (allowedNamedNet && euid != 0) {
 			// prevent port hijacking between user processes
 			for _, n := range strings.Split(net, ",") {
 				if err := networkSetup.SetPortProtection(n, 0); err != nil {
@@ -2423,6 +2660,66 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	}, nil
 }
 
+// namedNetworks returns the requested networks created by the user with
+// apptainer network create. The definitions are provided by the user so
+// their subnet is checked against the configured user network pool.
+func (c *container) namedNetworks(networks []string, uid int) ([]network.NamedNetwork, error) {
+	var named []network.NamedNetwork
+
+	for _, n := range c.engine.EngineConfig.GetNamedNetworks() {
+		if !slice.ContainsString(networks, n.Name) {
+			continue
+		}
+		nn := network.NamedNetwork{Name: n.Name, Subnet: n.Subnet}
+		if err := network.CheckNamedNetworkName(nn.Name); err != nil {
+			return nil, err
+		}
+		if err := network.CheckSubnet(nn.Subnet, c.engine.EngineConfig.File.UserNetworkPool, nn.Bridge(uid)); err != nil {
+			return nil, fmt.Errorf("network %s: %s", nn.Name, err)
+		}
+		named = append(named, nn)
+	}
+	return named, nil
+}
+
+// namedNetworkHosts returns the hosts file shared by the containers
+// attached to the first requested network created by the user.
+func (c *container) namedNetworkHosts() string {
+	if !c.netNS {
+		return ""
+	}
+	for _, n := range c.engine.EngineConfig.GetNamedNetworks() {
+		hosts, err := namedNetworkHostsFile(n.Name)
+		if err != nil {
+			sylog.Warningf("Could not find network %s hosts: %s", n.Name, err)
+			continue
+		}
+		return hosts
+	}
+	return ""
+}
+
+// prepareUserNetwork prepares the user-mode networking helper connecting
+// the container network namespace to the host network stack.
+func (c *container) prepareUserNetwork(pid int, publish []network.PortMapEntry) (func(context.Context) error, error) {
+	// the network namespace must be owned by a user namespace of the
+	// current user for the helper to join it without privileges
+	if !c.userNS && os.Geteuid() != 0 {
+		return nil, fmt.Errorf("%s network requires a user namespace, use --userns or --fakeroot", network.UserModeNetwork)
+	}
+
+	setup := network.NewUserModeSetup(pid)
+	if err := setup.SetArgs(c.engine.EngineConfig.GetNetworkArgs()); err != nil {
+		return nil, fmt.Errorf("error while setting network arguments: %s", err)
+	}
+	setup.PublishPorts(publish)
+	userNetwork = setup
+
+	return func(ctx context.Context) error {
+		return userNetwork.Start(ctx)
+	}, nil
+}
+
 // getFuseFdFromRPC returns fuse file descriptors from RPC server based on
 // the file descriptor list provided in argument, it also returns an
 // additional file descriptor corresponding to /proc/self/ns/user.
@@ -24,6 +24,11 @@ import (
 type EngineOperations struct {
 	CommonConfig *config.Common                `json:"-"`
 	EngineConfig *apptainerConfig.EngineConfig `json:"engineConfig"`
+
+	// hooks holds the hooks loaded by the master process
+	hooks *containerHooks
+	// audit holds the audit record written by the master process
+	audit *containerAudit
 }
 
 // InitConfig stores the parsed config.Common inside the engine.
@@ -0,0 +1,151 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/apptainer/apptainer/internal/pkg/hooks"
+	"github.com/apptainer/apptainer/pkg/ociruntime"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// containerHooks holds the hooks matching a container along with the
+// state passed to them, it's populated by the master process during
+// container creation.
+type containerHooks struct {
+	hooks  []*hooks.Hook
+	pid    int
+	bundle string
+}
+
+// loadHooks loads hooks from the hook directories configured in
+// apptainer.conf and keeps those matching the container annotations,
+// image labels and command. The bundle is the session directory
+// holding the container root filesystem.
+func (e *EngineOperations) loadHooks(pid int, bundle string) error {
+	dirs := e.EngineConfig.File.HooksDir
+	cdiHooks := e.cdiHooks()
+	if len(dirs) == 0 && len(cdiHooks) == 0 {
+		return nil
+	}
+
+	var all []*hooks.Hook
+	if len(dirs) > 0 {
+		var err error
+		if all, err = hooks.Load(dirs, true); err != nil {
+			return err
+		}
+	}
+
+	labels := make(map[string]string)
+	// labels are read from the container root filesystem, this is
+	// a best effort as the container process may not be accessible
+	if b, err := readContainerFile(pid, "/.singularity.d/labels.json"); err != nil {
+		sylog.Debugf("Could not read image labels: %s", err)
+	} else if err := json.Unmarshal(b, &labels); err != nil {
+		sylog.Debugf("Could not parse image labels: %s", err)
+	}
+
+	e.hooks = &containerHooks{
+		hooks:  hooks.Filter(all, e.EngineConfig.OciConfig.Annotations, labels, e.hookCommand()),
+		pid:    pid,
+		bundle: bundle,
+	}
+	// hooks of CDI devices are always executed
+	e.hooks.hooks = append(e.hooks.hooks, cdiHooks...)
+	return nil
+}
+
+// readContainerFile reads a file from the root filesystem of the container
+// process. The path is resolved with the container root as root directory,
+// symbolic links pointing outside of the container are therefore resolved
+// inside of it, as they would be by the container process.
+func readContainerFile(pid int, path string) ([]byte, error) {
+	root, err := unix.Open(fmt.Sprintf("/proc/%d/root", pid), unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open container root: %s", err)
+	}
+	defer unix.Close(root)
+
+	fd, err := unix.Openat2(root, path, &unix.OpenHow{
+		Flags:   unix.O_RDONLY | unix.O_CLOEXEC | unix.O_NONBLOCK,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s in container: %s", path, err)
+	}
+	f := os.NewFile(uintptr(fd), path)
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s in container is not a regular file", path)
+	}
+	return ioutil.ReadAll(f)
+}
+
+// hookCommand returns the command matched against hook command conditions,
+// for exec it corresponds to the command executed in the container, for other
+// actions it corresponds to the action script.
+func (e *EngineOperations) hookCommand() string {
+	if e.EngineConfig.OciConfig.Process == nil {
+		return ""
+	}
+	args := e.EngineConfig.OciConfig.Process.Args
+	if len(args) == 0 {
+		return ""
+	}
+	if args[0] == "/.singularity.d/actions/exec" && len(args) > 1 {
+		return args[1]
+	}
+	return args[0]
+}
+
+// runHooks executes container hooks for the stage with the container state
+// passed over stdin.
+func (e *EngineOperations) runHooks(ctx context.Context, stage string) error {
+	if e.hooks == nil || len(e.hooks.hooks) == 0 {
+		return nil
+	}
+
+	id := e.CommonConfig.ContainerID
+	if id == "" {
+		id = strconv.Itoa(e.hooks.pid)
+	}
+
+	status := ociruntime.Stopped
+	switch stage {
+	case hooks.Prestart:
+		status = ociruntime.Created
+	case hooks.Poststart:
+		status = ociruntime.Running
+	}
+
+	state := &specs.State{
+		Version:     specs.Version,
+		ID:          id,
+		Status:      specs.ContainerState(status),
+		Pid:         e.hooks.pid,
+		Bundle:      e.hooks.bundle,
+		Annotations: e.EngineConfig.OciConfig.Annotations,
+	}
+
+	return hooks.Run(ctx, e.hooks.hooks, stage, state)
+}
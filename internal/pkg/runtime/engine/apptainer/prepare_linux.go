@@ -43,6 +43,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/sypgp"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
 	"github.com/apptainer/apptainer/pkg/util/capabilities"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
@@ -87,6 +88,9 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		if !fs.IsOwner(buildcfg.APPTAINER_CONF_FILE, 0) {
 			return fmt.Errorf("%s must be owned by root", buildcfg.APPTAINER_CONF_FILE)
 		}
+		if err := apptainerconf.CheckDropInOwner(buildcfg.APPTAINER_CONF_FILE, 0); err != nil {
+			return err
+		}
 		// check for ownership of capability.json
 		if !fs.IsOwner(buildcfg.CAPABILITY_FILE, 0) {
 			return fmt.Errorf("%s must be owned by root", buildcfg.CAPABILITY_FILE)
@@ -138,6 +142,10 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
 	}
 
+	if err := e.prepareCDI(starterConfig.GetIsSUID()); err != nil {
+		return fmt.Errorf("while resolving CDI devices: %s", err)
+	}
+
 	if e.EngineConfig.GetInstanceJoin() {
 		if err := e.prepareInstanceJoinConfig(starterConfig); err != nil {
 			return err
@@ -196,6 +204,12 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		e.EngineConfig.SetUnixSocketPair([2]int{-1, -1})
 	}
 
+	// networks created by the user are set up with privileges gained
+	// from the setuid starter
+	if len(e.EngineConfig.GetNamedNetworks()) > 0 && !starterConfig.GetIsSUID() && os.Geteuid() != 0 {
+		return fmt.Errorf("networks created with 'apptainer network create' require root or a setuid installation")
+	}
+
 	// nvidia-container-cli requires additional caps in the starter bounding set.
 	// These are within the capability set for the starter process itself, *not* the capabilities
 	// that will be set on the running container process, which are defined with SetCapabilities above.
@@ -23,28 +23,27 @@ import (
 	"os/signal"
 	"path/filepath"
 	"reflect"
-	"regexp"
 	"runtime"
-	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/apptainer/apptainer/internal/pkg/checkpoint/dmtcp"
 	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/internal/pkg/hooks"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/security"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
-	"github.com/apptainer/apptainer/internal/pkg/util/shell"
 	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/network"
 	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/syfs"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/rlimit"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -346,6 +345,12 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		}
 	}
 
+	if err := e.runHooks(ctx, hooks.Poststart); err != nil {
+		sylog.Warningf("%s", err)
+	}
+
+	e.startAudit(pid)
+
 	if e.EngineConfig.GetInstance() {
 		name := e.CommonConfig.ContainerID
 
@@ -381,6 +386,12 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 			sylog.Warningf("Could not get ip for %s: %s", pw.Name, err)
 		}
 		file.IP = ip
+		if userNetwork != nil {
+			file.Ports = userNetwork.Ports()
+		} else if networkSetup != nil {
+			file.Ports = networkSetup.Ports()
+		}
+		e.addNamedNetworkHosts(name)
 
 		// by default we add all namespaces except the user namespace which
 		// is added conditionally. This delegates checks to the C starter code
@@ -568,6 +579,9 @@ func (e *EngineOperations) stopFuseDrivers() {
 }
 
 func (e *EngineOperations) getIP() (string, error) {
+	if userNetwork != nil {
+		return network.UserModeIP, nil
+	}
 	if networkSetup == nil {
 		return "", nil
 	}
@@ -589,6 +603,73 @@ func (e *EngineOperations) getIP() (string, error) {
 	return "", errors.New("could not get ip")
 }
 
+// namedNetworkHostsFile returns the hosts file shared by the containers
+// attached to the network created by the original user, the path is
+// rebuilt from the user home directory and never taken from the engine
+// configuration provided by the user.
+func namedNetworkHostsFile(name string) (string, error) {
+	if err := network.CheckNamedNetworkName(name); err != nil {
+		return "", err
+	}
+	pw, err := user.CurrentOriginal()
+	if err != nil {
+		return "", err
+	}
+	dir, err := syfs.ConfigDirForUsername(pw.Name)
+	if err != nil {
+		return "", err
+	}
+	path := network.NamedNetworkHostsFile(filepath.Join(dir, syfs.NetworkDirName), name)
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.Mode().IsRegular() || !ok || st.Uid != pw.UID {
+		return "", fmt.Errorf("%s is not a regular file owned by %s", path, pw.Name)
+	}
+	return path, nil
+}
+
+// addNamedNetworkHosts adds the instance IP address to the hosts file of
+// the networks created by the user the instance is attached to.
+func (e *EngineOperations) addNamedNetworkHosts(name string) {
+	if networkSetup == nil {
+		return
+	}
+	for _, n := range e.EngineConfig.GetNamedNetworks() {
+		ip, err := networkSetup.GetNetworkIP(n.Name, "4")
+		if err != nil {
+			sylog.Warningf("Could not get ip on network %s: %s", n.Name, err)
+			continue
+		}
+		hosts, err := namedNetworkHostsFile(n.Name)
+		if err != nil {
+			sylog.Warningf("Could not find network %s hosts: %s", n.Name, err)
+			continue
+		}
+		if err := network.AddHostsEntry(hosts, ip.String(), name); err != nil {
+			sylog.Warningf("Could not add %s to network %s hosts: %s", name, n.Name, err)
+		}
+	}
+}
+
+// removeNamedNetworkHosts removes the instance from the hosts file of
+// the networks created by the user the instance was attached to.
+func (e *EngineOperations) removeNamedNetworkHosts(name string) {
+	for _, n := range e.EngineConfig.GetNamedNetworks() {
+		hosts, err := namedNetworkHostsFile(n.Name)
+		if err != nil {
+			sylog.Debugf("Could not find network %s hosts: %s", n.Name, err)
+			continue
+		}
+		if err := network.RemoveHostsEntry(hosts, name); err != nil {
+			sylog.Debugf("Could not remove %s from network %s hosts: %s", name, n.Name, err)
+		}
+	}
+}
+
 func getExecError(err error, args []string, shell string) error {
 	// We know the shell exists at this point, so let's inspect its architecture
 	if shell == "" {
@@ -623,185 +704,6 @@ func (e *EngineOperations) execProcess(args, env []string) error {
 	return getExecError(err, args, e.EngineConfig.GetShell())
 }
 
-// bufferCloser wraps a bytes.Buffer with a Close method
-// required by the open handler of the shell interpreter.
-type bufferCloser struct {
-	bytes.Buffer
-}
-
-func (b *bufferCloser) Close() error {
-	b.Reset()
-	return nil
-}
-
-// Register a virtual file /.singularity.d/env/inject-apptainer-env.sh sourced
-// after /.singularity.d/env/99-base.sh or /environment.
-// This handler turns all SINGUALRITYENV_KEY=VAL defined variables into their form:
-// export KEY=VAL. It can be sourced only once otherwise it returns an empty content.
-// If noEval is true then exports are single quoted so their content is not evaluated
-// when the script is sourced (OCI compatible behavior).
-// If noEval is false then exports are double quoted, and their content is evaluated,
-// consuming one level of shell escaping and performing any unescaped var substitution,
-// subshell execution etc (Apptainer historic behavior).
-func injectEnvHandler(senv map[string]string, noEval bool) interpreter.OpenHandler {
-	var once sync.Once
-
-	return func(_ string, _ int, _ os.FileMode) (io.ReadWriteCloser, error) {
-		b := new(bufferCloser)
-
-		once.Do(func() {
-			defaultPathSnippet := `
-			if ! test -v PATH; then
-				export PATH=%q
-			fi
-			`
-			b.WriteString(fmt.Sprintf(defaultPathSnippet, env.DefaultPath))
-
-			snippet := `
-			if test -v %[1]s; then
-				sylog debug "Overriding %[1]s environment variable"
-			fi
-			export %[1]s=%[2]s
-			`
-			for key, value := range senv {
-				if key == "UID" || key == "GID" {
-					continue
-				}
-				if key == "LD_LIBRARY_PATH" && value != "" {
-					value = value + ":/.singularity.d/libs"
-				}
-				if noEval {
-					// No evaluation when the export is sourced
-					value = "'" + shell.EscapeSingleQuotes(value) + "'"
-				} else {
-					// Shell evaluation when the export is sourced
-					value = "\"" + shell.EscapeDoubleQuotes(value) + "\""
-				}
-				b.WriteString(fmt.Sprintf(snippet, key, value))
-			}
-		})
-
-		return b, nil
-	}
-}
-
-func runtimeVarsHandler(senv map[string]string) interpreter.OpenHandler {
-	var once sync.Once
-
-	return func(path string, _ int, _ os.FileMode) (io.ReadWriteCloser, error) {
-		b := new(bufferCloser)
-
-		once.Do(func() {
-			b.WriteString(files.RuntimeVars)
-		})
-
-		return b, nil
-	}
-}
-
-// sylogBuiltin allows to use sylog logger from shell script.
-func sylogBuiltin(ctx context.Context, argv []string) error {
-	if len(argv) < 2 {
-		return fmt.Errorf("sylog builtin requires two arguments")
-	}
-	switch argv[0] {
-	case "info":
-		sylog.Infof(argv[1])
-	case "error":
-		sylog.Errorf(argv[1])
-	case "verbose":
-		sylog.Verbosef(argv[1])
-	case "debug":
-		sylog.Debugf(argv[1])
-	case "warning":
-		sylog.Warningf(argv[1])
-	}
-	return nil
-}
-
-// getAllEnvBuiltin display all exported variables in the form KEY=VALUE.
-func getAllEnvBuiltin(shell *interpreter.Shell) interpreter.ShellBuiltin {
-	return func(ctx context.Context, argv []string) error {
-		hc := interp.HandlerCtx(ctx)
-
-		keyRe := regexp.MustCompile(`^[a-zA-Z_]+[a-zA-Z0-9_]*$`)
-
-		for _, env := range interpreter.GetEnv(hc) {
-			// Exclude environment vars that contain invalid characters
-			// in their KEY - e.g. bash functions in the environment
-			// like "BASH_FUNC_module%%"
-			key := strings.SplitN(env, "=", 2)[0]
-			if !keyRe.MatchString(key) {
-				sylog.Debugf("Not exporting %q to container environment: invalid key", key)
-				continue
-			}
-			// Because we are using IFS=\n we need to escape newlines here and
-			// unescape them in the action script when we export the var again.
-			//
-			// This is imperfect - it is not possible to represent a string
-			// containing a literal '\u000A' (unicode escaped newline) in it.
-			//
-			// Full escaping / unescaping requires iterative parsing of the
-			// string in the action script. This is too awkward and slow in
-			// shell code. If we can use `printf -v VAR "%b" ...` from mvdan.cc/sh
-			// in future, we may be able to revisit this.
-			env := strings.Replace(env, "\n", "\\u000A", -1)
-			fmt.Fprintf(hc.Stdout, "%s\n", env)
-		}
-		return nil
-	}
-}
-
-// fixPathBuiltin takes the current path value to fix it by injecting
-// missing default path and returns value on shell interpreter output.
-func fixPathBuiltin(ctx context.Context, argv []string) error {
-	hc := interp.HandlerCtx(ctx)
-
-	currentPath := filepath.SplitList(hc.Env.Get("PATH").String())
-	finalPath := currentPath
-
-	for _, d := range filepath.SplitList(env.DefaultPath) {
-		found := false
-		for _, p := range currentPath {
-			if d == p {
-				found = true
-				continue
-			}
-		}
-		if !found {
-			finalPath = append(finalPath, d)
-		}
-	}
-
-	listSep := string(os.PathListSeparator)
-	fmt.Fprintf(hc.Stdout, "%s\n", strings.Join(finalPath, listSep))
-	return nil
-}
-
-// hashBuiltin is a noop function for hash bash builtin, since we don't
-// store resolved path in a hash table, there is nothing to do.
-func hashBuiltin(ctx context.Context, argv []string) error {
-	return nil
-}
-
-func umaskBuiltin(ctx context.Context, argv []string) error {
-	hc := interp.HandlerCtx(ctx)
-
-	if len(argv) == 0 {
-		old := unix.Umask(0)
-		unix.Umask(old)
-		fmt.Fprintf(hc.Stdout, "%#.4o\n", old)
-	} else {
-		umask, err := strconv.ParseUint(argv[0], 8, 16)
-		if err != nil {
-			return fmt.Errorf("umask: %s: invalid octal number: %s", argv[0], err)
-		}
-		unix.Umask(int(umask))
-	}
-
-	return nil
-}
-
 func getEnvVal(env []string, envname string) string {
 	envname += "="
 	for _, keyval := range env {
@@ -844,16 +746,12 @@ func runActionScript(engineConfig *apptainerConfig.EngineConfig) ([]string, []st
 
 	// inject APPTAINERENV_ defined variables
 	senv := engineConfig.GetApptainerEnv()
-	shell.RegisterOpenHandler("/.inject-apptainer-env.sh", injectEnvHandler(senv, engineConfig.GetNoEval()))
+	shell.RegisterOpenHandler(env.InjectEnvPath, env.InjectEnvHandler(senv, engineConfig.GetNoEval()))
 
-	shell.RegisterOpenHandler("/.singularity.d/env/99-runtimevars.sh", runtimeVarsHandler(senv))
+	shell.RegisterOpenHandler(env.RuntimeVarsPath, env.RuntimeVarsHandler(senv))
 
 	// register few builtin
-	shell.RegisterShellBuiltin("getallenv", getAllEnvBuiltin(shell))
-	shell.RegisterShellBuiltin("sylog", sylogBuiltin)
-	shell.RegisterShellBuiltin("fixpath", fixPathBuiltin)
-	shell.RegisterShellBuiltin("hash", hashBuiltin)
-	shell.RegisterShellBuiltin("umask_builtin", umaskBuiltin)
+	env.RegisterActionBuiltins(shell)
 
 	// exec builtin won't execute the command but instead
 	// it returns arguments and environment variables and
@@ -25,6 +25,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/cgroups"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/oci/rpc/client"
+	"github.com/apptainer/apptainer/internal/pkg/util/exec"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/mount"
 	"github.com/apptainer/apptainer/pkg/ociruntime"
@@ -332,6 +333,24 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		}
 	}
 
+	// createRuntime and createContainer hooks are executed once the
+	// runtime environment has been created but before pivot_root,
+	// the former in the runtime namespaces, the latter in the container
+	// namespaces via the RPC server
+	hooks := e.EngineConfig.OciConfig.Hooks
+	if hooks != nil {
+		for _, h := range hooks.CreateRuntime {
+			if err := exec.Hook(ctx, &h, &e.EngineConfig.State.State); err != nil {
+				return err
+			}
+		}
+		for _, h := range hooks.CreateContainer {
+			if _, err := rpcOps.Hook(&h, &e.EngineConfig.State.State); err != nil {
+				return err
+			}
+		}
+	}
+
 	method := "pivot"
 	if !c.mntNS {
 		method = "chroot"
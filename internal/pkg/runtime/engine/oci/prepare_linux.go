@@ -66,6 +66,9 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 	if !fs.IsOwner(buildcfg.APPTAINER_CONF_FILE, 0) {
 		return fmt.Errorf("%s must be owned by root", buildcfg.APPTAINER_CONF_FILE)
 	}
+	if err := apptainerconf.CheckDropInOwner(buildcfg.APPTAINER_CONF_FILE, 0); err != nil {
+		return err
+	}
 	sConf, err := apptainerconf.Parse(buildcfg.APPTAINER_CONF_FILE)
 	if err != nil {
 		return fmt.Errorf("unable to parse apptainer.conf file: %s", err)
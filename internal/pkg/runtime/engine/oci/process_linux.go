@@ -152,6 +152,22 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		if _, err := masterConn.Read(data); err != nil {
 			return fmt.Errorf("failed to receive start signal: %s", err)
 		}
+
+		// startContainer hooks are executed in the container namespaces
+		// right before the container process, master sends the current
+		// container state along with the start signal
+		hooks := e.EngineConfig.OciConfig.Hooks
+		if hooks != nil && len(hooks.StartContainer) > 0 {
+			state := &specs.State{}
+			if err := json.NewDecoder(masterConn).Decode(state); err != nil {
+				return fmt.Errorf("failed to receive container state: %s", err)
+			}
+			for _, h := range hooks.StartContainer {
+				if err := exec.Hook(context.Background(), &h, state); err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	if err := security.Configure(&e.EngineConfig.OciConfig.Spec); err != nil {
@@ -450,6 +466,18 @@ func (e *EngineOperations) handleControl(masterConn net.Conn, attach, control ne
 				return
 			}
 
+			// send container state for startContainer hooks
+			hooks := e.EngineConfig.OciConfig.Hooks
+			if hooks != nil && len(hooks.StartContainer) > 0 {
+				e.EngineConfig.Lock()
+				err := json.NewEncoder(masterConn).Encode(e.EngineConfig.State.State)
+				e.EngineConfig.Unlock()
+				if err != nil {
+					fatalChan <- fmt.Errorf("failed to send container state: %s", err)
+					return
+				}
+			}
+
 			// send start event
 			start <- true
 
@@ -9,7 +9,17 @@
 
 package rpc
 
+import (
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
 // TouchArgs defines the arguments to touch.
 type TouchArgs struct {
 	Path string
 }
+
+// HookArgs defines the arguments to hook.
+type HookArgs struct {
+	Hook  specs.Hook
+	State specs.State
+}
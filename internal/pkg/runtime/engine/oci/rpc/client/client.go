@@ -15,6 +15,7 @@ import (
 	args "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc"
 	client "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc/client"
 	ociargs "github.com/apptainer/apptainer/internal/pkg/runtime/engine/oci/rpc"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // RPC holds the state necessary for remote procedure calls.
@@ -42,3 +43,14 @@ func (t *RPC) Touch(path string) (int, error) {
 	err := t.Client.Call(t.Name+".Touch", arguments, &reply)
 	return reply, err
 }
+
+// Hook calls the hook RPC using the supplied arguments.
+func (t *RPC) Hook(hook *specs.Hook, state *specs.State) (int, error) {
+	arguments := &ociargs.HookArgs{
+		Hook:  *hook,
+		State: *state,
+	}
+	var reply int
+	err := t.Client.Call(t.Name+".Hook", arguments, &reply)
+	return reply, err
+}
@@ -10,9 +10,11 @@
 package server
 
 import (
+	"context"
 	"os"
 	"syscall"
 
+	"github.com/apptainer/apptainer/internal/pkg/util/exec"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 
 	args "github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc"
@@ -40,3 +42,9 @@ func (t *Methods) MkdirAll(arguments *args.MkdirArgs, reply *int) (err error) {
 func (t *Methods) Touch(arguments *ociargs.TouchArgs, reply *int) (err error) {
 	return fs.Touch(arguments.Path)
 }
+
+// Hook executes an OCI hook from the container namespaces with the
+// specified arguments.
+func (t *Methods) Hook(arguments *ociargs.HookArgs, reply *int) (err error) {
+	return exec.Hook(context.Background(), &arguments.Hook, &arguments.State)
+}
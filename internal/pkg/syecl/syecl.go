@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/sif/v2/pkg/integrity"
 	"github.com/apptainer/sif/v2/pkg/sif"
 	toml "github.com/pelletier/go-toml"
@@ -225,10 +226,11 @@ func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err er
 
 	opts := []integrity.VerifierOpt{integrity.OptVerifyWithKeyRing(kr)}
 	if ecl.Legacy {
-		// Legacy behavior is to verify the primary partition only.
-		od, err := f.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+		// Legacy behavior is to verify the system partition only, the
+		// one selected for the host architecture is the one executed.
+		od, err := image.SelectSystemPartition(f)
 		if err != nil {
-			return false, fmt.Errorf("get primary system partition: %v", err)
+			return false, fmt.Errorf("get system partition: %v", err)
 		}
 		opts = append(opts, integrity.OptVerifyLegacy(), integrity.OptVerifyObject(od.ID()))
 	}
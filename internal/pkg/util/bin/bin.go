@@ -38,6 +38,9 @@ func FindBin(name string) (path string, err error) {
 	// distro provided setUID executables that are used in the fakeroot flow to setup subuid/subgid mappings
 	case "newuidmap", "newgidmap":
 		return findOnPath(name)
+	// user-mode networking helpers used by the slirp network
+	case "slirp4netns", "pasta":
+		return findOnPath(name)
 	}
 	return "", fmt.Errorf("unknown executable name %q", name)
 }
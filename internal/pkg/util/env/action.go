@@ -0,0 +1,231 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2018-2022, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
+	"github.com/apptainer/apptainer/internal/pkg/util/shell"
+	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const (
+	// InjectEnvPath is the path of the virtual file sourced by the
+	// action script to inject the APPTAINERENV_ variables.
+	InjectEnvPath = "/.inject-apptainer-env.sh"
+	// RuntimeVarsPath is the path of the virtual file sourced by the
+	// action script to set the runtime variables.
+	RuntimeVarsPath = "/.singularity.d/env/99-runtimevars.sh"
+)
+
+// bufferCloser wraps a bytes.Buffer with a Close method
+// required by the open handler of the shell interpreter.
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error {
+	b.Reset()
+	return nil
+}
+
+// InjectEnvHandler registers a virtual file /.inject-apptainer-env.sh sourced
+// after /.singularity.d/env/99-base.sh or /environment.
+// This handler turns all SINGUALRITYENV_KEY=VAL defined variables into their form:
+// export KEY=VAL. It can be sourced only once otherwise it returns an empty content.
+// If noEval is true then exports are single quoted so their content is not evaluated
+// when the script is sourced (OCI compatible behavior).
+// If noEval is false then exports are double quoted, and their content is evaluated,
+// consuming one level of shell escaping and performing any unescaped var substitution,
+// subshell execution etc (Apptainer historic behavior).
+func InjectEnvHandler(senv map[string]string, noEval bool) interpreter.OpenHandler {
+	var once sync.Once
+
+	return func(_ string, _ int, _ os.FileMode) (io.ReadWriteCloser, error) {
+		b := new(bufferCloser)
+
+		once.Do(func() {
+			defaultPathSnippet := `
+			if ! test -v PATH; then
+				export PATH=%q
+			fi
+			`
+			b.WriteString(fmt.Sprintf(defaultPathSnippet, DefaultPath))
+
+			snippet := `
+			if test -v %[1]s; then
+				sylog debug "Overriding %[1]s environment variable"
+			fi
+			export %[1]s=%[2]s
+			`
+			for key, value := range senv {
+				if key == "UID" || key == "GID" {
+					continue
+				}
+				if key == "LD_LIBRARY_PATH" && value != "" {
+					value = value + ":/.singularity.d/libs"
+				}
+				if noEval {
+					// No evaluation when the export is sourced
+					value = "'" + shell.EscapeSingleQuotes(value) + "'"
+				} else {
+					// Shell evaluation when the export is sourced
+					value = "\"" + shell.EscapeDoubleQuotes(value) + "\""
+				}
+				b.WriteString(fmt.Sprintf(snippet, key, value))
+			}
+		})
+
+		return b, nil
+	}
+}
+
+// RuntimeVarsHandler registers a virtual file /.singularity.d/env/99-runtimevars.sh
+// setting the runtime variables, it can be sourced only once otherwise it returns
+// an empty content.
+func RuntimeVarsHandler(senv map[string]string) interpreter.OpenHandler {
+	var once sync.Once
+
+	return func(path string, _ int, _ os.FileMode) (io.ReadWriteCloser, error) {
+		b := new(bufferCloser)
+
+		once.Do(func() {
+			b.WriteString(files.RuntimeVars)
+		})
+
+		return b, nil
+	}
+}
+
+// RegisterActionBuiltins registers the shell builtins used by the action script,
+// except the exec builtin which is registered by the caller.
+func RegisterActionBuiltins(s *interpreter.Shell) {
+	s.RegisterShellBuiltin("getallenv", getAllEnvBuiltin(s))
+	s.RegisterShellBuiltin("sylog", sylogBuiltin)
+	s.RegisterShellBuiltin("fixpath", fixPathBuiltin)
+	s.RegisterShellBuiltin("hash", hashBuiltin)
+	s.RegisterShellBuiltin("umask_builtin", umaskBuiltin)
+}
+
+// sylogBuiltin allows to use sylog logger from shell script.
+func sylogBuiltin(ctx context.Context, argv []string) error {
+	if len(argv) < 2 {
+		return fmt.Errorf("sylog builtin requires two arguments")
+	}
+	switch argv[0] {
+	case "info":
+		sylog.Infof(argv[1])
+	case "error":
+		sylog.Errorf(argv[1])
+	case "verbose":
+		sylog.Verbosef(argv[1])
+	case "debug":
+		sylog.Debugf(argv[1])
+	case "warning":
+		sylog.Warningf(argv[1])
+	}
+	return nil
+}
+
+// getAllEnvBuiltin display all exported variables in the form KEY=VALUE.
+func getAllEnvBuiltin(shell *interpreter.Shell) interpreter.ShellBuiltin {
+	return func(ctx context.Context, argv []string) error {
+		hc := interp.HandlerCtx(ctx)
+
+		keyRe := regexp.MustCompile(`^[a-zA-Z_]+[a-zA-Z0-9_]*$`)
+
+		for _, env := range interpreter.GetEnv(hc) {
+			// Exclude environment vars that contain invalid characters
+			// in their KEY - e.g. bash functions in the environment
+			// like "BASH_FUNC_module%%"
+			key := strings.SplitN(env, "=", 2)[0]
+			if !keyRe.MatchString(key) {
+				sylog.Debugf("Not exporting %q to container environment: invalid key", key)
+				continue
+			}
+			// Because we are using IFS=\n we need to escape newlines here and
+			// unescape them in the action script when we export the var again.
+			//
+			// This is imperfect - it is not possible to represent a string
+			// containing a literal '\u000A' (unicode escaped newline) in it.
+			//
+			// Full escaping / unescaping requires iterative parsing of the
+			// string in the action script. This is too awkward and slow in
+			// shell code. If we can use `printf -v VAR "%b" ...` from mvdan.cc/sh
+			// in future, we may be able to revisit this.
+			env := strings.Replace(env, "\n", "\\u000A", -1)
+			fmt.Fprintf(hc.Stdout, "%s\n", env)
+		}
+		return nil
+	}
+}
+
+// fixPathBuiltin takes the current path value to fix it by injecting
+// missing default path and returns value on shell interpreter output.
+func fixPathBuiltin(ctx context.Context, argv []string) error {
+	hc := interp.HandlerCtx(ctx)
+
+	currentPath := filepath.SplitList(hc.Env.Get("PATH").String())
+	finalPath := currentPath
+
+	for _, d := range filepath.SplitList(DefaultPath) {
+		found := false
+		for _, p := range currentPath {
+			if d == p {
+				found = true
+				continue
+			}
+		}
+		if !found {
+			finalPath = append(finalPath, d)
+		}
+	}
+
+	listSep := string(os.PathListSeparator)
+	fmt.Fprintf(hc.Stdout, "%s\n", strings.Join(finalPath, listSep))
+	return nil
+}
+
+// hashBuiltin is a noop function for hash bash builtin, since we don't
+// store resolved path in a hash table, there is nothing to do.
+func hashBuiltin(ctx context.Context, argv []string) error {
+	return nil
+}
+
+func umaskBuiltin(ctx context.Context, argv []string) error {
+	hc := interp.HandlerCtx(ctx)
+
+	if len(argv) == 0 {
+		old := unix.Umask(0)
+		unix.Umask(old)
+		fmt.Fprintf(hc.Stdout, "%#.4o\n", old)
+	} else {
+		umask, err := strconv.ParseUint(argv[0], 8, 16)
+		if err != nil {
+			return fmt.Errorf("umask: %s: invalid octal number: %s", argv[0], err)
+		}
+		unix.Umask(int(umask))
+	}
+
+	return nil
+}
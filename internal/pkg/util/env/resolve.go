@@ -0,0 +1,273 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
+	"github.com/apptainer/apptainer/internal/pkg/util/shell"
+	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"mvdan.cc/sh/v3/interp"
+)
+
+const (
+	// OriginHost is the origin of variables forwarded from the host environment.
+	OriginHost = "host environment"
+	// OriginRuntime is the origin of variables set by the Apptainer runtime.
+	OriginRuntime = "runtime"
+
+	// originBuiltin is the shell builtin tracking sourced scripts.
+	originBuiltin = "__origin__"
+)
+
+// Variable is a variable of a resolved container environment.
+type Variable struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Origin string `json:"origin"`
+}
+
+// ResolveConfig holds the environment passed by the runtime to the
+// action script of a container.
+type ResolveConfig struct {
+	// Root is the path of the container root filesystem, only the
+	// environment scripts are required.
+	Root string
+	// ProcessEnv is the environment of the container process.
+	ProcessEnv []string
+	// ApptainerEnv holds the variables injected by the action script
+	// as returned by SetContainerEnv.
+	ApptainerEnv map[string]string
+	// NoEval prevents the shell evaluation of ApptainerEnv values.
+	NoEval bool
+	// Cwd is the working directory of the container process.
+	Cwd string
+	// Origins maps variables of ProcessEnv and ApptainerEnv to their
+	// origin, variables without origin are set by the runtime.
+	Origins map[string]string
+}
+
+// originTracker records the script which last set each variable of
+// the environment, sourced scripts are wrapped by calls to the origin
+// builtin which compares the environment before and after each script.
+type originTracker struct {
+	cfg     ResolveConfig
+	initial map[string]string
+	env     map[string]string
+	origins map[string]string
+	scripts []string
+}
+
+func envMap(environ []string) map[string]string {
+	m := make(map[string]string, len(environ))
+	for _, e := range environ {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			m[kv[0]] = kv[1]
+		}
+	}
+	return m
+}
+
+func newOriginTracker(cfg ResolveConfig, environ []string) *originTracker {
+	t := &originTracker{
+		cfg:     cfg,
+		initial: envMap(environ),
+		origins: make(map[string]string),
+	}
+	t.env = t.initial
+	for name := range t.initial {
+		t.origins[name] = t.configOrigin(name)
+	}
+	return t
+}
+
+// configOrigin returns the origin of a variable passed by the runtime.
+func (t *originTracker) configOrigin(name string) string {
+	if origin, ok := t.cfg.Origins[name]; ok {
+		return origin
+	}
+	return OriginRuntime
+}
+
+// origin returns the origin of a variable set with value by the
+// current script.
+func (t *originTracker) origin(name, value string) string {
+	if len(t.scripts) == 0 {
+		// variables restored by the action script
+		if v, ok := t.initial[name]; ok && v == value {
+			return t.configOrigin(name)
+		}
+		return OriginRuntime
+	}
+	script := t.scripts[len(t.scripts)-1]
+	if script == InjectEnvPath {
+		return t.configOrigin(name)
+	}
+	return script
+}
+
+// update records the origin of the variables changed since the last update.
+func (t *originTracker) update(hc interp.HandlerContext) {
+	env := envMap(interpreter.GetEnv(hc))
+	for name, value := range env {
+		if old, ok := t.env[name]; !ok || old != value {
+			t.origins[name] = t.origin(name, value)
+		}
+	}
+	for name := range t.env {
+		if _, ok := env[name]; !ok {
+			delete(t.origins, name)
+		}
+	}
+	t.env = env
+}
+
+// builtin is the origin builtin, called with push <script> before
+// a script is sourced and with pop once it has been sourced.
+func (t *originTracker) builtin(ctx context.Context, argv []string) error {
+	t.update(interp.HandlerCtx(ctx))
+	if len(argv) == 2 && argv[0] == "push" {
+		t.scripts = append(t.scripts, argv[1])
+	} else if len(argv) == 1 && argv[0] == "pop" && len(t.scripts) > 0 {
+		t.scripts = t.scripts[:len(t.scripts)-1]
+	}
+	return nil
+}
+
+// wrap returns an open handler wrapping the content of the script
+// at path with calls to the origin builtin.
+func (t *originTracker) wrap(path string, handler interpreter.OpenHandler) interpreter.OpenHandler {
+	return func(p string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+		f, err := handler(p, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		b := new(bufferCloser)
+		fmt.Fprintf(b, "%s push '%s'\n", originBuiltin, shell.EscapeSingleQuotes(path))
+		if _, err := io.Copy(b, f); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(b, "\n%s pop\n", originBuiltin)
+		return b, nil
+	}
+}
+
+// rootFileHandler returns an open handler reading the file at path
+// in the root directory.
+func rootFileHandler(root, path string) interpreter.OpenHandler {
+	return func(_ string, _ int, _ os.FileMode) (io.ReadWriteCloser, error) {
+		p, err := securejoin.SecureJoin(root, path)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(p)
+	}
+}
+
+// envScripts returns the environment scripts of the root filesystem
+// which may be sourced by the action script.
+func envScripts(root string) []string {
+	scripts := []string{"/environment"}
+
+	dirs := []string{"/.singularity.d/env"}
+	if appsDir, err := securejoin.SecureJoin(root, "/scif/apps"); err == nil {
+		apps, _ := ioutil.ReadDir(appsDir)
+		for _, app := range apps {
+			dirs = append(dirs, filepath.Join("/scif/apps", app.Name(), "scif/env"))
+		}
+	}
+
+	for _, dir := range dirs {
+		d, err := securejoin.SecureJoin(root, dir)
+		if err != nil {
+			continue
+		}
+		entries, _ := ioutil.ReadDir(d)
+		for _, e := range entries {
+			if filepath.Ext(e.Name()) == ".sh" {
+				scripts = append(scripts, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return scripts
+}
+
+// Resolve evaluates the environment set by the action script for the
+// container process with the same shell interpreter pipeline, without
+// starting the container. Commands executed by the environment scripts
+// are ignored and fail with the exit status 127. It returns the final
+// environment sorted by variable names along with the script, flag or
+// variable which last set each variable.
+func Resolve(cfg ResolveConfig) ([]Variable, error) {
+	args := []string{"/.singularity.d/actions/exec", "/bin/true"}
+	penv := append(append([]string{}, cfg.ProcessEnv...), "APPTAINER_COMMAND=exec")
+
+	t := newOriginTracker(cfg, penv)
+
+	b := bytes.NewBufferString(files.ActionScript)
+
+	sh, err := interpreter.New(b, args[0], args[1:], penv, interp.StdIO(nil, ioutil.Discard, os.Stderr))
+	if err != nil {
+		return nil, err
+	}
+	sh.SetRootPath(cfg.Root, cfg.Cwd)
+	sh.DisableExec()
+
+	for _, script := range envScripts(cfg.Root) {
+		sh.RegisterOpenHandler(script, t.wrap(script, rootFileHandler(cfg.Root, script)))
+	}
+	sh.RegisterOpenHandler(InjectEnvPath, t.wrap(InjectEnvPath, InjectEnvHandler(cfg.ApptainerEnv, cfg.NoEval)))
+	sh.RegisterOpenHandler(RuntimeVarsPath, t.wrap(RuntimeVarsPath, RuntimeVarsHandler(cfg.ApptainerEnv)))
+
+	RegisterActionBuiltins(sh)
+	sh.RegisterShellBuiltin(originBuiltin, t.builtin)
+
+	// exec builtin records the final environment instead
+	// of executing the container process
+	var environ []string
+	sh.RegisterShellBuiltin("exec", func(ctx context.Context, argv []string) error {
+		hc := interp.HandlerCtx(ctx)
+		t.update(hc)
+		environ = interpreter.GetEnv(hc)
+		return nil
+	})
+
+	if err := sh.Run(); err != nil {
+		return nil, fmt.Errorf("while evaluating action script: %s", err)
+	}
+	if environ == nil {
+		return nil, fmt.Errorf("action script exited with status %d before executing the container process", sh.Status())
+	}
+
+	vars := make([]Variable, 0, len(environ))
+	for name, value := range envMap(environ) {
+		vars = append(vars, Variable{
+			Name:   name,
+			Value:  value,
+			Origin: t.origins[name],
+		})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars, nil
+}
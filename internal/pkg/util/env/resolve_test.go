@@ -0,0 +1,86 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+
+	scripts := map[string]string{
+		"90-environment.sh": "export FOO=image\nexport BAR=image\nexport KERNEL=$(uname -r)\n",
+		"95-apps.sh":        "export FOO=apps\n",
+		"99-base.sh":        "export PS1=\"Apptainer> \"\n",
+	}
+	envDir := filepath.Join(root, ".singularity.d", "env")
+	if err := os.MkdirAll(envDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(envDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vars, err := Resolve(ResolveConfig{
+		Root: root,
+		ProcessEnv: []string{
+			"PATH=/usr/bin:/bin",
+			"HOME=/home/tester",
+			"TERM=xterm",
+			"APPTAINER_CONTAINER=/tmp/test.sif",
+		},
+		ApptainerEnv: map[string]string{
+			"BAR": "flag",
+		},
+		Cwd: "/",
+		Origins: map[string]string{
+			"TERM": OriginHost,
+			"BAR":  "--env",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]Variable{
+		"FOO":                 {Value: "apps", Origin: "/.singularity.d/env/95-apps.sh"},
+		"BAR":                 {Value: "flag", Origin: "--env"},
+		"KERNEL":              {Value: "", Origin: "/.singularity.d/env/90-environment.sh"},
+		"PS1":                 {Value: "Apptainer> ", Origin: "/.singularity.d/env/99-base.sh"},
+		"HOME":                {Value: "/home/tester", Origin: OriginRuntime},
+		"TERM":                {Value: "xterm", Origin: OriginHost},
+		"APPTAINER_CONTAINER": {Value: "/tmp/test.sif", Origin: OriginRuntime},
+	}
+
+	for i, v := range vars {
+		if i > 0 && vars[i-1].Name >= v.Name {
+			t.Errorf("variables are not sorted: %s before %s", vars[i-1].Name, v.Name)
+		}
+		w, ok := want[v.Name]
+		if !ok {
+			continue
+		}
+		if v.Value != w.Value {
+			t.Errorf("unexpected value for %s: got %q instead of %q", v.Name, v.Value, w.Value)
+		}
+		if v.Origin != w.Origin {
+			t.Errorf("unexpected origin for %s: got %q instead of %q", v.Name, v.Origin, w.Origin)
+		}
+		delete(want, v.Name)
+	}
+	for name := range want {
+		t.Errorf("variable %s not found", name)
+	}
+}
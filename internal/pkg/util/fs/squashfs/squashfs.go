@@ -52,3 +52,23 @@ func GetMem() (string, error) {
 
 	return mem, err
 }
+
+// GetCompression returns the default compression algorithm
+// used to build squashfs images.
+func GetCompression() (string, error) {
+	c, err := getConfig()
+	if err != nil {
+		return "", err
+	}
+	return c.MksquashfsCompression, nil
+}
+
+// GetCompressionLevel returns the default compression level used
+// to build squashfs images, zero means the mksquashfs default.
+func GetCompressionLevel() (uint, error) {
+	c, err := getConfig()
+	if err != nil {
+		return 0, err
+	}
+	return c.MksquashfsCompLevel, nil
+}
@@ -291,10 +291,10 @@ func canEmulate(arch string) bool {
 	return false
 }
 
-// CompatibleWith returns if the current machine architecture is
-// compatible or can run via emulation the architecture passed in
+// NativelyCompatibleWith returns if the current machine architecture
+// is compatible without emulation with the architecture passed in
 // argument.
-func CompatibleWith(arch string) bool {
+func NativelyCompatibleWith(arch string) bool {
 	currentArch := runtime.GOARCH
 
 	if currentArch == arch {
@@ -307,5 +307,12 @@ func CompatibleWith(arch string) bool {
 		}
 	}
 
-	return canEmulate(arch)
+	return false
+}
+
+// CompatibleWith returns if the current machine architecture is
+// compatible or can run via emulation the architecture passed in
+// argument.
+func CompatibleWith(arch string) bool {
+	return NativelyCompatibleWith(arch) || canEmulate(arch)
 }
@@ -14,6 +14,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -22,6 +23,7 @@ import (
 	"syscall"
 	"time"
 
+	securejoin "github.com/cyphar/filepath-securejoin"
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
@@ -41,6 +43,8 @@ type Shell struct {
 	status        uint8
 	reader        io.Reader
 	runner        *interp.Runner
+	root          string
+	noExec        bool
 }
 
 // execTimeout defines the execution timeout for commands executed by the
@@ -182,6 +186,11 @@ func (s *Shell) internalExecHandler() interp.ExecHandlerFunc {
 				return nil
 			}
 		}
+		if s.noExec {
+			hc := interp.HandlerCtx(ctx)
+			fmt.Fprintf(hc.Stderr, "%s: command execution is disabled\n", args[0])
+			return interp.NewExitStatus(127)
+		}
 		return defaultExecHandler(ctx, args)
 	}
 }
@@ -196,10 +205,78 @@ func (s *Shell) internalOpenHandler() interp.OpenHandlerFunc {
 		if handler, ok := s.openHandlers[path]; ok {
 			return handler(path, flag, perm)
 		}
+		if s.root != "" && path != os.DevNull {
+			// path errors are reported by the interpreter without
+			// aborting the script
+			if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) != 0 {
+				return nil, &os.PathError{Op: "open", Path: path, Err: syscall.EROFS}
+			}
+			p, err := s.rootPath(path, true)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: path, Err: err}
+			}
+			path = p
+		}
 		return os.OpenFile(path, flag, perm)
 	}
 }
 
+// rootPath returns the path on the host filesystem of the path
+// located in the root directory set with SetRootPath, the last path
+// component is not resolved if follow is false.
+func (s *Shell) rootPath(path string, follow bool) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.runner.Dir, path)
+	}
+	if follow {
+		return securejoin.SecureJoin(s.root, path)
+	}
+	dir, err := securejoin.SecureJoin(s.root, filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// SetRootPath makes the shell interpreter resolve the paths of opened,
+// listed and tested files relative to the root directory, as if it was
+// running in a chroot, it allows to evaluate scripts of a container
+// root filesystem from the host. Files in the root directory can't be
+// modified and dir is the current working directory within the root
+// directory, it defaults to the root directory if empty.
+func (s *Shell) SetRootPath(root, dir string) {
+	if dir == "" {
+		dir = "/"
+	}
+	s.root = root
+	s.runner.Dir = dir
+
+	interp.ReadDirHandler(func(ctx context.Context, path string) ([]os.FileInfo, error) {
+		p, err := s.rootPath(path, true)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadDir(p)
+	})(s.runner)
+
+	interp.StatHandler(func(ctx context.Context, name string, followSymlinks bool) (os.FileInfo, error) {
+		p, err := s.rootPath(name, followSymlinks)
+		if err != nil {
+			return nil, err
+		}
+		if followSymlinks {
+			return os.Stat(p)
+		}
+		return os.Lstat(p)
+	})(s.runner)
+}
+
+// DisableExec disables the execution of commands which are not
+// shell builtins, those commands fail with the exit status 127.
+func (s *Shell) DisableExec() {
+	s.noExec = true
+}
+
 // RegisterShellBuiltin registers a shell interpreter builtin.
 func (s *Shell) RegisterShellBuiltin(name string, builtin ShellBuiltin) {
 	if s.shellBuiltins == nil {
@@ -14,7 +14,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
@@ -328,3 +330,87 @@ func TestEvaluateEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestRootPath(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "etc", "env"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "etc", "env", "foo.sh"), []byte("FOO=root"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		script     string
+		expectOut  string
+		expectErr  string
+		expectExit uint8
+	}{
+		{
+			name:      "source",
+			script:    "for f in /etc/env/*.sh; do . $f; done; echo $FOO",
+			expectOut: "root",
+		},
+		{
+			name:      "test file",
+			script:    "test -f /etc/env/foo.sh && test ! -e /etc/passwd && echo ok",
+			expectOut: "ok",
+		},
+		{
+			name:      "relative path",
+			script:    ". ./foo.sh; echo $FOO",
+			expectOut: "root",
+		},
+		{
+			name:      "write",
+			script:    "echo bar > /etc/env/foo.sh || echo failed",
+			expectOut: "failed",
+			expectErr: "open /etc/env/foo.sh: read-only file system",
+		},
+		{
+			name:       "exec",
+			script:     "uname",
+			expectErr:  "uname: command execution is disabled",
+			expectExit: 127,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin, stdout, stderr := newIOStream()
+
+			shell, err := New(bytes.NewBufferString(tt.script), "buffer", nil, nil, interp.StdIO(stdin, stdout, stderr))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			shell.SetRootPath(root, "/etc/env")
+			shell.DisableExec()
+
+			if err := shell.Run(); err != nil && tt.expectExit == 0 {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if shell.Status() != tt.expectExit {
+				t.Fatalf("unexpected exit status: got %d instead of %d", shell.Status(), tt.expectExit)
+			}
+
+			outStr := strings.TrimSpace(stdout.(*bytes.Buffer).String())
+			errStr := strings.TrimSpace(stderr.(*bytes.Buffer).String())
+
+			if tt.expectOut != "" && outStr != tt.expectOut {
+				t.Fatalf("unexpected stdout: %s instead of %s", outStr, tt.expectOut)
+			}
+			if tt.expectErr != "" && errStr != tt.expectErr {
+				t.Fatalf("unexpected stderr: %s instead of %s", errStr, tt.expectErr)
+			}
+		})
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(root, "etc", "env", "foo.sh"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(b) != "FOO=root" {
+		t.Fatalf("file in root directory has been modified: %s", b)
+	}
+}
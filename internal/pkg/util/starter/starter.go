@@ -79,25 +79,33 @@ var (
 
 func IsSuidInstall() bool {
 	isSuidOnce.Do(func() {
-		if buildcfg.APPTAINER_SUID_INSTALL != 1 {
-			return
-		}
-		path := filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter-suid")
-		info, err := os.Stat(path)
-		if err != nil {
-			return
+		suid, err := CheckSuidInstall()
+		if err != nil && os.Getuid() != 0 {
+			sylog.Fatalf("Installation issue: %s", err)
 		}
-		if os.Getuid() != 0 {
-			stat := info.Sys().(*syscall.Stat_t)
-			if stat.Uid != 0 || (info.Mode()&os.ModeSetuid) == 0 {
-				sylog.Fatalf("Installation issue: %v is not setuid root", path)
-			}
-		}
-		isSuid = true
+		isSuid = suid
 	})
 	return isSuid
 }
 
+// CheckSuidInstall returns true if the privileged binary is configured
+// and exists, and an error if it exists but is not setuid root.
+func CheckSuidInstall() (bool, error) {
+	if buildcfg.APPTAINER_SUID_INSTALL != 1 {
+		return false, nil
+	}
+	path := filepath.Join(buildcfg.LIBEXECDIR, "apptainer/bin/starter-suid")
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, nil
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Uid != 0 || (info.Mode()&os.ModeSetuid) == 0 {
+		return true, fmt.Errorf("%v is not setuid root", path)
+	}
+	return true, nil
+}
+
 // LoadOverlayModule sets LOAD_OVERLAY_MODULE environment variable
 // which tell starter to load overlay kernel module.
 func LoadOverlayModule(load bool) CommandOp {
@@ -144,7 +152,7 @@ func Run(name string, config *config.Common, ops ...CommandOp) error {
 	cmd.Stderr = c.stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("while running %s: %s", c.path, err)
+		return fmt.Errorf("while running %s: %w", c.path, err)
 	}
 	return nil
 }
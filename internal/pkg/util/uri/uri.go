@@ -29,16 +29,18 @@ const (
 
 // validURIs contains a list of known uris
 var validURIs = map[string]bool{
-	"library":        true,
-	"shub":           true,
-	"docker":         true,
-	"docker-archive": true,
-	"docker-daemon":  true,
-	"oci":            true,
-	"oci-archive":    true,
-	"http":           true,
-	"https":          true,
-	"oras":           true,
+	"library":            true,
+	"shub":               true,
+	"docker":             true,
+	"docker-archive":     true,
+	"docker-daemon":      true,
+	"oci":                true,
+	"oci-archive":        true,
+	"containers-storage": true,
+	"dir":                true,
+	"http":               true,
+	"https":              true,
+	"oras":               true,
 }
 
 // IsValid returns whether or not the given source is valid
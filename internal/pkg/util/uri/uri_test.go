@@ -47,6 +47,8 @@ func Test_Split(t *testing.T) {
 		{"docker with tags", "docker://sylabs.io/lolcow:latest", "docker", "//sylabs.io/lolcow:latest"},
 		{"library basic", "library://image", "library", "//image"},
 		{"library scoped", "library://collection/image", "library", "//collection/image"},
+		{"containers-storage", "containers-storage:localhost/image:latest", "containers-storage", "localhost/image:latest"},
+		{"dir", "dir:/tmp/image", "dir", "/tmp/image"},
 		{"without transport", "ubuntu", "", "ubuntu"},
 		{"without transport with colon", "ubuntu:18.04.img", "", "ubuntu:18.04.img"},
 	}
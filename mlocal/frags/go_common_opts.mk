@@ -1,7 +1,9 @@
 # go tool default build options
 GO111MODULE := on
-GO_TAGS := containers_image_openpgp sylog oci_engine apptainer_engine fakeroot_engine
-GO_TAGS_SUID := containers_image_openpgp sylog apptainer_engine fakeroot_engine
+# exclude_graphdriver_* tags disable the containers/storage graph drivers
+# requiring C libraries, images stored with these drivers can't be read
+GO_TAGS := containers_image_openpgp sylog oci_engine apptainer_engine fakeroot_engine exclude_graphdriver_btrfs exclude_graphdriver_devicemapper
+GO_TAGS_SUID := containers_image_openpgp sylog apptainer_engine fakeroot_engine exclude_graphdriver_btrfs exclude_graphdriver_devicemapper
 GO_LDFLAGS :=
 # Need to use non-pie build on ppc64le
 # https://github.com/apptainer/singularity/issues/5762
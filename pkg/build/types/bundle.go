@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/cache"
@@ -81,6 +82,24 @@ type Options struct {
 	// To warn when the above is needed, we need to know if the target of this
 	// bundle will be a sandbox
 	SandboxTarget bool
+	// Arch is the architecture of the built container, an empty
+	// value means the host architecture.
+	Arch string `json:"arch"`
+	// Compression is the squashfs compression algorithm of SIF images,
+	// an empty value selects the configured default.
+	Compression string `json:"compression"`
+	// CompressionLevel is the squashfs compression level of SIF images,
+	// zero selects the configured default.
+	CompressionLevel int `json:"compressionLevel"`
+}
+
+// TargetArch returns the architecture of the built container,
+// the host architecture unless the Arch option is set.
+func (o Options) TargetArch() string {
+	if o.Arch != "" {
+		return o.Arch
+	}
+	return runtime.GOARCH
 }
 
 // NewEncryptedBundle creates an Encrypted Bundle environment.
@@ -11,11 +11,14 @@ package image
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
+	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/sif/v2/pkg/sif"
 )
 
@@ -84,10 +87,10 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 
 	var groupID uint32
 
-	// Get the default system partition image
-	desc, err := fimg.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+	// Get the system partition image matching the host architecture
+	desc, err := SelectSystemPartition(fimg)
 	if err == nil {
-		fstype, _, goArch, err := desc.PartitionMetadata()
+		fstype, _, _, err := desc.PartitionMetadata()
 		if err != nil {
 			return err
 		}
@@ -97,14 +100,6 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 			return fmt.Errorf("while checking system partition header: %s", err)
 		}
 
-		// Check the compatibility of the image's target architecture, the
-		// CompatibleWith call will also check that the current machine
-		// has persistent emulation enabled in /proc/sys/fs/binfmt_misc to
-		// be able to execute container process correctly
-		if goArch != "unknown" && !machine.CompatibleWith(goArch) {
-			return fmt.Errorf("the image's architecture (%s) could not run on the host's (%s)", goArch, runtime.GOARCH)
-		}
-
 		groupID = desc.GroupID()
 
 		img.Partitions = []Section{
@@ -117,6 +112,8 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 				AllowedUsage: RootFsUsage,
 			},
 		}
+	} else if !errors.Is(err, sif.ErrObjectNotFound) && !errors.Is(err, sif.ErrNoObjects) {
+		return err
 	}
 
 	fimg.WithDescriptors(func(desc sif.Descriptor) bool {
@@ -125,8 +122,10 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 			if ptype != sif.PartData && ptype != sif.PartOverlay {
 				return false
 			}
-			// ignore overlay partitions not associated to root filesystem group ID if any
+			// ignore overlay partitions not associated to root filesystem group ID if any,
+			// an overlay of another architecture root filesystem can't be applied
 			if ptype == sif.PartOverlay && groupID > 0 && groupID != desc.GroupID() {
+				sylog.Warningf("Ignoring overlay partition %q of another architecture root filesystem", desc.Name())
 				return false
 			}
 
@@ -172,6 +171,83 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 	return nil
 }
 
+// SelectSystemPartition returns the root filesystem partition to use on
+// the host. Multi-architecture images store the root filesystem of the
+// default architecture in the primary system partition and those of other
+// architectures in system partitions, the partition with the host
+// architecture is preferred over a natively compatible one, itself
+// preferred over one requiring emulation. Overlay partitions only apply
+// to the root filesystem partition of their group.
+func SelectSystemPartition(fimg *sif.FileImage) (sif.Descriptor, error) {
+	prim, err := fimg.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+	if err != nil {
+		return sif.Descriptor{}, err
+	}
+	_, _, primArch, err := prim.PartitionMetadata()
+	if err != nil {
+		return sif.Descriptor{}, err
+	}
+	if primArch == "unknown" || primArch == runtime.GOARCH {
+		return prim, nil
+	}
+
+	descs := []sif.Descriptor{prim}
+	archs := []string{primArch}
+
+	sys, err := fimg.GetDescriptors(sif.WithPartitionType(sif.PartSystem))
+	if err != nil {
+		return sif.Descriptor{}, err
+	}
+	for _, d := range sys {
+		_, _, arch, err := d.PartitionMetadata()
+		if err != nil || arch == "unknown" {
+			continue
+		}
+		descs = append(descs, d)
+		archs = append(archs, arch)
+	}
+
+	// Check the compatibility of the image's target architectures, the
+	// CompatibleWith call will also check that the current machine
+	// has persistent emulation enabled in /proc/sys/fs/binfmt_misc to
+	// be able to execute container process correctly
+	for _, compatible := range []func(string) bool{
+		func(arch string) bool { return arch == runtime.GOARCH },
+		machine.NativelyCompatibleWith,
+		machine.CompatibleWith,
+	} {
+		for i, arch := range archs {
+			if compatible(arch) {
+				return descs[i], nil
+			}
+		}
+	}
+
+	if len(archs) > 1 {
+		return sif.Descriptor{}, fmt.Errorf("none of the image's architectures (%s) could run on the host's (%s)", strings.Join(archs, ", "), runtime.GOARCH)
+	}
+	return sif.Descriptor{}, fmt.Errorf("the image's architecture (%s) could not run on the host's (%s)", primArch, runtime.GOARCH)
+}
+
+// Platforms returns the architectures of the root filesystem partitions
+// of the SIF image, starting with the primary system partition.
+func Platforms(fimg *sif.FileImage) []string {
+	var archs []string
+
+	for _, pt := range []sif.PartType{sif.PartPrimSys, sif.PartSystem} {
+		descs, err := fimg.GetDescriptors(sif.WithPartitionType(pt))
+		if err != nil {
+			continue
+		}
+		for _, d := range descs {
+			if _, _, arch, err := d.PartitionMetadata(); err == nil {
+				archs = append(archs, arch)
+			}
+		}
+	}
+	return archs
+}
+
 func (f *sifFormat) openMode(writable bool) int {
 	if writable {
 		return os.O_RDWR
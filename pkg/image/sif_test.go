@@ -12,6 +12,7 @@ package image
 import (
 	"bytes"
 	"os"
+	"reflect"
 	"runtime"
 	"testing"
 
@@ -92,6 +93,13 @@ func TestSIFInitializer(t *testing.T) {
 		)
 	}
 
+	sysPart := func() (sif.DescriptorInput, error) {
+		return sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader(b),
+			sif.OptPartitionMetadata(sif.FsSquash, sif.PartSystem, runtime.GOARCH),
+			sif.OptGroupID(2),
+		)
+	}
+
 	overlayPart := func() (sif.DescriptorInput, error) {
 		return sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader(b),
 			sif.OptPartitionMetadata(sif.FsSquash, sif.PartOverlay, runtime.GOARCH),
@@ -138,6 +146,14 @@ func TestSIFInitializer(t *testing.T) {
 			expectedPartitions: 1,
 			expectedSections:   0,
 		},
+		{
+			name:               "PrimaryPartitionOtherArchAndSystemPartitionSIF",
+			path:               createSIF(t, false, primPartOtherArch, sysPart),
+			writable:           false,
+			expectedSuccess:    true,
+			expectedPartitions: 1,
+			expectedSections:   0,
+		},
 		{
 			name:               "PrimaryPartitionCorruptedSIF",
 			path:               createSIF(t, true, primPart),
@@ -210,6 +226,112 @@ func TestSIFInitializer(t *testing.T) {
 	}
 }
 
+func TestSelectSystemPartition(t *testing.T) {
+	b, err := os.ReadFile(testSquash)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", testSquash, err)
+	}
+
+	part := func(pt sif.PartType, arch string, groupID uint32) func() (sif.DescriptorInput, error) {
+		return func() (sif.DescriptorInput, error) {
+			return sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader(b),
+				sif.OptPartitionMetadata(sif.FsSquash, pt, arch),
+				sif.OptGroupID(groupID),
+			)
+		}
+	}
+
+	tests := []struct {
+		name              string
+		parts             []func() (sif.DescriptorInput, error)
+		expectedSuccess   bool
+		expectedArch      string
+		expectedPlatforms []string
+	}{
+		{
+			name:              "NoPartition",
+			expectedSuccess:   false,
+			expectedPlatforms: nil,
+		},
+		{
+			name:              "PrimaryPartition",
+			parts:             []func() (sif.DescriptorInput, error){part(sif.PartPrimSys, runtime.GOARCH, 1)},
+			expectedSuccess:   true,
+			expectedArch:      runtime.GOARCH,
+			expectedPlatforms: []string{runtime.GOARCH},
+		},
+		{
+			name: "PrimaryPartitionHostArch",
+			parts: []func() (sif.DescriptorInput, error){
+				part(sif.PartPrimSys, runtime.GOARCH, 1),
+				part(sif.PartSystem, "s390x", 2),
+			},
+			expectedSuccess:   true,
+			expectedArch:      runtime.GOARCH,
+			expectedPlatforms: []string{runtime.GOARCH, "s390x"},
+		},
+		{
+			name: "SystemPartitionHostArch",
+			parts: []func() (sif.DescriptorInput, error){
+				part(sif.PartPrimSys, "s390x", 1),
+				part(sif.PartSystem, "ppc64", 2),
+				part(sif.PartSystem, runtime.GOARCH, 3),
+			},
+			expectedSuccess:   true,
+			expectedArch:      runtime.GOARCH,
+			expectedPlatforms: []string{"s390x", "ppc64", runtime.GOARCH},
+		},
+		{
+			name: "SystemPartitionWithoutPrimary",
+			parts: []func() (sif.DescriptorInput, error){
+				part(sif.PartSystem, runtime.GOARCH, 1),
+			},
+			expectedSuccess:   false,
+			expectedPlatforms: []string{runtime.GOARCH},
+		},
+		{
+			name: "NoCompatiblePartition",
+			parts: []func() (sif.DescriptorInput, error){
+				part(sif.PartPrimSys, "s390x", 1),
+				part(sif.PartSystem, "ppc64", 2),
+			},
+			expectedSuccess:   false,
+			expectedPlatforms: []string{"s390x", "ppc64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createSIF(t, false, tt.parts...)
+			defer os.Remove(path)
+
+			fimg, err := sif.LoadContainerFromPath(path, sif.OptLoadWithFlag(os.O_RDONLY))
+			if err != nil {
+				t.Fatalf("failed to load SIF: %s", err)
+			}
+			defer fimg.UnloadContainer()
+
+			desc, err := SelectSystemPartition(fimg)
+			if (err == nil) != tt.expectedSuccess {
+				t.Fatalf("got error %v, expect success %v", err, tt.expectedSuccess)
+			}
+			if err == nil {
+				_, _, arch, err := desc.PartitionMetadata()
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if arch != tt.expectedArch {
+					t.Errorf("got partition with architecture %s, expected %s", arch, tt.expectedArch)
+				}
+			}
+
+			if p := Platforms(fimg); !reflect.DeepEqual(p, tt.expectedPlatforms) {
+				t.Errorf("got platforms %v, expected %v", p, tt.expectedPlatforms)
+			}
+		})
+	}
+}
+
 func TestSIFOpenMode(t *testing.T) {
 	var sifFmt sifFormat
 
@@ -31,6 +31,8 @@ type Attributes struct {
 	Helpfile    string                    `json:"helpfile,omitempty"`
 	Deffile     string                    `json:"deffile,omitempty"`
 	Startscript string                    `json:"startscript,omitempty"`
+	Platforms   []string                  `json:"platforms,omitempty"`
+	Compression string                    `json:"compression,omitempty"`
 }
 
 // Data holds the container metadata attributes.
@@ -0,0 +1,40 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"github.com/apptainer/apptainer/internal/pkg/cdi"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+)
+
+// setCDIConfig sets the CDI devices requested with --device. Devices are
+// resolved here to report errors early, the runtime resolves them again
+// from the CDI specification directories.
+func setCDIConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) error {
+	if len(o.Devices) == 0 {
+		return nil
+	}
+
+	for _, d := range o.Devices {
+		if _, _, err := cdi.ParseQualifiedName(d); err != nil {
+			return err
+		}
+	}
+
+	registry, err := cdi.Load(cdi.SpecDirs, false)
+	if err != nil {
+		return err
+	}
+	if _, err := registry.Edits(o.Devices); err != nil {
+		return err
+	}
+
+	engineConfig.SetCDIDevices(o.Devices)
+	return nil
+}
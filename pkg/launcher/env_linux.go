@@ -0,0 +1,177 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/image/unpacker"
+	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	imgutil "github.com/apptainer/apptainer/pkg/image"
+)
+
+// envFiles are the image files extracted to resolve the container
+// environment of image files.
+var envFiles = []string{
+	"/.singularity.d/env",
+	"/environment",
+	"/scif/apps/*/scif/env",
+}
+
+// ResolveEnv returns the environment of the process of a container
+// started from opts.Image with the environment related options of opts,
+// along with the script, flag or variable which last set each variable.
+// The environment is evaluated by the action script pipeline without
+// starting the container, commands executed by the image environment
+// scripts are ignored.
+func ResolveEnv(opts Options) ([]env.Variable, error) {
+	o := &opts
+
+	if o.ContainAll {
+		o.CleanEnv = true
+	}
+
+	abspath, err := filepath.Abs(o.Image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine image absolute path for %s: %s", o.Image, err)
+	}
+	img, err := imgutil.Init(abspath, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not open image %s: %s", abspath, err)
+	}
+	defer img.File.Close()
+
+	rootfs, err := envRootfs(img, o.TmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if rootfs != img.Path {
+		defer os.RemoveAll(filepath.Dir(rootfs))
+	}
+
+	homePath := o.Home
+	if homePath == "" {
+		pwd, err := user.GetPwUID(uint32(os.Getuid()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve user information for UID %d: %s", os.Getuid(), err)
+		}
+		homePath = pwd.Dir
+	}
+	_, homeDest, err := parseHome(homePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cwd := o.Pwd
+	if cwd == "" && (o.Contain || o.ContainAll) {
+		cwd = homeDest
+	} else if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+
+	hostEnv := make(map[string]string)
+	for _, e := range os.Environ() {
+		if kv := strings.SplitN(e, "=", 2); len(kv) == 2 {
+			hostEnv[kv[0]] = kv[1]
+		}
+	}
+
+	generator := generate.New(nil)
+	if o.NoEval {
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "NO_EVAL", "1")
+	}
+	generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "CONTAINER", abspath)
+	generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "NAME", filepath.Base(abspath))
+
+	apptainerEnv, containerEnv, err := setContainerEnv(generator, o, abspath, homeDest)
+	if err != nil {
+		return nil, err
+	}
+	generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "APPNAME", o.App)
+
+	origins := make(map[string]string)
+
+	// forwarded host variables, HOME and PATH are always set by the runtime
+	for _, e := range generator.Config.Process.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if kv[0] == "HOME" || kv[0] == "PATH" || (kv[0] == "LANG" && o.CleanEnv) {
+			continue
+		}
+		if v, ok := hostEnv[kv[0]]; ok && v == kv[1] {
+			origins[kv[0]] = env.OriginHost
+		}
+	}
+
+	// injected variables come from --env, --env-file or
+	// from APPTAINERENV_ prefixed host variables
+	for key := range apptainerEnv {
+		name := strings.TrimPrefix(key, "SING_USER_DEFINED_")
+		if _, ok := o.Env[name]; ok {
+			origins[key] = "--env"
+			continue
+		} else if _, ok := containerEnv[name]; ok {
+			origins[key] = "--env-file " + o.EnvFile
+			continue
+		}
+		for _, prefix := range env.ApptainerEnvPrefixes {
+			if _, ok := hostEnv[prefix+name]; ok {
+				origins[key] = prefix + name
+				break
+			}
+		}
+	}
+
+	return env.Resolve(env.ResolveConfig{
+		Root:         rootfs,
+		ProcessEnv:   generator.Config.Process.Env,
+		ApptainerEnv: apptainerEnv,
+		NoEval:       o.NoEval,
+		Cwd:          cwd,
+		Origins:      origins,
+	})
+}
+
+// envRootfs returns the path of the image root filesystem holding the
+// environment scripts, they are extracted in a temporary directory for
+// image files.
+func envRootfs(img *imgutil.Image, tmpDir string) (string, error) {
+	if img.Type == imgutil.SANDBOX {
+		return img.Path, nil
+	}
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return "", fmt.Errorf("while getting root filesystem of %s: %s", img.Path, err)
+	}
+	if part.Type != imgutil.SQUASHFS {
+		return "", fmt.Errorf("resolving the environment of %s is only supported for squashfs root filesystems", img.Path)
+	}
+
+	dir, err := ioutil.TempDir(tmpDir, "env-")
+	if err != nil {
+		return "", fmt.Errorf("could not create temporary directory: %s", err)
+	}
+	rootfs := filepath.Join(dir, "rootfs")
+
+	// the built-in squashfs reader doesn't fail on missing files
+	s := &unpacker.Squashfs{}
+	r := io.NewSectionReader(img.File, int64(part.Offset), int64(part.Size))
+	if err := s.ExtractFiles(envFiles, r, rootfs); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("while extracting environment scripts of %s: %s", img.Path, err)
+	}
+	return rootfs, nil
+}
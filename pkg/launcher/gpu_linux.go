@@ -0,0 +1,205 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2019-2022, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/checkpoint/dmtcp"
+	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// setGPUConfig sets up EngineConfig entries for NV / ROCm usage, if requested.
+func setGPUConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) error {
+	if engineConfig.File.AlwaysUseNv && !o.NoNvidia {
+		o.Nvidia = true
+		sylog.Verbosef("'always use nv = yes' found in apptainer.conf")
+	}
+	if engineConfig.File.AlwaysUseRocm && !o.NoRocm {
+		o.Rocm = true
+		sylog.Verbosef("'always use rocm = yes' found in apptainer.conf")
+	}
+
+	if o.Nvidia && o.Rocm {
+		sylog.Warningf("--nv and --rocm cannot be used together. Only --nv will be applied.")
+	}
+
+	if o.Nvidia {
+		// If nvccli was not enabled by flag or config, drop down to legacy binds immediately
+		if !engineConfig.File.UseNvCCLI && !o.NvCCLI {
+			return setNVLegacyConfig(engineConfig, o)
+		}
+
+		// TODO: In privileged fakeroot mode we don't have the correct namespace context to run nvidia-container-cli
+		// from  starter, so fall back to legacy NV handling until that workflow is refactored heavily.
+		fakeRootPriv := o.Fakeroot && engineConfig.File.AllowSetuid && starter.IsSuidInstall()
+		if !fakeRootPriv {
+			return setNvCCLIConfig(engineConfig, o)
+		}
+		return fmt.Errorf("--fakeroot does not support --nvccli in set-uid installations")
+	}
+
+	if o.Rocm {
+		return setRocmConfig(engineConfig, o)
+	}
+	return nil
+}
+
+// setNvCCLIConfig sets up EngineConfig entries for NVIDIA GPU configuration via nvidia-container-cli
+func setNvCCLIConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) (err error) {
+	sylog.Debugf("Using nvidia-container-cli for GPU setup")
+	engineConfig.SetNvCCLI(true)
+
+	if os.Getenv("NVIDIA_VISIBLE_DEVICES") == "" {
+		if o.Contain || o.ContainAll {
+			// When we use --contain we don't mount the NV devices by default in the nvidia-container-cli flow,
+			// they must be mounted via specifying with`NVIDIA_VISIBLE_DEVICES`. This differs from the legacy
+			// flow which mounts all GPU devices, always... so warn the user.
+			sylog.Warningf("When using nvidia-container-cli with --contain NVIDIA_VISIBLE_DEVICES must be set or no GPUs will be available in container.")
+		} else {
+			// In non-contained mode set NVIDIA_VISIBLE_DEVICES="all" by default, so MIGs are available.
+			// Otherwise there is a difference vs legacy GPU binding. See Issue sylabs/singularity#471.
+			sylog.Infof("Setting 'NVIDIA_VISIBLE_DEVICES=all' to emulate legacy GPU binding.")
+			o.extraEnv = append(o.extraEnv, "NVIDIA_VISIBLE_DEVICES=all")
+		}
+	}
+
+	// Pass NVIDIA_ env vars that will be converted to nvidia-container-cli options
+	nvCCLIEnv := []string{}
+	for _, e := range hostEnviron(o.extraEnv) {
+		if strings.HasPrefix(e, "NVIDIA_") {
+			nvCCLIEnv = append(nvCCLIEnv, e)
+		}
+	}
+	engineConfig.SetNvCCLIEnv(nvCCLIEnv)
+
+	if o.Namespaces.User && !o.Writable {
+		return fmt.Errorf("nvidia-container-cli requires --writable with user namespace/fakeroot")
+	}
+	if !o.Writable && !o.WritableTmpfs {
+		sylog.Infof("Setting --writable-tmpfs (required by nvidia-container-cli)")
+		o.WritableTmpfs = true
+	}
+
+	return nil
+}
+
+// setNVLegacyConfig sets up EngineConfig entries for NVIDIA GPU configuration via direct binds of configured bins/libs.
+func setNVLegacyConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) error {
+	sylog.Debugf("Using legacy binds for nv GPU setup")
+	engineConfig.SetNvLegacy(true)
+	gpuConfFile := filepath.Join(buildcfg.APPTAINER_CONFDIR, "nvliblist.conf")
+	// bind persistenced socket if found
+	ipcs, err := gpu.NvidiaIpcsPath()
+	if err != nil {
+		sylog.Warningf("While finding nv ipcs: %v", err)
+	}
+	libs, bins, err := gpu.NvidiaPaths(gpuConfFile)
+	if err != nil {
+		sylog.Warningf("While finding nv bind points: %v", err)
+	}
+	setGPUBinds(engineConfig, libs, bins, ipcs, "nv", o.Writable)
+	return nil
+}
+
+// setRocmConfig sets up EngineConfig entries for ROCm GPU configuration via direct binds of configured bins/libs.
+func setRocmConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) error {
+	sylog.Debugf("Using rocm GPU setup")
+	engineConfig.SetRocm(true)
+	gpuConfFile := filepath.Join(buildcfg.APPTAINER_CONFDIR, "rocmliblist.conf")
+	libs, bins, err := gpu.RocmPaths(gpuConfFile)
+	if err != nil {
+		sylog.Warningf("While finding ROCm bind points: %v", err)
+	}
+	setGPUBinds(engineConfig, libs, bins, []string{}, "nv", o.Writable)
+	return nil
+}
+
+// setGPUBinds sets EngineConfig entries to bind the provided list of libs, bins, ipc files.
+func setGPUBinds(engineConfig *apptainerConfig.EngineConfig, libs, bins, ipcs []string, gpuPlatform string, writable bool) {
+	files := make([]string, len(bins)+len(ipcs))
+	if len(files) == 0 {
+		sylog.Warningf("Could not find any %s files on this host!", gpuPlatform)
+	} else {
+		if writable {
+			sylog.Warningf("%s files may not be bound with --writable", gpuPlatform)
+		}
+		for i, binary := range bins {
+			usrBinBinary := filepath.Join("/usr/bin", filepath.Base(binary))
+			files[i] = strings.Join([]string{binary, usrBinBinary}, ":")
+		}
+		for i, ipc := range ipcs {
+			files[i+len(bins)] = ipc
+		}
+		engineConfig.SetFilesPath(files)
+	}
+	if len(libs) == 0 {
+		sylog.Warningf("Could not find any %s libraries on this host!", gpuPlatform)
+	} else {
+		engineConfig.SetLibrariesPath(libs)
+	}
+}
+
+// setCheckpointConfig sets EngineConfig entries to bind the provided list of libs and bins.
+func setCheckpointConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) error {
+	if o.DMTCPLaunch == "" && o.DMTCPRestart == "" {
+		return nil
+	}
+
+	return injectDMTCPConfig(engineConfig, o)
+}
+
+func injectDMTCPConfig(engineConfig *apptainerConfig.EngineConfig, o *Options) error {
+	sylog.Debugf("Injecting DMTCP configuration")
+	dmtcp.QuickInstallationCheck()
+
+	bins, libs, err := dmtcp.GetPaths()
+	if err != nil {
+		return err
+	}
+
+	var config apptainerConfig.DMTCPConfig
+	if o.DMTCPRestart != "" {
+		config = apptainerConfig.DMTCPConfig{
+			Enabled:    true,
+			Restart:    true,
+			Checkpoint: o.DMTCPRestart,
+			Args:       dmtcp.RestartArgs(),
+		}
+	} else {
+		config = apptainerConfig.DMTCPConfig{
+			Enabled:    true,
+			Restart:    false,
+			Checkpoint: o.DMTCPLaunch,
+			Args:       dmtcp.LaunchArgs(),
+		}
+	}
+
+	m := dmtcp.NewManager()
+	e, err := m.Get(config.Checkpoint)
+	if err != nil {
+		return err
+	}
+
+	sylog.Debugf("Injecting checkpoint state bind: %q", config.Checkpoint)
+	engineConfig.SetBindPath(append(engineConfig.GetBindPath(), e.BindPath()))
+	engineConfig.AppendFilesPath(bins...)
+	engineConfig.AppendLibrariesPath(libs...)
+	engineConfig.SetDMTCPConfig(config)
+
+	return nil
+}
@@ -0,0 +1,1136 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// Copyright (c) 2019-2022, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
+	"github.com/apptainer/apptainer/internal/pkg/image/driver"
+	"github.com/apptainer/apptainer/internal/pkg/image/unpacker"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci"
+	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/apptainer/apptainer/internal/pkg/security"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/internal/pkg/util/env"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/shell/interpreter"
+	"github.com/apptainer/apptainer/internal/pkg/util/starter"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	imgutil "github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/network"
+	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
+	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/syfs"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/apptainer/apptainer/pkg/util/capabilities"
+	"github.com/apptainer/apptainer/pkg/util/cryptkey"
+	"github.com/apptainer/apptainer/pkg/util/fs/proc"
+	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	"github.com/apptainer/apptainer/pkg/util/rlimit"
+	"golang.org/x/sys/unix"
+)
+
+// container holds the runtime configuration of a container ready
+// to be executed by starter.
+type container struct {
+	procname    string
+	config      *config.Common
+	useSuid     bool
+	loadOverlay bool
+	userNS      bool
+	uid         uint32
+}
+
+// ErrReexecuted is returned when the container was launched and waited
+// for by a copy of the calling program re-executed from ReexecArgs in a
+// root-mapped user namespace, the caller has nothing left to do.
+var ErrReexecuted = errors.New("container launched by a re-executed process")
+
+// Exec launches the container in place of the current process, it
+// never returns on success.
+func Exec(opts Options) error {
+	c, err := prepare(opts, "")
+	if err != nil {
+		return err
+	}
+	return starter.Exec(
+		c.procname,
+		c.config,
+		starter.UseSuid(c.useSuid),
+		starter.LoadOverlayModule(c.loadOverlay),
+	)
+}
+
+// Run launches the container and waits for its termination, it returns
+// the container process exit status. A process killed by a signal
+// returns 128 plus the signal number as exit status.
+func Run(opts Options) (int, error) {
+	c, err := prepare(opts, "")
+	if errors.Is(err, ErrReexecuted) {
+		return 0, err
+	} else if err != nil {
+		return 255, err
+	}
+
+	stdin, stdout, stderr := opts.Stdin, opts.Stdout, opts.Stderr
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	err = starter.Run(
+		c.procname,
+		c.config,
+		starter.UseSuid(c.useSuid),
+		starter.WithStdin(stdin),
+		starter.WithStdout(stdout),
+		starter.WithStderr(stderr),
+		starter.LoadOverlayModule(c.loadOverlay),
+	)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal()), nil
+			}
+			return status.ExitStatus(), nil
+		}
+	} else if err != nil {
+		return 255, err
+	}
+	return 0, nil
+}
+
+// StartInstance starts the container as a named instance running in
+// background, it returns once the instance is started.
+func StartInstance(name string, opts Options) error {
+	if name == "" {
+		return fmt.Errorf("an instance name is required")
+	}
+
+	c, err := prepare(opts, name)
+	if err != nil {
+		return err
+	}
+
+	stdout, stderr, err := instance.SetLogFile(name, c.userNS, int(c.uid), instance.LogSubDir)
+	if err != nil {
+		return fmt.Errorf("failed to create instance log files: %s", err)
+	}
+
+	start, err := stderr.Seek(0, io.SeekEnd)
+	if err != nil {
+		sylog.Warningf("failed to get standard error stream offset: %s", err)
+	}
+
+	cmdErr := starter.Run(
+		c.procname,
+		c.config,
+		starter.UseSuid(c.useSuid),
+		starter.WithStdout(stdout),
+		starter.WithStderr(stderr),
+		starter.LoadOverlayModule(c.loadOverlay),
+	)
+
+	if sylog.GetLevel() != 0 {
+		// starter can exit a bit before all errors has been reported
+		// by instance process, wait a bit to catch all errors
+		time.Sleep(100 * time.Millisecond)
+
+		end, err := stderr.Seek(0, io.SeekEnd)
+		if err != nil {
+			sylog.Warningf("failed to get standard error stream offset: %s", err)
+		}
+		if end-start > 0 {
+			output := make([]byte, end-start)
+			stderr.ReadAt(output, start)
+			fmt.Println(string(output))
+		}
+	}
+
+	if cmdErr != nil {
+		return fmt.Errorf("failed to start instance: %s", cmdErr)
+	}
+
+	sylog.Verbosef("you will find instance output here: %s", stdout.Name())
+	sylog.Verbosef("you will find instance error here: %s", stderr.Name())
+	sylog.Infof("instance started successfully")
+
+	return nil
+}
+
+// currentConfig returns the current apptainer.conf configuration,
+// the default configuration file is parsed if none was loaded.
+func currentConfig() (*apptainerconf.File, error) {
+	if c := apptainerconf.GetCurrentConfig(); c != nil {
+		return c, nil
+	}
+	c, err := apptainerconf.Parse(buildcfg.APPTAINER_CONF_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get apptainer configuration: %s", err)
+	}
+	apptainerconf.SetCurrentConfig(c)
+	apptainerconf.SetBinaryPath(true)
+	return c, nil
+}
+
+// prepare builds the container runtime configuration from options,
+// name is the instance name if the container is started as an instance.
+//
+//nolint:maintidx
+func prepare(opts Options, name string) (*container, error) {
+	var err error
+
+	o := &opts
+
+	targetUID := 0
+	targetGID := make([]int, 0)
+
+	procname := ""
+
+	uid := uint32(os.Getuid())
+	gid := uint32(os.Getgid())
+	insideUserNs, _ := namespaces.IsInsideUserNamespace(os.Getpid())
+
+	// Are we running from a privileged account?
+	isPrivileged := uid == 0
+
+	var fakerootPath string
+	if o.Fakeroot {
+		if isPrivileged && namespaces.IsUnprivileged() {
+			// Already running root-mapped unprivileged
+			o.Fakeroot = false
+			sylog.Debugf("running root-mapped unprivileged")
+			fakerootPath, err = fakeroot.FindFake()
+			if err != nil {
+				sylog.Infof("fakeroot command not found, using only root-mapped namespace")
+			} else {
+				sylog.Infof("Using fakeroot command combined with root-mapped namespace")
+			}
+		} else if !isPrivileged && !fakeroot.IsUIDMapped(uid) {
+			sylog.Infof("User not listed in %v, trying root-mapped namespace", fakeroot.SubUIDFile)
+			o.Fakeroot = false
+			if len(o.ReexecArgs) > 0 {
+				err = fakeroot.UnshareRootMapped(o.ReexecArgs)
+				if err == nil {
+					// All good
+					return nil, ErrReexecuted
+				}
+				sylog.Debugf("%v", err)
+			}
+			fakerootPath, err = fakeroot.FindFake()
+			if err != nil {
+				return nil, fmt.Errorf("--fakeroot requires either being in %v, unprivileged user namespaces, or the fakeroot command", fakeroot.SubUIDFile)
+			}
+			sylog.Infof("No user namespaces available, using only the fakeroot command")
+		}
+	}
+
+	checkPrivileges := func(cond bool, desc string, fn func() error) error {
+		if !cond {
+			return nil
+		}
+
+		if !isPrivileged {
+			return fmt.Errorf("%s requires root privileges", desc)
+		}
+
+		return fn()
+	}
+
+	engineConfig := apptainerConfig.NewConfig()
+
+	imageArg := o.ImageArg
+	if imageArg == "" {
+		imageArg = o.Image
+	}
+	engineConfig.SetImageArg(imageArg)
+	engineConfig.File, err = currentConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ociConfig := &oci.Config{}
+	generator := generate.New(&ociConfig.Spec)
+
+	engineConfig.OciConfig = ociConfig
+
+	generator.SetProcessArgs(o.Args)
+
+	currMask := syscall.Umask(0o022)
+	if !o.NoUmask {
+		// Save the current umask, to be set for the process run in the container
+		// https://github.com/apptainer/singularity/issues/5214
+		sylog.Debugf("Saving umask %04o for propagation into container", currMask)
+		engineConfig.SetUmask(currMask)
+		engineConfig.SetRestoreUmask(true)
+	}
+
+	if o.NoEval {
+		engineConfig.SetNoEval(true)
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "NO_EVAL", "1")
+	}
+
+	uidParam := security.GetParam(o.Security, "uid")
+	gidParam := security.GetParam(o.Security, "gid")
+
+	// handle target UID/GID for root user
+	err = checkPrivileges(uidParam != "", "uid security feature", func() error {
+		u, err := strconv.ParseUint(uidParam, 10, 32)
+		if err != nil {
+			return fmt.Errorf("failed to parse provided UID")
+		}
+		targetUID = int(u)
+		uid = uint32(targetUID)
+
+		engineConfig.SetTargetUID(targetUID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkPrivileges(gidParam != "", "gid security feature", func() error {
+		gids := strings.Split(gidParam, ":")
+		for _, id := range gids {
+			g, err := strconv.ParseUint(id, 10, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse provided GID")
+			}
+			targetGID = append(targetGID, int(g))
+		}
+		if len(gids) > 0 {
+			gid = uint32(targetGID[0])
+		}
+
+		engineConfig.SetTargetGID(targetGID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(o.Image, "instance://") {
+		if name != "" {
+			return nil, fmt.Errorf("starting an instance from another is not allowed")
+		}
+		instanceName := instance.ExtractName(o.Image)
+		file, err := instance.Get(instanceName, instance.AppSubDir)
+		if err != nil {
+			return nil, err
+		}
+		o.Namespaces.User = file.UserNs
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "CONTAINER", file.Image)
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "NAME", filepath.Base(file.Image))
+		engineConfig.SetImage(o.Image)
+		engineConfig.SetInstanceJoin(true)
+	} else {
+		abspath, err := filepath.Abs(o.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine image absolute path for %s: %s", o.Image, err)
+		}
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "CONTAINER", abspath)
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "NAME", filepath.Base(abspath))
+		engineConfig.SetImage(abspath)
+	}
+
+	// privileged installation by default
+	useSuid := true
+
+	if !starter.IsSuidInstall() {
+		// not a privileged installation
+		useSuid = false
+
+		if !o.Namespaces.User && uid != 0 {
+			sylog.Verbosef("Unprivileged installation: using user namespace")
+			o.Namespaces.User = true
+		}
+	}
+
+	// use non privileged starter binary:
+	// - if running as root
+	// - if already running inside a user namespace
+	// - if user namespace is requested
+	// - if running as user and 'allow setuid = no' is set in apptainer.conf
+	if uid == 0 || insideUserNs || o.Namespaces.User || !engineConfig.File.AllowSetuid {
+		useSuid = false
+
+		// fallback to user namespace:
+		// - for non root user with setuid installation and 'allow setuid = no'
+		// - for root user without effective capability CAP_SYS_ADMIN
+		if uid != 0 && starter.IsSuidInstall() && !engineConfig.File.AllowSetuid {
+			sylog.Verbosef("'allow setuid' set to 'no' by configuration, fallback to user namespace")
+			o.Namespaces.User = true
+		} else if uid == 0 && !o.Namespaces.User {
+			caps, err := capabilities.GetProcessEffective()
+			if err != nil {
+				return nil, fmt.Errorf("could not get process effective capabilities: %s", err)
+			}
+			if caps&uint64(1<<unix.CAP_SYS_ADMIN) == 0 {
+				sylog.Verbosef("Effective capability CAP_SYS_ADMIN is missing, fallback to user namespace")
+				o.Namespaces.User = true
+			}
+		}
+	}
+
+	// early check for key material before we start engine so we can fail fast if missing
+	// we do not need this check when joining a running instance, just for starting a container
+	if !engineConfig.GetInstanceJoin() {
+		if err := setEncryptionKey(engineConfig, o.KeyInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	// First get binds from -B/--bind and env var
+	bindPaths := append([]string{}, o.Binds...)
+	binds, err := apptainerConfig.ParseBindPath(bindPaths)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing bind path: %s", err)
+	}
+
+	// Now add binds from one or more --mount and env var.
+	// Note that these do not get exported for nested containers
+	for _, m := range o.Mounts {
+		bps, err := apptainerConfig.ParseMountString(m)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing mount %q: %s", m, err)
+		}
+		binds = append(binds, bps...)
+	}
+
+	if fakerootPath != "" {
+		engineConfig.SetFakerootPath(fakerootPath)
+		// Add binds for fakeroot command
+		fakebindPaths, err := fakeroot.GetFakeBinds(fakerootPath)
+		if err != nil {
+			return nil, fmt.Errorf("while getting fakeroot bindpoints: %v", err)
+		}
+		bindPaths = append(bindPaths, fakebindPaths...)
+		fakebinds, err := apptainerConfig.ParseBindPath(fakebindPaths)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing fakeroot bind paths: %s", err)
+		}
+		binds = append(binds, fakebinds...)
+	}
+
+	engineConfig.SetBindPath(binds)
+	generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "BIND", strings.Join(nestedBindPaths(bindPaths), ","))
+
+	if len(o.FuseMount) > 0 {
+		/* If --fusemount is given, imply --pid */
+		o.Namespaces.PID = true
+		if err := engineConfig.SetFuseMount(o.FuseMount); err != nil {
+			return nil, fmt.Errorf("while setting fuse mount: %s", err)
+		}
+	}
+	engineConfig.SetNetwork(o.Network)
+	engineConfig.SetDNS(o.DNS)
+	engineConfig.SetNetworkArgs(o.NetworkArgs)
+	if len(o.Publish) > 0 {
+		/* If --publish is given, imply --net */
+		o.Namespaces.Net = true
+		if _, err := network.ParsePortMaps(o.Publish); err != nil {
+			return nil, err
+		}
+		engineConfig.SetPublishPorts(o.Publish)
+	}
+	engineConfig.SetOverlayImage(o.Overlay)
+	engineConfig.SetWritableImage(o.Writable)
+	engineConfig.SetNoHome(o.NoHome)
+	setNoMountFlags(engineConfig, o.NoMount)
+
+	if err := setGPUConfig(engineConfig, o); err != nil {
+		// We must fail on error, as we are checking for correct ownership of nvidia-container-cli,
+		// which is important to maintain security.
+		return nil, fmt.Errorf("while setting GPU configuration: %s", err)
+	}
+
+	if err := setCheckpointConfig(engineConfig, o); err != nil {
+		return nil, fmt.Errorf("while setting checkpoint configuration: %s", err)
+	}
+
+	if err := setCDIConfig(engineConfig, o); err != nil {
+		return nil, fmt.Errorf("while setting CDI devices: %s", err)
+	}
+
+	engineConfig.SetAddCaps(o.AddCaps)
+	engineConfig.SetDropCaps(o.DropCaps)
+	engineConfig.SetConfigurationFile(o.ConfigFile)
+	engineConfig.SetUseBuildConfig(o.UseBuildConfig)
+
+	err = checkPrivileges(o.AllowSUID, "--allow-setuid", func() error {
+		engineConfig.SetAllowSUID(o.AllowSUID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkPrivileges(o.KeepPrivs, "--keep-privs", func() error {
+		engineConfig.SetKeepPrivs(o.KeepPrivs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	engineConfig.SetNoPrivs(o.NoPrivs)
+	engineConfig.SetSecurity(o.Security)
+	engineConfig.SetShell(o.Shell)
+	engineConfig.AppendLibrariesPath(o.ContainLibs...)
+	engineConfig.SetFakeroot(o.Fakeroot)
+
+	if o.Shell != "" {
+		generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "SHELL", o.Shell)
+	}
+
+	if name != "" && uid != 0 && o.CgroupsTOMLFile != "" {
+		return nil, fmt.Errorf("Instances do not currently support rootless cgroups")
+	}
+
+	if uid != 0 {
+		sylog.Debugf("Recording rootless XDG_RUNTIME_DIR / DBUS_SESSION_BUS_ADDRESS")
+		engineConfig.SetXdgRuntimeDir(os.Getenv("XDG_RUNTIME_DIR"))
+		engineConfig.SetDbusSessionBusAddress(os.Getenv("DBUS_SESSION_BUS_ADDRESS"))
+	}
+
+	engineConfig.SetCgroupsJSON(o.CgroupsJSON)
+
+	if o.Writable && o.WritableTmpfs {
+		sylog.Warningf("Disabling --writable-tmpfs flag, mutually exclusive with --writable")
+		engineConfig.SetWritableTmpfs(false)
+	} else {
+		engineConfig.SetWritableTmpfs(o.WritableTmpfs)
+	}
+
+	homePath := o.Home
+	customHome := homePath != ""
+	if !customHome {
+		pwd, err := user.GetPwUID(uint32(os.Getuid()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve user information for UID %d: %s", os.Getuid(), err)
+		}
+		homePath = pwd.Dir
+	}
+	engineConfig.SetCustomHome(customHome)
+
+	// If we have fakeroot & the home flag has not been used then we have the standard
+	// /root location for the root user $HOME in the container.
+	// This doesn't count as a SetCustomHome(true), as we are mounting from the real
+	// user's standard $HOME -> /root and we want to respect --contain not mounting
+	// the $HOME in this case.
+	// See https://github.com/apptainer/singularity/pull/5227
+	if !customHome && o.Fakeroot {
+		homePath = fmt.Sprintf("%s:/root", homePath)
+	}
+
+	// set home directory for the targeted UID if it exists on host system
+	if !customHome && targetUID != 0 {
+		if targetUID > 500 {
+			if pwd, err := user.GetPwUID(uint32(targetUID)); err == nil {
+				sylog.Debugf("Target UID requested, set home directory to %s", pwd.Dir)
+				homePath = pwd.Dir
+				engineConfig.SetCustomHome(true)
+			} else {
+				sylog.Verbosef("Home directory for UID %d not found, home won't be mounted", targetUID)
+				engineConfig.SetNoHome(true)
+				homePath = "/"
+			}
+		} else {
+			sylog.Verbosef("System UID %d requested, home won't be mounted", targetUID)
+			engineConfig.SetNoHome(true)
+			homePath = "/"
+		}
+	}
+
+	if o.Hostname != "" {
+		o.Namespaces.UTS = true
+		engineConfig.SetHostname(o.Hostname)
+	}
+
+	err = checkPrivileges(o.Boot, "--boot", func() error { return nil })
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Contain || o.ContainAll || o.Boot {
+		engineConfig.SetContain(true)
+
+		if o.ContainAll {
+			o.Namespaces.PID = true
+			o.Namespaces.IPC = true
+			o.CleanEnv = true
+		}
+	}
+
+	engineConfig.SetScratchDir(o.Scratch)
+	engineConfig.SetWorkdir(o.Workdir)
+
+	homeSrc, homeDest, err := parseHome(homePath)
+	if err != nil {
+		return nil, err
+	}
+	engineConfig.SetHomeSource(homeSrc)
+	engineConfig.SetHomeDest(homeDest)
+
+	if o.Fakeroot {
+		o.Namespaces.User = true
+	}
+
+	/* if name submitted, run as instance */
+	if name != "" {
+		o.Namespaces.PID = true
+		engineConfig.SetInstance(true)
+		engineConfig.SetBootInstance(o.Boot)
+
+		if useSuid && !o.Namespaces.User && hidepidProc() {
+			return nil, fmt.Errorf("hidepid option set on /proc mount, require 'hidepid=0' to start instance with setuid workflow")
+		}
+
+		_, err := instance.Get(name, instance.AppSubDir)
+		if err == nil {
+			return nil, fmt.Errorf("instance %s already exists", name)
+		}
+
+		if o.Boot {
+			o.Namespaces.UTS = true
+			o.Namespaces.Net = true
+			if o.Hostname == "" {
+				engineConfig.SetHostname(name)
+			}
+			if !o.KeepPrivs {
+				engineConfig.SetDropCaps("CAP_SYS_BOOT,CAP_SYS_RAWIO")
+			}
+			generator.SetProcessArgs([]string{"/sbin/init"})
+		}
+		pwd, err := user.GetPwUID(uint32(os.Getuid()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve user information for UID %d: %s", os.Getuid(), err)
+		}
+		procname, err = instance.ProcName(name, pwd.Name)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		generator.SetProcessArgs(o.Args)
+		procname = "Apptainer runtime parent"
+	}
+
+	if o.Namespaces.Net {
+		named, err := namedNetworks(o.Network)
+		if err != nil {
+			return nil, err
+		}
+		engineConfig.SetNamedNetworks(named)
+
+		if o.Fakeroot && o.Network != "none" && o.Network != network.UserModeNetwork && len(named) == 0 {
+			engineConfig.SetNetwork("fakeroot")
+
+			// unprivileged installation could not use fakeroot
+			// network because it requires a setuid installation
+			// so we fallback to none
+			if !starter.IsSuidInstall() || !engineConfig.File.AllowSetuid {
+				sylog.Warningf(
+					"fakeroot with unprivileged installation or 'allow setuid = no' " +
+						"could not use 'fakeroot' network, fallback to 'none' network",
+				)
+				engineConfig.SetNetwork("none")
+			}
+		}
+		generator.AddOrReplaceLinuxNamespace("network", "")
+	}
+	if o.Namespaces.UTS {
+		generator.AddOrReplaceLinuxNamespace("uts", "")
+	}
+	if o.Namespaces.PID {
+		generator.AddOrReplaceLinuxNamespace("pid", "")
+		engineConfig.SetNoInit(o.NoInit)
+	}
+	if o.Namespaces.IPC {
+		generator.AddOrReplaceLinuxNamespace("ipc", "")
+	}
+	if o.Namespaces.User {
+		generator.AddOrReplaceLinuxNamespace("user", "")
+
+		if !o.Fakeroot {
+			generator.AddLinuxUIDMapping(uid, uid, 1)
+			generator.AddLinuxGIDMapping(gid, gid, 1)
+		}
+	}
+
+	apptainerEnv, _, err := setContainerEnv(generator, o, engineConfig.GetImage(), engineConfig.GetHomeDest())
+	if err != nil {
+		return nil, err
+	}
+	engineConfig.SetApptainerEnv(apptainerEnv)
+
+	if pwd, err := os.Getwd(); err == nil {
+		engineConfig.SetCwd(pwd)
+		if o.Pwd != "" {
+			generator.SetProcessCwd(o.Pwd)
+			if generator.Config.Annotations == nil {
+				generator.Config.Annotations = make(map[string]string)
+			}
+			generator.Config.Annotations["CustomCwd"] = "true"
+		} else {
+			if engineConfig.GetContain() {
+				generator.SetProcessCwd(engineConfig.GetHomeDest())
+			} else {
+				generator.SetProcessCwd(pwd)
+			}
+		}
+	} else {
+		sylog.Warningf("can't determine current working directory: %s", err)
+	}
+
+	// starter will force the loading of kernel overlay module
+	loadOverlay := false
+	if !o.Namespaces.User && starter.IsSuidInstall() {
+		loadOverlay = true
+	}
+
+	generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "APPNAME", o.App)
+
+	// initialize internal image drivers
+	var desiredFeatures imgutil.DriverFeature
+	if fs.IsFile(o.Image) {
+		desiredFeatures = imgutil.ImageFeature
+	}
+	driver.InitImageDrivers(true, o.Namespaces.User || insideUserNs, engineConfig.File, desiredFeatures)
+
+	// convert image file to sandbox if we are using user
+	// namespace or if we are currently running inside a
+	// user namespace
+	if (o.Namespaces.User || insideUserNs) && fs.IsFile(o.Image) {
+		if err := convertToSandbox(engineConfig, generator, o); err != nil {
+			return nil, err
+		}
+	}
+
+	// setuid workflow set RLIMIT_STACK to its default value,
+	// get the original value to restore it before executing
+	// container process
+	if useSuid {
+		soft, hard, err := rlimit.Get("RLIMIT_STACK")
+		if err != nil {
+			sylog.Warningf("can't retrieve stack size limit: %s", err)
+		}
+		generator.AddProcessRlimits("RLIMIT_STACK", hard, soft)
+	}
+
+	cfg := &config.Common{
+		EngineName:   apptainerConfig.Name,
+		ContainerID:  name,
+		EngineConfig: engineConfig,
+	}
+
+	callbackType := (clicallback.ApptainerEngineConfig)(nil)
+	callbacks, err := plugin.LoadCallbacks(callbackType)
+	if err != nil {
+		return nil, fmt.Errorf("while loading plugins callbacks '%T': %s", callbackType, err)
+	}
+	for _, c := range callbacks {
+		c.(clicallback.ApptainerEngineConfig)(cfg)
+	}
+
+	return &container{
+		procname:    procname,
+		config:      cfg,
+		useSuid:     useSuid,
+		loadOverlay: loadOverlay,
+		userNS:      o.Namespaces.User || insideUserNs,
+		uid:         uid,
+	}, nil
+}
+
+// setEncryptionKey sets the decryption key in the engine configuration
+// if the image root filesystem is encrypted.
+func setEncryptionKey(engineConfig *apptainerConfig.EngineConfig, keyInfo func() (cryptkey.KeyInfo, error)) error {
+	sylog.Debugf("Checking for encrypted system partition")
+	img, err := imgutil.Init(engineConfig.GetImage(), false)
+	if err != nil {
+		return fmt.Errorf("could not open image %s: %s", engineConfig.GetImage(), err)
+	}
+	// the image file is closed before executing starter, otherwise
+	// its descriptor would leak to the container process
+	defer img.File.Close()
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return fmt.Errorf("while getting root filesystem in %s: %s", engineConfig.GetImage(), err)
+	}
+
+	// ensure we have decryption material
+	if part.Type != imgutil.ENCRYPTSQUASHFS {
+		return nil
+	}
+
+	sylog.Debugf("Encrypted container filesystem detected")
+
+	if keyInfo == nil {
+		return fmt.Errorf("cannot load key for decryption: no key material provided")
+	}
+	ki, err := keyInfo()
+	if err != nil {
+		return fmt.Errorf("cannot load key for decryption: %v", err)
+	}
+
+	plaintextKey, err := cryptkey.PlaintextKey(ki, engineConfig.GetImage())
+	if err != nil {
+		sylog.Errorf("Cannot decrypt %s: %v", engineConfig.GetImage(), err)
+		return fmt.Errorf("please check you are providing the correct key for decryption")
+	}
+
+	engineConfig.SetEncryptionKey(plaintextKey)
+	return nil
+}
+
+// namedNetworks returns the definitions of the requested networks created
+// by the user with apptainer network create.
+func namedNetworks(networks string) ([]apptainerConfig.NamedNetwork, error) {
+	var named []apptainerConfig.NamedNetwork
+
+	dir := syfs.NetworkDir()
+	for _, name := range strings.Split(networks, ",") {
+		if network.CheckNamedNetworkName(name) != nil {
+			continue
+		}
+		n, err := network.LoadNamedNetwork(dir, name)
+		if errors.Is(err, network.ErrNoNamedNetwork) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		named = append(named, apptainerConfig.NamedNetwork{
+			Name:   n.Name,
+			Subnet: n.Subnet,
+		})
+	}
+	return named, nil
+}
+
+// nestedBindPaths returns bind paths as seen by a nested container,
+// the source is replaced by the destination because this level is
+// bound at the destination.
+func nestedBindPaths(bindPaths []string) []string {
+	nested := make([]string, len(bindPaths))
+	for i, bindPath := range bindPaths {
+		splits := strings.Split(bindPath, ":")
+		if len(splits) > 1 {
+			if len(splits) > 2 {
+				// Replace the source with the destination
+				splits[0] = splits[1]
+				bindPath = strings.Join(splits, ":")
+			} else {
+				// leave only the destination
+				bindPath = splits[1]
+			}
+		}
+		nested[i] = bindPath
+	}
+	return nested
+}
+
+// parseHome returns the source and destination of a home directory
+// specification src[:dest].
+func parseHome(home string) (string, string, error) {
+	homeSlice := strings.Split(home, ":")
+
+	if len(homeSlice) > 2 || len(homeSlice) == 0 {
+		return "", "", fmt.Errorf("home argument has incorrect number of elements: %v", len(homeSlice))
+	}
+	if len(homeSlice) == 1 {
+		return homeSlice[0], homeSlice[0], nil
+	}
+	return homeSlice[0], homeSlice[1], nil
+}
+
+// setContainerEnv sets the container process environment from the host
+// environment and the --env and --env-file variables, it returns the
+// variables injected by the action script and the variables set from
+// --env and --env-file.
+func setContainerEnv(generator *generate.Generator, o *Options, image, homeDest string) (map[string]string, map[string]string, error) {
+	containerEnv, err := loadEnv(o.Env, o.EnvFile, o.Args, image)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// process --env and --env-file variables for injection
+	// into the environment by prefixing them with APPTAINERENV_
+	extraEnv := append([]string{}, o.extraEnv...)
+	for envName, envValue := range containerEnv {
+		// We can allow envValue to be empty (explicit set to empty) but not name!
+		if envName == "" {
+			sylog.Warningf("Ignore environment variable %s=%s: variable name missing", envName, envValue)
+			continue
+		}
+		extraEnv = append(extraEnv, "APPTAINERENV_"+envName+"="+envValue)
+	}
+
+	environment := hostEnviron(extraEnv)
+
+	// Clean environment
+	return env.SetContainerEnv(generator, environment, o.CleanEnv, homeDest), containerEnv, nil
+}
+
+// hostEnviron returns a copy of the host environment where the extra
+// variables override the ones with the same name, the process
+// environment is left untouched.
+func hostEnviron(extra []string) []string {
+	override := make(map[string]bool, len(extra))
+	for _, e := range extra {
+		override[strings.SplitN(e, "=", 2)[0]] = true
+	}
+
+	environment := make([]string, 0, len(extra))
+	for _, e := range os.Environ() {
+		if !override[strings.SplitN(e, "=", 2)[0]] {
+			environment = append(environment, e)
+		}
+	}
+	return append(environment, extra...)
+}
+
+// loadEnv returns the environment variables set in the container from
+// the environment file and the variables map, variables from the map
+// take precedence over variables defined by the environment file.
+func loadEnv(vars map[string]string, envFile string, args []string, image string) (map[string]string, error) {
+	containerEnv := make(map[string]string, len(vars))
+	for k, v := range vars {
+		containerEnv[k] = v
+	}
+
+	if envFile == "" {
+		return containerEnv, nil
+	}
+
+	currentEnv := append(
+		os.Environ(),
+		"APPTAINER_IMAGE="+image,
+	)
+
+	content, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %q environment file: %s", envFile, err)
+	}
+
+	envvars, err := interpreter.EvaluateEnv(content, args, currentEnv)
+	if err != nil {
+		return nil, fmt.Errorf("while processing %s: %s", envFile, err)
+	}
+	sylog.Debugf("Setting environment variables from file %s", envFile)
+
+	for _, envar := range envvars {
+		e := strings.SplitN(envar, "=", 2)
+		if len(e) != 2 {
+			sylog.Warningf("Ignore environment variable %q: '=' is missing", envar)
+			continue
+		}
+
+		// Ensure we don't overwrite --env variables with environment file
+		if _, ok := vars[e[0]]; ok {
+			sylog.Warningf("Ignore environment variable %s from %s: override from --env", e[0], envFile)
+		} else {
+			containerEnv[e[0]] = e[1]
+		}
+	}
+
+	return containerEnv, nil
+}
+
+// convertToSandbox extracts the image file to a temporary sandbox
+// unless an image driver supporting image files is configured.
+func convertToSandbox(engineConfig *apptainerConfig.EngineConfig, generator *generate.Generator, o *Options) error {
+	if engineConfig.File.ImageDriver != "" {
+		// load image driver plugins
+		callbackType := (apptainercallback.RegisterImageDriver)(nil)
+		callbacks, err := plugin.LoadCallbacks(callbackType)
+		if err != nil {
+			sylog.Debugf("Loading plugins callbacks '%T' failed: %s", callbackType, err)
+		} else {
+			for _, callback := range callbacks {
+				if err := callback.(apptainercallback.RegisterImageDriver)(true); err != nil {
+					sylog.Debugf("While registering image driver: %s", err)
+				}
+			}
+		}
+		driver := imgutil.GetDriver(engineConfig.File.ImageDriver)
+		if driver != nil && driver.Features()&imgutil.ImageFeature != 0 {
+			// the image driver indicates support for image so let's
+			// proceed with the image driver without conversion
+			return nil
+		}
+	}
+
+	// the built-in squashfs reader is used if unsquashfs is not found
+	unsquashfsPath, err := bin.FindBin("unsquashfs")
+	if err != nil {
+		sylog.Debugf("While searching unsquashfs: %s", err)
+	}
+	sylog.Verbosef("User namespace requested, convert image %s to sandbox", o.Image)
+	sylog.Infof("Converting SIF file to temporary sandbox...")
+	rootfsDir, imageDir, err := convertImage(o.Image, unsquashfsPath, o.TmpDir)
+	if err != nil {
+		return fmt.Errorf("while extracting %s: %s", o.Image, err)
+	}
+	engineConfig.SetImage(imageDir)
+	engineConfig.SetDeleteTempDir(rootfsDir)
+	generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "CONTAINER", imageDir)
+
+	// remove original SIF after converting to sandbox if requested
+	if o.RemoveImage {
+		sylog.Debugf("Removing tmp image: %s", o.Image)
+		if err := os.Remove(o.Image); err != nil {
+			sylog.Errorf("unable to remove tmp image: %s: %v", o.Image, err)
+		}
+	}
+	return nil
+}
+
+// convertImage extracts the image found at filename to directory dir within a temporary directory
+// tempDir. If the unsquashfs binary is not located, the binary at unsquashfsPath is used, or the
+// built-in squashfs reader if unsquashfsPath is empty. It is the caller's responsibility to remove
+// rootfsDir when no longer needed.
+func convertImage(filename string, unsquashfsPath string, tmpDir string) (rootfsDir, imageDir string, err error) {
+	img, err := imgutil.Init(filename, false)
+	if err != nil {
+		return "", "", fmt.Errorf("could not open image %s: %s", filename, err)
+	}
+	defer img.File.Close()
+
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return "", "", fmt.Errorf("while getting root filesystem in %s: %s", filename, err)
+	}
+
+	// Nice message if we have been given an older ext3 image, which cannot be extracted due to lack of privilege
+	// to loopback mount.
+	if part.Type == imgutil.EXT3 {
+		sylog.Errorf("File %q is an ext3 format continer image.", filename)
+		sylog.Errorf("Only SIF and squashfs images can be extracted in unprivileged mode.")
+		sylog.Errorf("Use `apptainer build` to convert this image to a SIF file using a setuid install of Apptainer.")
+	}
+
+	// Only squashfs can be extracted
+	if part.Type != imgutil.SQUASHFS {
+		return "", "", fmt.Errorf("not a squashfs root filesystem")
+	}
+
+	// create a reader for rootfs partition
+	reader, err := imgutil.NewPartitionReader(img, "", 0)
+	if err != nil {
+		return "", "", fmt.Errorf("could not extract root filesystem: %s", err)
+	}
+	s := unpacker.NewSquashfs()
+	if !s.HasUnsquashfs() && unsquashfsPath != "" {
+		s.UnsquashfsPath = unsquashfsPath
+	}
+
+	// create temporary sandbox
+	rootfsDir, err = ioutil.TempDir(tmpDir, "rootfs-")
+	if err != nil {
+		return "", "", fmt.Errorf("could not create temporary sandbox: %s", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(rootfsDir)
+		}
+	}()
+
+	// create an inner dir to extract to, so we don't clobber the secure permissions on the tmpDir.
+	imageDir = filepath.Join(rootfsDir, "root")
+	if err := os.Mkdir(imageDir, 0o755); err != nil {
+		return "", "", fmt.Errorf("could not create root directory: %s", err)
+	}
+
+	// extract root filesystem
+	if err := s.ExtractAll(reader, imageDir); err != nil {
+		return "", "", fmt.Errorf("root filesystem extraction failed: %s", err)
+	}
+
+	return rootfsDir, imageDir, err
+}
+
+// hidepidProc checks if hidepid is set on /proc mount point, when this
+// option is an instance started with setuid workflow could not even be
+// joined later or stopped correctly.
+func hidepidProc() bool {
+	entries, err := proc.GetMountInfoEntry("/proc/self/mountinfo")
+	if err != nil {
+		sylog.Warningf("while reading /proc/self/mountinfo: %s", err)
+		return false
+	}
+	for _, e := range entries {
+		if e.Point == "/proc" {
+			for _, o := range e.SuperOptions {
+				if strings.HasPrefix(o, "hidepid=") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// setNoMountFlags sets engine flags to disable mounts, to allow overriding
+// them if they are set true in the apptainer.conf
+func setNoMountFlags(c *apptainerConfig.EngineConfig, noMount []string) {
+	skipBinds := []string{}
+	for _, v := range noMount {
+		switch v {
+		case "proc":
+			c.SetNoProc(true)
+		case "sys":
+			c.SetNoSys(true)
+		case "dev":
+			c.SetNoDev(true)
+		case "devpts":
+			c.SetNoDevPts(true)
+		case "home":
+			c.SetNoHome(true)
+		case "tmp":
+			c.SetNoTmp(true)
+		case "hostfs":
+			c.SetNoHostfs(true)
+		case "cwd":
+			c.SetNoCwd(true)
+		default:
+			if filepath.IsAbs(v) {
+				skipBinds = append(skipBinds, v)
+				continue
+			}
+			sylog.Warningf("Ignoring unknown mount type '%s'", v)
+		}
+	}
+	c.SetSkipBinds(skipBinds)
+}
@@ -0,0 +1,232 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package launcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+)
+
+func setDefaultConfig(t *testing.T) {
+	c, err := apptainerconf.Parse("")
+	if err != nil {
+		t.Fatalf("while getting default configuration: %s", err)
+	}
+	apptainerconf.SetCurrentConfig(c)
+}
+
+func TestNestedBindPaths(t *testing.T) {
+	binds := []string{"/opt", "/data:/mnt", "/src:/dst:ro"}
+	expected := []string{"/opt", "/mnt", "/dst:/dst:ro"}
+
+	nested := nestedBindPaths(binds)
+	if !reflect.DeepEqual(nested, expected) {
+		t.Errorf("got %v, expected %v", nested, expected)
+	}
+	if binds[1] != "/data:/mnt" {
+		t.Errorf("bind paths were modified: %v", binds)
+	}
+}
+
+func TestParseHome(t *testing.T) {
+	tests := []struct {
+		name    string
+		home    string
+		src     string
+		dest    string
+		wantErr bool
+	}{
+		{
+			name: "Source",
+			home: "/home/user",
+			src:  "/home/user",
+			dest: "/home/user",
+		},
+		{
+			name: "SourceDest",
+			home: "/tmp/home:/home/user",
+			src:  "/tmp/home",
+			dest: "/home/user",
+		},
+		{
+			name:    "TooManyElements",
+			home:    "/a:/b:/c",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dest, err := parseHome(tt.home)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			}
+			if src != tt.src || dest != tt.dest {
+				t.Errorf("got %s:%s, expected %s:%s", src, dest, tt.src, tt.dest)
+			}
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	content := "FOO=file\nBAR=file\n"
+	if err := ioutil.WriteFile(envFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("while writing environment file: %s", err)
+	}
+
+	vars := map[string]string{"FOO": "env"}
+
+	env, err := loadEnv(vars, envFile, nil, "/image.sif")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if env["FOO"] != "env" {
+		t.Errorf("FOO=%s, expected value from variables", env["FOO"])
+	}
+	if env["BAR"] != "file" {
+		t.Errorf("BAR=%s, expected value from environment file", env["BAR"])
+	}
+	if _, ok := vars["BAR"]; ok {
+		t.Errorf("variables map was modified: %v", vars)
+	}
+
+	if _, err := loadEnv(nil, filepath.Join(t.TempDir(), "missing"), nil, ""); err == nil {
+		t.Errorf("unexpected success with missing environment file")
+	}
+}
+
+func TestSetNoMountFlags(t *testing.T) {
+	c := apptainerConfig.NewConfig()
+
+	setNoMountFlags(c, []string{"proc", "tmp", "/etc/hosts", "unknown"})
+
+	if !c.GetNoProc() || !c.GetNoTmp() {
+		t.Errorf("proc and tmp mounts were not disabled")
+	}
+	if c.GetNoSys() || c.GetNoDev() {
+		t.Errorf("unexpected disabled mounts")
+	}
+	if skip := c.GetSkipBinds(); !reflect.DeepEqual(skip, []string{"/etc/hosts"}) {
+		t.Errorf("got skipped binds %v, expected [/etc/hosts]", skip)
+	}
+}
+
+func TestPrepareErrors(t *testing.T) {
+	setDefaultConfig(t)
+
+	tests := []struct {
+		name     string
+		opts     Options
+		instance string
+		err      string
+	}{
+		{
+			name: "MissingImage",
+			opts: Options{Image: filepath.Join(t.TempDir(), "missing.sif")},
+			err:  "could not open image",
+		},
+		{
+			name:     "InstanceFromInstance",
+			opts:     Options{Image: "instance://test"},
+			instance: "test2",
+			err:      "starting an instance from another is not allowed",
+		},
+		{
+			name: "BadMount",
+			opts: Options{Image: t.TempDir(), Mounts: []string{"type=bind"}},
+			err:  "while parsing mount",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prepare(tt.opts, tt.instance)
+			if err == nil {
+				t.Fatalf("unexpected success")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %q, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRunError(t *testing.T) {
+	setDefaultConfig(t)
+
+	status, err := Run(Options{Image: filepath.Join(t.TempDir(), "missing.sif")})
+	if err == nil {
+		t.Fatalf("unexpected success")
+	}
+	if status != 255 {
+		t.Errorf("got exit status %d, expected 255", status)
+	}
+}
+
+func TestPrepareEngineConfig(t *testing.T) {
+	setDefaultConfig(t)
+
+	image := t.TempDir()
+	opts := Options{
+		Image:         image,
+		Args:          []string{"/bin/true"},
+		Binds:         []string{"/opt"},
+		Home:          "/tmp/home:/home/user",
+		Hostname:      "test",
+		Env:           map[string]string{"FOO": "bar"},
+		Contain:       true,
+		WritableTmpfs: true,
+		NoMount:       []string{"tmp"},
+		Namespaces:    Namespaces{UTS: true},
+	}
+
+	c, err := prepare(opts, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ec, ok := c.config.EngineConfig.(*apptainerConfig.EngineConfig)
+	if !ok {
+		t.Fatalf("unexpected engine configuration type %T", c.config.EngineConfig)
+	}
+
+	if ec.GetImage() != image {
+		t.Errorf("got image %s, expected %s", ec.GetImage(), image)
+	}
+	if b := ec.GetBindPath(); len(b) != 1 || b[0].Source != "/opt" || b[0].Destination != "/opt" {
+		t.Errorf("got bind paths %v, expected /opt", b)
+	}
+	if ec.GetHomeSource() != "/tmp/home" || ec.GetHomeDest() != "/home/user" {
+		t.Errorf("got home %s:%s, expected /tmp/home:/home/user", ec.GetHomeSource(), ec.GetHomeDest())
+	}
+	if !ec.GetContain() || !ec.GetWritableTmpfs() || !ec.GetNoTmp() {
+		t.Errorf("contain, writable tmpfs or no tmp option was not set")
+	}
+	if ec.GetHostname() != "test" {
+		t.Errorf("got hostname %q, expected test", ec.GetHostname())
+	}
+	if !reflect.DeepEqual(ec.OciConfig.Process.Args, opts.Args) {
+		t.Errorf("got process args %v, expected %v", ec.OciConfig.Process.Args, opts.Args)
+	}
+	if v := ec.GetApptainerEnv()["FOO"]; v != "bar" {
+		t.Errorf("got FOO=%s in container environment, expected bar", v)
+	}
+	if v, ok := os.LookupEnv("APPTAINERENV_FOO"); ok {
+		t.Errorf("process environment was modified: APPTAINERENV_FOO=%s", v)
+	}
+}
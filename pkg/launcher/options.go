@@ -0,0 +1,187 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package launcher provides a Go API to launch containers with the
+// Apptainer native runtime, it implements the action commands (exec,
+// run, shell, test) and instance start of the command line.
+package launcher
+
+import (
+	"io"
+
+	"github.com/apptainer/apptainer/pkg/util/cryptkey"
+)
+
+// Namespaces describes the namespaces requested for a container.
+type Namespaces struct {
+	Net  bool
+	UTS  bool
+	User bool
+	PID  bool
+	IPC  bool
+}
+
+// Options describes how a container is launched, fields correspond
+// to the action command flags and an empty Options launches a
+// container with the default configuration.
+type Options struct {
+	// Image is the path to a container image or a sandbox directory,
+	// or an instance://<name> URI to join a running instance.
+	Image string
+	// ImageArg is the image argument as given by the user before
+	// any URI resolution, it defaults to Image.
+	ImageArg string
+	// Args is the process command executed in the container.
+	Args []string
+	// App is the SCIF application to run.
+	App string
+
+	// Binds holds bind path specifications src[:dest[:opts]].
+	Binds []string
+	// Mounts holds mount specifications as accepted by --mount.
+	Mounts []string
+	// Devices holds fully qualified names of CDI devices as accepted
+	// by --device.
+	Devices []string
+	// Home is the home directory specification src[:dest], the
+	// home directory of the current user is used when empty.
+	Home string
+	// Overlay holds overlay images or directories.
+	Overlay []string
+	// Scratch holds scratch directories created in the container.
+	Scratch []string
+	// Workdir is the host directory used for /tmp, /var/tmp and $HOME.
+	Workdir string
+	// Pwd is the initial working directory in the container.
+	Pwd string
+	// Shell is the shell executed by the shell action.
+	Shell string
+	// Hostname sets the container hostname, implies a UTS namespace.
+	Hostname string
+	// ContainLibs holds host libraries bound into the container.
+	ContainLibs []string
+	// FuseMount holds FUSE filesystem specifications, implies a
+	// PID namespace.
+	FuseMount []string
+	// NoMount holds the system mounts or bind paths to disable.
+	NoMount []string
+
+	// Network is the comma separated list of networks to join
+	// when a network namespace is requested.
+	Network string
+	// NetworkArgs holds arguments passed to network plugins.
+	NetworkArgs []string
+	// Publish holds the host ports published to the container with
+	// the form hostPort[:containerPort]/protocol, it implies a network
+	// namespace.
+	Publish []string
+	// DNS is the comma separated list of DNS servers.
+	DNS string
+
+	// Env holds environment variables set in the container.
+	Env map[string]string
+	// EnvFile is a file of environment variables set in the
+	// container, variables from Env take precedence.
+	EnvFile string
+	// CleanEnv prevents host environment variables to be passed
+	// to the container.
+	CleanEnv bool
+	// NoEval prevents shell evaluation of environment variables
+	// and arguments.
+	NoEval bool
+	// NoUmask prevents the propagation of the umask into the container.
+	NoUmask bool
+
+	// Namespaces are the namespaces requested for the container.
+	Namespaces Namespaces
+	// Fakeroot runs the container as a fake root user.
+	Fakeroot bool
+	// Boot executes /sbin/init as the instance process, root only.
+	Boot bool
+	// Contain uses minimal /dev and empty other directories.
+	Contain bool
+	// ContainAll contains file systems, PID, IPC and environment.
+	ContainAll bool
+	// NoInit disables the shim process started in a PID namespace.
+	NoInit bool
+	// Writable mounts the container image read-write.
+	Writable bool
+	// WritableTmpfs makes the container file system writable with
+	// a tmpfs overlay.
+	WritableTmpfs bool
+	// NoHome disables the home directory mount.
+	NoHome bool
+
+	// Security holds security options (selinux, apparmor, seccomp, uid, gid).
+	Security []string
+	// AllowSUID allows setuid binaries in the container, root only.
+	AllowSUID bool
+	// KeepPrivs keeps all root privileges in the container, root only.
+	KeepPrivs bool
+	// NoPrivs drops all privileges in the container.
+	NoPrivs bool
+	// AddCaps is the comma separated list of capabilities to add.
+	AddCaps string
+	// DropCaps is the comma separated list of capabilities to drop.
+	DropCaps string
+
+	// CgroupsJSON is the cgroups resource limits configuration in
+	// JSON format.
+	CgroupsJSON string
+	// CgroupsTOMLFile is the cgroups configuration file CgroupsJSON was
+	// loaded from, instances of non-root users don't support it.
+	CgroupsTOMLFile string
+
+	// Nvidia enables NVIDIA GPU support.
+	Nvidia bool
+	// NvCCLI uses nvidia-container-cli for NVIDIA GPU setup.
+	NvCCLI bool
+	// NoNvidia disables NVIDIA GPU support enabled by configuration.
+	NoNvidia bool
+	// Rocm enables AMD ROCm GPU support.
+	Rocm bool
+	// NoRocm disables ROCm GPU support enabled by configuration.
+	NoRocm bool
+
+	// DMTCPLaunch is the checkpoint name used to launch the
+	// container with DMTCP.
+	DMTCPLaunch string
+	// DMTCPRestart is the checkpoint name used to restart the
+	// container with DMTCP.
+	DMTCPRestart string
+
+	// KeyInfo returns the key material used to decrypt an encrypted
+	// image, it's only called for encrypted images.
+	KeyInfo func() (cryptkey.KeyInfo, error)
+
+	// ConfigFile is the apptainer.conf path propagated to the runtime.
+	ConfigFile string
+	// UseBuildConfig uses the build configuration in the runtime.
+	UseBuildConfig bool
+	// TmpDir is the directory used to extract images to temporary
+	// sandboxes.
+	TmpDir string
+	// RemoveImage removes the image file once extracted to a
+	// temporary sandbox.
+	RemoveImage bool
+	// ReexecArgs is the command line re-executed in a root-mapped
+	// user namespace when fakeroot is requested by a user without
+	// subordinate ID mappings. The fakeroot command alone is used
+	// in this case when empty.
+	ReexecArgs []string
+
+	// Stdin, Stdout and Stderr are the container streams used by Run,
+	// the streams of the current process are used when nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// extraEnv holds host environment variables set by the launcher,
+	// they override the process environment.
+	extraEnv []string
+}
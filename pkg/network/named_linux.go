@@ -0,0 +1,430 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+	"github.com/containernetworking/cni/libcni"
+)
+
+const (
+	// namedNetworkExt is the extension of named network definition files.
+	namedNetworkExt = ".json"
+	// namedNetworkHostsExt is the extension of named network hosts files.
+	namedNetworkHostsExt = ".hosts"
+	// namedNetworkDataDir is the directory where the host-local IPAM
+	// plugin stores the addresses allocated for named networks.
+	namedNetworkDataDir = "/var/lib/cni/networks"
+	// hostsMarker separates the default hosts entries from the entries
+	// of the containers attached to a named network.
+	hostsMarker = "# apptainer network hosts"
+)
+
+var namedNetworkReg = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// ErrNoNamedNetwork is returned when a named network doesn't exist.
+var ErrNoNamedNetwork = netError("no such network")
+
+// NamedNetwork is a bridge network created by a user with
+// apptainer network create.
+type NamedNetwork struct {
+	Name   string `json:"name"`
+	Subnet string `json:"subnet"`
+}
+
+// CheckNamedNetworkName returns an error if name is not a valid network name.
+func CheckNamedNetworkName(name string) error {
+	if !namedNetworkReg.MatchString(name) {
+		return fmt.Errorf("invalid network name %q, must start with an alphanumeric character followed by alphanumeric, '_', '.' or '-' characters", name)
+	}
+	return nil
+}
+
+// NamedNetworkHostsFile returns the path of the hosts file shared by the
+// containers attached to the named network stored in dir.
+func NamedNetworkHostsFile(dir, name string) string {
+	return filepath.Join(dir, name+namedNetworkHostsExt)
+}
+
+// LoadNamedNetwork returns the named network stored in dir.
+func LoadNamedNetwork(dir, name string) (*NamedNetwork, error) {
+	if err := CheckNamedNetworkName(name); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, name+namedNetworkExt))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNoNamedNetwork, name)
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading network %s: %s", name, err)
+	}
+	n := new(NamedNetwork)
+	if err := json.Unmarshal(b, n); err != nil {
+		return nil, fmt.Errorf("while decoding network %s: %s", name, err)
+	}
+	return n, nil
+}
+
+// LoadNamedNetworks returns the named networks stored in dir sorted by name.
+func LoadNamedNetworks(dir string) ([]NamedNetwork, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+namedNetworkExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	networks := make([]NamedNetwork, 0, len(matches))
+	for _, m := range matches {
+		n, err := LoadNamedNetwork(dir, strings.TrimSuffix(filepath.Base(m), namedNetworkExt))
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, *n)
+	}
+	return networks, nil
+}
+
+// SaveNamedNetwork stores the named network definition in dir along
+// with an initial hosts file.
+func SaveNamedNetwork(dir string, n *NamedNetwork) error {
+	if err := CheckNamedNetworkName(n.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("while creating network directory: %s", err)
+	}
+	b, err := json.MarshalIndent(n, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, n.Name+namedNetworkExt), b, 0o644); err != nil {
+		return fmt.Errorf("while writing network %s: %s", n.Name, err)
+	}
+	return ioutil.WriteFile(NamedNetworkHostsFile(dir, n.Name), hostsContent(nil), 0o644)
+}
+
+// DeleteNamedNetwork removes the named network definition and its hosts
+// file from dir.
+func DeleteNamedNetwork(dir, name string) error {
+	if _, err := LoadNamedNetwork(dir, name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, name+namedNetworkExt)); err != nil {
+		return fmt.Errorf("while removing network %s: %s", name, err)
+	}
+	if err := os.Remove(NamedNetworkHostsFile(dir, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("while removing network %s hosts file: %s", name, err)
+	}
+	return nil
+}
+
+// Bridge returns the name of the bridge interface of the named network
+// created by the user identified by uid. The name embeds the uid, only
+// the network name is hashed, so a user can't choose a network name
+// matching the bridge of another user.
+func (n *NamedNetwork) Bridge(uid int) string {
+	h := fnv.New32a()
+	h.Write([]byte(n.Name))
+	return fmt.Sprintf("ap%08x%05x", uint32(uid), h.Sum32()&0xfffff)
+}
+
+// ConfList returns the CNI configuration of the named network created
+// by the user identified by uid.
+func (n *NamedNetwork) ConfList(uid int) (*libcni.NetworkConfigList, error) {
+	conf := map[string]interface{}{
+		"cniVersion": "1.0.0",
+		"name":       n.Name,
+		"plugins": []interface{}{
+			map[string]interface{}{
+				"type":      "bridge",
+				"bridge":    n.Bridge(uid),
+				"isGateway": true,
+				"ipMasq":    true,
+				"ipam": map[string]interface{}{
+					"type":    "host-local",
+					"subnet":  n.Subnet,
+					"dataDir": filepath.Join(namedNetworkDataDir, "apptainer-"+strconv.Itoa(uid)),
+					"routes": []interface{}{
+						map[string]string{"dst": "0.0.0.0/0"},
+					},
+				},
+			},
+			map[string]interface{}{
+				"type": "firewall",
+			},
+			map[string]interface{}{
+				"type":         "portmap",
+				"capabilities": map[string]bool{"portMappings": true},
+				"snat":         true,
+			},
+		},
+	}
+	b, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	return libcni.ConfListFromBytes(b)
+}
+
+// overlaps returns if both networks share addresses.
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// CheckSubnet returns an error if subnet is not an IPv4 subnet within
+// pool or if it overlaps with an address of a host interface other than
+// bridge. An existing bridge interface must only have IPv4 addresses
+// within subnet, otherwise it belongs to another network.
+func CheckSubnet(subnet, pool, bridge string) error {
+	ip, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %q: %s", subnet, err)
+	}
+	if ip.To4() == nil {
+		return fmt.Errorf("subnet %s is not an IPv4 subnet", subnet)
+	}
+	if !ip.Equal(ipnet.IP) {
+		return fmt.Errorf("subnet %s is not a network address, use %s", subnet, ipnet)
+	}
+	ones, _ := ipnet.Mask.Size()
+	if ones > 30 {
+		return fmt.Errorf("subnet %s is too small", subnet)
+	}
+
+	_, poolnet, err := net.ParseCIDR(pool)
+	if err != nil {
+		return fmt.Errorf("invalid user network pool %q: %s", pool, err)
+	}
+	poolOnes, _ := poolnet.Mask.Size()
+	if !poolnet.Contains(ipnet.IP) || ones < poolOnes {
+		return fmt.Errorf("subnet %s is not within the user network pool %s", subnet, pool)
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return fmt.Errorf("while listing network interfaces: %s", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			if iface.Name == bridge {
+				return fmt.Errorf("while getting bridge %s addresses: %s", bridge, err)
+			}
+			continue
+		}
+		for _, addr := range addrs {
+			a, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if iface.Name == bridge {
+				if a.IP.To4() != nil && !ipnet.Contains(a.IP) {
+					return fmt.Errorf("bridge %s has address %s outside of subnet %s", bridge, a, subnet)
+				}
+			} else if overlaps(a, ipnet) {
+				return fmt.Errorf("subnet %s overlaps with address %s of interface %s", subnet, a, iface.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// SubnetsOverlap returns if subnet overlaps with one of the other subnets.
+func SubnetsOverlap(subnet string, others []string) bool {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return false
+	}
+	for _, o := range others {
+		if _, n, err := net.ParseCIDR(o); err == nil && overlaps(n, ipnet) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllocateSubnet returns the first /24 subnet of pool which doesn't
+// overlap with the used subnets or with the host interface addresses.
+func AllocateSubnet(pool string, used []string) (string, error) {
+	_, poolnet, err := net.ParseCIDR(pool)
+	if err != nil {
+		return "", fmt.Errorf("invalid user network pool %q: %s", pool, err)
+	}
+	if poolnet.IP.To4() == nil {
+		return "", fmt.Errorf("user network pool %s is not an IPv4 network", pool)
+	}
+
+	ones, _ := poolnet.Mask.Size()
+	size := 24
+	if ones > size {
+		size = ones
+	}
+
+	start := binary.BigEndian.Uint32(poolnet.IP.To4())
+	count := uint32(1) << uint(size-ones)
+	for i := uint32(0); i < count; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+i<<uint(32-size))
+		candidate := (&net.IPNet{IP: ip, Mask: net.CIDRMask(size, 32)}).String()
+
+		if !SubnetsOverlap(candidate, used) && CheckSubnet(candidate, pool, "") == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free subnet left in the user network pool %s", pool)
+}
+
+// HostsEntry associates a container name with its IP address.
+type HostsEntry struct {
+	IP   string
+	Name string
+}
+
+// hostsContent returns the content of a hosts file with the default
+// entries followed by the container entries.
+func hostsContent(entries []HostsEntry) []byte {
+	var b bytes.Buffer
+	b.Write(files.DefaultHosts())
+	b.WriteString(hostsMarker + "\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s\t%s\n", e.IP, e.Name)
+	}
+	return b.Bytes()
+}
+
+// parseHosts returns the container entries of hosts file content.
+func parseHosts(content []byte) []HostsEntry {
+	var entries []HostsEntry
+
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == hostsMarker {
+			found = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if !found || len(fields) < 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, HostsEntry{IP: fields[0], Name: fields[1]})
+	}
+	return entries
+}
+
+// HostsEntries returns the container entries of the hosts file at path.
+func HostsEntries(path string) ([]HostsEntry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseHosts(b), nil
+}
+
+// updateHosts rewrites the hosts file at path in place with the entries
+// returned by update, the file is rewritten in place as it is bind
+// mounted in running containers.
+func updateHosts(path string, update func([]HostsEntry) []HostsEntry) error {
+	fd, err := lock.Exclusive(path)
+	if err != nil {
+		return fmt.Errorf("while locking %s: %s", path, err)
+	}
+	defer lock.Release(fd)
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	content := hostsContent(update(parseHosts(b)))
+
+	if _, err := f.WriteAt(content, 0); err != nil {
+		return fmt.Errorf("while writing %s: %s", path, err)
+	}
+	return f.Truncate(int64(len(content)))
+}
+
+// AddHostsEntry adds or replaces the entry of the container name in the
+// hosts file at path.
+func AddHostsEntry(path, ip, name string) error {
+	return updateHosts(path, func(entries []HostsEntry) []HostsEntry {
+		entries = removeEntry(entries, name)
+		return append(entries, HostsEntry{IP: ip, Name: name})
+	})
+}
+
+// RemoveHostsEntry removes the entry of the container name from the
+// hosts file at path.
+func RemoveHostsEntry(path, name string) error {
+	return updateHosts(path, func(entries []HostsEntry) []HostsEntry {
+		return removeEntry(entries, name)
+	})
+}
+
+func removeEntry(entries []HostsEntry, name string) []HostsEntry {
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Name != name {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// NewSetupWithNamedNetworks creates and returns a network setup like
+// NewSetup, the configurations of the named networks created by the user
+// identified by uid are generated instead of being loaded from the CNI
+// configuration directory.
+func NewSetupWithNamedNetworks(networks []string, named []NamedNetwork, uid int, containerID string, netNS string, cniPath *CNIPath) (*Setup, error) {
+	if cniPath == nil || cniPath.Conf == "" {
+		return nil, ErrNoCNIConfig
+	}
+
+	networkConfList := make([]*libcni.NetworkConfigList, len(networks))
+
+	for i, network := range networks {
+		var err error
+
+		for _, n := range named {
+			if n.Name == network {
+				networkConfList[i], err = n.ConfList(uid)
+				break
+			}
+		}
+		if networkConfList[i] == nil && err == nil {
+			networkConfList[i], err = libcni.LoadConfList(cniPath.Conf, network)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewSetupFromConfig(networkConfList, containerID, netNS, cniPath)
+}
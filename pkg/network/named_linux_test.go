@@ -0,0 +1,160 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestNamedNetworkStore(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, n := range []NamedNetwork{{"web", "10.89.1.0/24"}, {"db", "10.89.2.0/24"}} {
+		n := n
+		if err := SaveNamedNetwork(dir, &n); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := SaveNamedNetwork(dir, &NamedNetwork{Name: "../escape"}); err == nil {
+		t.Errorf("unexpected success with invalid name")
+	}
+
+	networks, err := LoadNamedNetworks(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []NamedNetwork{{"db", "10.89.2.0/24"}, {"web", "10.89.1.0/24"}}
+	if !reflect.DeepEqual(networks, want) {
+		t.Errorf("unexpected networks %v", networks)
+	}
+
+	if err := DeleteNamedNetwork(dir, "web"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := LoadNamedNetwork(dir, "web"); !errors.Is(err, ErrNoNamedNetwork) {
+		t.Errorf("unexpected error for deleted network: %v", err)
+	}
+	if _, err := os.Stat(NamedNetworkHostsFile(dir, "web")); !os.IsNotExist(err) {
+		t.Errorf("hosts file of deleted network still present")
+	}
+}
+
+func TestSubnets(t *testing.T) {
+	const pool = "10.89.0.0/16"
+
+	tests := []struct {
+		subnet      string
+		expectError bool
+	}{
+		{"10.89.3.0/24", false},
+		{"10.89.3.0/23", true},
+		{"10.89.3.1/24", true},
+		{"10.90.0.0/24", true},
+		{"10.88.0.0/15", true},
+		{"10.89.3.0/31", true},
+		{"fd00::/64", true},
+	}
+	for _, tt := range tests {
+		err := CheckSubnet(tt.subnet, pool, "")
+		if err != nil && !tt.expectError {
+			t.Errorf("unexpected error for %s: %s", tt.subnet, err)
+		} else if err == nil && tt.expectError {
+			t.Errorf("unexpected success for %s", tt.subnet)
+		}
+	}
+
+	// the loopback interface has an address outside of the subnet
+	// and can't be used as the network bridge
+	if err := CheckSubnet("127.1.0.0/24", "127.0.0.0/8", "lo"); err == nil || !strings.Contains(err.Error(), "outside of subnet") {
+		t.Errorf("unexpected error for bridge with foreign address: %v", err)
+	}
+
+	subnet, err := AllocateSubnet(pool, []string{"10.89.0.0/24", "10.89.1.0/24", "10.89.3.0/24"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if subnet != "10.89.2.0/24" {
+		t.Errorf("unexpected subnet %s", subnet)
+	}
+	if _, err := AllocateSubnet("10.89.0.0/24", []string{"10.89.0.0/16"}); err == nil {
+		t.Errorf("unexpected success with exhausted pool")
+	}
+}
+
+func TestHostsEntries(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveNamedNetwork(dir, &NamedNetwork{Name: "net", Subnet: "10.89.1.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	path := NamedNetworkHostsFile(dir, "net")
+
+	var before syscall.Stat_t
+	if err := syscall.Stat(path, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []HostsEntry{{"10.89.1.2", "web"}, {"10.89.1.3", "db"}, {"10.89.1.4", "web"}} {
+		if err := AddHostsEntry(path, e.IP, e.Name); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := RemoveHostsEntry(path, "db"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries, err := HostsEntries(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []HostsEntry{{"10.89.1.4", "web"}}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("unexpected entries %v", entries)
+	}
+
+	// the file must be updated in place as it is bind mounted in containers
+	var after syscall.Stat_t
+	if err := syscall.Stat(path, &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Ino != after.Ino {
+		t.Errorf("hosts file was replaced instead of being updated in place")
+	}
+}
+
+func TestNamedNetworkConfList(t *testing.T) {
+	n := &NamedNetwork{Name: "web", Subnet: "10.89.1.0/24"}
+
+	if n.Bridge(1000) == n.Bridge(1001) {
+		t.Errorf("same bridge name for different users")
+	}
+	if b := n.Bridge(1000); !strings.HasPrefix(b, "ap000003e8") {
+		t.Errorf("bridge name %s doesn't embed the user ID", b)
+	}
+	if l := len(n.Bridge(1000)); l > 15 {
+		t.Errorf("bridge name too long: %d characters", l)
+	}
+
+	conf, err := n.ConfList(1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if conf.Name != "web" {
+		t.Errorf("unexpected network name %s", conf.Name)
+	}
+	if len(conf.Plugins) != 3 || conf.Plugins[0].Network.Type != "bridge" {
+		t.Errorf("unexpected plugins in configuration")
+	}
+	if !conf.Plugins[2].Network.Capabilities["portMappings"] {
+		t.Errorf("portmap plugin without portMappings capability")
+	}
+}
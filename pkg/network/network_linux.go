@@ -66,6 +66,11 @@ type PortMapEntry struct {
 	HostIP        string `json:"hostIP,omitempty"`
 }
 
+// String returns the port mapping as hostPort:containerPort/protocol.
+func (pm PortMapEntry) String() string {
+	return fmt.Sprintf("%d:%d/%s", pm.HostPort, pm.ContainerPort, pm.Protocol)
+}
+
 // GetAllNetworkConfigList lists configured networks in configuration path directory
 // provided by cniPath
 func GetAllNetworkConfigList(cniPath *CNIPath) ([]*libcni.NetworkConfigList, error) {
@@ -195,6 +200,60 @@ func parseArg(arg string) ([][2]string, error) {
 	return argList, nil
 }
 
+// parsePortMap parses a portmap argument of the form
+// hostPort[:containerPort]/protocol.
+func parsePortMap(value string) (PortMapEntry, error) {
+	pm := PortMapEntry{}
+
+	splittedPort := strings.SplitN(value, "/", 2)
+	if len(splittedPort) != 2 {
+		return pm, fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
+	}
+	pm.Protocol = splittedPort[1]
+	if pm.Protocol != "tcp" && pm.Protocol != "udp" {
+		return pm, fmt.Errorf("only tcp and udp protocol can be specified")
+	}
+	ports := strings.Split(splittedPort[0], ":")
+	if len(ports) != 1 && len(ports) != 2 {
+		return pm, fmt.Errorf("portmap port argument is badly formatted")
+	}
+	if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
+		pm.HostPort = int(n)
+		if pm.HostPort <= 0 || pm.HostPort > 65535 {
+			return pm, fmt.Errorf("host port must be greater than 0 and less than 65535")
+		}
+	} else {
+		return pm, fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
+	}
+	if len(ports) == 2 {
+		if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
+			pm.ContainerPort = int(n)
+			if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
+				return pm, fmt.Errorf("container port must be greater than 0 and less than 65535")
+			}
+		} else {
+			return pm, fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
+		}
+	} else {
+		pm.ContainerPort = pm.HostPort
+	}
+	return pm, nil
+}
+
+// ParsePortMaps parses port mappings of the form
+// hostPort[:containerPort]/protocol.
+func ParsePortMaps(ports []string) ([]PortMapEntry, error) {
+	entries := make([]PortMapEntry, 0, len(ports))
+	for _, p := range ports {
+		pm, err := parsePortMap(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port mapping %q: %s", p, err)
+		}
+		entries = append(entries, pm)
+	}
+	return entries, nil
+}
+
 // SetCapability sets capability arguments for the corresponding network plugin
 // uses by a configured network
 func (m *Setup) SetCapability(network string, capName string, args interface{}) error {
@@ -281,41 +340,11 @@ func (m *Setup) SetArgs(args []string) error {
 			key := kv[0]
 			value := kv[1]
 			if key == "portmap" {
-				pm := &PortMapEntry{}
-
-				splittedPort := strings.SplitN(value, "/", 2)
-				if len(splittedPort) != 2 {
-					return fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
-				}
-				pm.Protocol = splittedPort[1]
-				if pm.Protocol != "tcp" && pm.Protocol != "udp" {
-					return fmt.Errorf("only tcp and udp protocol can be specified")
-				}
-				ports := strings.Split(splittedPort[0], ":")
-				if len(ports) != 1 && len(ports) != 2 {
-					return fmt.Errorf("portmap port argument is badly formatted")
-				}
-				if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
-					pm.HostPort = int(n)
-					if pm.HostPort <= 0 || pm.HostPort > 65535 {
-						return fmt.Errorf("host port must be greater than 0 and less than 65535")
-					}
-				} else {
-					return fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
-				}
-				if len(ports) == 2 {
-					if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
-						pm.ContainerPort = int(n)
-						if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
-							return fmt.Errorf("container port must be greater than 0 and less than 65535")
-						}
-					} else {
-						return fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
-					}
-				} else {
-					pm.ContainerPort = pm.HostPort
+				pm, err := parsePortMap(value)
+				if err != nil {
+					return err
 				}
-				if err := m.SetCapability(networkName, "portMappings", *pm); err != nil {
+				if err := m.SetCapability(networkName, "portMappings", pm); err != nil {
 					return err
 				}
 			} else if key == "ipRange" {
@@ -340,6 +369,33 @@ func (m *Setup) SetArgs(args []string) error {
 	return nil
 }
 
+// PublishPorts publishes host ports to the container through the
+// first configured network, which must support port mappings.
+func (m *Setup) PublishPorts(ports []PortMapEntry) error {
+	if len(m.networks) < 1 {
+		return fmt.Errorf("there is no configured network in list")
+	}
+	for _, pm := range ports {
+		if err := m.SetCapability(m.networks[0], "portMappings", pm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ports returns the port mappings of all configured networks as
+// hostPort:containerPort/protocol.
+func (m *Setup) Ports() []string {
+	var ports []string
+	for i := range m.runtimeConf {
+		entries, _ := m.runtimeConf[i].CapabilityArgs["portMappings"].([]PortMapEntry)
+		for _, pm := range entries {
+			ports = append(ports, pm.String())
+		}
+	}
+	return ports
+}
+
 // GetNetworkIP returns IP associated with a configured network, if network
 // is empty, the function returns IP for the first configured network
 func (m *Setup) GetNetworkIP(network string, version string) (net.IP, error) {
@@ -370,6 +370,37 @@ func TestNewSetup(t *testing.T) {
 }
 
 // ping requested IP from host
+func TestPublishPorts(t *testing.T) {
+	n := &NamedNetwork{Name: "web", Subnet: "10.89.1.0/24"}
+	conf, err := n.ConfList(1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	setup, err := NewSetupFromConfig([]*libcni.NetworkConfigList{conf}, "test", "/proc/self/ns/net", &CNIPath{Conf: t.TempDir(), Plugin: t.TempDir()})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := ParsePortMaps([]string{"8080:80"}); err == nil {
+		t.Errorf("unexpected success with missing protocol")
+	}
+	ports, err := ParsePortMaps([]string{"8080:80/tcp", "5353/udp"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := setup.SetArgs([]string{"portmap=2222:22/tcp"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := setup.PublishPorts(ports); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"2222:22/tcp", "8080:80/tcp", "5353:5353/udp"}
+	if got := setup.Ports(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ports %v instead of %v", got, want)
+	}
+}
+
 func testPingIP(nsPath string, cniPath *CNIPath, stdin io.WriteCloser, stdout io.ReadCloser) error {
 	testIP := "10.111.111.10"
 
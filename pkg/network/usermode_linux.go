@@ -0,0 +1,350 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/slice"
+)
+
+// UserModeNetwork is the network name selecting user-mode networking,
+// it provides outbound connectivity and port forwarding to network
+// namespaces created by unprivileged users.
+const UserModeNetwork = "slirp"
+
+const (
+	// UserModeIP is the IP address of the container interface.
+	UserModeIP = "10.0.2.100"
+	// UserModeDNS is the address of the DNS forwarder.
+	UserModeDNS = "10.0.2.3"
+
+	userModeGateway = "10.0.2.2"
+	userModeNetmask = "24"
+	userModeMTU     = "65520"
+	userModeIface   = "tap0"
+)
+
+// userModeHelpers lists the supported user-mode networking helpers
+// in order of preference.
+var userModeHelpers = []string{"slirp4netns", "pasta"}
+
+// UserModeSetup contains the setup of a user-mode networking helper
+// connecting the network namespace of a process to the host network
+// stack without privileges.
+type UserModeSetup struct {
+	pid      int
+	helper   string
+	ports    []PortMapEntry
+	stateDir string
+	cmd      *exec.Cmd
+	exitPipe *os.File
+}
+
+// NewUserModeSetup returns a user-mode network setup for the network
+// namespace of the process identified by pid.
+func NewUserModeSetup(pid int) *UserModeSetup {
+	return &UserModeSetup{pid: pid}
+}
+
+// SetArgs parses the network arguments, portmap arguments use the
+// same format as CNI networks and helper selects slirp4netns or pasta.
+func (m *UserModeSetup) SetArgs(args []string) error {
+	for _, arg := range args {
+		eq := strings.IndexByte(arg, '=')
+		if i := strings.IndexByte(arg, ':'); i >= 0 && (eq < 0 || i < eq) {
+			if arg[:i] != UserModeNetwork {
+				return fmt.Errorf("network %s wasn't specified in --network option", arg[:i])
+			}
+			arg = arg[i+1:]
+		}
+		argList, err := parseArg(arg)
+		if err != nil {
+			return err
+		}
+		for _, kv := range argList {
+			switch kv[0] {
+			case "portmap":
+				pm, err := parsePortMap(kv[1])
+				if err != nil {
+					return err
+				}
+				m.ports = append(m.ports, pm)
+			case "helper":
+				if !slice.ContainsString(userModeHelpers, kv[1]) {
+					return fmt.Errorf("unsupported %s network helper %q, must be one of %s", UserModeNetwork, kv[1], strings.Join(userModeHelpers, ", "))
+				}
+				m.helper = kv[1]
+			default:
+				return fmt.Errorf("unknown %s network argument %q", UserModeNetwork, kv[0])
+			}
+		}
+	}
+	return nil
+}
+
+// PublishPorts adds host ports forwarded to the container.
+func (m *UserModeSetup) PublishPorts(ports []PortMapEntry) {
+	m.ports = append(m.ports, ports...)
+}
+
+// Ports returns the forwarded ports as hostPort:containerPort/protocol.
+func (m *UserModeSetup) Ports() []string {
+	ports := make([]string, 0, len(m.ports))
+	for _, pm := range m.ports {
+		ports = append(ports, pm.String())
+	}
+	return ports
+}
+
+// Start starts the user-mode networking helper and returns once the
+// network interface is configured and the ports are forwarded.
+func (m *UserModeSetup) Start(ctx context.Context) error {
+	helper := m.helper
+	var path string
+	var err error
+
+	if helper == "" {
+		for _, h := range userModeHelpers {
+			if path, err = bin.FindBin(h); err == nil {
+				helper = h
+				break
+			}
+		}
+		if helper == "" {
+			return fmt.Errorf("%s network requires %s to be installed", UserModeNetwork, strings.Join(userModeHelpers, " or "))
+		}
+	} else if path, err = bin.FindBin(helper); err != nil {
+		return fmt.Errorf("while looking for %s: %s", helper, err)
+	}
+
+	m.stateDir, err = ioutil.TempDir("", "apptainer-slirp-")
+	if err != nil {
+		return fmt.Errorf("while creating %s state directory: %s", helper, err)
+	}
+
+	sylog.Debugf("Starting %s for process %d", path, m.pid)
+	if helper == "pasta" {
+		return m.startPasta(ctx, path)
+	}
+	return m.startSlirp4netns(ctx, path)
+}
+
+// startSlirp4netns starts slirp4netns in the background, it terminates
+// when the exit pipe is closed by Stop or when the calling process exits.
+func (m *UserModeSetup) startSlirp4netns(ctx context.Context, path string) error {
+	logFile := filepath.Join(m.stateDir, "slirp4netns.log")
+	log, err := os.Create(logFile)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	exitR, exitW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return err
+	}
+
+	apiSocket := filepath.Join(m.stateDir, "api.sock")
+	cmd := exec.Command(path,
+		"--configure",
+		"--mtu="+userModeMTU,
+		"--disable-host-loopback",
+		"--api-socket", apiSocket,
+		"--ready-fd", "3",
+		"--exit-fd", "4",
+		strconv.Itoa(m.pid),
+		userModeIface,
+	)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.ExtraFiles = []*os.File{readyW, exitR}
+
+	err = cmd.Start()
+	readyW.Close()
+	exitR.Close()
+	if err != nil {
+		exitW.Close()
+		return fmt.Errorf("while starting slirp4netns: %s", err)
+	}
+	m.cmd = cmd
+	m.exitPipe = exitW
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := readyR.Read(b)
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			m.Stop()
+			out, _ := ioutil.ReadFile(logFile)
+			return fmt.Errorf("slirp4netns failed: %s", strings.TrimSpace(string(out)))
+		}
+	case <-ctx.Done():
+		m.Stop()
+		return ctx.Err()
+	}
+
+	for _, pm := range m.ports {
+		if err := slirp4netnsAddHostFwd(apiSocket, pm); err != nil {
+			m.Stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// slirp4netnsAddHostFwd forwards a host port to the container through
+// the slirp4netns API socket.
+func slirp4netnsAddHostFwd(apiSocket string, pm PortMapEntry) error {
+	hostAddr := pm.HostIP
+	if hostAddr == "" {
+		hostAddr = "0.0.0.0"
+	}
+	req := map[string]interface{}{
+		"execute": "add_hostfwd",
+		"arguments": map[string]interface{}{
+			"proto":      pm.Protocol,
+			"host_addr":  hostAddr,
+			"host_port":  pm.HostPort,
+			"guest_addr": UserModeIP,
+			"guest_port": pm.ContainerPort,
+		},
+	}
+
+	conn, err := net.Dial("unix", apiSocket)
+	if err != nil {
+		return fmt.Errorf("while connecting to slirp4netns: %s", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("while sending slirp4netns request: %s", err)
+	}
+	if uc, ok := conn.(*net.UnixConn); ok {
+		uc.CloseWrite()
+	}
+
+	var resp struct {
+		Error *struct {
+			Desc string `json:"desc"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("while reading slirp4netns response: %s", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("could not forward port %d/%s: %s", pm.HostPort, pm.Protocol, resp.Error.Desc)
+	}
+	return nil
+}
+
+// startPasta runs pasta which daemonizes once the network interface is
+// configured, its process ID is recorded in the state directory.
+func (m *UserModeSetup) startPasta(ctx context.Context, path string) error {
+	args := []string{
+		"--config-net",
+		"--quiet",
+		"--pid", filepath.Join(m.stateDir, "pasta.pid"),
+		"--ns-ifname", userModeIface,
+		"--mtu", userModeMTU,
+		"--address", UserModeIP,
+		"--netmask", userModeNetmask,
+		"--gateway", userModeGateway,
+		"--dns-forward", UserModeDNS,
+		"--no-map-gw",
+	}
+
+	forwards := map[string][]string{"tcp": nil, "udp": nil}
+	for _, pm := range m.ports {
+		spec := fmt.Sprintf("%d:%d", pm.HostPort, pm.ContainerPort)
+		if pm.HostIP != "" {
+			spec = pm.HostIP + "/" + spec
+		}
+		forwards[pm.Protocol] = append(forwards[pm.Protocol], spec)
+	}
+	for _, proto := range []string{"tcp", "udp"} {
+		flag := "--" + proto + "-ports"
+		if len(forwards[proto]) == 0 {
+			args = append(args, flag, "none")
+		}
+		for _, spec := range forwards[proto] {
+			args = append(args, flag, spec)
+		}
+	}
+	args = append(args, strconv.Itoa(m.pid))
+
+	// pasta output goes to a file as its daemon would keep a pipe open
+	logFile := filepath.Join(m.stateDir, "pasta.log")
+	log, err := os.Create(logFile)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := cmd.Run(); err != nil {
+		m.Stop()
+		out, _ := ioutil.ReadFile(logFile)
+		return fmt.Errorf("pasta failed: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Stop terminates the user-mode networking helper and removes its
+// state directory.
+func (m *UserModeSetup) Stop() error {
+	var err error
+
+	if m.cmd != nil {
+		m.exitPipe.Close()
+		if werr := m.cmd.Wait(); werr != nil {
+			sylog.Debugf("slirp4netns terminated with error: %s", werr)
+		}
+		m.cmd = nil
+	}
+
+	if m.stateDir != "" {
+		if b, rerr := ioutil.ReadFile(filepath.Join(m.stateDir, "pasta.pid")); rerr == nil {
+			if pid, _ := strconv.Atoi(strings.TrimSpace(string(b))); pid > 0 {
+				if kerr := syscall.Kill(pid, syscall.SIGTERM); kerr != nil && kerr != syscall.ESRCH {
+					err = fmt.Errorf("could not terminate pasta: %s", kerr)
+				}
+			}
+		}
+		os.RemoveAll(m.stateDir)
+		m.stateDir = ""
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserModeSetArgs(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		expectedPorts  []string
+		expectedHelper string
+		expectError    bool
+	}{
+		{
+			name:          "NoArgs",
+			expectedPorts: []string{},
+		},
+		{
+			name:          "PortMap",
+			args:          []string{"portmap=8080:80/tcp", "slirp:portmap=5353/udp"},
+			expectedPorts: []string{"8080:80/tcp", "5353:5353/udp"},
+		},
+		{
+			name:           "MultiplePortMapHelper",
+			args:           []string{"portmap=8080:80/tcp;portmap=8443:443/tcp;helper=pasta"},
+			expectedPorts:  []string{"8080:80/tcp", "8443:443/tcp"},
+			expectedHelper: "pasta",
+		},
+		{
+			name:        "BadProtocol",
+			args:        []string{"portmap=8080:80/sctp"},
+			expectError: true,
+		},
+		{
+			name:        "UnknownHelper",
+			args:        []string{"helper=vpnkit"},
+			expectError: true,
+		},
+		{
+			name:        "UnknownArgument",
+			args:        []string{"IP=10.0.2.50"},
+			expectError: true,
+		},
+		{
+			name:        "OtherNetwork",
+			args:        []string{"bridge:portmap=8080:80/tcp"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewUserModeSetup(1)
+			err := m.SetArgs(tt.args)
+			if err != nil && !tt.expectError {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.expectError {
+				t.Fatalf("unexpected success")
+			} else if err != nil {
+				return
+			}
+			if ports := m.Ports(); !reflect.DeepEqual(ports, tt.expectedPorts) {
+				t.Errorf("unexpected ports %v instead of %v", ports, tt.expectedPorts)
+			}
+			if m.helper != tt.expectedHelper {
+				t.Errorf("unexpected helper %q instead of %q", m.helper, tt.expectedHelper)
+			}
+		})
+	}
+}
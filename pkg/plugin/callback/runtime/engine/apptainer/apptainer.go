@@ -36,3 +36,10 @@ type PostStartProcess func(config *config.Common, pid int) error
 // This callback is called in:
 // - internal/pkg/runtime/engine/apptainer/container_linux.go
 type RegisterImageDriver func(unprivileged bool) error
+
+// CleanupContainer callback is called after the container process
+// exited with its exit status. It's a good place to add custom logger
+// and/or notifier.
+// This callback is called in:
+// - internal/pkg/runtime/engine/apptainer/cleanup_linux.go
+type CleanupContainer func(config *config.Common, status syscall.WaitStatus) error
@@ -0,0 +1,217 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package executable implements the protocol spoken between Apptainer and
+// executable plugins. Unlike plugins loaded as Go plugin objects, an
+// executable plugin is a standalone program which doesn't need to be
+// compiled against the Apptainer source tree, it can be written in any
+// language as long as it implements the protocol.
+//
+// Apptainer starts the plugin executable and exchanges JSON-RPC 1.0
+// messages with it over the plugin standard input and standard output.
+// The standard error of the plugin is the standard error of Apptainer.
+// Each session starts with a Plugin.Handshake call followed by at most
+// one other call, then the plugin standard input is closed and the
+// plugin must exit.
+//
+// Methods exposed by a plugin are:
+//   - Plugin.Handshake: HandshakeArgs -> HandshakeReply
+//   - Plugin.Install: InstallArgs -> Empty
+//   - Plugin.Run: RunArgs -> Empty
+//   - Plugin.EngineConfig: EngineConfigArgs -> EngineConfigReply
+//   - Plugin.Event: Event -> Empty
+//
+// During a Plugin.Run call, the standard output of Apptainer is passed
+// to the plugin as file descriptor 3.
+package executable
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+)
+
+// ProtocolVersion is the version of the protocol implemented by this
+// package. The plugin must reply with the same version during the
+// handshake.
+const ProtocolVersion = 1
+
+// Methods of the protocol.
+const (
+	MethodHandshake    = "Plugin.Handshake"
+	MethodInstall      = "Plugin.Install"
+	MethodRun          = "Plugin.Run"
+	MethodEngineConfig = "Plugin.EngineConfig"
+	MethodEvent        = "Plugin.Event"
+)
+
+// Capabilities announced by a plugin during the handshake.
+const (
+	// CapabilityCommands indicates the plugin registers commands
+	// and/or flags.
+	CapabilityCommands = "commands"
+	// CapabilityEngineConfig indicates the plugin modifies the
+	// apptainer engine configuration.
+	CapabilityEngineConfig = "engine-config"
+	// CapabilityEvents indicates the plugin receives runtime
+	// lifecycle events.
+	CapabilityEvents = "events"
+	// CapabilityInstall indicates the plugin must be called during
+	// plugin installation.
+	CapabilityInstall = "install"
+)
+
+// Runtime lifecycle events.
+const (
+	// EventStart is sent once the container process started.
+	EventStart = "start"
+	// EventStop is sent once the container process exited.
+	EventStop = "stop"
+)
+
+// StdoutFd is the file descriptor of the Apptainer standard output
+// passed to the plugin during a Plugin.Run call.
+const StdoutFd = 3
+
+// Empty is used for calls without arguments or reply.
+type Empty struct{}
+
+// HandshakeArgs are the arguments of Plugin.Handshake.
+type HandshakeArgs struct {
+	// ProtocolVersion is the protocol version spoken by Apptainer.
+	ProtocolVersion int `json:"protocolVersion"`
+	// ApptainerVersion is the version of Apptainer.
+	ApptainerVersion string `json:"apptainerVersion"`
+}
+
+// HandshakeReply is the reply of Plugin.Handshake.
+type HandshakeReply struct {
+	// ProtocolVersion is the protocol version spoken by the plugin.
+	ProtocolVersion int `json:"protocolVersion"`
+	// Manifest is the plugin manifest.
+	Manifest pluginapi.Manifest `json:"manifest"`
+	// Capabilities lists the plugin capabilities.
+	Capabilities []string `json:"capabilities"`
+	// Commands lists the commands registered by the plugin.
+	Commands []Command `json:"commands,omitempty"`
+	// Flags lists the flags registered by the plugin.
+	Flags []Flag `json:"flags,omitempty"`
+}
+
+// HasCapability returns if the plugin announced the capability.
+func (r *HandshakeReply) HasCapability(capability string) bool {
+	for _, c := range r.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Command describes a command registered by a plugin.
+type Command struct {
+	// Parent is the name of the parent command, empty for a top
+	// level command. Names of sub commands are joined with an
+	// underscore (eg: instance_start).
+	Parent string `json:"parent,omitempty"`
+	// Use is the one-line usage message, the first word is the
+	// command name.
+	Use string `json:"use"`
+	// Short is the short description of the command.
+	Short string `json:"short,omitempty"`
+	// Long is the long description of the command.
+	Long string `json:"long,omitempty"`
+	// Example shows examples of the command.
+	Example string `json:"example,omitempty"`
+
+	// Run is called by Serve to execute the command, it receives
+	// the Apptainer standard output, the command arguments and
+	// the value of the flags registered by the plugin.
+	Run func(stdout io.Writer, args []string, flags map[string]string) error `json:"-"`
+}
+
+// FullName returns the command name as sent in RunArgs, the name of
+// a sub command is joined to its parent name with an underscore.
+func (c Command) FullName() string {
+	name := ""
+	if f := strings.Fields(c.Use); len(f) > 0 {
+		name = f[0]
+	}
+	if c.Parent != "" {
+		return c.Parent + "_" + name
+	}
+	return name
+}
+
+// Flag describes a flag registered by a plugin.
+type Flag struct {
+	// Name is the flag name.
+	Name string `json:"name"`
+	// ShortHand is the optional one letter shorthand.
+	ShortHand string `json:"shortHand,omitempty"`
+	// Usage is the flag help message.
+	Usage string `json:"usage,omitempty"`
+	// Default is the flag default value.
+	Default string `json:"default,omitempty"`
+	// Bool indicates a boolean flag.
+	Bool bool `json:"bool,omitempty"`
+	// EnvKeys lists the environment variable suffixes which
+	// can set the flag (eg: FOO for APPTAINER_FOO).
+	EnvKeys []string `json:"envKeys,omitempty"`
+	// Commands lists the names of the commands accepting
+	// the flag (eg: exec, instance_start).
+	Commands []string `json:"commands"`
+}
+
+// InstallArgs are the arguments of Plugin.Install.
+type InstallArgs struct {
+	// Path is the plugin installation directory.
+	Path string `json:"path"`
+}
+
+// RunArgs are the arguments of Plugin.Run.
+type RunArgs struct {
+	// Command is the name of the executed command.
+	Command string `json:"command"`
+	// Args are the command arguments.
+	Args []string `json:"args"`
+	// Flags holds the value of the flags registered by the plugin.
+	Flags map[string]string `json:"flags"`
+}
+
+// EngineConfigArgs are the arguments of Plugin.EngineConfig.
+type EngineConfigArgs struct {
+	// Config is the JSON representation of the engine
+	// configuration (config.Common).
+	Config json.RawMessage `json:"config"`
+	// Flags holds the value of the flags registered by the plugin.
+	Flags map[string]string `json:"flags"`
+}
+
+// EngineConfigReply is the reply of Plugin.EngineConfig.
+type EngineConfigReply struct {
+	// Config is the JSON representation of the modified engine
+	// configuration.
+	Config json.RawMessage `json:"config"`
+}
+
+// Event is a runtime lifecycle event, it's the argument of Plugin.Event.
+type Event struct {
+	// Type is the event type.
+	Type string `json:"type"`
+	// ContainerID is the container ID, the instance name for instances.
+	ContainerID string `json:"containerID"`
+	// Image is the container image.
+	Image string `json:"image,omitempty"`
+	// Pid is the container process PID.
+	Pid int `json:"pid,omitempty"`
+	// ExitStatus is the container process exit status for stop events.
+	ExitStatus int `json:"exitStatus,omitempty"`
+}
@@ -0,0 +1,200 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package executable
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+
+	pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+)
+
+// Plugin describes an executable plugin implemented in Go and served
+// with Serve. Capabilities are deduced from the non-nil fields.
+//
+// An example of how this will look from the plugin main package:
+//
+//	package main
+//
+//	import (
+//		"fmt"
+//		"io"
+//		"os"
+//
+//		pluginapi "github.com/apptainer/apptainer/pkg/plugin"
+//		"github.com/apptainer/apptainer/pkg/plugin/executable"
+//	)
+//
+//	func main() {
+//		err := executable.Serve(&executable.Plugin{
+//			Manifest: pluginapi.Manifest{
+//				Name:        "example.com/hello",
+//				Author:      "Apptainer Team",
+//				Version:     "0.1.0",
+//				Description: "Say hello",
+//			},
+//			Commands: []executable.Command{
+//				{
+//					Use:   "hello",
+//					Short: "Say hello",
+//					Run: func(stdout io.Writer, args []string, flags map[string]string) error {
+//						_, err := fmt.Fprintln(stdout, "hello", flags["name"])
+//						return err
+//					},
+//				},
+//			},
+//			Flags: []executable.Flag{
+//				{Name: "name", Default: "world", Commands: []string{"hello"}},
+//			},
+//		})
+//		if err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+type Plugin struct {
+	// Manifest contains the plugin manifest.
+	Manifest pluginapi.Manifest
+	// Commands lists the commands registered by the plugin.
+	Commands []Command
+	// Flags lists the flags registered by the plugin.
+	Flags []Flag
+	// Install is called during plugin installation with the
+	// plugin installation directory.
+	Install func(path string) error
+	// EngineConfig is called to modify the apptainer engine
+	// configuration before the container creation, it receives
+	// the value of the flags registered by the plugin.
+	EngineConfig func(cfg *config.Common, flags map[string]string) error
+	// Event is called for each runtime lifecycle event.
+	Event func(e Event) error
+}
+
+// capabilities returns the plugin capabilities.
+func (p *Plugin) capabilities() []string {
+	var caps []string
+
+	if len(p.Commands) > 0 || len(p.Flags) > 0 {
+		caps = append(caps, CapabilityCommands)
+	}
+	if p.EngineConfig != nil {
+		caps = append(caps, CapabilityEngineConfig)
+	}
+	if p.Event != nil {
+		caps = append(caps, CapabilityEvents)
+	}
+	if p.Install != nil {
+		caps = append(caps, CapabilityInstall)
+	}
+	return caps
+}
+
+// stdioConn is the connection over the standard input and output.
+type stdioConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (c stdioConn) Close() error {
+	return nil
+}
+
+// Serve serves the plugin over the standard input and output until
+// Apptainer closes the plugin standard input. As the standard output
+// is used by the protocol, os.Stdout is replaced by os.Stderr.
+func Serve(p *Plugin) error {
+	conn := stdioConn{Reader: os.Stdin, Writer: os.Stdout}
+	os.Stdout = os.Stderr
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("Plugin", &Service{plugin: p}); err != nil {
+		return fmt.Errorf("while registering plugin service: %s", err)
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+
+	return nil
+}
+
+// Service exposes the plugin methods, it's exported to satisfy the
+// net/rpc requirements and is not intended to be used directly.
+type Service struct {
+	plugin *Plugin
+}
+
+// Handshake implements the Plugin.Handshake method.
+func (s *Service) Handshake(args HandshakeArgs, reply *HandshakeReply) error {
+	if args.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d, plugin requires version %d", args.ProtocolVersion, ProtocolVersion)
+	}
+	reply.ProtocolVersion = ProtocolVersion
+	reply.Manifest = s.plugin.Manifest
+	reply.Capabilities = s.plugin.capabilities()
+	reply.Commands = s.plugin.Commands
+	reply.Flags = s.plugin.Flags
+	return nil
+}
+
+// Install implements the Plugin.Install method.
+func (s *Service) Install(args InstallArgs, reply *Empty) error {
+	if s.plugin.Install == nil {
+		return nil
+	}
+	return s.plugin.Install(args.Path)
+}
+
+// Run implements the Plugin.Run method.
+func (s *Service) Run(args RunArgs, reply *Empty) error {
+	for _, c := range s.plugin.Commands {
+		if c.FullName() != args.Command || c.Run == nil {
+			continue
+		}
+		stdout := os.NewFile(StdoutFd, "stdout")
+		if _, err := stdout.Stat(); err != nil {
+			stdout = os.Stderr
+		}
+		return c.Run(stdout, args.Args, args.Flags)
+	}
+	return fmt.Errorf("unknown command %q", args.Command)
+}
+
+// EngineConfig implements the Plugin.EngineConfig method.
+func (s *Service) EngineConfig(args EngineConfigArgs, reply *EngineConfigReply) error {
+	if s.plugin.EngineConfig == nil {
+		return fmt.Errorf("engine configuration not supported")
+	}
+
+	cfg := &config.Common{EngineConfig: apptainerConfig.NewConfig()}
+	if err := json.Unmarshal(args.Config, cfg); err != nil {
+		return fmt.Errorf("while decoding engine configuration: %s", err)
+	}
+	if err := s.plugin.EngineConfig(cfg, args.Flags); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("while encoding engine configuration: %s", err)
+	}
+	reply.Config = b
+	return nil
+}
+
+// Event implements the Plugin.Event method.
+func (s *Service) Event(args Event, reply *Empty) error {
+	if s.plugin.Event == nil {
+		return nil
+	}
+	return s.plugin.Event(args)
+}
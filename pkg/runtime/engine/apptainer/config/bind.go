@@ -66,6 +66,44 @@ func (b *BindPath) Readonly() bool {
 	return b.Options != nil && b.Options["ro"] != nil
 }
 
+// Tmpfs returns true if the BindPath is a tmpfs mount.
+func (b *BindPath) Tmpfs() bool {
+	return b.Options != nil && b.Options["tmpfs"] != nil
+}
+
+// Overlay returns true if the BindPath is an overlay mount making its
+// destination writable.
+func (b *BindPath) Overlay() bool {
+	return b.Options != nil && b.Options["overlay"] != nil
+}
+
+// Size returns the value of the option size for a tmpfs BindPath, or an
+// empty string if the option wasn't set.
+func (b *BindPath) Size() string {
+	if b.Options != nil && b.Options["size"] != nil {
+		return b.Options["size"].Value
+	}
+	return ""
+}
+
+// Mode returns the value of the option mode for a tmpfs BindPath, or an
+// empty string if the option wasn't set.
+func (b *BindPath) Mode() string {
+	if b.Options != nil && b.Options["mode"] != nil {
+		return b.Options["mode"].Value
+	}
+	return ""
+}
+
+// Upper returns the value of the option upper for an overlay BindPath, or
+// an empty string if the option wasn't set.
+func (b *BindPath) Upper() string {
+	if b.Options != nil && b.Options["upper"] != nil {
+		return b.Options["upper"].Value
+	}
+	return ""
+}
+
 // ParseBindPath parses a an array of strings each specifying one or
 // more (comma separated) bind paths in src[:dst[:options]] format, and
 // returns all encountered bind paths as a slice. Options may be simple
@@ -14,6 +14,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/apptainer/apptainer/internal/pkg/cdi"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci"
 	"github.com/apptainer/apptainer/pkg/image"
 	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
@@ -69,11 +70,20 @@ type DMTCPConfig struct {
 	Args       []string `json:"args,omitempty"`
 }
 
+// NamedNetwork stores the definition of a network created by the user
+// with apptainer network create.
+type NamedNetwork struct {
+	Name   string `json:"name"`
+	Subnet string `json:"subnet"`
+}
+
 // JSONConfig stores engine specific configuration that is allowed to be set by the user.
 type JSONConfig struct {
 	ScratchDir            []string          `json:"scratchdir,omitempty"`
 	OverlayImage          []string          `json:"overlayImage,omitempty"`
 	NetworkArgs           []string          `json:"networkArgs,omitempty"`
+	PublishPorts          []string          `json:"publishPorts,omitempty"`
+	NamedNetworks         []NamedNetwork    `json:"namedNetworks,omitempty"`
 	Security              []string          `json:"security,omitempty"`
 	FilesPath             []string          `json:"filesPath,omitempty"`
 	LibrariesPath         []string          `json:"librariesPath,omitempty"`
@@ -139,6 +149,9 @@ type JSONConfig struct {
 	XdgRuntimeDir         string            `json:"xdgRuntimeDir,omitempty"`
 	DbusSessionBusAddress string            `json:"dbusSessionBusAddress,omitempty"`
 	NoEval                bool              `json:"noEval,omitempty"`
+	CDIDevices            []string          `json:"cdiDevices,omitempty"`
+	// CDIEdits is resolved by the runtime from CDIDevices.
+	CDIEdits *cdi.ContainerEdits `json:"cdiEdits,omitempty"`
 }
 
 // SetImage sets the container image path to be used by EngineConfig.JSON.
@@ -221,6 +234,26 @@ func (e *EngineConfig) GetNvCCLI() bool {
 	return e.JSON.NvCCLI
 }
 
+// SetCDIDevices sets the fully qualified CDI device names requested.
+func (e *EngineConfig) SetCDIDevices(devices []string) {
+	e.JSON.CDIDevices = devices
+}
+
+// GetCDIDevices returns the fully qualified CDI device names requested.
+func (e *EngineConfig) GetCDIDevices() []string {
+	return e.JSON.CDIDevices
+}
+
+// SetCDIEdits sets the container edits resolved from the CDI devices.
+func (e *EngineConfig) SetCDIEdits(edits *cdi.ContainerEdits) {
+	e.JSON.CDIEdits = edits
+}
+
+// GetCDIEdits returns the container edits resolved from the CDI devices.
+func (e *EngineConfig) GetCDIEdits() *cdi.ContainerEdits {
+	return e.JSON.CDIEdits
+}
+
 // SetNvCCLIEnv sets env vars holding options for nvidia-container-cli GPU setup
 func (e *EngineConfig) SetNvCCLIEnv(NvCCLIEnv []string) {
 	e.JSON.NvCCLIEnv = NvCCLIEnv
@@ -551,6 +584,29 @@ func (e *EngineConfig) GetNetworkArgs() []string {
 	return e.JSON.NetworkArgs
 }
 
+// SetPublishPorts sets the host ports published to the container
+// with the form hostPort[:containerPort]/protocol.
+func (e *EngineConfig) SetPublishPorts(ports []string) {
+	e.JSON.PublishPorts = ports
+}
+
+// GetPublishPorts retrieves the host ports published to the container.
+func (e *EngineConfig) GetPublishPorts() []string {
+	return e.JSON.PublishPorts
+}
+
+// SetNamedNetworks sets the definitions of the requested networks created
+// by the user.
+func (e *EngineConfig) SetNamedNetworks(networks []NamedNetwork) {
+	e.JSON.NamedNetworks = networks
+}
+
+// GetNamedNetworks retrieves the definitions of the requested networks
+// created by the user.
+func (e *EngineConfig) GetNamedNetworks() []NamedNetwork {
+	return e.JSON.NamedNetworks
+}
+
 // SetDNS sets a commas separated list of DNS servers to add in resolv.conf.
 func (e *EngineConfig) SetDNS(dns string) {
 	e.JSON.DNS = dns
@@ -8,9 +8,37 @@ package apptainer
 import (
 	"encoding/csv"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+// mountTypeOptions maps the supported mount types to their valid options.
+var mountTypeOptions = map[string]map[string]bool{
+	"bind":    {"ro": true, "image-src": true, "id": true},
+	"image":   {"ro": true, "image-src": true, "id": true},
+	"tmpfs":   {"ro": true, "size": true, "mode": true},
+	"overlay": {"upper": true},
+}
+
+// tmpfsSize matches the sizes accepted by the tmpfs size option and
+// tmpfsMode the octal permissions accepted by the tmpfs mode option.
+var (
+	tmpfsSize = regexp.MustCompile(`^[0-9]+[kKmMgG%]?$`)
+	tmpfsMode = regexp.MustCompile(`^[0-7]{3,4}$`)
+)
+
+// CheckTmpfsOptions returns an error if the size or mode options of a
+// tmpfs mount are set to values not accepted by the tmpfs filesystem.
+func CheckTmpfsOptions(size, mode string) error {
+	if size != "" && !tmpfsSize.MatchString(size) {
+		return fmt.Errorf("invalid tmpfs size %q", size)
+	}
+	if mode != "" && !tmpfsMode.MatchString(mode) {
+		return fmt.Errorf("invalid tmpfs mode %q", mode)
+	}
+	return nil
+}
+
 // ParseMountString converts a --mount string into one or more BindPath structs.
 //
 // Our intention is to support common docker --mount strings, but have
@@ -26,8 +54,12 @@ import (
 // The fields are in key[=value] format. Flag options have no value, e.g.:
 //   type=bind,source=/opt,destination=/other,rw
 //
-// We only support type=bind at present, so assume this if type is missing and
-// error for other types.
+// Supported types are:
+//   type=bind (default if type is missing), binds a source path
+//   type=image, mounts a squashfs or ext3 image file, or SIF data partition
+//   type=tmpfs, mounts a tmpfs with optional size and mode options
+//   type=overlay, makes the destination writable, changes are stored in
+//                 the host directory set with upper or discarded
 func ParseMountString(mount string) (bindPaths []BindPath, err error) {
 	r := strings.NewReader(mount)
 	c := csv.NewReader(r)
@@ -40,6 +72,7 @@ func ParseMountString(mount string) (bindPaths []BindPath, err error) {
 		bp := BindPath{
 			Options: map[string]*BindOption{},
 		}
+		mountType := "bind"
 
 		for _, f := range r {
 			kv := strings.SplitN(f, "=", 2)
@@ -50,11 +83,12 @@ func ParseMountString(mount string) (bindPaths []BindPath, err error) {
 			}
 
 			switch key {
-			// TODO - Eventually support volume and tmpfs? Requires structural changes to engine mount functionality.
+			// TODO - Eventually support volume? Requires structural changes to engine mount functionality.
 			case "type":
-				if val != "bind" {
-					return []BindPath{}, fmt.Errorf("unsupported mount type %q, only 'bind' is supported", val)
+				if _, ok := mountTypeOptions[val]; !ok {
+					return []BindPath{}, fmt.Errorf("unsupported mount type %q, only 'bind', 'image', 'tmpfs' and 'overlay' are supported", val)
 				}
+				mountType = val
 			case "source", "src":
 				if val == "" {
 					return []BindPath{}, fmt.Errorf("mount source cannot be empty")
@@ -79,6 +113,24 @@ func ParseMountString(mount string) (bindPaths []BindPath, err error) {
 					return []BindPath{}, fmt.Errorf("id cannot be empty")
 				}
 				bp.Options["id"] = &BindOption{Value: val}
+			// tmpfs only - size of the tmpfs (e.g. 2G or 50%)
+			case "size":
+				if err := CheckTmpfsOptions(val, ""); err != nil {
+					return []BindPath{}, err
+				}
+				bp.Options["size"] = &BindOption{Value: val}
+			// tmpfs only - octal permissions of the tmpfs root directory
+			case "mode":
+				if err := CheckTmpfsOptions("", val); err != nil {
+					return []BindPath{}, err
+				}
+				bp.Options["mode"] = &BindOption{Value: val}
+			// overlay only - host directory storing the changes
+			case "upper":
+				if val == "" {
+					return []BindPath{}, fmt.Errorf("upper cannot be empty")
+				}
+				bp.Options["upper"] = &BindOption{Value: val}
 			case "bind-propagation":
 				return []BindPath{}, fmt.Errorf("bind-propagation not supported for individual mounts, check apptainer.conf for global setting")
 			default:
@@ -86,8 +138,29 @@ func ParseMountString(mount string) (bindPaths []BindPath, err error) {
 			}
 		}
 
-		if bp.Source == "" || bp.Destination == "" {
-			return []BindPath{}, fmt.Errorf("mounts must specify a source and a destination")
+		for opt := range bp.Options {
+			if !mountTypeOptions[mountType][opt] {
+				return []BindPath{}, fmt.Errorf("option %q is not valid for %s mounts", opt, mountType)
+			}
+		}
+
+		switch mountType {
+		case "bind", "image":
+			if bp.Source == "" || bp.Destination == "" {
+				return []BindPath{}, fmt.Errorf("mounts must specify a source and a destination")
+			}
+			// mount the whole image filesystem by default
+			if mountType == "image" && bp.Options["image-src"] == nil {
+				bp.Options["image-src"] = &BindOption{Value: "/"}
+			}
+		case "tmpfs", "overlay":
+			if bp.Source != "" {
+				return []BindPath{}, fmt.Errorf("%s mounts do not accept a source", mountType)
+			}
+			if bp.Destination == "" {
+				return []BindPath{}, fmt.Errorf("mounts must specify a destination")
+			}
+			bp.Options[mountType] = &BindOption{}
 		}
 		bindPaths = append(bindPaths, bp)
 	}
@@ -200,6 +200,116 @@ func TestParseMountString(t *testing.T) {
 			want:        []BindPath{},
 			wantErr:     true,
 		},
+		{
+			name:        "image",
+			mountString: "type=image,source=data.sqfs,destination=/data",
+			want: []BindPath{
+				{
+					Source:      "data.sqfs",
+					Destination: "/data",
+					Options: map[string]*BindOption{
+						"image-src": {Value: "/"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "imageNoSource",
+			mountString: "type=image,destination=/data",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfs",
+			mountString: "type=tmpfs,destination=/scratch,size=2G,mode=1777",
+			want: []BindPath{
+				{
+					Destination: "/scratch",
+					Options: map[string]*BindOption{
+						"tmpfs": {},
+						"size":  {Value: "2G"},
+						"mode":  {Value: "1777"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "tmpfsSource",
+			mountString: "type=tmpfs,source=/opt,destination=/scratch",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsBadSize",
+			mountString: "type=tmpfs,destination=/scratch,size=2 GB",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsBadMode",
+			mountString: "type=tmpfs,destination=/scratch,mode=999",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsInjectedOption",
+			mountString: `type=tmpfs,destination=/scratch,"size=1k,uid=0"`,
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsLongMode",
+			mountString: "type=tmpfs,destination=/scratch,mode=0001777",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "tmpfsImageSrc",
+			mountString: "type=tmpfs,destination=/scratch,image-src=/opt",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "overlay",
+			mountString: "type=overlay,destination=/opt/app,upper=/tmp/app",
+			want: []BindPath{
+				{
+					Destination: "/opt/app",
+					Options: map[string]*BindOption{
+						"overlay": {},
+						"upper":   {Value: "/tmp/app"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "overlayNoUpper",
+			mountString: "type=overlay,destination=/opt/app",
+			want: []BindPath{
+				{
+					Destination: "/opt/app",
+					Options: map[string]*BindOption{
+						"overlay": {},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "overlayReadonly",
+			mountString: "type=overlay,destination=/opt/app,ro",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
+		{
+			name:        "bindSize",
+			mountString: "type=bind,source=/opt,destination=/opt,size=2G",
+			want:        []BindPath{},
+			wantErr:     true,
+		},
 		{
 			name:        "csvEscaped",
 			mountString: `type=bind,"source=/comma,dir","destination=/quote""dir"`,
@@ -30,6 +30,7 @@ const (
 	RemoteConfFile = "remote.yaml"
 	RemoteCache    = "remote-cache"
 	DockerConfFile = "docker-config.json"
+	NetworkDirName = "network"
 	apptainerDir   = ".apptainer"
 	legacyDir      = ".singularity"
 )
@@ -84,6 +85,12 @@ func DockerConf() string {
 	return filepath.Join(ConfigDir(), DockerConfFile)
 }
 
+// NetworkDir returns the directory where the networks created by the
+// user are stored.
+func NetworkDir() string {
+	return filepath.Join(ConfigDir(), NetworkDirName)
+}
+
 // ConfigDirForUsername returns the directory where the apptainer
 // configuration and data for the specified username is located.
 func ConfigDirForUsername(username string) (string, error) {
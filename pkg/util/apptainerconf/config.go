@@ -67,33 +67,36 @@ type File struct {
 	MountProc               bool     `default:"yes" authorized:"yes,no" directive:"mount proc"`
 	MountSys                bool     `default:"yes" authorized:"yes,no" directive:"mount sys"`
 	MountDevPts             bool     `default:"yes" authorized:"yes,no" directive:"mount devpts"`
-	MountHome               bool     `default:"yes" authorized:"yes,no" directive:"mount home"`
-	MountTmp                bool     `default:"yes" authorized:"yes,no" directive:"mount tmp"`
-	MountHostfs             bool     `default:"no" authorized:"yes,no" directive:"mount hostfs"`
-	UserBindControl         bool     `default:"yes" authorized:"yes,no" directive:"user bind control"`
-	EnableFusemount         bool     `default:"yes" authorized:"yes,no" directive:"enable fusemount"`
-	EnableUnderlay          bool     `default:"yes" authorized:"yes,no" directive:"enable underlay"`
+	MountHome               bool     `default:"yes" authorized:"yes,no" directive:"mount home" match:"yes"`
+	MountTmp                bool     `default:"yes" authorized:"yes,no" directive:"mount tmp" match:"yes"`
+	MountHostfs             bool     `default:"no" authorized:"yes,no" directive:"mount hostfs" match:"yes"`
+	UserBindControl         bool     `default:"yes" authorized:"yes,no" directive:"user bind control" match:"yes"`
+	EnableFusemount         bool     `default:"yes" authorized:"yes,no" directive:"enable fusemount" match:"yes"`
+	EnableUnderlay          bool     `default:"yes" authorized:"yes,no" directive:"enable underlay" match:"yes"`
 	MountSlave              bool     `default:"yes" authorized:"yes,no" directive:"mount slave"`
-	AllowContainerSIF       bool     `default:"yes" authorized:"yes,no" directive:"allow container sif"`
-	AllowContainerEncrypted bool     `default:"yes" authorized:"yes,no" directive:"allow container encrypted"`
-	AllowContainerSquashfs  bool     `default:"yes" authorized:"yes,no" directive:"allow container squashfs"`
-	AllowContainerExtfs     bool     `default:"yes" authorized:"yes,no" directive:"allow container extfs"`
-	AllowContainerDir       bool     `default:"yes" authorized:"yes,no" directive:"allow container dir"`
+	AllowContainerSIF       bool     `default:"yes" authorized:"yes,no" directive:"allow container sif" match:"yes"`
+	AllowContainerEncrypted bool     `default:"yes" authorized:"yes,no" directive:"allow container encrypted" match:"yes"`
+	AllowContainerSquashfs  bool     `default:"yes" authorized:"yes,no" directive:"allow container squashfs" match:"yes"`
+	AllowContainerExtfs     bool     `default:"yes" authorized:"yes,no" directive:"allow container extfs" match:"yes"`
+	AllowContainerDir       bool     `default:"yes" authorized:"yes,no" directive:"allow container dir" match:"yes"`
 	AlwaysUseNv             bool     `default:"no" authorized:"yes,no" directive:"always use nv"`
 	UseNvCCLI               bool     `default:"no" authorized:"yes,no" directive:"use nvidia-container-cli"`
 	AlwaysUseRocm           bool     `default:"no" authorized:"yes,no" directive:"always use rocm"`
 	SharedLoopDevices       bool     `default:"no" authorized:"yes,no" directive:"shared loop devices"`
 	MaxLoopDevices          uint     `default:"256" directive:"max loop devices"`
 	SessiondirMaxSize       uint     `default:"16" directive:"sessiondir max size"`
+	TmpfsMaxSize            uint     `default:"0" directive:"tmpfs max size"`
 	MountDev                string   `default:"yes" authorized:"yes,no,minimal" directive:"mount dev"`
-	EnableOverlay           string   `default:"try" authorized:"yes,no,try,driver" directive:"enable overlay"`
-	BindPath                []string `default:"/etc/localtime,/etc/hosts" directive:"bind path"`
-	LimitContainerOwners    []string `directive:"limit container owners"`
-	LimitContainerGroups    []string `directive:"limit container groups"`
-	LimitContainerPaths     []string `directive:"limit container paths"`
-	AllowNetUsers           []string `directive:"allow net users"`
-	AllowNetGroups          []string `directive:"allow net groups"`
-	AllowNetNetworks        []string `directive:"allow net networks"`
+	EnableOverlay           string   `default:"try" authorized:"yes,no,try,driver" directive:"enable overlay" match:"yes"`
+	BindPath                []string `default:"/etc/localtime,/etc/hosts" directive:"bind path" match:"yes"`
+	LimitContainerOwners    []string `directive:"limit container owners" match:"yes"`
+	LimitContainerGroups    []string `directive:"limit container groups" match:"yes"`
+	LimitContainerPaths     []string `directive:"limit container paths" match:"yes"`
+	AllowNetUsers           []string `directive:"allow net users" match:"yes"`
+	AllowNetGroups          []string `directive:"allow net groups" match:"yes"`
+	AllowNetNetworks        []string `directive:"allow net networks" match:"yes"`
+	AllowUserNetworks       bool     `default:"no" authorized:"yes,no" directive:"allow user networks" match:"yes"`
+	UserNetworkPool         string   `default:"10.89.0.0/16" directive:"user network pool"`
 	RootDefaultCapabilities string   `default:"full" authorized:"full,file,no" directive:"root default capabilities"`
 	MemoryFSType            string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
 	CniConfPath             string   `directive:"cni configuration path"`
@@ -105,19 +108,39 @@ type File struct {
 	MksquashfsPath          string   `directive:"mksquashfs path"`
 	MksquashfsProcs         uint     `default:"0" directive:"mksquashfs procs"`
 	MksquashfsMem           string   `directive:"mksquashfs mem"`
+	MksquashfsCompression   string   `default:"gzip" directive:"mksquashfs compression"`
+	MksquashfsCompLevel     uint     `default:"0" directive:"mksquashfs compression level"`
 	NvidiaContainerCliPath  string   `directive:"nvidia-container-cli path"`
 	UnsquashfsPath          string   `directive:"unsquashfs path"`
 	ImageDriver             string   `directive:"image driver"`
 	DownloadConcurrency     uint     `default:"3" directive:"download concurrency"`
 	DownloadPartSize        uint     `default:"5242880" directive:"download part size"`
 	DownloadBufferSize      uint     `default:"32768" directive:"download buffer size"`
+	DownloadRetries         uint     `default:"5" directive:"download retries"`
 	SystemdCgroups          bool     `default:"yes" authorized:"yes,no" directive:"systemd cgroups"`
+	HooksDir                []string `directive:"hooks dir"`
+	AuditLog                string   `default:"no" authorized:"no,syslog,file" directive:"audit log"`
+	AuditLogFile            string   `directive:"audit log file"`
+	AuditImageDigest        bool     `default:"no" authorized:"yes,no" directive:"audit image digest"`
 }
 
 const TemplateAsset = `# APPTAINER.CONF
 # This is the global configuration file for Apptainer. This file controls
 # what the container is allowed to do on a particular host, and as a result
 # this file must be owned by root.
+#
+# Files ending with .conf in the apptainer.conf.d directory located next to
+# this file are merged in lexical order after this file, they must also be
+# owned by root. A directive set with "=" in a drop-in file replaces the
+# values set by previous files, "+=" appends values to multi-valued
+# directives. Drop-in files may end with conditional blocks started by
+# "match user = <users>" or "match group = <groups>" lines, they apply to the
+# listed user or group names or IDs until the next match line or the end of
+# the file and take precedence over the directives set outside of blocks.
+# Only the limit container, allow container, allow net, allow user networks,
+# bind path, mount home, mount tmp, mount hostfs, user bind control, enable
+# overlay, enable fusemount and enable underlay directives can be set in
+# blocks.
 
 # ALLOW SETUID: [BOOL]
 # DEFAULT: yes
@@ -270,6 +293,14 @@ mount slave = {{ if eq .MountSlave true }}yes{{ else }}no{{ end }}
 # location to do default read/writes to (e.g. "--workdir" or "--home").
 sessiondir max size = {{ .SessiondirMaxSize }}
 
+# TMPFS MAX SIZE: [STRING]
+# DEFAULT: 0
+# This specifies the maximum size (in MB) of a tmpfs requested by users with
+# "--mount type=tmpfs", it's also the size given to a tmpfs requested without
+# size. A value of 0 doesn't limit the size, a tmpfs without size can then use
+# up to half of the host memory.
+tmpfs max size = {{ .TmpfsMaxSize }}
+
 # LIMIT CONTAINER OWNERS: [STRING]
 # DEFAULT: NULL
 # Only allow containers to be used that are owned by a given user. If this
@@ -354,6 +385,20 @@ allow container dir = {{ if eq .AllowContainerDir true }}yes{{ else }}no{{ end }
 {{- if eq $index 0 }}allow net networks = {{ else }}, {{ end }}{{$group}}
 {{- end }}
 
+# ALLOW USER NETWORKS: [BOOL]
+# DEFAULT: no
+# Allow non-root users to run containers on the bridge networks they create
+# with 'apptainer network create'. Those networks require Apptainer running
+# in SUID mode for non-root users.
+allow user networks = {{ if eq .AllowUserNetworks true }}yes{{ else }}no{{ end }}
+
+# USER NETWORK POOL: [STRING]
+# DEFAULT: 10.89.0.0/16
+# Address range from which the subnets of the networks created with
+# 'apptainer network create' are allocated. Subnets outside of this range
+# are refused.
+user network pool = {{ .UserNetworkPool }}
+
 # ALWAYS USE NV ${TYPE}: [BOOL]
 # DEFAULT: no
 # This feature allows an administrator to determine that every action command
@@ -458,6 +503,21 @@ mksquashfs procs = {{ .MksquashfsProcs }}
 # mksquashfs mem = 1G
 {{ if ne .MksquashfsMem "" }}mksquashfs mem = {{ .MksquashfsMem }}{{ end }}
 
+# MKSQUASHFS COMPRESSION: [STRING]
+# DEFAULT: gzip
+# Compression algorithm used by mksquashfs when building SIF images, one of
+# gzip, lz4, lzo, xz or zstd. The installed mksquashfs must support the
+# algorithm, and the kernel or squashfuse must support it to run images.
+# The build --compression option overrides this value.
+mksquashfs compression = {{ .MksquashfsCompression }}
+
+# MKSQUASHFS COMPRESSION LEVEL: [UINT]
+# DEFAULT: 0 (mksquashfs default)
+# Compression level used by mksquashfs, between 1 and 9 for gzip and lzo, and
+# between 1 and 22 for zstd. The xz and lz4 algorithms don't support levels.
+# The build --compression-level option overrides this value.
+mksquashfs compression level = {{ .MksquashfsCompLevel }}
+
 # NVIDIA-CONTAINER-CLI PATH: [STRING]
 # DEFAULT: Undefined
 # DEPRECATED
@@ -492,13 +552,15 @@ image driver = {{ .ImageDriver }}
 # DOWNLOAD CONCURRENCY: [UINT]
 # DEFAULT: 3
 # This option specifies how many concurrent streams when downloading (pulling)
-# an image from cloud library.
+# an image from cloud library, or how many layers are downloaded concurrently
+# when building from an OCI image with the cache disabled.
 download concurrency = {{ .DownloadConcurrency }}
 
 # DOWNLOAD PART SIZE: [UINT]
 # DEFAULT: 5242880
 # This option specifies the size of each part when concurrent downloads are
-# enabled.
+# enabled. When building from an OCI image with the cache disabled, it is
+# the amount of data buffered in memory for each layer being downloaded.
 download part size = {{ .DownloadPartSize }}
 
 # DOWNLOAD BUFFER SIZE: [UINT]
@@ -507,9 +569,59 @@ download part size = {{ .DownloadPartSize }}
 # are enabled.
 download buffer size = {{ .DownloadBufferSize }}
 
+# DOWNLOAD RETRIES: [UINT]
+# DEFAULT: 5
+# This option specifies how many times an interrupted download from a library
+# or an http(s) URL is resumed before giving up. The count is reset each time
+# data is received.
+download retries = {{ .DownloadRetries }}
+
 # SYSTEMD CGROUPS: [BOOL]
 # DEFAULT: yes
 # Whether to use systemd to manage container cgroups. Required for rootless cgroups
 # functionality. 'no' will manage cgroups directly via cgroupfs.
 systemd cgroups = {{ if eq .SystemdCgroups true }}yes{{ else }}no{{ end }}
+
+# HOOKS DIR: [STRING]
+# DEFAULT: Undefined
+# Directories containing hook configuration files (*.json) executed by the
+# native runtime for run, exec, shell and instance commands. The format is
+# similar to the OCI hooks.d format, each file describes the hook executable,
+# the conditions (annotations, image labels, command) under which it is
+# executed and its stages (prestart, poststart, poststop). A configuration
+# file with the same name in a subsequent directory overrides the previous
+# one. Directories and configuration files must be owned by root. The
+# container state passed to hooks has the session directory as bundle, the
+# container root filesystem is reachable through /proc/<pid>/root.
+#hooks dir = /etc/apptainer/hooks.d
+{{ range $index, $dir := .HooksDir }}
+{{- if eq $index 0 }}hooks dir = {{ else }}, {{ end }}{{$dir}}
+{{- end }}
+
+# AUDIT LOG: [no/syslog/file]
+# DEFAULT: no
+# Write an audit record when a container is started and when it exits for
+# run, exec, shell and instance start commands. Records contain the user,
+# the image path, SIF ID and signer fingerprints, the bind paths,
+# the requested namespaces, cgroup limits, start and end times and the
+# exit status, encoded as JSON.
+# - no: audit is disabled
+# - syslog: records are sent to syslog (and to journald on systemd hosts)
+# - file: records are appended to the file set by 'audit log file'
+audit log = {{ .AuditLog }}
+
+# AUDIT LOG FILE: [STRING]
+# DEFAULT: Undefined
+# Path to the JSON-lines file where audit records are appended when
+# 'audit log' is set to 'file'. When Apptainer is not installed with the
+# setuid workflow, the file must be writable by users.
+#audit log file = /var/log/apptainer/audit.log
+{{ if ne .AuditLogFile "" }}audit log file = {{ .AuditLogFile }}{{ end }}
+
+# AUDIT IMAGE DIGEST: [BOOL]
+# DEFAULT: no
+# Add the SHA256 digest of the image file to the audit record written when
+# the container exits. The whole image is read to compute it, which may
+# take a while and cause significant I/O for large images started often.
+audit image digest = {{ if eq .AuditImageDigest true }}yes{{ else }}no{{ end }}
 `
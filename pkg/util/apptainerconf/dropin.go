@@ -0,0 +1,350 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainerconf
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// OriginDefault is the origin of directives set by no configuration file.
+const OriginDefault = "default"
+
+// dropInReg matches directive assignments of drop-in files, values
+// assigned with "+=" are appended to the values set by previous files.
+var dropInReg = regexp.MustCompile(`^([a-zA-Z _-]+?)[[:blank:]]*(\+?=)[[:blank:]]*(.*)$`)
+
+// assignment is a directive assignment of a drop-in file.
+type assignment struct {
+	directive string
+	value     string
+	append    bool
+}
+
+// block is a conditional block of a drop-in file applying to the listed
+// user or group names or IDs.
+type block struct {
+	kind        string
+	names       []string
+	origin      string
+	assignments []assignment
+}
+
+// identity holds the user and group names and IDs of the current user
+// matched against conditional blocks.
+type identity struct {
+	users  []string
+	groups []string
+}
+
+func (b *block) matches(id identity) bool {
+	names := id.users
+	if b.kind == "group" {
+		names = id.groups
+	}
+	for _, n := range b.names {
+		for _, name := range names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// currentIdentity returns the identity of the user running apptainer,
+// the original user and its host groups are returned when running in a
+// user namespace.
+var currentIdentity = func() identity {
+	var id identity
+
+	u, err := user.CurrentOriginal()
+	if err != nil {
+		id.users = append(id.users, strconv.Itoa(os.Getuid()))
+		return id
+	}
+	id.users = append(id.users, strconv.FormatUint(uint64(u.UID), 10), u.Name)
+
+	// the group list of the original user is resolved from the group
+	// database, the process groups are mapped to the user namespace
+	gids := []string{strconv.FormatUint(uint64(u.GID), 10)}
+	if ou, err := osuser.LookupId(strconv.FormatUint(uint64(u.UID), 10)); err == nil {
+		if ids, err := ou.GroupIds(); err == nil {
+			gids = ids
+		} else {
+			sylog.Debugf("While getting groups of user %s: %s", u.Name, err)
+		}
+	}
+	for _, gid := range gids {
+		id.groups = append(id.groups, gid)
+		if n, err := strconv.ParseUint(gid, 10, 32); err == nil {
+			if g, err := user.GetGrGID(uint32(n)); err == nil {
+				id.groups = append(id.groups, g.Name)
+			}
+		}
+	}
+	return id
+}
+
+// directiveField returns the File field corresponding to a directive.
+func directiveField(directive string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(File{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("directive") == directive {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// DropInDir returns the path of the drop-in directory of the
+// configuration file at path.
+func DropInDir(path string) string {
+	return path + ".d"
+}
+
+// DropInFiles returns the drop-in files of the configuration file at
+// path in the lexical order they are merged.
+func DropInFiles(path string) ([]string, error) {
+	entries, err := ioutil.ReadDir(DropInDir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("while reading drop-in directory: %s", err)
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".conf" {
+			continue
+		}
+		files = append(files, filepath.Join(DropInDir(path), e.Name()))
+	}
+	return files, nil
+}
+
+// CheckDropInOwner returns an error if the drop-in directory or one of
+// the drop-in files of the configuration file at path is not owned by
+// the user identified by uid.
+func CheckDropInOwner(path string, uid uint32) error {
+	dir := DropInDir(path)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	} else if !fs.IsOwner(dir, uid) {
+		return fmt.Errorf("%s must be owned by root", dir)
+	}
+
+	files, err := DropInFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !fs.IsOwner(f, uid) {
+			return fmt.Errorf("%s must be owned by root", f)
+		}
+	}
+	return nil
+}
+
+// parseDropIn parses the drop-in file at path and returns the directive
+// assignments set outside of conditional blocks and the conditional blocks.
+func parseDropIn(path string) ([]assignment, []block, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var assignments []assignment
+	var blocks []block
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := dropInReg.FindStringSubmatch(line)
+		if match == nil {
+			sylog.Warningf("%s:%d: ignoring invalid line %q", path, n, line)
+			continue
+		}
+		directive := strings.TrimSpace(match[1])
+		value := strings.TrimSpace(match[3])
+
+		if kind := strings.TrimPrefix(directive, "match "); kind != directive {
+			if kind != "user" && kind != "group" {
+				return nil, nil, fmt.Errorf("%s:%d: unknown match criteria %q", path, n, kind)
+			}
+			b := block{kind: kind, origin: fmt.Sprintf("%s (match %s = %s)", path, kind, value)}
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					b.names = append(b.names, name)
+				}
+			}
+			blocks = append(blocks, b)
+			continue
+		}
+
+		field, ok := directiveField(directive)
+		if !ok {
+			sylog.Warningf("%s:%d: ignoring unknown directive %q", path, n, directive)
+			continue
+		}
+		if len(blocks) > 0 && field.Tag.Get("match") != "yes" {
+			return nil, nil, fmt.Errorf("%s:%d: directive %q can't be set in a match block", path, n, directive)
+		}
+
+		a := assignment{
+			directive: directive,
+			value:     value,
+			append:    match[2] == "+=" && field.Type.Kind() == reflect.Slice,
+		}
+		if len(blocks) > 0 {
+			b := &blocks[len(blocks)-1]
+			b.assignments = append(b.assignments, a)
+		} else {
+			assignments = append(assignments, a)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("while reading %s: %s", path, err)
+	}
+	return assignments, blocks, nil
+}
+
+// merge applies directive assignments of a drop-in file or a conditional
+// block to the directives, the first assignment of a directive with "="
+// replaces its previous values.
+func merge(directives Directives, origins map[string]string, assignments []assignment, origin string) {
+	reset := make(map[string]bool)
+	for _, a := range assignments {
+		if !a.append && !reset[a.directive] {
+			directives[a.directive] = []string{}
+			reset[a.directive] = true
+		}
+		if a.value != "" {
+			directives[a.directive] = append(directives[a.directive], a.value)
+		}
+		origins[a.directive] = origin
+	}
+}
+
+// parseFiles parses the configuration file at path and its drop-in
+// files and returns the merged directives along with the file which
+// set each directive.
+func parseFiles(path string) (Directives, map[string]string, error) {
+	c, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer c.Close()
+
+	directives, err := GetDirectives(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while parsing data: %s", err)
+	}
+	origins := make(map[string]string)
+	for directive := range directives {
+		origins[directive] = path
+	}
+
+	files, err := DropInFiles(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []block
+	for _, f := range files {
+		assignments, b, err := parseDropIn(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		merge(directives, origins, assignments, f)
+		blocks = append(blocks, b...)
+	}
+
+	// matching blocks take precedence over directives set outside of blocks
+	if len(blocks) > 0 {
+		id := currentIdentity()
+		for _, b := range blocks {
+			if b.matches(id) {
+				merge(directives, origins, b.assignments, b.origin)
+			}
+		}
+	}
+
+	return directives, origins, nil
+}
+
+// Setting holds the effective value of a configuration directive
+// along with the file which set it.
+type Setting struct {
+	Directive string
+	Value     string
+	Origin    string
+}
+
+// ParseSettings parses the configuration file with the specified path
+// along with its drop-in files and returns the effective value of each
+// directive in the order of the File fields.
+func ParseSettings(path string) ([]Setting, error) {
+	directives, origins, err := parseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := GetConfig(directives)
+	if err != nil {
+		return nil, err
+	}
+
+	elem := reflect.ValueOf(config).Elem()
+	settings := make([]Setting, 0, elem.NumField())
+
+	for i := 0; i < elem.NumField(); i++ {
+		directive := elem.Type().Field(i).Tag.Get("directive")
+		origin, ok := origins[directive]
+		if !ok {
+			origin = OriginDefault
+		}
+
+		var value string
+		switch v := elem.Field(i).Interface().(type) {
+		case bool:
+			value = "no"
+			if v {
+				value = "yes"
+			}
+		case []string:
+			value = strings.Join(v, ",")
+		default:
+			value = fmt.Sprintf("%v", v)
+		}
+
+		settings = append(settings, Setting{
+			Directive: directive,
+			Value:     value,
+			Origin:    origin,
+		})
+	}
+	return settings, nil
+}
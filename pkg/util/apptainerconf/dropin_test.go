@@ -0,0 +1,192 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainerconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDropIn(t *testing.T) {
+	defer func(f func() identity) {
+		currentIdentity = f
+	}(currentIdentity)
+
+	currentIdentity = func() identity {
+		return identity{
+			users:  []string{"1000", "alice"},
+			groups: []string{"1000", "alice", "2000", "gpu"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		config      string
+		dropIns     map[string]string
+		expectError bool
+		check       func(t *testing.T, c *File)
+	}{
+		{
+			name:   "NoDropIn",
+			config: "bind path = /etc/hosts\nmax loop devices = 128\n",
+			check: func(t *testing.T, c *File) {
+				if !reflect.DeepEqual(c.BindPath, []string{"/etc/hosts"}) {
+					t.Errorf("unexpected bind path: %v", c.BindPath)
+				}
+				if c.MaxLoopDevices != 128 {
+					t.Errorf("unexpected max loop devices: %d", c.MaxLoopDevices)
+				}
+			},
+		},
+		{
+			name:   "LexicalOrder",
+			config: "max loop devices = 128\n",
+			dropIns: map[string]string{
+				"20-b.conf":   "max loop devices = 64\n",
+				"10-a.conf":   "max loop devices = 32\n",
+				"30-c.ignore": "max loop devices = 16\n",
+			},
+			check: func(t *testing.T, c *File) {
+				if c.MaxLoopDevices != 64 {
+					t.Errorf("unexpected max loop devices: %d", c.MaxLoopDevices)
+				}
+			},
+		},
+		{
+			name:   "ReplaceAndAppend",
+			config: "bind path = /etc/hosts\nbind path = /etc/localtime\nlimit container paths = /opt\n",
+			dropIns: map[string]string{
+				"10-a.conf": "bind path += /scratch\nlimit container paths = /data\nlimit container paths = /home\n",
+				"20-b.conf": "bind path += /software\nallow net networks =\n",
+			},
+			check: func(t *testing.T, c *File) {
+				want := []string{"/etc/hosts", "/etc/localtime", "/scratch", "/software"}
+				if !reflect.DeepEqual(c.BindPath, want) {
+					t.Errorf("unexpected bind path: %v", c.BindPath)
+				}
+				want = []string{"/data", "/home"}
+				if !reflect.DeepEqual(c.LimitContainerPaths, want) {
+					t.Errorf("unexpected limit container paths: %v", c.LimitContainerPaths)
+				}
+				if len(c.AllowNetNetworks) != 0 {
+					t.Errorf("unexpected allow net networks: %v", c.AllowNetNetworks)
+				}
+			},
+		},
+		{
+			name:   "MatchBlocks",
+			config: "allow net networks = bridge\n",
+			dropIns: map[string]string{
+				"10-a.conf": "match group = gpu,other\nallow net networks = ptp\nbind path += /gpu\n" +
+					"match user = bob\nallow net networks = none\n",
+				"20-b.conf": "allow net networks = macvlan\nbind path = /etc/hosts\n" +
+					"match user = 1000\nmount home = no\n",
+			},
+			check: func(t *testing.T, c *File) {
+				if !reflect.DeepEqual(c.AllowNetNetworks, []string{"ptp"}) {
+					t.Errorf("unexpected allow net networks: %v", c.AllowNetNetworks)
+				}
+				if !reflect.DeepEqual(c.BindPath, []string{"/etc/hosts", "/gpu"}) {
+					t.Errorf("unexpected bind path: %v", c.BindPath)
+				}
+				if c.MountHome {
+					t.Errorf("unexpected mount home value")
+				}
+			},
+		},
+		{
+			name:        "MatchForbiddenDirective",
+			dropIns:     map[string]string{"10-a.conf": "match user = alice\nallow setuid = no\n"},
+			expectError: true,
+		},
+		{
+			name:        "MatchUnknownCriteria",
+			dropIns:     map[string]string{"10-a.conf": "match host = node1\nmount home = no\n"},
+			expectError: true,
+		},
+		{
+			name:        "MatchInMainFile",
+			config:      "match user = alice\nmount home = no\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "apptainer.conf")
+			writeConfig(t, configFile, tt.config)
+			for name, content := range tt.dropIns {
+				writeConfig(t, filepath.Join(DropInDir(configFile), name), content)
+			}
+
+			c, err := Parse(configFile)
+			if err != nil && !tt.expectError {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.expectError {
+				t.Fatalf("unexpected success")
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	defer func(f func() identity) {
+		currentIdentity = f
+	}(currentIdentity)
+
+	currentIdentity = func() identity {
+		return identity{groups: []string{"gpu"}}
+	}
+
+	configFile := filepath.Join(t.TempDir(), "apptainer.conf")
+	writeConfig(t, configFile, "mount home = yes\nbind path = /etc/hosts\n")
+	dropIn := filepath.Join(DropInDir(configFile), "10-site.conf")
+	writeConfig(t, dropIn, "bind path += /scratch\nmatch group = gpu\nmount home = no\n")
+
+	settings, err := ParseSettings(configFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]Setting{
+		"mount home":       {Value: "no", Origin: dropIn + " (match group = gpu)"},
+		"bind path":        {Value: "/etc/hosts,/scratch", Origin: dropIn},
+		"max loop devices": {Value: "256", Origin: OriginDefault},
+	}
+	for _, s := range settings {
+		w, ok := want[s.Directive]
+		if !ok {
+			continue
+		}
+		if s.Value != w.Value || s.Origin != w.Origin {
+			t.Errorf("unexpected setting for %s: got %q from %q instead of %q from %q", s.Directive, s.Value, s.Origin, w.Value, w.Origin)
+		}
+		delete(want, s.Directive)
+	}
+	for directive := range want {
+		t.Errorf("directive %s not found", directive)
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -45,6 +44,9 @@ func GetDirectives(reader io.Reader) (Directives, error) {
 		if match != nil {
 			key := strings.TrimSpace(string(match[1]))
 			val := strings.TrimSpace(string(match[2]))
+			if strings.HasPrefix(key, "match ") {
+				return nil, fmt.Errorf("match blocks are only supported in drop-in files")
+			}
 			if val != "" {
 				directives[key] = append(directives[key], val)
 			}
@@ -173,23 +175,18 @@ func GetConfig(directives Directives) (*File, error) {
 	return file, nil
 }
 
-// Parse parses configuration file with the specified path.
+// Parse parses configuration file with the specified path
+// and merges its drop-in files.
 func Parse(filepath string) (*File, error) {
 	if filepath == "" {
 		// grab the default configuration
 		return GetConfig(nil)
 	}
 
-	c, err := os.Open(filepath)
+	directives, _, err := parseFiles(filepath)
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
-
-	directives, err := GetDirectives(c)
-	if err != nil {
-		return nil, fmt.Errorf("while parsing data: %s", err)
-	}
 
 	return GetConfig(directives)
 }
@@ -244,6 +244,39 @@ func CountChilds(pid int) (int, error) {
 	return childs, nil
 }
 
+// Descendants returns the process IDs of all descendants of a given
+// process id, parent processes are returned before their children
+func Descendants(pid int) ([]int, error) {
+	parentProc := fmt.Sprintf("/proc/%d", pid)
+	if _, err := os.Stat(parentProc); os.IsNotExist(err) {
+		return nil, fmt.Errorf("pid %d doesn't exists", pid)
+	}
+
+	childs := make(map[int][]int)
+	pattern := filepath.Join("/proc", "[0-9]*")
+
+	matches, _ := filepath.Glob(pattern)
+	for _, path := range matches {
+		p, err := strconv.Atoi(filepath.Base(path))
+		if err != nil {
+			continue
+		}
+		// process may have exited in the meantime
+		ppid, err := Getppid(p)
+		if err != nil {
+			continue
+		}
+		childs[ppid] = append(childs[ppid], p)
+	}
+
+	var pids []int
+	for queue := childs[pid]; len(queue) > 0; queue = queue[1:] {
+		pids = append(pids, queue[0])
+		queue = append(queue, childs[queue[0]]...)
+	}
+	return pids, nil
+}
+
 // ReadIDMap reads uid_map or gid_map and returns both container ID
 // and host ID
 func ReadIDMap(path string) (uint32, uint32, error) {
@@ -15,6 +15,7 @@ import (
 	"os/exec"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/test"
 )
@@ -349,6 +350,53 @@ func TestCountChilds(t *testing.T) {
 	}
 }
 
+func TestDescendants(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	cmd := exec.Command("/bin/sh", "-c", "sleep 60 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// wait for the shell to fork sleep
+	for i := 0; i < 100; i++ {
+		if childs, _ := CountChilds(cmd.Process.Pid); childs > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pids, err := Descendants(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell := -1
+	for i, pid := range pids {
+		if pid == cmd.Process.Pid {
+			shell = i
+			break
+		}
+	}
+	if shell < 0 {
+		t.Fatalf("shell process %d not found in descendants %v", cmd.Process.Pid, pids)
+	}
+	if shell == len(pids)-1 {
+		t.Fatalf("sleep process not found after shell process in descendants %v", pids)
+	}
+	if ppid, err := Getppid(pids[len(pids)-1]); err != nil || ppid != cmd.Process.Pid {
+		t.Fatalf("unexpected parent process %d for the last descendant", ppid)
+	}
+
+	if _, err := Descendants(0); err == nil {
+		t.Fatal("no error reported with PID 0")
+	}
+}
+
 func TestReadIDMap(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)